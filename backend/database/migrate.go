@@ -25,17 +25,17 @@ func RunMigrations(db *sql.DB) error {
 	}
 
 	// Check if we need to run migrations
-	version, dirty, err := m.Version()
+	version, _, err := m.Version()
 	if err != nil && err != migrate.ErrNilVersion {
 		return fmt.Errorf("could not check migration version: %v", err)
 	}
 
-	// Only run migrations if we haven't run them before or if there are new migrations
-	if err == migrate.ErrNilVersion || dirty {
-		if err := m.Up(); err != nil && err != migrate.ErrNoChange {
-			return fmt.Errorf("could not run migrations: %v", err)
-		}
-		log.Printf("Migrations completed successfully. Current version: %d", version)
+	// Apply any migrations that haven't been run yet
+	if err := m.Up(); err != nil && err != migrate.ErrNoChange {
+		return fmt.Errorf("could not run migrations: %v", err)
+	}
+	if newVersion, _, err := m.Version(); err == nil && newVersion != version {
+		log.Printf("Migrations completed successfully. Current version: %d", newVersion)
 	} else {
 		log.Printf("Database is up to date. Current version: %d", version)
 	}
@@ -0,0 +1,763 @@
+package handlers
+
+import (
+	"archive/zip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+	"task-manager/models"
+	"task-manager/storage"
+)
+
+const (
+	defaultDeletionGraceDays = 30
+	purgeInterval            = time.Hour
+	purgeBatchSize           = 50
+)
+
+// AccountHandler exports and deletes user accounts. Deleted accounts are
+// kept for a grace period, during which they can be restored, and are then
+// purged by RunPurge.
+type AccountHandler struct {
+	db          *sql.DB
+	store       storage.BlobStore
+	gracePeriod time.Duration
+}
+
+func NewAccountHandler(db *sql.DB, store storage.BlobStore) *AccountHandler {
+	days := defaultDeletionGraceDays
+	if v, err := strconv.Atoi(os.Getenv("ACCOUNT_DELETION_GRACE_DAYS")); err == nil && v >= 0 {
+		days = v
+	}
+	return &AccountHandler{db: db, store: store, gracePeriod: time.Duration(days) * 24 * time.Hour}
+}
+
+// ExportData returns a zip of everything stored about the authenticated user:
+// profile.json, tasks.json (including deleted tasks and their custom field
+// values), categories.json, tags.json, comments.json, history.json,
+// time_entries.json, custom_fields.json, workflows.json, templates.json,
+// views.json, webhooks.json (without signing secrets), attachments.json with the files under attachments/, and a manifest.json
+// written last
+func (h *AccountHandler) ExportData(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Everything but the attachment contents is read up front so that
+	// database errors can still be reported with a status code
+	profile, err := loadProfile(h.db, userID)
+	if err != nil {
+		http.Error(w, "Error fetching profile", http.StatusInternalServerError)
+		return
+	}
+	tasks, err := exportUserTasks(h.db, userID)
+	if err != nil {
+		log.Printf("Error exporting tasks for user %d: %v", userID, err)
+		http.Error(w, "Error fetching tasks", http.StatusInternalServerError)
+		return
+	}
+	categories, err := exportUserCategories(h.db, userID)
+	if err != nil {
+		http.Error(w, "Error fetching categories", http.StatusInternalServerError)
+		return
+	}
+	tags, err := exportUserTags(h.db, userID)
+	if err != nil {
+		http.Error(w, "Error fetching tags", http.StatusInternalServerError)
+		return
+	}
+	comments, err := exportUserComments(h.db, userID)
+	if err != nil {
+		http.Error(w, "Error fetching comments", http.StatusInternalServerError)
+		return
+	}
+	history, err := exportUserHistory(h.db, userID)
+	if err != nil {
+		http.Error(w, "Error fetching task history", http.StatusInternalServerError)
+		return
+	}
+	timeEntries, err := exportUserTimeEntries(h.db, userID)
+	if err != nil {
+		http.Error(w, "Error fetching time entries", http.StatusInternalServerError)
+		return
+	}
+	customFields, err := exportUserCustomFields(h.db, userID)
+	if err != nil {
+		http.Error(w, "Error fetching custom fields", http.StatusInternalServerError)
+		return
+	}
+	workflows, err := exportUserWorkflows(h.db, userID)
+	if err != nil {
+		http.Error(w, "Error fetching workflows", http.StatusInternalServerError)
+		return
+	}
+	templates, err := exportUserTemplates(h.db, userID)
+	if err != nil {
+		http.Error(w, "Error fetching templates", http.StatusInternalServerError)
+		return
+	}
+	views, err := exportUserViews(h.db, userID)
+	if err != nil {
+		http.Error(w, "Error fetching views", http.StatusInternalServerError)
+		return
+	}
+	webhooks, err := exportUserWebhooks(h.db, userID)
+	if err != nil {
+		http.Error(w, "Error fetching webhooks", http.StatusInternalServerError)
+		return
+	}
+	attachments, storageKeys, err := exportUserAttachments(h.db, userID)
+	if err != nil {
+		http.Error(w, "Error fetching attachments", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{
+		"filename": "task-manager-export-" + time.Now().UTC().Format("20060102") + ".zip",
+	}))
+
+	// Headers are sent with the first file, so errors from here on can only be logged
+	manifest := models.DataExportManifest{UserID: userID, ExportedAt: time.Now().UTC(), MissingAttachments: []int{}}
+	zw := zip.NewWriter(w)
+	err = func() error {
+		files := []struct {
+			name string
+			data interface{}
+		}{
+			{"profile.json", profile},
+			{"tasks.json", tasks},
+			{"categories.json", categories},
+			{"tags.json", tags},
+			{"comments.json", comments},
+			{"history.json", history},
+			{"time_entries.json", timeEntries},
+			{"custom_fields.json", customFields},
+			{"workflows.json", workflows},
+			{"templates.json", templates},
+			{"views.json", views},
+			{"webhooks.json", webhooks},
+			{"attachments.json", attachments},
+		}
+		for _, f := range files {
+			if err := writeZipJSON(zw, f.name, f.data); err != nil {
+				return err
+			}
+			manifest.Files = append(manifest.Files, f.name)
+		}
+		for i, a := range attachments {
+			ok, err := h.writeZipBlob(r.Context(), zw, a.Path, storageKeys[i])
+			if err != nil {
+				return err
+			}
+			if !ok {
+				manifest.MissingAttachments = append(manifest.MissingAttachments, a.ID)
+				continue
+			}
+			manifest.Files = append(manifest.Files, a.Path)
+		}
+		if err := writeZipJSON(zw, "manifest.json", manifest); err != nil {
+			return err
+		}
+		return zw.Close()
+	}()
+	if err != nil {
+		log.Printf("Error writing data export for user %d: %v", userID, err)
+	}
+}
+
+// writeZipJSON adds an indented JSON file to a zip
+func writeZipJSON(zw *zip.Writer, name string, v interface{}) error {
+	f, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// writeZipBlob copies a blob into a zip. It reports false without an error
+// when the blob can't be opened, so one missing file doesn't spoil the export.
+func (h *AccountHandler) writeZipBlob(ctx context.Context, zw *zip.Writer, name, storageKey string) (bool, error) {
+	blob, err := h.store.Get(ctx, storageKey)
+	if err != nil {
+		log.Printf("Error reading attachment %s for export: %v", storageKey, err)
+		return false, nil
+	}
+	defer blob.Close()
+	f, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store})
+	if err != nil {
+		return false, err
+	}
+	_, err = io.Copy(f, blob)
+	return err == nil, err
+}
+
+func exportUserTasks(db *sql.DB, userID int) ([]*models.TaskExport, error) {
+	rows, err := db.Query(`
+		SELECT `+taskColumns+`, t.is_deleted
+		FROM tasks t
+		WHERE t.user_id = $1
+		ORDER BY t.id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tasks := []*models.TaskExport{}
+	for rows.Next() {
+		task, err := scanTaskExport(rows)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks, rows.Err()
+}
+
+func exportUserCategories(db *sql.DB, userID int) ([]models.CategoryUsage, error) {
+	counts := make(map[string]int)
+	rows, err := db.Query(`
+		SELECT category, count(*) FROM tasks
+		WHERE user_id = $1 AND is_deleted = false
+		GROUP BY category
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		var count int
+		if err := rows.Scan(&name, &count); err != nil {
+			return nil, err
+		}
+		counts[name] = count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	categories := []models.CategoryUsage{}
+	for _, name := range sortedCategories() {
+		categories = append(categories, models.CategoryUsage{Name: name, TaskCount: counts[name]})
+	}
+	return categories, nil
+}
+
+func exportUserTags(db *sql.DB, userID int) ([]models.Tag, error) {
+	rows, err := db.Query(`
+		SELECT g.id, g.name, g.color, g.created_at, g.updated_at,
+		       (SELECT count(*) FROM task_tags tt WHERE tt.tag_id = g.id)
+		FROM tags g
+		WHERE g.user_id = $1
+		ORDER BY lower(g.name)
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []models.Tag{}
+	for rows.Next() {
+		var tag models.Tag
+		if err := rows.Scan(&tag.ID, &tag.Name, &tag.Color, &tag.CreatedAt, &tag.UpdatedAt, &tag.TaskCount); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
+
+// exportUserComments returns comments on the user's tasks and comments the user wrote elsewhere
+func exportUserComments(db *sql.DB, userID int) ([]models.Comment, error) {
+	rows, err := db.Query(`
+		SELECT c.id, c.task_id, COALESCE(c.user_id, 0), COALESCE(u.email, ''),
+		       c.body, c.body_html, c.created_at, c.updated_at, c.edited_at
+		FROM task_comments c
+		JOIN tasks t ON t.id = c.task_id
+		LEFT JOIN users u ON u.id = c.user_id
+		WHERE (t.user_id = $1 OR c.user_id = $1) AND c.is_deleted = false
+		ORDER BY c.id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	comments := []models.Comment{}
+	for rows.Next() {
+		comment, err := scanComment(rows)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, comment)
+	}
+	return comments, rows.Err()
+}
+
+func exportUserHistory(db *sql.DB, userID int) ([]models.TaskEvent, error) {
+	rows, err := db.Query(`
+		SELECT e.id, e.task_id, e.user_id, COALESCE(u.email, ''), e.action, e.changes, e.created_at
+		FROM task_events e
+		JOIN tasks t ON t.id = e.task_id
+		LEFT JOIN users u ON u.id = e.user_id
+		WHERE t.user_id = $1
+		ORDER BY e.task_id, e.created_at, e.id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []models.TaskEvent{}
+	for rows.Next() {
+		var event models.TaskEvent
+		var actorID sql.NullInt64
+		var changes []byte
+		err := rows.Scan(&event.ID, &event.TaskID, &actorID, &event.ActorEmail,
+			&event.Action, &changes, &event.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(changes, &event.Changes); err != nil {
+			return nil, err
+		}
+		event.ActorID = nullIntPtr(actorID)
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+func exportUserTimeEntries(db *sql.DB, userID int) ([]models.TimeEntry, error) {
+	rows, err := db.Query(`
+		SELECT `+timeEntryColumns+`
+		FROM time_entries e
+		WHERE e.user_id = $1
+		ORDER BY e.started_at, e.id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []models.TimeEntry{}
+	for rows.Next() {
+		entry, err := scanTimeEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+func exportUserCustomFields(db *sql.DB, userID int) ([]models.CustomField, error) {
+	rows, err := db.Query(`
+		SELECT `+customFieldColumns+`
+		FROM custom_fields
+		WHERE user_id = $1
+		ORDER BY id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	fields := []models.CustomField{}
+	for rows.Next() {
+		f, err := scanCustomField(rows)
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, f)
+	}
+	return fields, rows.Err()
+}
+
+// exportUserWorkflows returns the workflows the user defined; the built-in
+// default isn't included
+func exportUserWorkflows(db *sql.DB, userID int) ([]models.Workflow, error) {
+	rows, err := db.Query(`
+		SELECT `+workflowColumns+`
+		FROM workflows
+		WHERE user_id = $1
+		ORDER BY id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	workflows := []models.Workflow{}
+	for rows.Next() {
+		wf, err := scanWorkflow(rows)
+		if err != nil {
+			return nil, err
+		}
+		workflows = append(workflows, wf)
+	}
+	return workflows, rows.Err()
+}
+
+func exportUserTemplates(db *sql.DB, userID int) ([]models.Template, error) {
+	rows, err := db.Query(`
+		SELECT `+templateColumns+`
+		FROM task_templates
+		WHERE user_id = $1
+		ORDER BY id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	templates := []models.Template{}
+	for rows.Next() {
+		t, err := scanTemplate(rows)
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, t)
+	}
+	return templates, rows.Err()
+}
+
+func exportUserViews(db *sql.DB, userID int) ([]models.View, error) {
+	rows, err := db.Query(`
+		SELECT `+viewColumns+`
+		FROM views
+		WHERE user_id = $1
+		ORDER BY id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	views := []models.View{}
+	for rows.Next() {
+		v, err := scanView(rows)
+		if err != nil {
+			return nil, err
+		}
+		views = append(views, v)
+	}
+	return views, rows.Err()
+}
+
+// exportUserWebhooks returns the user's webhooks without their signing secrets
+func exportUserWebhooks(db *sql.DB, userID int) ([]models.Webhook, error) {
+	rows, err := db.Query(`
+		SELECT id, url, events, description, is_active, created_at, updated_at
+		FROM webhooks
+		WHERE user_id = $1
+		ORDER BY id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := []models.Webhook{}
+	for rows.Next() {
+		var webhook models.Webhook
+		if err := scanWebhook(rows, &webhook); err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	return webhooks, rows.Err()
+}
+
+// exportUserAttachments returns the user's attachments and, in the same order, their storage keys
+func exportUserAttachments(db *sql.DB, userID int) ([]models.AttachmentExport, []string, error) {
+	rows, err := db.Query(`
+		SELECT a.id, a.task_id, a.filename, a.content_type, a.size_bytes, a.sha256, a.created_at, a.storage_key
+		FROM task_attachments a
+		JOIN tasks t ON t.id = a.task_id
+		WHERE t.user_id = $1
+		ORDER BY a.id
+	`, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	attachments := []models.AttachmentExport{}
+	var keys []string
+	for rows.Next() {
+		var a models.AttachmentExport
+		var storageKey string
+		err := rows.Scan(&a.ID, &a.TaskID, &a.Filename, &a.ContentType, &a.Size, &a.SHA256, &a.CreatedAt, &storageKey)
+		if err != nil {
+			return nil, nil, err
+		}
+		// Prefixing the ID keeps files with the same name apart
+		a.Path = fmt.Sprintf("attachments/%d/%d-%s", a.TaskID, a.ID, sanitizeFilename(a.Filename))
+		attachments = append(attachments, a)
+		keys = append(keys, storageKey)
+	}
+	return attachments, keys, rows.Err()
+}
+
+// DeleteAccount schedules the authenticated user's account for deletion after
+// re-checking their password. All of the user's tokens stop working at once,
+// the calendar feed and inbound email addresses are disabled and webhooks
+// are deactivated; the data itself is purged when the grace period is over.
+func (h *AccountHandler) DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.AccountDeletion
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Password == "" {
+		http.Error(w, "Password is required", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		http.Error(w, "Error starting transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var passwordHash string
+	err = tx.QueryRow(`SELECT password_hash FROM users WHERE id = $1 FOR UPDATE`, userID).Scan(&passwordHash)
+	if err == sql.ErrNoRows {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error fetching user", http.StatusInternalServerError)
+		return
+	}
+	if !models.CheckPassword(passwordHash, req.Password) {
+		http.Error(w, "Incorrect password", http.StatusForbidden)
+		return
+	}
+
+	var status models.AccountDeletionStatus
+	err = tx.QueryRow(`
+		UPDATE users
+		SET deleted_at = CURRENT_TIMESTAMP, tokens_revoked_before = CURRENT_TIMESTAMP,
+			calendar_token = NULL, inbound_token = NULL
+		WHERE id = $1
+		RETURNING deleted_at
+	`, userID).Scan(&status.DeletedAt)
+	if err != nil {
+		log.Printf("Error deleting account: %v", err)
+		http.Error(w, "Error deleting account", http.StatusInternalServerError)
+		return
+	}
+	if _, err := tx.Exec(`UPDATE webhooks SET is_active = false WHERE user_id = $1`, userID); err != nil {
+		log.Printf("Error deactivating webhooks: %v", err)
+		http.Error(w, "Error deleting account", http.StatusInternalServerError)
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		http.Error(w, "Error committing transaction", http.StatusInternalServerError)
+		return
+	}
+	status.PurgeAfter = status.DeletedAt.Add(h.gracePeriod)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(status)
+}
+
+// RestoreAccount cancels a pending deletion during the grace period and
+// returns a new token. Webhooks stay deactivated until the user re-enables them.
+func (h *AccountHandler) RestoreAccount(w http.ResponseWriter, r *http.Request) {
+	var req AuthRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	var userID int
+	var passwordHash string
+	var deletedAt sql.NullTime
+	err := h.db.QueryRow(`
+		SELECT id, password_hash, deleted_at FROM users WHERE email = $1
+	`, req.Email).Scan(&userID, &passwordHash, &deletedAt)
+	if err != nil || !models.CheckPassword(passwordHash, req.Password) {
+		http.Error(w, "Invalid email or password", http.StatusUnauthorized)
+		return
+	}
+	if !deletedAt.Valid {
+		http.Error(w, "Account is not scheduled for deletion", http.StatusConflict)
+		return
+	}
+
+	result, err := h.db.Exec(`
+		UPDATE users SET deleted_at = NULL
+		WHERE id = $1 AND deleted_at IS NOT NULL
+	`, userID)
+	if err != nil {
+		log.Printf("Error restoring account: %v", err)
+		http.Error(w, "Error restoring account", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		// Purged or restored since the row was read
+		http.Error(w, "Account is not scheduled for deletion", http.StatusConflict)
+		return
+	}
+
+	token, err := generateJWT(userID)
+	if err != nil {
+		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(AuthResponse{Token: token})
+}
+
+// RunPurge permanently deletes accounts whose grace period is over until ctx is cancelled
+func (h *AccountHandler) RunPurge(ctx context.Context) {
+	ticker := time.NewTicker(purgeInterval)
+	defer ticker.Stop()
+	for {
+		if err := h.purgeDue(ctx); err != nil {
+			log.Printf("Error purging deleted accounts: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// purgeDue purges accounts deleted before the grace period, a batch at a
+// time. An account that fails to purge is logged and skipped until the next
+// run, so it can't hold up the others.
+func (h *AccountHandler) purgeDue(ctx context.Context) error {
+	failed := []int64{}
+	for {
+		rows, err := h.db.QueryContext(ctx, `
+			SELECT id FROM users
+			WHERE deleted_at < CURRENT_TIMESTAMP - $1 * interval '1 second'
+				AND id <> ALL($3)
+			ORDER BY deleted_at
+			LIMIT $2
+		`, int64(h.gracePeriod.Seconds()), purgeBatchSize, pq.Array(failed))
+		if err != nil {
+			return err
+		}
+		var userIDs []int
+		for rows.Next() {
+			var id int
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return err
+			}
+			userIDs = append(userIDs, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, id := range userIDs {
+			if err := h.purgeAccount(ctx, id); err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				log.Printf("Error purging deleted account %d: %v", id, err)
+				failed = append(failed, int64(id))
+				continue
+			}
+			log.Printf("Purged deleted account %d", id)
+		}
+		if len(userIDs) < purgeBatchSize {
+			if len(failed) > 0 {
+				return fmt.Errorf("%d accounts couldn't be purged", len(failed))
+			}
+			return nil
+		}
+	}
+}
+
+// purgeAccount deletes a user with their tasks and attachment contents.
+// Comments they left on other users' tasks stay, without an author.
+func (h *AccountHandler) purgeAccount(ctx context.Context, userID int) error {
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	blobs := newBlobCleanup(h.db, h.store)
+	defer blobs.run(tx)
+
+	// Re-check under the row lock in case the account was restored meanwhile
+	var id int
+	err = tx.QueryRow(`
+		SELECT id FROM users WHERE id = $1 AND deleted_at IS NOT NULL FOR UPDATE
+	`, userID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	rows, err := tx.Query(`
+		SELECT a.id, a.task_id FROM task_attachments a
+		JOIN tasks t ON t.id = a.task_id
+		WHERE t.user_id = $1
+	`, userID)
+	if err != nil {
+		return err
+	}
+	var attachments [][2]int
+	for rows.Next() {
+		var id, taskID int
+		if err := rows.Scan(&id, &taskID); err != nil {
+			rows.Close()
+			return err
+		}
+		attachments = append(attachments, [2]int{id, taskID})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, a := range attachments {
+		if err := deleteAttachment(tx, blobs, a[1], a[0]); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec(`DELETE FROM tasks WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM users WHERE id = $1`, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,521 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+	"task-manager/models"
+	"task-manager/storage"
+)
+
+const defaultMaxAttachmentSize = 10 << 20 // 10 MiB
+
+// defaultAllowedTypes lists the detected content types accepted by default.
+// Entries ending in "/" match any subtype.
+var defaultAllowedTypes = []string{
+	"image/",
+	"text/plain",
+	"text/csv",
+	"application/pdf",
+	"application/zip",
+	"application/json",
+}
+
+var (
+	errAttachmentTooLarge = errors.New("attachment is too large")
+	errAttachmentType     = errors.New("attachment type is not allowed")
+	errAttachmentNotFound = errors.New("attachment not found")
+	errAttachmentNoFile   = errors.New("no file was uploaded")
+)
+
+// attachmentLimits constrains what can be uploaded
+type attachmentLimits struct {
+	maxSize      int64
+	allowedTypes []string
+}
+
+// attachmentLimitsFromEnv reads ATTACHMENT_MAX_BYTES and ATTACHMENT_ALLOWED_TYPES
+func attachmentLimitsFromEnv() attachmentLimits {
+	limits := attachmentLimits{maxSize: defaultMaxAttachmentSize, allowedTypes: defaultAllowedTypes}
+	if v, err := strconv.ParseInt(os.Getenv("ATTACHMENT_MAX_BYTES"), 10, 64); err == nil && v > 0 {
+		limits.maxSize = v
+	}
+	if v := os.Getenv("ATTACHMENT_ALLOWED_TYPES"); v != "" {
+		limits.allowedTypes = strings.Split(v, ",")
+	}
+	return limits
+}
+
+// allows reports whether a content type is on the allow list
+func (l attachmentLimits) allows(contentType string) bool {
+	for _, allowed := range l.allowedTypes {
+		allowed = strings.TrimSpace(allowed)
+		if allowed == contentType || (strings.HasSuffix(allowed, "/") && strings.HasPrefix(contentType, allowed)) {
+			return true
+		}
+	}
+	return false
+}
+
+type AttachmentHandler struct {
+	db     *sql.DB
+	store  storage.BlobStore
+	limits attachmentLimits
+}
+
+func NewAttachmentHandler(db *sql.DB, store storage.BlobStore) *AttachmentHandler {
+	return &AttachmentHandler{db: db, store: store, limits: attachmentLimitsFromEnv()}
+}
+
+// GetAttachments lists the attachments of a task
+func (h *AttachmentHandler) GetAttachments(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	taskID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid task ID", http.StatusBadRequest)
+		return
+	}
+
+	exists, err := taskBelongsToUser(h.db, taskID, userID)
+	if err != nil {
+		http.Error(w, "Error checking task existence", http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "Task not found", http.StatusNotFound)
+		return
+	}
+
+	rows, err := h.db.Query(`
+		SELECT id, task_id, filename, content_type, size_bytes, sha256, created_at
+		FROM task_attachments
+		WHERE task_id = $1
+		ORDER BY created_at ASC, id ASC
+	`, taskID)
+	if err != nil {
+		http.Error(w, "Error fetching attachments", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	attachments := []models.Attachment{}
+	for rows.Next() {
+		var a models.Attachment
+		if err := rows.Scan(&a.ID, &a.TaskID, &a.Filename, &a.ContentType, &a.Size, &a.SHA256, &a.CreatedAt); err != nil {
+			http.Error(w, "Error scanning attachment", http.StatusInternalServerError)
+			return
+		}
+		attachments = append(attachments, a)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(attachments)
+}
+
+// UploadAttachment stores the "file" part of a multipart form as a task attachment
+func (h *AttachmentHandler) UploadAttachment(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	taskID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid task ID", http.StatusBadRequest)
+		return
+	}
+
+	// Allow some room for the multipart framing around the file itself
+	r.Body = http.MaxBytesReader(w, r.Body, h.limits.maxSize+1<<20)
+	filename, data, err := readMultipartFile(r, "file", h.limits.maxSize)
+	if err != nil {
+		writeAttachmentError(w, err)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		http.Error(w, "Error starting transaction", http.StatusInternalServerError)
+		return
+	}
+	blobs := newBlobCleanup(h.db, h.store)
+	defer blobs.run(tx)
+
+	exists, err := taskBelongsToUser(tx, taskID, userID)
+	if err != nil {
+		http.Error(w, "Error checking task existence", http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "Task not found", http.StatusNotFound)
+		return
+	}
+
+	attachment, err := saveAttachment(r.Context(), tx, blobs, h.limits, taskID, userID, filename, data)
+	if err != nil {
+		writeAttachmentError(w, err)
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		http.Error(w, "Error committing transaction", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(attachment)
+}
+
+// DownloadAttachment streams an attachment's contents
+func (h *AttachmentHandler) DownloadAttachment(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	taskID, attachmentID, err := attachmentRouteIDs(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var a models.Attachment
+	var storageKey string
+	err = h.db.QueryRow(`
+		SELECT a.id, a.task_id, a.filename, a.content_type, a.size_bytes, a.sha256, a.created_at, a.storage_key
+		FROM task_attachments a
+		JOIN tasks t ON t.id = a.task_id
+		WHERE a.id = $1 AND a.task_id = $2 AND t.user_id = $3 AND t.is_deleted = false
+	`, attachmentID, taskID, userID).Scan(&a.ID, &a.TaskID, &a.Filename, &a.ContentType, &a.Size, &a.SHA256, &a.CreatedAt, &storageKey)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Attachment not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error fetching attachment", http.StatusInternalServerError)
+		return
+	}
+
+	etag := `"` + a.SHA256 + `"`
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	blob, err := h.store.Get(r.Context(), storageKey)
+	if err != nil {
+		log.Printf("Error reading attachment %d from storage: %v", a.ID, err)
+		http.Error(w, "Error reading attachment", http.StatusInternalServerError)
+		return
+	}
+	defer blob.Close()
+
+	w.Header().Set("Content-Type", a.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(a.Size, 10))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": a.Filename}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("ETag", etag)
+	io.Copy(w, blob)
+}
+
+// DeleteAttachment removes an attachment, deleting its blob once nothing else uses it
+func (h *AttachmentHandler) DeleteAttachment(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	taskID, attachmentID, err := attachmentRouteIDs(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		http.Error(w, "Error starting transaction", http.StatusInternalServerError)
+		return
+	}
+	blobs := newBlobCleanup(h.db, h.store)
+	defer blobs.run(tx)
+
+	exists, err := taskBelongsToUser(tx, taskID, userID)
+	if err != nil {
+		http.Error(w, "Error checking task existence", http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "Task not found", http.StatusNotFound)
+		return
+	}
+
+	if err := deleteAttachment(tx, blobs, taskID, attachmentID); err != nil {
+		writeAttachmentError(w, err)
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		http.Error(w, "Error committing transaction", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// saveAttachment validates file contents, stores them once per distinct hash
+// and records the attachment metadata inside the caller's transaction
+func saveAttachment(ctx context.Context, tx *sql.Tx, blobs *blobCleanup, limits attachmentLimits,
+	taskID, userID int, filename string, data []byte) (models.Attachment, error) {
+	if int64(len(data)) > limits.maxSize {
+		return models.Attachment{}, errAttachmentTooLarge
+	}
+	contentType, _, _ := mime.ParseMediaType(http.DetectContentType(data))
+	if !limits.allows(contentType) {
+		return models.Attachment{}, fmt.Errorf("%w: %s", errAttachmentType, contentType)
+	}
+
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	storageKey := attachmentStorageKey(hash)
+
+	// Serialize uploads and deletes of the same content so a blob is never
+	// removed while another attachment is being added for it
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock(hashtext($1))`, hash); err != nil {
+		return models.Attachment{}, err
+	}
+	var stored bool
+	err := tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM task_attachments WHERE sha256 = $1)`, hash).Scan(&stored)
+	if err != nil {
+		return models.Attachment{}, err
+	}
+	if !stored {
+		// Remembered before the put, so a partly written blob is removed too
+		// if the transaction doesn't commit
+		blobs.add(hash)
+		if err := blobs.store.Put(ctx, storageKey, bytes.NewReader(data), int64(len(data)), contentType); err != nil {
+			return models.Attachment{}, fmt.Errorf("failed to store attachment: %v", err)
+		}
+	}
+
+	a := models.Attachment{
+		TaskID:      taskID,
+		Filename:    sanitizeFilename(filename),
+		ContentType: contentType,
+		Size:        int64(len(data)),
+		SHA256:      hash,
+	}
+	err = tx.QueryRow(`
+		INSERT INTO task_attachments (task_id, user_id, filename, content_type, size_bytes, sha256, storage_key)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at
+	`, taskID, userID, a.Filename, a.ContentType, a.Size, a.SHA256, storageKey).Scan(&a.ID, &a.CreatedAt)
+	return a, err
+}
+
+// deleteAttachment removes an attachment row. Its blob is deleted by blobs
+// once the transaction has ended, if no other row references it then.
+func deleteAttachment(tx *sql.Tx, blobs *blobCleanup, taskID, attachmentID int) error {
+	var hash string
+	err := tx.QueryRow(`
+		SELECT sha256 FROM task_attachments WHERE id = $1 AND task_id = $2
+	`, attachmentID, taskID).Scan(&hash)
+	if err == sql.ErrNoRows {
+		return errAttachmentNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock(hashtext($1))`, hash); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM task_attachments WHERE id = $1`, attachmentID); err != nil {
+		return err
+	}
+
+	var stillUsed bool
+	err = tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM task_attachments WHERE sha256 = $1)`, hash).Scan(&stillUsed)
+	if err != nil {
+		return err
+	}
+	if !stillUsed {
+		blobs.add(hash)
+	}
+	return nil
+}
+
+// attachmentStorageKey is the key attachment contents are stored under
+func attachmentStorageKey(hash string) string {
+	return "sha256/" + hash[:2] + "/" + hash
+}
+
+// blobCleanup remembers the attachment contents a transaction stored or
+// stopped using. Blobs are only deleted after the transaction has ended, and
+// only if no attachment references them by then: a rollback never leaves a
+// row pointing at a deleted blob, and a failed insert leaves no orphan.
+type blobCleanup struct {
+	db     *sql.DB
+	store  storage.BlobStore
+	hashes []string
+}
+
+func newBlobCleanup(db *sql.DB, store storage.BlobStore) *blobCleanup {
+	return &blobCleanup{db: db, store: store}
+}
+
+func (c *blobCleanup) add(hash string) {
+	c.hashes = append(c.hashes, hash)
+}
+
+// run rolls tx back unless it was committed, then deletes the remembered
+// blobs that nothing references. Failures are logged; they leave an unused
+// blob behind, never a missing one.
+func (c *blobCleanup) run(tx *sql.Tx) {
+	tx.Rollback()
+	for _, hash := range c.hashes {
+		if err := c.deleteUnused(hash); err != nil {
+			log.Printf("Error deleting attachment contents %s: %v", hash, err)
+		}
+	}
+}
+
+func (c *blobCleanup) deleteUnused(hash string) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Held while deleting, so no upload of the same content slips in between
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock(hashtext($1))`, hash); err != nil {
+		return err
+	}
+	var used bool
+	err = tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM task_attachments WHERE sha256 = $1)`, hash).Scan(&used)
+	if err != nil || used {
+		return err
+	}
+	if err := c.store.Delete(context.Background(), attachmentStorageKey(hash)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// readMultipartFile reads the named file field of a multipart request into memory,
+// refusing files larger than maxSize
+func readMultipartFile(r *http.Request, field string, maxSize int64) (string, []byte, error) {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return "", nil, fmt.Errorf("%w: expected multipart/form-data", errAttachmentNoFile)
+	}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return "", nil, errAttachmentNoFile
+		}
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				return "", nil, errAttachmentTooLarge
+			}
+			return "", nil, err
+		}
+		if part.FormName() != field || part.FileName() == "" {
+			part.Close()
+			continue
+		}
+		data, err := io.ReadAll(io.LimitReader(part, maxSize+1))
+		part.Close()
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				return "", nil, errAttachmentTooLarge
+			}
+			return "", nil, err
+		}
+		if int64(len(data)) > maxSize {
+			return "", nil, errAttachmentTooLarge
+		}
+		return part.FileName(), data, nil
+	}
+}
+
+// sanitizeFilename strips directories and control characters from an uploaded name
+func sanitizeFilename(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, name)
+	if len(name) > 255 {
+		// Cut at a rune boundary so no character is split
+		cut := 255
+		for cut > 0 && !utf8.RuneStart(name[cut]) {
+			cut--
+		}
+		name = name[:cut]
+	}
+	if name == "" || name == "." || name == "/" {
+		name = "attachment"
+	}
+	return name
+}
+
+// attachmentRouteIDs parses the task and attachment IDs from the request path
+func attachmentRouteIDs(r *http.Request) (int, int, error) {
+	vars := mux.Vars(r)
+	taskID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		return 0, 0, fmt.Errorf("Invalid task ID")
+	}
+	attachmentID, err := strconv.Atoi(vars["attachmentId"])
+	if err != nil {
+		return 0, 0, fmt.Errorf("Invalid attachment ID")
+	}
+	return taskID, attachmentID, nil
+}
+
+// writeAttachmentError maps attachment errors onto HTTP responses
+func writeAttachmentError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errAttachmentTooLarge):
+		http.Error(w, "Attachment is too large", http.StatusRequestEntityTooLarge)
+	case errors.Is(err, errAttachmentType):
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+	case errors.Is(err, errAttachmentNoFile):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, errAttachmentNotFound):
+		http.Error(w, "Attachment not found", http.StatusNotFound)
+	default:
+		log.Printf("Error handling attachment: %v", err)
+		http.Error(w, "Error handling attachment", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSanitizeFilename(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{"plain", "report.pdf", "report.pdf"},
+		{"unix path", "../../etc/passwd", "passwd"},
+		{"windows path", `C:\Users\me\notes.txt`, "notes.txt"},
+		{"control characters", "a\x00b\nc.txt", "abc.txt"},
+		{"empty", "", "attachment"},
+		{"dot", ".", "attachment"},
+		{"root", "/", "attachment"},
+		{"long ascii", strings.Repeat("a", 300), strings.Repeat("a", 255)},
+		// 254 bytes of ASCII followed by a two-byte rune straddling the limit
+		{"rune at the limit", strings.Repeat("a", 254) + "é", strings.Repeat("a", 254)},
+		{"long multi-byte", strings.Repeat("日", 100), strings.Repeat("日", 85)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := sanitizeFilename(tt.in)
+			if got != tt.want {
+				t.Errorf("sanitizeFilename(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+			if !utf8.ValidString(got) {
+				t.Errorf("sanitizeFilename(%q) returned invalid UTF-8", tt.in)
+			}
+		})
+	}
+}
@@ -3,12 +3,14 @@ package handlers
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"os"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/joho/godotenv"
+	"task-manager/models"
 )
 
 type AuthRequest struct {
@@ -22,6 +24,8 @@ type AuthResponse struct {
 
 var jwtSecret []byte
 
+var errInvalidToken = errors.New("invalid or expired token")
+
 func init() {
 	godotenv.Load()
 	jwtSecret = []byte(os.Getenv("JWT_SECRET"))
@@ -67,7 +71,8 @@ func LoginHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 		var user models.User
-		err := db.QueryRow("SELECT id, email, password_hash FROM users WHERE email=$1", req.Email).Scan(&user.ID, &user.Email, &user.PasswordHash)
+		var deletedAt sql.NullTime
+		err := db.QueryRow("SELECT id, email, password_hash, deleted_at FROM users WHERE email=$1", req.Email).Scan(&user.ID, &user.Email, &user.PasswordHash, &deletedAt)
 		if err != nil {
 			http.Error(w, "Invalid email or password", http.StatusUnauthorized)
 			return
@@ -76,6 +81,10 @@ func LoginHandler(db *sql.DB) http.HandlerFunc {
 			http.Error(w, "Invalid email or password", http.StatusUnauthorized)
 			return
 		}
+		if deletedAt.Valid {
+			http.Error(w, "Account is scheduled for deletion; restore it with POST /api/account/restore", http.StatusForbidden)
+			return
+		}
 		// Generate JWT
 		token, err := generateJWT(user.ID)
 		if err != nil {
@@ -90,6 +99,7 @@ func LoginHandler(db *sql.DB) http.HandlerFunc {
 func generateJWT(userID int) (string, error) {
 	claims := jwt.MapClaims{
 		"user_id": userID,
+		"iat":     time.Now().Unix(),
 		"exp":     time.Now().Add(24 * time.Hour).Unix(),
 	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
@@ -98,19 +108,52 @@ func generateJWT(userID int) (string, error) {
 
 // ParseJWT parses and validates a JWT, returning the user ID
 func ParseJWT(tokenStr string) (int, error) {
+	userID, _, err := parseJWTClaims(tokenStr)
+	return userID, err
+}
+
+// parseJWTClaims parses and validates a JWT, returning the user ID and when
+// the token was issued (zero for tokens issued without an iat claim)
+func parseJWTClaims(tokenStr string) (int, time.Time, error) {
 	token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
 		return jwtSecret, nil
 	})
 	if err != nil || !token.Valid {
-		return 0, err
+		return 0, time.Time{}, errInvalidToken
 	}
 	claims, ok := token.Claims.(jwt.MapClaims)
 	if !ok {
-		return 0, err
+		return 0, time.Time{}, errInvalidToken
 	}
 	userID, ok := claims["user_id"].(float64)
 	if !ok {
+		return 0, time.Time{}, errInvalidToken
+	}
+	var issuedAt time.Time
+	if iat, ok := claims["iat"].(float64); ok {
+		issuedAt = time.Unix(int64(iat), 0)
+	}
+	return int(userID), issuedAt, nil
+}
+
+// authenticateToken validates a JWT and checks that its user still exists,
+// isn't scheduled for deletion and hasn't revoked the token
+func authenticateToken(q queryer, tokenStr string) (int, error) {
+	userID, issuedAt, err := parseJWTClaims(tokenStr)
+	if err != nil {
+		return 0, err
+	}
+	var active bool
+	err = q.QueryRow(`
+		SELECT deleted_at IS NULL AND (tokens_revoked_before IS NULL OR tokens_revoked_before <= $2)
+		FROM users
+		WHERE id = $1
+	`, userID, issuedAt).Scan(&active)
+	if err == sql.ErrNoRows || (err == nil && !active) {
+		return 0, errInvalidToken
+	}
+	if err != nil {
 		return 0, err
 	}
-	return int(userID), nil
+	return userID, nil
 } 
\ No newline at end of file
@@ -0,0 +1,289 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"task-manager/models"
+)
+
+// maxBulkItems bounds how many tasks a single bulk request may touch
+const maxBulkItems = 200
+
+// BulkTasks applies one operation to many tasks in a single transaction.
+// In "atomic" mode (the default) any failure rolls back the whole batch;
+// in "best_effort" mode failed items are skipped and the rest are committed.
+// base_versions plays the part of If-Match for each task: an item whose task
+// is at another version is a conflict, returned with the task as it is now.
+func (h *TaskHandler) BulkTasks(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.BulkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Mode == "" {
+		req.Mode = "atomic"
+	}
+	if msg := validateBulkRequest(&req); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	tx, err := beginTaskTx(h.db, userID)
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		http.Error(w, "Error starting transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	resp := models.BulkResponse{Mode: req.Mode, Results: make([]models.BulkItemResult, 0, len(req.IDs))}
+	for i, taskID := range req.IDs {
+		if req.Mode == "best_effort" {
+			if _, err := tx.Exec("SAVEPOINT bulk_item"); err != nil {
+				http.Error(w, "Error creating savepoint", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		err := checkBaseVersion(tx, userID, taskID, &req, h.requireIfMatch)
+		var task *models.Task
+		if err == nil {
+			task, err = applyBulkOperation(tx, userID, taskID, &req)
+		}
+		if err != nil {
+			resp.Failed++
+			result := models.BulkItemResult{ID: taskID, Status: "failed", Error: bulkErrorMessage(err)}
+			status := http.StatusUnprocessableEntity
+			if failed, ok := err.(*preconditionFailedError); ok {
+				result.Status, result.Task = "conflict", &failed.current
+				status = http.StatusPreconditionFailed
+			} else if err == errPreconditionRequired {
+				status = http.StatusPreconditionRequired
+			}
+			resp.Results = append(resp.Results, result)
+			if req.Mode == "atomic" {
+				// Everything before this item is undone along with it
+				for j := range resp.Results[:i] {
+					resp.Results[j].Status = "rolled_back"
+					resp.Results[j].Task = nil
+				}
+				resp.Succeeded = 0
+				for _, remaining := range req.IDs[i+1:] {
+					resp.Results = append(resp.Results, models.BulkItemResult{ID: remaining, Status: "rolled_back"})
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(status)
+				json.NewEncoder(w).Encode(resp)
+				return
+			}
+			if _, err := tx.Exec("ROLLBACK TO SAVEPOINT bulk_item"); err != nil {
+				http.Error(w, "Error rolling back to savepoint", http.StatusInternalServerError)
+				return
+			}
+			continue
+		}
+
+		if req.Mode == "best_effort" {
+			if _, err := tx.Exec("RELEASE SAVEPOINT bulk_item"); err != nil {
+				http.Error(w, "Error releasing savepoint", http.StatusInternalServerError)
+				return
+			}
+		}
+		resp.Succeeded++
+		resp.Results = append(resp.Results, models.BulkItemResult{ID: taskID, Status: "ok", Task: task})
+	}
+
+	if err = tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		http.Error(w, "Error committing transaction", http.StatusInternalServerError)
+		return
+	}
+	resp.Committed = true
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// checkBaseVersion locks a task and checks it against the version the
+// request gives for it. Without one the check passes unless required is set.
+func checkBaseVersion(tx *sql.Tx, userID, taskID int, req *models.BulkRequest, required bool) error {
+	version, ok := req.BaseVersions[taskID]
+	if !ok {
+		if required {
+			return errPreconditionRequired
+		}
+		return nil
+	}
+	current, err := lockTask(tx, taskID, userID, req.Operation == "restore")
+	if err != nil {
+		return err
+	}
+	if current.Version != version {
+		return &preconditionFailedError{current: current}
+	}
+	return nil
+}
+
+// applyBulkOperation runs the requested operation against a single task
+func applyBulkOperation(tx *sql.Tx, userID, taskID int, req *models.BulkRequest) (*models.Task, error) {
+	switch req.Operation {
+	case "update":
+		return bulkUpdate(tx, userID, taskID, *req.Fields)
+	case "move_category":
+		category := req.Category
+		return bulkUpdate(tx, userID, taskID, models.BulkFields{Category: &category})
+	case "delete":
+		return nil, deleteTaskTx(tx, userID, taskID)
+	case "restore":
+		task, err := restoreTaskTx(tx, userID, taskID)
+		if err != nil {
+			return nil, err
+		}
+		return &task, nil
+	case "add_tag":
+		task, err := attachTagsTx(tx, userID, taskID, []string{req.Tag})
+		if err != nil {
+			return nil, err
+		}
+		return &task, nil
+	}
+	return nil, fmt.Errorf("unknown operation %q", req.Operation)
+}
+
+// bulkUpdate changes only the provided fields of a task, keeping the rest as they are
+func bulkUpdate(tx *sql.Tx, userID, taskID int, fields models.BulkFields) (*models.Task, error) {
+	current, err := lockTask(tx, taskID, userID, false)
+	if err != nil {
+		return nil, err
+	}
+
+	taskUpdate := models.TaskUpdate{
+		Title:       current.Title,
+		Description: current.Description,
+		Status:      current.Status,
+		Priority:    current.Priority,
+		Category:    current.Category,
+		DueDate:     current.DueDate,
+	}
+	if fields.Title != nil {
+		taskUpdate.Title = *fields.Title
+	}
+	if fields.Description != nil {
+		taskUpdate.Description = *fields.Description
+	}
+	if fields.Status != nil {
+		taskUpdate.Status = *fields.Status
+	}
+	if fields.Priority != nil {
+		taskUpdate.Priority = *fields.Priority
+	}
+	if fields.Category != nil {
+		taskUpdate.Category = *fields.Category
+	}
+	if fields.DueDate != nil {
+		taskUpdate.DueDate = fields.DueDate
+	}
+	if fields.ClearDueDate {
+		taskUpdate.DueDate = nil
+	}
+	taskUpdate.CustomFields = fields.CustomFields
+	taskUpdate.EstimateMinutes = fields.EstimateMinutes
+
+	task, err := updateTaskTx(tx, userID, taskID, taskUpdate)
+	if err != nil {
+		return nil, err
+	}
+	return &task, nil
+}
+
+// validateBulkRequest returns an error message if the request can't be run
+func validateBulkRequest(req *models.BulkRequest) string {
+	if len(req.IDs) == 0 {
+		return "At least one task ID is required"
+	}
+	if len(req.IDs) > maxBulkItems {
+		return fmt.Sprintf("At most %d tasks can be changed in one request", maxBulkItems)
+	}
+	seen := make(map[int]bool)
+	for _, id := range req.IDs {
+		if seen[id] {
+			return fmt.Sprintf("Task %d is listed more than once", id)
+		}
+		seen[id] = true
+	}
+	for id := range req.BaseVersions {
+		if !seen[id] {
+			return fmt.Sprintf("base_versions names task %d, which isn't in ids", id)
+		}
+	}
+	if req.Mode != "atomic" && req.Mode != "best_effort" {
+		return "Mode must be atomic or best_effort"
+	}
+
+	switch req.Operation {
+	case "update":
+		if req.Fields == nil {
+			return "Fields are required for the update operation"
+		}
+		if msg := validateBulkFields(req.Fields); msg != "" {
+			return msg
+		}
+	case "move_category":
+		if !isValidCategory(req.Category) {
+			return "Invalid category value"
+		}
+	case "add_tag":
+		req.Tag = strings.TrimSpace(req.Tag)
+		if msg := validateTagName(req.Tag); msg != "" {
+			return msg
+		}
+	case "delete", "restore":
+	default:
+		return "Operation must be one of update, delete, restore, move_category or add_tag"
+	}
+	return ""
+}
+
+// validateBulkFields returns an error message if a field would be set to an invalid value
+func validateBulkFields(f *models.BulkFields) string {
+	switch {
+	case f.Title != nil && len(strings.TrimSpace(*f.Title)) < 3:
+		return "Title must be at least 3 characters long"
+	case f.Status != nil && !isValidStatus(*f.Status):
+		return "Invalid status value"
+	case f.Priority != nil && !isValidPriority(*f.Priority):
+		return "Invalid priority value"
+	case f.Category != nil && !isValidCategory(*f.Category):
+		return "Invalid category value"
+	case f.EstimateMinutes != nil && *f.EstimateMinutes != 0 && !isValidEstimate(*f.EstimateMinutes):
+		return "Estimate must be between 1 and 100000 minutes"
+	}
+	return ""
+}
+
+// bulkErrorMessage turns an item error into a message safe to return to the client
+func bulkErrorMessage(err error) string {
+	if err == errTaskNotFound {
+		return "Task not found"
+	}
+	if err == errPreconditionRequired {
+		return "base_versions must give the task's version"
+	}
+	switch err.(type) {
+	case *taskRuleError, *preconditionFailedError:
+		return err.Error()
+	}
+	log.Printf("Error in bulk operation: %v", err)
+	return "Error applying operation"
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+
+	"task-manager/models"
+)
+
+func TestValidateBulkRequestBaseVersions(t *testing.T) {
+	tests := []struct {
+		versions map[int]int
+		msg      string
+	}{
+		{nil, ""},
+		{map[int]int{1: 3, 2: 1}, ""},
+		{map[int]int{3: 1}, "base_versions names task 3"},
+	}
+	for _, tt := range tests {
+		req := models.BulkRequest{IDs: []int{1, 2}, Operation: "delete", Mode: "atomic", BaseVersions: tt.versions}
+		msg := validateBulkRequest(&req)
+		if (tt.msg == "") != (msg == "") || !strings.Contains(msg, tt.msg) {
+			t.Errorf("base_versions %v: got %q, want %q", tt.versions, msg, tt.msg)
+		}
+	}
+}
+
+func TestValidateSyncPushRequireVersion(t *testing.T) {
+	version := 4
+	title := "Renamed"
+	push := func(m models.SyncMutation) *models.SyncPush {
+		return &models.SyncPush{Mutations: []models.SyncMutation{m}}
+	}
+	tests := []struct {
+		name     string
+		push     *models.SyncPush
+		required bool
+		msg      string
+	}{
+		{"update without version", push(models.SyncMutation{Op: "update", TaskID: 1, Fields: &models.BulkFields{Title: &title}}), false, ""},
+		{"update without required version", push(models.SyncMutation{Op: "update", TaskID: 1, Fields: &models.BulkFields{Title: &title}}), true, "base_version is required"},
+		{"update with version", push(models.SyncMutation{Op: "update", TaskID: 1, BaseVersion: &version, Fields: &models.BulkFields{Title: &title}}), true, ""},
+		{"delete without required version", push(models.SyncMutation{Op: "delete", TaskID: 1}), true, "base_version is required"},
+		{"create needs no version", push(models.SyncMutation{Op: "create", Task: &models.TaskCreate{Title: "New task"}}), true, ""},
+	}
+	for _, tt := range tests {
+		msg := validateSyncPush(tt.push, tt.required)
+		if (tt.msg == "") != (msg == "") || !strings.Contains(msg, tt.msg) {
+			t.Errorf("%s: got %q, want %q", tt.name, msg, tt.msg)
+		}
+	}
+}
@@ -0,0 +1,823 @@
+package handlers
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/xml"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"task-manager/ical"
+	"task-manager/models"
+)
+
+const (
+	caldavPrefix     = "/caldav"
+	syncTokenPrefix  = "https://task-manager/sync/"
+	maxCalendarBytes = 1 << 20
+)
+
+// caldavCategories maps collection names in URLs onto task categories.
+// Every category is exposed as its own VTODO calendar.
+var caldavCategories = map[string]string{
+	"work":      "Work",
+	"personal":  "Personal",
+	"shopping":  "Shopping",
+	"health":    "Health",
+	"education": "Education",
+}
+
+// CalDAVHandler serves a CalDAV (RFC 4791) view of each user's tasks:
+//
+//	/caldav/principals/{user}/               the user's principal
+//	/caldav/calendars/{user}/                calendar home
+//	/caldav/calendars/{user}/{category}/     one VTODO calendar per category
+//	/caldav/calendars/{user}/{category}/x.ics  a single task
+//
+// Clients authenticate with HTTP Basic auth using their email and password,
+// or with the same bearer token as the REST API.
+type CalDAVHandler struct {
+	db *sql.DB
+}
+
+func NewCalDAVHandler(db *sql.DB) *CalDAVHandler {
+	return &CalDAVHandler{db: db}
+}
+
+// caldavPath is a parsed request path
+type caldavPath struct {
+	kind     string // root, principal, home, calendar or task
+	userID   int
+	category string
+	name     string
+}
+
+// davTask is a task together with its CalDAV identity
+type davTask struct {
+	task    models.Task
+	uid     string
+	name    string
+	deleted bool
+}
+
+// davTaskColumns extends taskColumns with the columns scanned by scanDAVTask
+const davTaskColumns = taskColumns + `,
+	COALESCE(t.ical_uid, ''), COALESCE(t.caldav_name, 'task-' || t.id || '.ics'), t.is_deleted`
+
+func scanDAVTask(row interface{ Scan(...interface{}) error }) (davTask, error) {
+	var d davTask
+	task, err := scanTask(scanAppender{row: row, extra: []interface{}{&d.uid, &d.name, &d.deleted}})
+	d.task = task
+	if d.uid == "" {
+		d.uid = taskUID(&task)
+	}
+	return d, err
+}
+
+// etag is the task's version tag, the same one the REST API uses for If-Match
+func (d davTask) etag() string {
+	return taskETag(d.task)
+}
+
+// calendarData renders the task as a VCALENDAR holding one VTODO
+func (d davTask) calendarData() string {
+	cal := newCalendar(d.task.Category)
+	todo := taskToVTODO(&d.task, time.Now())
+	todo.Set("UID", ical.EscapeText(d.uid))
+	cal.Components = append(cal.Components, todo)
+	var b bytes.Buffer
+	ical.Encode(&b, cal)
+	return b.String()
+}
+
+func principalHref(userID int) string {
+	return caldavPrefix + "/principals/" + strconv.Itoa(userID) + "/"
+}
+
+func homeHref(userID int) string {
+	return caldavPrefix + "/calendars/" + strconv.Itoa(userID) + "/"
+}
+
+func calendarHref(userID int, collection string) string {
+	return homeHref(userID) + collection + "/"
+}
+
+func taskHref(userID int, collection, name string) string {
+	return calendarHref(userID, collection) + url.PathEscape(name)
+}
+
+// collectionName returns the URL segment for a category
+func collectionName(category string) string {
+	return strings.ToLower(category)
+}
+
+func (h *CalDAVHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("DAV", "1, 3, calendar-access")
+	if r.Method == http.MethodOptions {
+		w.Header().Set("Allow", "OPTIONS, GET, HEAD, PUT, DELETE, PROPFIND, REPORT")
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	userID, ok := h.authenticate(r)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Basic realm="Task Manager", charset="UTF-8"`)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	path, ok := parseCalDAVPath(r.URL.Path)
+	if !ok {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	if path.kind != "root" && path.userID != userID {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	path.userID = userID
+
+	switch r.Method {
+	case "PROPFIND":
+		h.propfind(w, r, path)
+	case "REPORT":
+		h.report(w, r, path)
+	case http.MethodGet, http.MethodHead:
+		h.get(w, r, path)
+	case http.MethodPut:
+		h.put(w, r, path)
+	case http.MethodDelete:
+		h.delete(w, r, path)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// WellKnown redirects /.well-known/caldav to the CalDAV root (RFC 6764)
+func (h *CalDAVHandler) WellKnown(w http.ResponseWriter, r *http.Request) {
+	http.Redirect(w, r, caldavPrefix+"/", http.StatusMovedPermanently)
+}
+
+// authenticate checks Basic credentials or a bearer token and returns the user ID
+func (h *CalDAVHandler) authenticate(r *http.Request) (int, bool) {
+	if header := r.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		userID, err := authenticateToken(h.db, strings.TrimPrefix(header, "Bearer "))
+		return userID, err == nil && userID != 0
+	}
+	email, password, ok := r.BasicAuth()
+	if !ok {
+		return 0, false
+	}
+	var user models.User
+	err := h.db.QueryRow("SELECT id, email, password_hash FROM users WHERE email=$1 AND deleted_at IS NULL", email).
+		Scan(&user.ID, &user.Email, &user.PasswordHash)
+	if err != nil || !models.CheckPassword(user.PasswordHash, password) {
+		return 0, false
+	}
+	return user.ID, true
+}
+
+// parseCalDAVPath splits a request path into its parts
+func parseCalDAVPath(p string) (caldavPath, bool) {
+	rest := strings.Trim(strings.TrimPrefix(p, caldavPrefix), "/")
+	if rest == "" {
+		return caldavPath{kind: "root"}, true
+	}
+	parts := strings.Split(rest, "/")
+	if len(parts) < 2 {
+		return caldavPath{}, false
+	}
+	userID, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return caldavPath{}, false
+	}
+	switch {
+	case parts[0] == "principals" && len(parts) == 2:
+		return caldavPath{kind: "principal", userID: userID}, true
+	case parts[0] == "calendars" && len(parts) == 2:
+		return caldavPath{kind: "home", userID: userID}, true
+	case parts[0] == "calendars" && len(parts) <= 4:
+		category, ok := caldavCategories[parts[2]]
+		if !ok {
+			return caldavPath{}, false
+		}
+		if len(parts) == 3 {
+			return caldavPath{kind: "calendar", userID: userID, category: category}, true
+		}
+		name, err := url.PathUnescape(parts[3])
+		if err != nil || name == "" {
+			return caldavPath{}, false
+		}
+		return caldavPath{kind: "task", userID: userID, category: category, name: name}, true
+	}
+	return caldavPath{}, false
+}
+
+// propfind answers PROPFIND for any resource, honoring Depth 0 and 1
+func (h *CalDAVHandler) propfind(w http.ResponseWriter, r *http.Request, path caldavPath) {
+	req, err := parseDAVRequest(io.LimitReader(r.Body, maxCalendarBytes))
+	if err != nil {
+		http.Error(w, "Invalid XML body", http.StatusBadRequest)
+		return
+	}
+	depthOne := r.Header.Get("Depth") != "0"
+
+	var responses []davResponse
+	switch path.kind {
+	case "root":
+		responses = append(responses, selectProps(req, caldavPrefix+"/", h.rootProps(path.userID)))
+	case "principal":
+		props, err := h.principalProps(path.userID)
+		if err != nil {
+			http.Error(w, "Error fetching principal", http.StatusInternalServerError)
+			return
+		}
+		responses = append(responses, selectProps(req, principalHref(path.userID), props))
+	case "home":
+		responses = append(responses, selectProps(req, homeHref(path.userID), h.homeProps(path.userID)))
+		if depthOne {
+			for _, category := range sortedCategories() {
+				props, err := h.calendarProps(path.userID, category)
+				if err != nil {
+					http.Error(w, "Error fetching calendar", http.StatusInternalServerError)
+					return
+				}
+				responses = append(responses, selectProps(req, calendarHref(path.userID, collectionName(category)), props))
+			}
+		}
+	case "calendar":
+		props, err := h.calendarProps(path.userID, path.category)
+		if err != nil {
+			http.Error(w, "Error fetching calendar", http.StatusInternalServerError)
+			return
+		}
+		responses = append(responses, selectProps(req, calendarHref(path.userID, collectionName(path.category)), props))
+		if depthOne {
+			tasks, err := h.collectionTasks(path.userID, path.category)
+			if err != nil {
+				http.Error(w, "Error fetching tasks", http.StatusInternalServerError)
+				return
+			}
+			for _, d := range tasks {
+				responses = append(responses, selectProps(req, taskHref(path.userID, collectionName(path.category), d.name), taskProps(d, false)))
+			}
+		}
+	case "task":
+		d, err := h.findTask(h.db, path, false)
+		if err == errTaskNotFound {
+			http.Error(w, "Not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Error fetching task", http.StatusInternalServerError)
+			return
+		}
+		responses = append(responses, selectProps(req, taskHref(path.userID, collectionName(path.category), d.name), taskProps(d, false)))
+	}
+	writeMultistatus(w, responses, "")
+}
+
+// report answers calendar-query, calendar-multiget and sync-collection reports
+func (h *CalDAVHandler) report(w http.ResponseWriter, r *http.Request, path caldavPath) {
+	if path.kind != "calendar" {
+		http.Error(w, "Reports are only supported on calendar collections", http.StatusForbidden)
+		return
+	}
+	req, err := parseDAVRequest(io.LimitReader(r.Body, maxCalendarBytes))
+	if err != nil {
+		http.Error(w, "Invalid XML body", http.StatusBadRequest)
+		return
+	}
+	collection := collectionName(path.category)
+	withData := req.wantsProp(xml.Name{Space: nsCalDAV, Local: "calendar-data"})
+
+	var responses []davResponse
+	switch {
+	case req.root.Space == nsCalDAV && req.root.Local == "calendar-query":
+		// Only VTODO components live here; a filter for anything else matches nothing
+		for _, comp := range req.compFilters {
+			if comp != "VCALENDAR" && comp != "VTODO" {
+				writeMultistatus(w, nil, "")
+				return
+			}
+		}
+		tasks, err := h.collectionTasks(path.userID, path.category)
+		if err != nil {
+			http.Error(w, "Error fetching tasks", http.StatusInternalServerError)
+			return
+		}
+		for _, d := range tasks {
+			responses = append(responses, selectProps(req, taskHref(path.userID, collection, d.name), taskProps(d, withData)))
+		}
+		writeMultistatus(w, responses, "")
+
+	case req.root.Space == nsCalDAV && req.root.Local == "calendar-multiget":
+		for _, href := range req.hrefs {
+			target, ok := parseCalDAVPath(hrefPath(href))
+			if !ok || target.kind != "task" || target.userID != path.userID || target.category != path.category {
+				responses = append(responses, davResponse{href: href, status: http.StatusNotFound})
+				continue
+			}
+			d, err := h.findTask(h.db, target, false)
+			if err == errTaskNotFound {
+				responses = append(responses, davResponse{href: href, status: http.StatusNotFound})
+				continue
+			}
+			if err != nil {
+				http.Error(w, "Error fetching task", http.StatusInternalServerError)
+				return
+			}
+			responses = append(responses, selectProps(req, href, taskProps(d, withData)))
+		}
+		writeMultistatus(w, responses, "")
+
+	case req.root.Space == nsDAV && req.root.Local == "sync-collection":
+		h.syncCollection(w, req, path, withData)
+
+	default:
+		writeDAVError(w, http.StatusForbidden, xml.Name{Space: nsDAV, Local: "supported-report"})
+	}
+}
+
+// syncCollection reports what changed since the client's sync token (RFC 6578).
+// Tasks that were deleted or moved to another category since then are
+// reported with a 404 status so the client drops them.
+func (h *CalDAVHandler) syncCollection(w http.ResponseWriter, req *davRequest, path caldavPath, withData bool) {
+	current, err := h.changeSeq(path.userID)
+	if err != nil {
+		http.Error(w, "Error fetching sync token", http.StatusInternalServerError)
+		return
+	}
+	since := int64(-1)
+	if req.syncToken != "" {
+		since, err = strconv.ParseInt(strings.TrimPrefix(req.syncToken, syncTokenPrefix), 10, 64)
+		// Tokens from before change numbering held timestamps, far beyond
+		// any change number; refusing them makes the client sync afresh
+		if err != nil || !strings.HasPrefix(req.syncToken, syncTokenPrefix) || since < 0 || since > current {
+			writeDAVError(w, http.StatusForbidden, xml.Name{Space: nsDAV, Local: "valid-sync-token"})
+			return
+		}
+	}
+	token := syncTokenPrefix + strconv.FormatInt(current, 10)
+
+	var rows *sql.Rows
+	if since < 0 {
+		rows, err = h.db.Query(`
+			SELECT `+davTaskColumns+`
+			FROM tasks t
+			WHERE t.user_id = $1 AND t.category = $2 AND t.is_deleted = false
+			ORDER BY t.id
+		`, path.userID, path.category)
+	} else {
+		rows, err = h.db.Query(`
+			SELECT `+davTaskColumns+`
+			FROM tasks t
+			WHERE t.user_id = $1 AND t.change_seq > $2
+			ORDER BY t.id
+		`, path.userID, since)
+	}
+	if err != nil {
+		http.Error(w, "Error fetching changes", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	collection := collectionName(path.category)
+	var responses []davResponse
+	for rows.Next() {
+		d, err := scanDAVTask(rows)
+		if err != nil {
+			http.Error(w, "Error scanning task", http.StatusInternalServerError)
+			return
+		}
+		href := taskHref(path.userID, collection, d.name)
+		if d.deleted || d.task.Category != path.category {
+			responses = append(responses, davResponse{href: href, status: http.StatusNotFound})
+			continue
+		}
+		responses = append(responses, selectProps(req, href, taskProps(d, withData)))
+	}
+	writeMultistatus(w, responses, token)
+}
+
+// get returns a single task as iCalendar text
+func (h *CalDAVHandler) get(w http.ResponseWriter, r *http.Request, path caldavPath) {
+	if path.kind != "task" {
+		http.Error(w, "Use PROPFIND to list collections", http.StatusMethodNotAllowed)
+		return
+	}
+	d, err := h.findTask(h.db, path, false)
+	if err == errTaskNotFound {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error fetching task", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("ETag", d.etag())
+	if etagMatches(r.Header.Get("If-None-Match"), d.etag()) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8; component=VTODO")
+	w.Header().Set("Last-Modified", d.task.UpdatedAt.UTC().Format(http.TimeFormat))
+	if r.Method == http.MethodGet {
+		io.WriteString(w, d.calendarData())
+	}
+}
+
+// put creates or replaces a task from a VTODO. Replacing goes through the
+// same update path as the REST API's UpdateTask.
+func (h *CalDAVHandler) put(w http.ResponseWriter, r *http.Request, path caldavPath) {
+	if path.kind != "task" {
+		http.Error(w, "Collections can't be replaced", http.StatusMethodNotAllowed)
+		return
+	}
+
+	cal, err := ical.Decode(io.LimitReader(r.Body, maxCalendarBytes))
+	if err != nil {
+		writeDAVError(w, http.StatusBadRequest, xml.Name{Space: nsCalDAV, Local: "valid-calendar-data"})
+		return
+	}
+	todo := cal.Find("VTODO")
+	if cal.Name != "VCALENDAR" || todo == nil {
+		writeDAVError(w, http.StatusForbidden, xml.Name{Space: nsCalDAV, Local: "supported-calendar-component"})
+		return
+	}
+	fields, err := vtodoFields(todo)
+	if err != nil {
+		writeDAVError(w, http.StatusBadRequest, xml.Name{Space: nsCalDAV, Local: "valid-calendar-data"})
+		return
+	}
+
+	tx, err := beginTaskTx(h.db, path.userID)
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		http.Error(w, "Error starting transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	current, err := h.findTask(tx, path, true)
+	exists := err == nil
+	if err != nil && err != errTaskNotFound {
+		http.Error(w, "Error fetching task", http.StatusInternalServerError)
+		return
+	}
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" && (!exists || !etagMatches(ifMatch, current.etag())) {
+		http.Error(w, "Precondition failed", http.StatusPreconditionFailed)
+		return
+	}
+	if r.Header.Get("If-None-Match") == "*" && exists {
+		http.Error(w, "Precondition failed", http.StatusPreconditionFailed)
+		return
+	}
+
+	category, currentStatus := path.category, ""
+	if exists {
+		category, currentStatus = current.task.Category, current.task.Status
+	}
+	wf, err := workflowFor(tx, path.userID, category)
+	if err != nil {
+		http.Error(w, "Error fetching workflow", http.StatusInternalServerError)
+		return
+	}
+	status := workflowStatus(&wf, fields.status, currentStatus)
+
+	var task models.Task
+	if exists {
+		taskUpdate := models.TaskUpdate{
+			Title:       fields.title,
+			Description: fields.description,
+			Status:      status,
+			Priority:    fields.priority,
+			DueDate:     fields.dueDate,
+		}
+		if taskUpdate.Priority == "" {
+			taskUpdate.Priority = current.task.Priority
+		}
+		if len(strings.TrimSpace(taskUpdate.Title)) < 3 {
+			http.Error(w, "Title must be at least 3 characters long", http.StatusBadRequest)
+			return
+		}
+		task, err = updateTaskTx(tx, path.userID, current.task.ID, taskUpdate)
+	} else {
+		taskCreate := models.TaskCreate{
+			Title:       fields.title,
+			Description: fields.description,
+			Status:      status,
+			Priority:    fields.priority,
+			Category:    path.category,
+			DueDate:     fields.dueDate,
+		}
+		var profile models.Profile
+		if profile, err = loadProfile(tx, path.userID); err != nil {
+			http.Error(w, "Error loading profile", http.StatusInternalServerError)
+			return
+		}
+		applyProfileDefaults(&taskCreate, profile)
+		if msg := validateTaskCreate(&taskCreate); msg != "" {
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+		task, err = createTaskTx(tx, path.userID, taskCreate)
+		if err == nil {
+			err = tx.QueryRow(`
+				UPDATE tasks SET ical_uid = NULLIF($1, ''), caldav_name = $2
+				WHERE id = $3
+				RETURNING updated_at, version
+			`, fields.uid, path.name, task.ID).Scan(&task.UpdatedAt, &task.Version)
+		}
+	}
+	if _, ok := err.(*taskRuleError); ok {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	if err != nil {
+		log.Printf("Error saving task from CalDAV: %v", err)
+		http.Error(w, "Error saving task", http.StatusInternalServerError)
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		http.Error(w, "Error committing transaction", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("ETag", davTask{task: task}.etag())
+	if exists {
+		w.WriteHeader(http.StatusNoContent)
+	} else {
+		w.WriteHeader(http.StatusCreated)
+	}
+}
+
+// delete soft deletes a task
+func (h *CalDAVHandler) delete(w http.ResponseWriter, r *http.Request, path caldavPath) {
+	if path.kind != "task" {
+		http.Error(w, "Collections can't be deleted", http.StatusForbidden)
+		return
+	}
+
+	tx, err := beginTaskTx(h.db, path.userID)
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		http.Error(w, "Error starting transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	current, err := h.findTask(tx, path, true)
+	if err == errTaskNotFound {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error fetching task", http.StatusInternalServerError)
+		return
+	}
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" && !etagMatches(ifMatch, current.etag()) {
+		http.Error(w, "Precondition failed", http.StatusPreconditionFailed)
+		return
+	}
+
+	if err := deleteTaskTx(tx, path.userID, current.task.ID); err != nil {
+		log.Printf("Error deleting task from CalDAV: %v", err)
+		http.Error(w, "Error deleting task", http.StatusInternalServerError)
+		return
+	}
+	if err = tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		http.Error(w, "Error committing transaction", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// findTask looks up the live task addressed by a task path
+func (h *CalDAVHandler) findTask(q queryer, path caldavPath, forUpdate bool) (davTask, error) {
+	lock := ""
+	if forUpdate {
+		lock = "FOR UPDATE OF t"
+	}
+	d, err := scanDAVTask(q.QueryRow(`
+		SELECT `+davTaskColumns+`
+		FROM tasks t
+		WHERE t.user_id = $1 AND t.category = $2 AND t.is_deleted = false
+		  AND COALESCE(t.caldav_name, 'task-' || t.id || '.ics') = $3
+		`+lock, path.userID, path.category, path.name))
+	if errors.Is(err, sql.ErrNoRows) {
+		return d, errTaskNotFound
+	}
+	return d, err
+}
+
+// collectionTasks lists the live tasks in a category
+func (h *CalDAVHandler) collectionTasks(userID int, category string) ([]davTask, error) {
+	rows, err := h.db.Query(`
+		SELECT `+davTaskColumns+`
+		FROM tasks t
+		WHERE t.user_id = $1 AND t.category = $2 AND t.is_deleted = false
+		ORDER BY t.id
+	`, userID, category)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tasks []davTask
+	for rows.Next() {
+		d, err := scanDAVTask(rows)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, d)
+	}
+	return tasks, rows.Err()
+}
+
+// changeSeq returns the number of the latest change to any of the user's
+// tasks. Numbers are taken when a change is written and the user's changes
+// commit in order (see beginTaskTx), so unlike a timestamp a change that
+// commits late can't fall behind a token already handed out.
+func (h *CalDAVHandler) changeSeq(userID int) (int64, error) {
+	var seq int64
+	err := h.db.QueryRow(`SELECT task_change_seq FROM users WHERE id = $1`, userID).Scan(&seq)
+	return seq, err
+}
+
+// syncToken returns a token describing the latest change to any of the user's tasks
+func (h *CalDAVHandler) syncToken(userID int) (string, error) {
+	seq, err := h.changeSeq(userID)
+	if err != nil {
+		return "", err
+	}
+	return syncTokenPrefix + strconv.FormatInt(seq, 10), nil
+}
+
+func (h *CalDAVHandler) rootProps(userID int) []davProp {
+	return []davProp{
+		{xml.Name{Space: nsDAV, Local: "resourcetype"}, "<d:collection/>"},
+		{xml.Name{Space: nsDAV, Local: "current-user-principal"}, hrefProp(principalHref(userID))},
+	}
+}
+
+func (h *CalDAVHandler) principalProps(userID int) ([]davProp, error) {
+	var email string
+	if err := h.db.QueryRow(`SELECT email FROM users WHERE id = $1`, userID).Scan(&email); err != nil {
+		return nil, err
+	}
+	return []davProp{
+		{xml.Name{Space: nsDAV, Local: "resourcetype"}, "<d:principal/>"},
+		{xml.Name{Space: nsDAV, Local: "displayname"}, xmlEscape(email)},
+		{xml.Name{Space: nsDAV, Local: "current-user-principal"}, hrefProp(principalHref(userID))},
+		{xml.Name{Space: nsDAV, Local: "principal-URL"}, hrefProp(principalHref(userID))},
+		{xml.Name{Space: nsCalDAV, Local: "calendar-home-set"}, hrefProp(homeHref(userID))},
+		{xml.Name{Space: nsCalDAV, Local: "calendar-user-address-set"}, hrefProp("mailto:" + email)},
+	}, nil
+}
+
+func (h *CalDAVHandler) homeProps(userID int) []davProp {
+	return []davProp{
+		{xml.Name{Space: nsDAV, Local: "resourcetype"}, "<d:collection/>"},
+		{xml.Name{Space: nsDAV, Local: "current-user-principal"}, hrefProp(principalHref(userID))},
+		{xml.Name{Space: nsDAV, Local: "owner"}, hrefProp(principalHref(userID))},
+	}
+}
+
+func (h *CalDAVHandler) calendarProps(userID int, category string) ([]davProp, error) {
+	token, err := h.syncToken(userID)
+	if err != nil {
+		return nil, err
+	}
+	return []davProp{
+		{xml.Name{Space: nsDAV, Local: "resourcetype"}, "<d:collection/><c:calendar/>"},
+		{xml.Name{Space: nsDAV, Local: "displayname"}, xmlEscape(category)},
+		{xml.Name{Space: nsDAV, Local: "current-user-principal"}, hrefProp(principalHref(userID))},
+		{xml.Name{Space: nsDAV, Local: "owner"}, hrefProp(principalHref(userID))},
+		{xml.Name{Space: nsDAV, Local: "sync-token"}, xmlEscape(token)},
+		{xml.Name{Space: nsCS, Local: "getctag"}, xmlEscape(token)},
+		{xml.Name{Space: nsCalDAV, Local: "supported-calendar-component-set"}, `<c:comp name="VTODO"/>`},
+		{xml.Name{Space: nsDAV, Local: "supported-report-set"},
+			"<d:supported-report><d:report><c:calendar-query/></d:report></d:supported-report>" +
+				"<d:supported-report><d:report><c:calendar-multiget/></d:report></d:supported-report>" +
+				"<d:supported-report><d:report><d:sync-collection/></d:report></d:supported-report>"},
+		{xml.Name{Space: nsDAV, Local: "current-user-privilege-set"},
+			"<d:privilege><d:read/></d:privilege><d:privilege><d:write/></d:privilege>" +
+				"<d:privilege><d:write-content/></d:privilege><d:privilege><d:bind/></d:privilege>" +
+				"<d:privilege><d:unbind/></d:privilege>"},
+	}, nil
+}
+
+// taskProps lists the properties of a task resource, optionally with its calendar data
+func taskProps(d davTask, withData bool) []davProp {
+	props := []davProp{
+		{xml.Name{Space: nsDAV, Local: "resourcetype"}, ""},
+		{xml.Name{Space: nsDAV, Local: "getetag"}, xmlEscape(d.etag())},
+		{xml.Name{Space: nsDAV, Local: "getcontenttype"}, "text/calendar; charset=utf-8; component=VTODO"},
+		{xml.Name{Space: nsDAV, Local: "getlastmodified"}, d.task.UpdatedAt.UTC().Format(http.TimeFormat)},
+	}
+	if withData {
+		props = append(props, davProp{xml.Name{Space: nsCalDAV, Local: "calendar-data"}, xmlEscape(d.calendarData())})
+	}
+	return props
+}
+
+// todoFields holds the task fields read from a VTODO
+type todoFields struct {
+	uid         string
+	title       string
+	description string
+	status      string // NEEDS-ACTION, IN-PROCESS or COMPLETED
+	priority    string // empty when the VTODO has no priority
+	dueDate     *time.Time
+}
+
+// workflowStatus picks the workflow state for a VTODO status. A task keeps
+// its current state while that still maps to the same VTODO status, so
+// clients that only know the iCalendar values don't undo custom states.
+func workflowStatus(wf *models.Workflow, vtodoStatus, current string) string {
+	known := current != "" && wf.HasState(current)
+	if known && icalStatus(current, wf.IsDone(current)) == vtodoStatus {
+		return current
+	}
+	switch vtodoStatus {
+	case "COMPLETED":
+		return wf.DoneState()
+	case "IN-PROCESS":
+		if wf.HasState("in_progress") && !wf.IsDone("in_progress") {
+			return "in_progress"
+		}
+		if known && !wf.IsDone(current) {
+			return current
+		}
+	}
+	return wf.InitialState()
+}
+
+// vtodoFields maps a VTODO's properties onto task fields
+func vtodoFields(todo *ical.Component) (todoFields, error) {
+	var f todoFields
+	if p := todo.Get("UID"); p != nil {
+		f.uid = p.Text()
+	}
+	if p := todo.Get("SUMMARY"); p != nil {
+		f.title = strings.TrimSpace(p.Text())
+	}
+	if p := todo.Get("DESCRIPTION"); p != nil {
+		f.description = p.Text()
+	}
+
+	f.status = "NEEDS-ACTION"
+	if p := todo.Get("STATUS"); p != nil {
+		switch v := strings.ToUpper(p.Value); v {
+		case "COMPLETED", "IN-PROCESS":
+			f.status = v
+		}
+	} else if todo.Get("COMPLETED") != nil {
+		f.status = "COMPLETED"
+	}
+
+	if p := todo.Get("PRIORITY"); p != nil {
+		switch n, _ := strconv.Atoi(strings.TrimSpace(p.Value)); {
+		case n >= 1 && n <= 4:
+			f.priority = "high"
+		case n == 5:
+			f.priority = "medium"
+		case n >= 6 && n <= 9:
+			f.priority = "low"
+		}
+	}
+
+	if p := todo.Get("DUE"); p != nil {
+		due, err := p.Time(time.UTC)
+		if err != nil {
+			return f, err
+		}
+		f.dueDate = &due
+	}
+	return f, nil
+}
+
+// hrefPath extracts the path from an href that may be an absolute URL
+func hrefPath(href string) string {
+	if u, err := url.Parse(href); err == nil {
+		return u.EscapedPath()
+	}
+	return href
+}
+
+// sortedCategories returns the task categories in a stable order
+func sortedCategories() []string {
+	return []string{"Work", "Personal", "Shopping", "Health", "Education"}
+}
@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"task-manager/ical"
+)
+
+// VTODOs as sent by common clients, trimmed to the properties that matter
+const (
+	appleRemindersTodo = "BEGIN:VCALENDAR\r\n" +
+		"VERSION:2.0\r\n" +
+		"PRODID:-//Apple Inc.//iOS 17.4//EN\r\n" +
+		"BEGIN:VTODO\r\n" +
+		"CREATED:20260301T091500Z\r\n" +
+		"DTSTAMP:20260301T091512Z\r\n" +
+		"DUE;TZID=Europe/Berlin:20260310T170000\r\n" +
+		"PRIORITY:1\r\n" +
+		"SEQUENCE:0\r\n" +
+		"SUMMARY:Call the plumber\r\n" +
+		"UID:4B0C1F3E-7F5A-4E2C-9D1A-5C3B2A1F0E9D\r\n" +
+		"X-APPLE-SORT-ORDER:762513312\r\n" +
+		"END:VTODO\r\n" +
+		"END:VCALENDAR\r\n"
+
+	thunderbirdTodo = "BEGIN:VCALENDAR\r\n" +
+		"PRODID:-//Mozilla.org/NONSGML Mozilla Calendar V1.1//EN\r\n" +
+		"VERSION:2.0\r\n" +
+		"BEGIN:VTODO\r\n" +
+		"CREATED:20260302T080000Z\r\n" +
+		"LAST-MODIFIED:20260305T101010Z\r\n" +
+		"DTSTAMP:20260305T101010Z\r\n" +
+		"UID:a3f6c2d0-91b4-4c5e-8f7a-2b9d1e0c4a5f\r\n" +
+		"SUMMARY:Quarterly report\\, draft\r\n" +
+		"PRIORITY:5\r\n" +
+		"STATUS:IN-PROCESS\r\n" +
+		"PERCENT-COMPLETE:40\r\n" +
+		"DUE;VALUE=DATE:20260331\r\n" +
+		"DESCRIPTION:Numbers from finance\\; charts from marketing.\\nSend to the \r\n" +
+		" board by Friday.\r\n" +
+		"END:VTODO\r\n" +
+		"END:VCALENDAR\r\n"
+
+	tasksOrgTodo = "BEGIN:VCALENDAR\r\n" +
+		"VERSION:2.0\r\n" +
+		"PRODID:+//IDN tasks.org//android-130204//EN\r\n" +
+		"BEGIN:VTODO\r\n" +
+		"DTSTAMP:20260306T120000Z\r\n" +
+		"UID:6253934817375104461\r\n" +
+		"CREATED:20260303T070000Z\r\n" +
+		"LAST-MODIFIED:20260306T120000Z\r\n" +
+		"SUMMARY:  Water the plants  \r\n" +
+		"PRIORITY:9\r\n" +
+		"COMPLETED:20260306T115959Z\r\n" +
+		"DUE:20260306T100000Z\r\n" +
+		"END:VTODO\r\n" +
+		"END:VCALENDAR\r\n"
+)
+
+func TestVTODOFieldsClients(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("time zone data not available")
+	}
+	due := func(t time.Time) *time.Time { return &t }
+	tests := []struct {
+		name string
+		src  string
+		want todoFields
+	}{
+		{"Apple Reminders", appleRemindersTodo, todoFields{
+			uid:      "4B0C1F3E-7F5A-4E2C-9D1A-5C3B2A1F0E9D",
+			title:    "Call the plumber",
+			status:   "NEEDS-ACTION",
+			priority: "high",
+			dueDate:  due(time.Date(2026, 3, 10, 17, 0, 0, 0, berlin)),
+		}},
+		{"Thunderbird", thunderbirdTodo, todoFields{
+			uid:         "a3f6c2d0-91b4-4c5e-8f7a-2b9d1e0c4a5f",
+			title:       "Quarterly report, draft",
+			description: "Numbers from finance; charts from marketing.\nSend to the board by Friday.",
+			status:      "IN-PROCESS",
+			priority:    "medium",
+			dueDate:     due(time.Date(2026, 3, 31, 0, 0, 0, 0, time.UTC)),
+		}},
+		{"Tasks.org", tasksOrgTodo, todoFields{
+			uid:      "6253934817375104461",
+			title:    "Water the plants",
+			status:   "COMPLETED",
+			priority: "low",
+			dueDate:  due(time.Date(2026, 3, 6, 10, 0, 0, 0, time.UTC)),
+		}},
+	}
+	for _, tt := range tests {
+		cal, err := ical.Decode(strings.NewReader(tt.src))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		got, err := vtodoFields(cal.Find("VTODO"))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got.uid != tt.want.uid || got.title != tt.want.title || got.description != tt.want.description ||
+			got.status != tt.want.status || got.priority != tt.want.priority {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+		if got.dueDate == nil || !got.dueDate.Equal(*tt.want.dueDate) {
+			t.Errorf("%s: due %v, want %v", tt.name, got.dueDate, tt.want.dueDate)
+		}
+	}
+}
+
+func TestVTODOFieldsStatusAndPriority(t *testing.T) {
+	tests := []struct {
+		props    string
+		status   string
+		priority string
+	}{
+		{"", "NEEDS-ACTION", ""},
+		{"STATUS:NEEDS-ACTION\r\n", "NEEDS-ACTION", ""},
+		{"STATUS:completed\r\n", "COMPLETED", ""},
+		{"STATUS:IN-PROCESS\r\n", "IN-PROCESS", ""},
+		{"STATUS:CANCELLED\r\n", "NEEDS-ACTION", ""},
+		{"STATUS:NEEDS-ACTION\r\nCOMPLETED:20260306T115959Z\r\n", "NEEDS-ACTION", ""},
+		{"COMPLETED:20260306T115959Z\r\n", "COMPLETED", ""},
+		{"PRIORITY:0\r\n", "NEEDS-ACTION", ""},
+		{"PRIORITY:4\r\n", "NEEDS-ACTION", "high"},
+		{"PRIORITY:5\r\n", "NEEDS-ACTION", "medium"},
+		{"PRIORITY:6\r\n", "NEEDS-ACTION", "low"},
+		{"PRIORITY:10\r\n", "NEEDS-ACTION", ""},
+		{"PRIORITY:high\r\n", "NEEDS-ACTION", ""},
+	}
+	for _, tt := range tests {
+		src := "BEGIN:VTODO\r\nUID:x\r\nSUMMARY:Task\r\n" + tt.props + "END:VTODO\r\n"
+		todo, err := ical.Decode(strings.NewReader(src))
+		if err != nil {
+			t.Fatalf("%q: %v", tt.props, err)
+		}
+		got, err := vtodoFields(todo)
+		if err != nil {
+			t.Fatalf("%q: %v", tt.props, err)
+		}
+		if got.status != tt.status || got.priority != tt.priority {
+			t.Errorf("%q: got %s/%q, want %s/%q", tt.props, got.status, got.priority, tt.status, tt.priority)
+		}
+		if got.dueDate != nil {
+			t.Errorf("%q: unexpected due date %v", tt.props, got.dueDate)
+		}
+	}
+}
+
+func TestVTODOFieldsInvalidDue(t *testing.T) {
+	src := "BEGIN:VTODO\r\nUID:x\r\nSUMMARY:Task\r\nDUE:next friday\r\nEND:VTODO\r\n"
+	todo, err := ical.Decode(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := vtodoFields(todo); err == nil {
+		t.Error("expected an error for an unparseable DUE")
+	}
+}
@@ -0,0 +1,294 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"task-manager/ical"
+	"task-manager/models"
+)
+
+// calendarProductID identifies this server in generated calendars
+const calendarProductID = "-//Task Manager//Tasks//EN"
+
+type CalendarHandler struct {
+	db *sql.DB
+}
+
+func NewCalendarHandler(db *sql.DB) *CalendarHandler {
+	return &CalendarHandler{db: db}
+}
+
+// GetFeedURL returns the authenticated user's secret calendar feed URL,
+// creating the secret the first time it is requested
+func (h *CalendarHandler) GetFeedURL(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var token sql.NullString
+	if err := h.db.QueryRow(`SELECT calendar_token FROM users WHERE id = $1`, userID).Scan(&token); err != nil {
+		http.Error(w, "Error fetching calendar feed", http.StatusInternalServerError)
+		return
+	}
+	if !token.Valid {
+		newToken, err := h.setFeedToken(userID, false)
+		if err != nil {
+			log.Printf("Error creating calendar token: %v", err)
+			http.Error(w, "Error creating calendar feed", http.StatusInternalServerError)
+			return
+		}
+		token = sql.NullString{String: newToken, Valid: true}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(feedURLResponse(r, token.String))
+}
+
+// RotateFeedURL replaces the secret in the feed URL, invalidating the old one
+func (h *CalendarHandler) RotateFeedURL(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	token, err := h.setFeedToken(userID, true)
+	if err != nil {
+		log.Printf("Error rotating calendar token: %v", err)
+		http.Error(w, "Error rotating calendar feed", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(feedURLResponse(r, token))
+}
+
+// setFeedToken stores a new random token. Unless replace is set, an existing
+// token (for example one created by a concurrent request) is kept and returned.
+func (h *CalendarHandler) setFeedToken(userID int, replace bool) (string, error) {
+	token, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	err = h.db.QueryRow(`
+		UPDATE users
+		SET calendar_token = CASE WHEN $3 OR calendar_token IS NULL THEN $1 ELSE calendar_token END
+		WHERE id = $2
+		RETURNING calendar_token
+	`, token, userID, replace).Scan(&token)
+	return token, err
+}
+
+// Feed serves the iCalendar feed identified by the secret token in the URL.
+// Tasks with due dates become VTODO entries; with ?events=true a VEVENT is
+// also produced at each due date. Responses carry an ETag, a hash of the
+// rendered feed, so clients can poll with If-None-Match.
+func (h *CalendarHandler) Feed(w http.ResponseWriter, r *http.Request) {
+	token := mux.Vars(r)["token"]
+	includeEvents := r.URL.Query().Get("events") == "true"
+
+	var userID int
+	err := h.db.QueryRow(`SELECT id FROM users WHERE calendar_token = $1`, token).Scan(&userID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Calendar not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error fetching calendar", http.StatusInternalServerError)
+		return
+	}
+
+	rows, err := h.db.Query(`
+		SELECT `+taskColumns+`
+		FROM tasks t
+		WHERE t.user_id = $1 AND t.is_deleted = false AND t.due_date IS NOT NULL
+		ORDER BY t.due_date
+	`, userID)
+	if err != nil {
+		http.Error(w, "Error fetching tasks", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	// Entries are stamped with their last change rather than the time of the
+	// request, as RFC 5545 asks of calendars without a METHOD, so the same
+	// tasks always render the same feed
+	cal := newCalendar("Tasks")
+	for rows.Next() {
+		task, err := scanTask(rows)
+		if err != nil {
+			http.Error(w, "Error scanning task", http.StatusInternalServerError)
+			return
+		}
+		cal.Components = append(cal.Components, taskToVTODO(&task, task.UpdatedAt))
+		if includeEvents {
+			cal.Components = append(cal.Components, taskToVEVENT(&task, task.UpdatedAt))
+		}
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "Error fetching tasks", http.StatusInternalServerError)
+		return
+	}
+
+	var body bytes.Buffer
+	if err := ical.Encode(&body, cal); err != nil {
+		log.Printf("Error rendering calendar feed: %v", err)
+		http.Error(w, "Error rendering calendar", http.StatusInternalServerError)
+		return
+	}
+	sum := sha256.Sum256(body.Bytes())
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "private, max-age=0, must-revalidate")
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Write(body.Bytes())
+}
+
+// newCalendar creates an empty VCALENDAR
+func newCalendar(name string) *ical.Component {
+	cal := ical.NewComponent("VCALENDAR")
+	cal.Add("VERSION", "2.0")
+	cal.Add("PRODID", calendarProductID)
+	cal.Add("CALSCALE", "GREGORIAN")
+	cal.AddText("X-WR-CALNAME", name)
+	return cal
+}
+
+// taskUID returns the iCalendar UID of a task
+func taskUID(task *models.Task) string {
+	return "task-" + strconv.Itoa(task.ID) + "@task-manager"
+}
+
+// icalStatus maps a task status onto the VTODO STATUS values; every done
+// state of a workflow is COMPLETED
+func icalStatus(status string, done bool) string {
+	switch {
+	case done:
+		return "COMPLETED"
+	case status == "in_progress":
+		return "IN-PROCESS"
+	default:
+		return "NEEDS-ACTION"
+	}
+}
+
+// icalPriority maps a task priority onto the iCalendar 1 (highest) to 9 (lowest) scale
+func icalPriority(priority string) string {
+	switch priority {
+	case "high":
+		return "1"
+	case "medium":
+		return "5"
+	default:
+		return "9"
+	}
+}
+
+// taskToVTODO converts a task into a VTODO component
+func taskToVTODO(task *models.Task, stamp time.Time) *ical.Component {
+	todo := ical.NewComponent("VTODO")
+	todo.AddText("UID", taskUID(task))
+	todo.AddTime("DTSTAMP", stamp)
+	todo.AddTime("CREATED", task.CreatedAt)
+	todo.AddTime("LAST-MODIFIED", task.UpdatedAt)
+	todo.AddText("SUMMARY", task.Title)
+	if task.Description != "" {
+		todo.AddText("DESCRIPTION", task.Description)
+	}
+	if task.DueDate != nil {
+		todo.AddTime("DUE", *task.DueDate)
+	}
+	todo.Add("STATUS", icalStatus(task.Status, task.CompletedAt != nil))
+	todo.Add("PRIORITY", icalPriority(task.Priority))
+	if task.CompletedAt != nil {
+		todo.Add("PERCENT-COMPLETE", "100")
+		todo.AddTime("COMPLETED", *task.CompletedAt)
+	}
+	todo.Add("CATEGORIES", taskCategories(task))
+	return todo
+}
+
+// taskToVEVENT converts a task with a due date into a short VEVENT at that time
+func taskToVEVENT(task *models.Task, stamp time.Time) *ical.Component {
+	event := ical.NewComponent("VEVENT")
+	event.AddText("UID", "event-"+taskUID(task))
+	event.AddTime("DTSTAMP", stamp)
+	event.AddTime("DTSTART", *task.DueDate)
+	event.Add("DURATION", "PT30M")
+	event.AddText("SUMMARY", task.Title)
+	if task.Description != "" {
+		event.AddText("DESCRIPTION", task.Description)
+	}
+	event.Add("TRANSP", "TRANSPARENT")
+	event.Add("CATEGORIES", taskCategories(task))
+	return event
+}
+
+// taskCategories lists a task's category followed by its tags as a CATEGORIES value
+func taskCategories(task *models.Task) string {
+	values := []string{ical.EscapeText(task.Category)}
+	for _, tag := range task.Tags {
+		values = append(values, ical.EscapeText(tag))
+	}
+	return strings.Join(values, ",")
+}
+
+// etagMatches reports whether an If-None-Match or If-Match header lists the ETag
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// feedURLResponse builds the JSON body describing a feed URL
+func feedURLResponse(r *http.Request, token string) map[string]string {
+	return map[string]string{
+		"url": publicBaseURL(r) + "/api/calendar/" + token + ".ics",
+	}
+}
+
+// publicBaseURL returns the externally visible base URL of this server,
+// taken from PUBLIC_URL or else from the request
+func publicBaseURL(r *http.Request) string {
+	if base := os.Getenv("PUBLIC_URL"); base != "" {
+		return strings.TrimSuffix(base, "/")
+	}
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// randomToken returns a URL-safe random secret
+func randomToken() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
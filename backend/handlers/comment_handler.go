@@ -0,0 +1,394 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"task-manager/markdown"
+	"task-manager/models"
+)
+
+const maxCommentLength = 10000
+
+type CommentHandler struct {
+	db *sql.DB
+}
+
+func NewCommentHandler(db *sql.DB) *CommentHandler {
+	return &CommentHandler{db: db}
+}
+
+// GetComments lists the comments on a task, oldest first
+func (h *CommentHandler) GetComments(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	taskID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid task ID", http.StatusBadRequest)
+		return
+	}
+
+	exists, err := taskBelongsToUser(h.db, taskID, userID)
+	if err != nil {
+		http.Error(w, "Error checking task existence", http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "Task not found", http.StatusNotFound)
+		return
+	}
+
+	rows, err := h.db.Query(`
+		SELECT c.id, c.task_id, COALESCE(c.user_id, 0), COALESCE(u.email, ''),
+		       c.body, c.body_html, c.created_at, c.updated_at, c.edited_at
+		FROM task_comments c
+		LEFT JOIN users u ON u.id = c.user_id
+		WHERE c.task_id = $1 AND c.is_deleted = false
+		ORDER BY c.created_at ASC, c.id ASC
+	`, taskID)
+	if err != nil {
+		http.Error(w, "Error fetching comments", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	comments := []models.Comment{}
+	for rows.Next() {
+		comment, err := scanComment(rows)
+		if err != nil {
+			http.Error(w, "Error scanning comment", http.StatusInternalServerError)
+			return
+		}
+		comments = append(comments, comment)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(comments)
+}
+
+// CreateComment adds a comment to a task
+func (h *CommentHandler) CreateComment(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	taskID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid task ID", http.StatusBadRequest)
+		return
+	}
+
+	var commentCreate models.CommentCreate
+	if err := json.NewDecoder(r.Body).Decode(&commentCreate); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if msg := validateCommentBody(commentCreate.Body); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		http.Error(w, "Error starting transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	exists, err := taskBelongsToUser(tx, taskID, userID)
+	if err != nil {
+		http.Error(w, "Error checking task existence", http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "Task not found", http.StatusNotFound)
+		return
+	}
+
+	var commentID int
+	err = tx.QueryRow(`
+		INSERT INTO task_comments (task_id, user_id, body, body_html)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id
+	`, taskID, userID, commentCreate.Body, markdown.Render(commentCreate.Body)).Scan(&commentID)
+	if err != nil {
+		log.Printf("Error creating comment: %v", err)
+		http.Error(w, "Error creating comment", http.StatusInternalServerError)
+		return
+	}
+
+	comment, err := getComment(tx, taskID, commentID)
+	if err != nil {
+		http.Error(w, "Error fetching comment", http.StatusInternalServerError)
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		http.Error(w, "Error committing transaction", http.StatusInternalServerError)
+		return
+	}
+
+	comment.Mentions = markdown.Mentions(commentCreate.Body)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(comment)
+}
+
+// UpdateComment edits a comment, keeping the previous body in its history.
+// Only the author may edit a comment.
+func (h *CommentHandler) UpdateComment(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	taskID, commentID, err := commentRouteIDs(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var commentUpdate models.CommentUpdate
+	if err := json.NewDecoder(r.Body).Decode(&commentUpdate); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if msg := validateCommentBody(commentUpdate.Body); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		http.Error(w, "Error starting transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	exists, err := taskBelongsToUser(tx, taskID, userID)
+	if err != nil {
+		http.Error(w, "Error checking task existence", http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "Task not found", http.StatusNotFound)
+		return
+	}
+
+	var authorID sql.NullInt64
+	var oldBody string
+	err = tx.QueryRow(`
+		SELECT user_id, body FROM task_comments
+		WHERE id = $1 AND task_id = $2 AND is_deleted = false
+		FOR UPDATE
+	`, commentID, taskID).Scan(&authorID, &oldBody)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Comment not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error fetching comment", http.StatusInternalServerError)
+		return
+	}
+	if !authorID.Valid || int(authorID.Int64) != userID {
+		http.Error(w, "Only the author can edit a comment", http.StatusForbidden)
+		return
+	}
+
+	if oldBody != commentUpdate.Body {
+		_, err = tx.Exec(`
+			INSERT INTO task_comment_edits (comment_id, body, edited_by)
+			VALUES ($1, $2, $3)
+		`, commentID, oldBody, userID)
+		if err != nil {
+			log.Printf("Error saving comment history: %v", err)
+			http.Error(w, "Error saving comment history", http.StatusInternalServerError)
+			return
+		}
+
+		_, err = tx.Exec(`
+			UPDATE task_comments
+			SET body = $1, body_html = $2, edited_at = CURRENT_TIMESTAMP
+			WHERE id = $3
+		`, commentUpdate.Body, markdown.Render(commentUpdate.Body), commentID)
+		if err != nil {
+			log.Printf("Error updating comment: %v", err)
+			http.Error(w, "Error updating comment", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	comment, err := getComment(tx, taskID, commentID)
+	if err != nil {
+		http.Error(w, "Error fetching comment", http.StatusInternalServerError)
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		http.Error(w, "Error committing transaction", http.StatusInternalServerError)
+		return
+	}
+
+	comment.Mentions = markdown.Mentions(commentUpdate.Body)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(comment)
+}
+
+// DeleteComment soft deletes a comment
+func (h *CommentHandler) DeleteComment(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	taskID, commentID, err := commentRouteIDs(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	exists, err := taskBelongsToUser(h.db, taskID, userID)
+	if err != nil {
+		http.Error(w, "Error checking task existence", http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "Task not found", http.StatusNotFound)
+		return
+	}
+
+	result, err := h.db.Exec(`
+		UPDATE task_comments
+		SET is_deleted = true
+		WHERE id = $1 AND task_id = $2 AND user_id = $3 AND is_deleted = false
+	`, commentID, taskID, userID)
+	if err != nil {
+		log.Printf("Error deleting comment: %v", err)
+		http.Error(w, "Error deleting comment", http.StatusInternalServerError)
+		return
+	}
+	if rowsAffected, err := result.RowsAffected(); err != nil || rowsAffected == 0 {
+		http.Error(w, "Comment not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetCommentHistory lists the previous revisions of a comment, newest first
+func (h *CommentHandler) GetCommentHistory(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	taskID, commentID, err := commentRouteIDs(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	exists, err := taskBelongsToUser(h.db, taskID, userID)
+	if err != nil {
+		http.Error(w, "Error checking task existence", http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "Task not found", http.StatusNotFound)
+		return
+	}
+
+	rows, err := h.db.Query(`
+		SELECT e.id, e.comment_id, e.body, COALESCE(e.edited_by, 0), e.edited_at
+		FROM task_comment_edits e
+		JOIN task_comments c ON c.id = e.comment_id
+		WHERE e.comment_id = $1 AND c.task_id = $2 AND c.is_deleted = false
+		ORDER BY e.edited_at DESC, e.id DESC
+	`, commentID, taskID)
+	if err != nil {
+		http.Error(w, "Error fetching comment history", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	edits := []models.CommentEdit{}
+	for rows.Next() {
+		var edit models.CommentEdit
+		if err := rows.Scan(&edit.ID, &edit.CommentID, &edit.Body, &edit.EditedBy, &edit.EditedAt); err != nil {
+			http.Error(w, "Error scanning comment history", http.StatusInternalServerError)
+			return
+		}
+		edits = append(edits, edit)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(edits)
+}
+
+// commentRouteIDs parses the task and comment IDs from the request path
+func commentRouteIDs(r *http.Request) (int, int, error) {
+	vars := mux.Vars(r)
+	taskID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		return 0, 0, fmt.Errorf("Invalid task ID")
+	}
+	commentID, err := strconv.Atoi(vars["commentId"])
+	if err != nil {
+		return 0, 0, fmt.Errorf("Invalid comment ID")
+	}
+	return taskID, commentID, nil
+}
+
+// validateCommentBody returns an error message if the body is unacceptable
+func validateCommentBody(body string) string {
+	if strings.TrimSpace(body) == "" {
+		return "Comment body is required"
+	}
+	if len(body) > maxCommentLength {
+		return fmt.Sprintf("Comment body must be at most %d characters long", maxCommentLength)
+	}
+	return ""
+}
+
+// getComment loads a single comment with its author
+func getComment(q queryer, taskID, commentID int) (models.Comment, error) {
+	row := q.QueryRow(`
+		SELECT c.id, c.task_id, COALESCE(c.user_id, 0), COALESCE(u.email, ''),
+		       c.body, c.body_html, c.created_at, c.updated_at, c.edited_at
+		FROM task_comments c
+		LEFT JOIN users u ON u.id = c.user_id
+		WHERE c.id = $1 AND c.task_id = $2 AND c.is_deleted = false
+	`, commentID, taskID)
+	return scanComment(row)
+}
+
+// scanComment reads a comment from a row produced by the comment queries above
+func scanComment(row interface{ Scan(...interface{}) error }) (models.Comment, error) {
+	var comment models.Comment
+	var editedAt sql.NullTime
+	err := row.Scan(
+		&comment.ID, &comment.TaskID, &comment.AuthorID, &comment.AuthorEmail,
+		&comment.Body, &comment.BodyHTML, &comment.CreatedAt, &comment.UpdatedAt, &editedAt,
+	)
+	if err != nil {
+		return comment, err
+	}
+	if editedAt.Valid {
+		comment.EditedAt = &editedAt.Time
+	}
+	return comment, nil
+}
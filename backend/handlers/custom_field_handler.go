@@ -0,0 +1,548 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+	"task-manager/models"
+)
+
+const (
+	maxCustomFieldOptions = 100
+	maxCustomTextLength   = 1000
+)
+
+const customFieldColumns = `id, COALESCE(category, ''), key, name, type, options, required, created_at, updated_at`
+
+func scanCustomField(row interface{ Scan(...interface{}) error }) (models.CustomField, error) {
+	var f models.CustomField
+	var createdAt, updatedAt sql.NullTime
+	err := row.Scan(&f.ID, &f.Category, &f.Key, &f.Name, &f.Type, pq.Array(&f.Options), &f.Required, &createdAt, &updatedAt)
+	f.CreatedAt = nullTimePtr(createdAt)
+	f.UpdatedAt = nullTimePtr(updatedAt)
+	return f, err
+}
+
+// loadCustomFields returns the user's custom field definitions by key
+func loadCustomFields(q queryer, userID int) (map[string]models.CustomField, error) {
+	rows, err := q.Query(`SELECT `+customFieldColumns+` FROM custom_fields WHERE user_id = $1`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	fields := make(map[string]models.CustomField)
+	for rows.Next() {
+		f, err := scanCustomField(rows)
+		if err != nil {
+			return nil, err
+		}
+		fields[f.Key] = f
+	}
+	return fields, rows.Err()
+}
+
+// customFieldValues applies changes to a task's custom field values and
+// returns the result. Every field with a value must apply to the task's
+// category, so a task keeping values can't move to a category without
+// those fields, and every value must suit its field; a nil value clears a
+// field. New tasks must have a value for each required field of their
+// category.
+func customFieldValues(q queryer, userID int, category string, current, changes map[string]interface{}, creating bool) (map[string]interface{}, error) {
+	values := make(map[string]interface{}, len(current)+len(changes))
+	for key, v := range current {
+		values[key] = v
+	}
+	if len(values) == 0 && len(changes) == 0 && !creating {
+		return values, nil
+	}
+
+	fields, err := loadCustomFields(q, userID)
+	if err != nil {
+		return nil, err
+	}
+	for key, v := range changes {
+		f, ok := fields[key]
+		if ok && v == nil {
+			if f.Required && f.AppliesTo(category) {
+				return nil, &taskRuleError{fmt.Sprintf("Custom field %q is required", key)}
+			}
+			delete(values, key)
+			continue
+		}
+		if !ok || !f.AppliesTo(category) {
+			return nil, &taskRuleError{fmt.Sprintf("Unknown custom field %q for category %s", key, category)}
+		}
+		normalized, err := customFieldValue(userID, &f, v)
+		if err != nil {
+			return nil, err
+		}
+		values[key] = normalized
+	}
+
+	for key := range values {
+		if f, ok := fields[key]; ok && !f.AppliesTo(category) {
+			return nil, &taskRuleError{fmt.Sprintf("Custom field %q isn't available in category %s; clear it first", key, category)}
+		}
+	}
+	if creating {
+		for key, f := range fields {
+			if _, ok := values[key]; f.Required && f.AppliesTo(category) && !ok {
+				return nil, &taskRuleError{fmt.Sprintf("Custom field %q is required", key)}
+			}
+		}
+	}
+	return values, nil
+}
+
+// customFieldValue checks a value decoded from JSON against its field and
+// returns it in the form it is stored in. Tasks aren't shared, so the only
+// user a user field may name is the task's owner.
+func customFieldValue(userID int, f *models.CustomField, v interface{}) (interface{}, error) {
+	invalid := func(expected string) error {
+		return &taskRuleError{fmt.Sprintf("Custom field %q must be %s", f.Key, expected)}
+	}
+
+	switch f.Type {
+	case "text":
+		s, ok := v.(string)
+		if !ok || len(s) > maxCustomTextLength {
+			return nil, invalid(fmt.Sprintf("a string of at most %d characters", maxCustomTextLength))
+		}
+		return s, nil
+	case "number":
+		n, ok := v.(float64)
+		if !ok || math.IsInf(n, 0) || math.IsNaN(n) {
+			return nil, invalid("a number")
+		}
+		return n, nil
+	case "date":
+		s, ok := v.(string)
+		if !ok {
+			return nil, invalid("a date in YYYY-MM-DD form")
+		}
+		if _, err := time.Parse("2006-01-02", s); err != nil {
+			return nil, invalid("a date in YYYY-MM-DD form")
+		}
+		return s, nil
+	case "select":
+		s, ok := v.(string)
+		if !ok || !hasOption(f, s) {
+			return nil, invalid("one of " + strings.Join(f.Options, ", "))
+		}
+		return s, nil
+	case "multi_select":
+		list, ok := v.([]interface{})
+		if !ok {
+			return nil, invalid("a list of " + strings.Join(f.Options, ", "))
+		}
+		seen := make(map[string]bool)
+		chosen := []interface{}{}
+		for _, item := range list {
+			s, ok := item.(string)
+			if !ok || !hasOption(f, s) {
+				return nil, invalid("a list of " + strings.Join(f.Options, ", "))
+			}
+			if !seen[s] {
+				seen[s] = true
+				chosen = append(chosen, s)
+			}
+		}
+		return chosen, nil
+	case "user":
+		n, ok := v.(float64)
+		if !ok || n != float64(userID) {
+			return nil, invalid("your own user ID")
+		}
+		return userID, nil
+	}
+	return nil, fmt.Errorf("custom field %d has unknown type %s", f.ID, f.Type)
+}
+
+func hasOption(f *models.CustomField, option string) bool {
+	for _, o := range f.Options {
+		if o == option {
+			return true
+		}
+	}
+	return false
+}
+
+// parseCustomFieldFilter turns a ?cf.<key>= query value into a value of the
+// field's type, as stored on tasks
+func parseCustomFieldFilter(f *models.CustomField, raw string) (interface{}, bool) {
+	switch f.Type {
+	case "number":
+		n, err := strconv.ParseFloat(raw, 64)
+		return n, err == nil && !math.IsInf(n, 0) && !math.IsNaN(n)
+	case "date":
+		_, err := time.Parse("2006-01-02", raw)
+		return raw, err == nil
+	case "user":
+		n, err := strconv.Atoi(raw)
+		return n, err == nil
+	}
+	return raw, true
+}
+
+// customFieldQuery adds the ?cf.<key>= filters in params to query and
+// returns the ORDER BY expression for an order of cf.<key> or -cf.<key>
+// (descending). It returns an error message for unknown fields or values
+// that don't suit them.
+func customFieldQuery(q queryer, userID int, query *taskQuery, params url.Values, order string) (string, string, error) {
+	var fields map[string]models.CustomField
+	field := func(key string) (*models.CustomField, error) {
+		if fields == nil {
+			var err error
+			if fields, err = loadCustomFields(q, userID); err != nil {
+				return nil, err
+			}
+		}
+		f, ok := fields[key]
+		if !ok {
+			return nil, nil
+		}
+		return &f, nil
+	}
+
+	for name, values := range params {
+		if !strings.HasPrefix(name, "cf.") {
+			continue
+		}
+		key, op := strings.TrimPrefix(name, "cf."), ""
+		if i := strings.LastIndex(key, "."); i >= 0 {
+			key, op = key[:i], key[i+1:]
+		}
+		f, err := field(key)
+		if err != nil {
+			return "", "", err
+		}
+		if f == nil {
+			return "", "Unknown custom field " + key, nil
+		}
+		switch {
+		case op == "":
+		case op == "gte" || op == "lte":
+			if f.Type != "number" && f.Type != "date" {
+				return "", "Only number and date fields can be filtered with ." + op, nil
+			}
+		default:
+			return "", "Invalid custom field filter " + name + "; use cf.<key>, cf.<key>.gte or cf.<key>.lte", nil
+		}
+		for _, raw := range values {
+			value, ok := parseCustomFieldFilter(f, raw)
+			if !ok {
+				return "", "Invalid value for custom field " + key, nil
+			}
+			query.withCustomField(f, op, value)
+		}
+	}
+
+	if order == "" {
+		return "", "", nil
+	}
+	direction := " ASC"
+	if strings.HasPrefix(order, "-") {
+		order, direction = order[1:], " DESC"
+	}
+	f, err := field(strings.TrimPrefix(order, "cf."))
+	if err != nil {
+		return "", "", err
+	}
+	if f == nil || !strings.HasPrefix(order, "cf.") {
+		return "", "Unknown custom field " + strings.TrimPrefix(order, "cf."), nil
+	}
+	if f.Type == "multi_select" {
+		return "", "Tasks can't be sorted by a multi_select field", nil
+	}
+	return query.customFieldExpr(f) + direction + " NULLS LAST, t.created_at DESC", "", nil
+}
+
+type CustomFieldHandler struct {
+	db *sql.DB
+}
+
+func NewCustomFieldHandler(db *sql.DB) *CustomFieldHandler {
+	return &CustomFieldHandler{db: db}
+}
+
+// GetCustomFields lists the authenticated user's custom fields. ?category=
+// limits the list to the fields available in that category.
+func (h *CustomFieldHandler) GetCustomFields(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	category := r.URL.Query().Get("category")
+	rows, err := h.db.Query(`
+		SELECT `+customFieldColumns+`
+		FROM custom_fields
+		WHERE user_id = $1 AND ($2 = '' OR category IS NULL OR category = $2)
+		ORDER BY category NULLS FIRST, lower(name), id
+	`, userID, category)
+	if err != nil {
+		http.Error(w, "Error fetching custom fields", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	fields := []models.CustomField{}
+	for rows.Next() {
+		f, err := scanCustomField(rows)
+		if err != nil {
+			http.Error(w, "Error scanning custom field", http.StatusInternalServerError)
+			return
+		}
+		fields = append(fields, f)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(fields)
+}
+
+// CreateCustomField defines a new custom field for the authenticated user
+func (h *CustomFieldHandler) CreateCustomField(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var input models.CustomFieldInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if msg := validateCustomFieldInput(&input); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	f, err := scanCustomField(h.db.QueryRow(`
+		INSERT INTO custom_fields (user_id, category, key, name, type, options, required)
+		VALUES ($1, NULLIF($2, ''), $3, $4, $5, $6, $7)
+		RETURNING `+customFieldColumns+`
+	`, userID, input.Category, input.Key, input.Name, input.Type, pq.Array(input.Options), input.Required))
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+		http.Error(w, "A custom field with this key already exists", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Error creating custom field: %v", err)
+		http.Error(w, "Error creating custom field", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(f)
+}
+
+// UpdateCustomField changes a custom field's name, category, options or
+// required flag. Options still in use and categories that would leave
+// values on tasks outside the field's scope are refused.
+func (h *CustomFieldHandler) UpdateCustomField(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	fieldID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid custom field ID", http.StatusBadRequest)
+		return
+	}
+
+	var input models.CustomFieldInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tx, err := beginTaskTx(h.db, userID)
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		http.Error(w, "Error starting transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	current, err := scanCustomField(tx.QueryRow(`
+		SELECT `+customFieldColumns+` FROM custom_fields
+		WHERE id = $1 AND user_id = $2
+		FOR UPDATE
+	`, fieldID, userID))
+	if err == sql.ErrNoRows {
+		http.Error(w, "Custom field not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error fetching custom field", http.StatusInternalServerError)
+		return
+	}
+
+	if input.Key == "" {
+		input.Key = current.Key
+	}
+	if input.Type == "" {
+		input.Type = current.Type
+	}
+	if input.Key != current.Key || input.Type != current.Type {
+		http.Error(w, "The key and type of a custom field can't be changed", http.StatusBadRequest)
+		return
+	}
+	if msg := validateCustomFieldInput(&input); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	// Values must stay within the field's category and options
+	var stranded int
+	err = tx.QueryRow(`
+		SELECT count(*) FROM tasks
+		WHERE user_id = $1 AND custom_fields ? $2
+			AND (($3 <> '' AND category <> $3)
+				OR ($4 AND NOT (custom_fields -> $2 <@ to_jsonb($5::text[]))))
+	`, userID, current.Key, input.Category, input.Type == "select" || input.Type == "multi_select",
+		pq.Array(input.Options)).Scan(&stranded)
+	if err != nil {
+		log.Printf("Error checking custom field values: %v", err)
+		http.Error(w, "Error checking custom field values", http.StatusInternalServerError)
+		return
+	}
+	if stranded > 0 {
+		http.Error(w, fmt.Sprintf("%d tasks have values that the changed field wouldn't allow", stranded), http.StatusConflict)
+		return
+	}
+
+	f, err := scanCustomField(tx.QueryRow(`
+		UPDATE custom_fields
+		SET category = NULLIF($1, ''), name = $2, options = $3, required = $4
+		WHERE id = $5 AND user_id = $6
+		RETURNING `+customFieldColumns+`
+	`, input.Category, input.Name, pq.Array(input.Options), input.Required, fieldID, userID))
+	if err != nil {
+		log.Printf("Error updating custom field: %v", err)
+		http.Error(w, "Error updating custom field", http.StatusInternalServerError)
+		return
+	}
+	if err = tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		http.Error(w, "Error committing transaction", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(f)
+}
+
+// DeleteCustomField removes a custom field and its values from every task
+func (h *CustomFieldHandler) DeleteCustomField(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	fieldID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid custom field ID", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := beginTaskTx(h.db, userID)
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		http.Error(w, "Error starting transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var key string
+	err = tx.QueryRow(`
+		DELETE FROM custom_fields WHERE id = $1 AND user_id = $2
+		RETURNING key
+	`, fieldID, userID).Scan(&key)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Custom field not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error deleting custom field", http.StatusInternalServerError)
+		return
+	}
+	_, err = tx.Exec(`
+		UPDATE tasks SET custom_fields = custom_fields - $2
+		WHERE user_id = $1 AND custom_fields ? $2
+	`, userID, key)
+	if err != nil {
+		log.Printf("Error removing custom field values: %v", err)
+		http.Error(w, "Error removing custom field values", http.StatusInternalServerError)
+		return
+	}
+	if err = tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		http.Error(w, "Error committing transaction", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// validateCustomFieldInput returns an error message if the definition is invalid
+func validateCustomFieldInput(input *models.CustomFieldInput) string {
+	input.Name = strings.TrimSpace(input.Name)
+	switch {
+	case !models.CustomFieldKeyPattern.MatchString(input.Key):
+		return "Key must be lowercase letters, digits and underscores, starting with a letter and at most 40 characters long"
+	case input.Name == "":
+		return "Name is required"
+	case len(input.Name) > 100:
+		return "Name must be at most 100 characters long"
+	case input.Category != "" && !isValidCategory(input.Category):
+		return "Invalid category value"
+	}
+
+	known := false
+	for _, t := range models.CustomFieldTypes {
+		known = known || t == input.Type
+	}
+	if !known {
+		return "Type must be one of " + strings.Join(models.CustomFieldTypes, ", ")
+	}
+
+	if input.Type != "select" && input.Type != "multi_select" {
+		if len(input.Options) > 0 {
+			return "Only select and multi_select fields have options"
+		}
+		input.Options = []string{}
+		return ""
+	}
+	if len(input.Options) == 0 || len(input.Options) > maxCustomFieldOptions {
+		return fmt.Sprintf("Select fields need between 1 and %d options", maxCustomFieldOptions)
+	}
+	seen := make(map[string]bool)
+	for i, o := range input.Options {
+		o = strings.TrimSpace(o)
+		if o == "" || len(o) > 100 {
+			return "Options must be between 1 and 100 characters long"
+		}
+		if seen[o] {
+			return fmt.Sprintf("Option %q is listed twice", o)
+		}
+		seen[o] = true
+		input.Options[i] = o
+	}
+	return ""
+}
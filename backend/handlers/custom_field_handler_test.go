@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+
+	"task-manager/models"
+)
+
+func TestCustomFieldValue(t *testing.T) {
+	const userID = 7
+	fields := map[string]*models.CustomField{
+		"text":   {Key: "notes", Type: "text"},
+		"number": {Key: "points", Type: "number"},
+		"date":   {Key: "launch", Type: "date"},
+		"select": {Key: "team", Type: "select", Options: []string{"Backend", "Frontend"}},
+		"multi":  {Key: "labels", Type: "multi_select", Options: []string{"a", "b"}},
+		"user":   {Key: "owner", Type: "user"},
+	}
+	tests := []struct {
+		field string
+		value interface{}
+		want  interface{}
+		ok    bool
+	}{
+		{"text", "hello", "hello", true},
+		{"text", 3.0, nil, false},
+		{"number", 2.5, 2.5, true},
+		{"number", "2.5", nil, false},
+		{"date", "2026-03-01", "2026-03-01", true},
+		{"date", "2026-02-30", nil, false},
+		{"select", "Backend", "Backend", true},
+		{"select", "backend", nil, false},
+		{"multi", []interface{}{"a", "b", "a"}, []interface{}{"a", "b"}, true},
+		{"multi", []interface{}{"c"}, nil, false},
+		{"user", 7.0, userID, true},
+		{"user", 8.0, nil, false},
+		{"user", 7.5, nil, false},
+		{"user", "7", nil, false},
+		{"user", -7.0, nil, false},
+	}
+	for _, tt := range tests {
+		got, err := customFieldValue(userID, fields[tt.field], tt.value)
+		if tt.ok != (err == nil) {
+			t.Errorf("%s %v: error %v", tt.field, tt.value, err)
+			continue
+		}
+		if err != nil {
+			if _, ok := err.(*taskRuleError); !ok {
+				t.Errorf("%s %v: got %T, want a taskRuleError", tt.field, tt.value, err)
+			}
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s %v: got %v, want %v", tt.field, tt.value, got, tt.want)
+		}
+	}
+}
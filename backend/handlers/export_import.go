@@ -0,0 +1,607 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"task-manager/models"
+)
+
+const (
+	maxImportRows  = 5000
+	maxImportBytes = 10 << 20 // 10 MiB
+)
+
+// exportColumns is the CSV header written by exports and understood by imports
+var exportColumns = []string{
+	"id", "external_id", "title", "description", "status", "priority", "category",
+	"tags", "due_date", "created_at", "updated_at", "completed_at", "deleted", "recurrence",
+	"custom_fields", "estimate_minutes", "parent_id",
+}
+
+// ExportTasks streams all of the user's tasks as csv, json or ndjson.
+// Pass ?include_deleted=true to also export soft-deleted tasks.
+func (h *TaskHandler) ExportTasks(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "json"
+	}
+	if format != "csv" && format != "json" && format != "ndjson" {
+		http.Error(w, "Format must be csv, json or ndjson", http.StatusBadRequest)
+		return
+	}
+	includeDeleted := r.URL.Query().Get("include_deleted") == "true"
+
+	rows, err := h.db.Query(`
+		SELECT `+taskColumns+`, t.is_deleted
+		FROM tasks t
+		WHERE t.user_id = $1 AND (t.is_deleted = false OR $2)
+		ORDER BY t.id
+	`, userID, includeDeleted)
+	if err != nil {
+		http.Error(w, "Error fetching tasks", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	switch format {
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	case "json":
+		w.Header().Set("Content-Type", "application/json")
+	case "ndjson":
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	}
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": "tasks." + format}))
+
+	// Headers are sent with the first row, so errors from here on can only be logged
+	err = writeTaskExport(w, format, func() (*models.TaskExport, error) {
+		if !rows.Next() {
+			return nil, rows.Err()
+		}
+		return scanTaskExport(rows)
+	})
+	if err != nil {
+		log.Printf("Error exporting tasks for user %d: %v", userID, err)
+	}
+}
+
+// writeTaskExport writes tasks returned by next until it returns nil
+func writeTaskExport(w io.Writer, format string, next func() (*models.TaskExport, error)) error {
+	switch format {
+	case "csv":
+		cw := csv.NewWriter(w)
+		if err := cw.Write(exportColumns); err != nil {
+			return err
+		}
+		for {
+			task, err := next()
+			if err != nil || task == nil {
+				cw.Flush()
+				return err
+			}
+			if err := cw.Write(taskCSVRecord(task)); err != nil {
+				return err
+			}
+		}
+	case "ndjson":
+		enc := json.NewEncoder(w)
+		for {
+			task, err := next()
+			if err != nil || task == nil {
+				return err
+			}
+			if err := enc.Encode(task); err != nil {
+				return err
+			}
+		}
+	default:
+		enc := json.NewEncoder(w)
+		io.WriteString(w, "[")
+		for first := true; ; first = false {
+			task, err := next()
+			if err != nil {
+				return err
+			}
+			if task == nil {
+				_, err := io.WriteString(w, "]\n")
+				return err
+			}
+			if !first {
+				io.WriteString(w, ",")
+			}
+			if err := enc.Encode(task); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// scanTaskExport reads a row selected with taskColumns followed by is_deleted
+func scanTaskExport(row interface{ Scan(...interface{}) error }) (*models.TaskExport, error) {
+	var export models.TaskExport
+	var deleted bool
+	task, err := scanTask(scanAppender{row: row, extra: []interface{}{&deleted}})
+	if err != nil {
+		return nil, err
+	}
+	export.Task = task
+	export.Deleted = deleted
+	return &export, nil
+}
+
+// scanAppender adds extra destinations after those passed to Scan
+type scanAppender struct {
+	row   interface{ Scan(...interface{}) error }
+	extra []interface{}
+}
+
+func (s scanAppender) Scan(dest ...interface{}) error {
+	return s.row.Scan(append(dest, s.extra...)...)
+}
+
+// taskCSVRecord formats a task as a CSV record matching exportColumns
+func taskCSVRecord(t *models.TaskExport) []string {
+	formatTime := func(tm *time.Time) string {
+		if tm == nil {
+			return ""
+		}
+		return tm.UTC().Format(time.RFC3339)
+	}
+	return []string{
+		strconv.Itoa(t.ID),
+		t.ExternalID,
+		t.Title,
+		t.Description,
+		t.Status,
+		t.Priority,
+		t.Category,
+		strings.Join(t.Tags, ","),
+		formatTime(t.DueDate),
+		formatTime(&t.CreatedAt),
+		formatTime(&t.UpdatedAt),
+		formatTime(t.CompletedAt),
+		strconv.FormatBool(t.Deleted),
+		t.Recurrence,
+		customFieldsText(t.CustomFields), // a JSON object
+		formatEstimate(t.EstimateMinutes),
+		formatID(t.ParentID),
+	}
+}
+
+func formatEstimate(minutes *int) string {
+	if minutes == nil {
+		return ""
+	}
+	return strconv.Itoa(*minutes)
+}
+
+func formatID(id *int) string {
+	if id == nil {
+		return ""
+	}
+	return strconv.Itoa(*id)
+}
+
+// importRow is a parsed row waiting to be imported
+type importRow struct {
+	row      int
+	task     models.TaskCreate
+	id       int  // the task's ID where it was exported from, if known
+	parentID *int // the exported ID of its parent, another row of the import
+	deleted  bool // the task was exported from the trash and goes back there
+	err      string
+}
+
+// importParent maps a row's exported parent ID onto the task created for
+// that parent earlier in the import. A parent that isn't in the import, or
+// wasn't created, leaves the task without one.
+func importParent(row importRow, created map[int]int) *int {
+	if row.parentID == nil {
+		return nil
+	}
+	id, ok := created[*row.parentID]
+	if !ok {
+		return nil
+	}
+	return &id
+}
+
+// ImportTasks creates tasks from an uploaded csv, json or ndjson document.
+// The format comes from ?format= or the Content-Type header. Each row is
+// validated like CreateTask input; rows whose external_id already exists are
+// skipped. With ?dry_run=true nothing is saved but the report is the same.
+func (h *TaskHandler) ImportTasks(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		switch mediaType {
+		case "text/csv":
+			format = "csv"
+		case "application/x-ndjson", "application/jsonl":
+			format = "ndjson"
+		default:
+			format = "json"
+		}
+	}
+
+	body := http.MaxBytesReader(w, r.Body, maxImportBytes)
+	var rows []importRow
+	var err error
+	switch format {
+	case "csv":
+		rows, err = parseCSVImport(body)
+	case "json":
+		rows, err = parseJSONImport(body)
+	case "ndjson":
+		rows, err = parseNDJSONImport(body)
+	default:
+		http.Error(w, "Format must be csv, json or ndjson", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			http.Error(w, "Import file is too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Invalid import file: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	h.runImport(w, userID, rows, r.URL.Query().Get("dry_run") == "true")
+}
+
+// runImport validates and inserts rows in one transaction and writes the report.
+// Each row runs inside a savepoint so one bad row doesn't abort the others.
+// Rows without a priority or category get the user's defaults, and rows
+// marked deleted are imported into the trash.
+func (h *TaskHandler) runImport(w http.ResponseWriter, userID int, rows []importRow, dryRun bool) {
+	if len(rows) > maxImportRows {
+		http.Error(w, fmt.Sprintf("At most %d rows can be imported at once", maxImportRows), http.StatusRequestEntityTooLarge)
+		return
+	}
+	profile, err := loadProfile(h.db, userID)
+	if err != nil {
+		http.Error(w, "Error loading profile", http.StatusInternalServerError)
+		return
+	}
+
+	tx, err := beginTaskTx(h.db, userID)
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		http.Error(w, "Error starting transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	report := models.ImportReport{DryRun: dryRun, Total: len(rows), Rows: make([]models.ImportRowResult, 0, len(rows))}
+	seen := make(map[string]bool)
+	created := make(map[int]int) // exported IDs to the IDs of the tasks created for them
+	var trashed []int
+	for _, row := range rows {
+		result := models.ImportRowResult{Row: row.row, ExternalID: row.task.ExternalID}
+		row.task.ParentID = importParent(row, created)
+		if row.err == "" {
+			applyProfileDefaults(&row.task, profile)
+			row.err = validateTaskCreate(&row.task)
+		}
+		if row.err != "" {
+			result.Status, result.Error = "invalid", row.err
+			report.Invalid++
+			report.Rows = append(report.Rows, result)
+			continue
+		}
+
+		if id := row.task.ExternalID; id != "" {
+			duplicate := seen[id]
+			if !duplicate {
+				err := tx.QueryRow(`
+					SELECT EXISTS(SELECT 1 FROM tasks WHERE user_id = $1 AND external_id = $2)
+				`, userID, id).Scan(&duplicate)
+				if err != nil {
+					http.Error(w, "Error checking for duplicates", http.StatusInternalServerError)
+					return
+				}
+			}
+			seen[id] = true
+			if duplicate {
+				result.Status = "duplicate"
+				report.Duplicate++
+				report.Rows = append(report.Rows, result)
+				continue
+			}
+		}
+
+		if _, err := tx.Exec("SAVEPOINT import_row"); err != nil {
+			http.Error(w, "Error creating savepoint", http.StatusInternalServerError)
+			return
+		}
+		task, err := createTaskTx(tx, userID, row.task)
+		if err != nil {
+			log.Printf("Error importing row %d: %v", row.row, err)
+			if _, err := tx.Exec("ROLLBACK TO SAVEPOINT import_row"); err != nil {
+				http.Error(w, "Error rolling back to savepoint", http.StatusInternalServerError)
+				return
+			}
+			if _, ok := err.(*taskRuleError); ok {
+				result.Status, result.Error = "invalid", err.Error()
+				report.Invalid++
+				report.Rows = append(report.Rows, result)
+				continue
+			}
+			result.Status, result.Error = "failed", "Error creating task"
+			report.Failed++
+			report.Rows = append(report.Rows, result)
+			continue
+		}
+		if _, err := tx.Exec("RELEASE SAVEPOINT import_row"); err != nil {
+			http.Error(w, "Error releasing savepoint", http.StatusInternalServerError)
+			return
+		}
+		if row.id != 0 {
+			created[row.id] = task.ID
+		}
+		if row.deleted {
+			trashed = append(trashed, task.ID)
+		}
+		result.Status = "created"
+		if !dryRun {
+			result.TaskID = task.ID
+		}
+		report.Created++
+		report.Rows = append(report.Rows, result)
+	}
+
+	// Deleted rows go to the trash once all rows are in, as subtasks can only
+	// be created under live tasks
+	for _, id := range trashed {
+		if err := deleteTaskTx(tx, userID, id); err != nil {
+			log.Printf("Error moving imported task %d to the trash: %v", id, err)
+			http.Error(w, "Error importing deleted tasks", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if !dryRun {
+		if err = tx.Commit(); err != nil {
+			log.Printf("Error committing transaction: %v", err)
+			http.Error(w, "Error committing transaction", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !dryRun && report.Created > 0 {
+		w.WriteHeader(http.StatusCreated)
+	}
+	json.NewEncoder(w).Encode(report)
+}
+
+// applyProfileDefaults fills in the priority and category a task was given
+// none of, from the user's profile, as CreateTask does
+func applyProfileDefaults(tc *models.TaskCreate, profile models.Profile) {
+	if tc.Priority == "" {
+		tc.Priority = profile.DefaultPriority
+	}
+	if tc.Category == "" {
+		tc.Category = profile.DefaultCategory
+	}
+}
+
+// validateTaskCreate applies the same rules as CreateTask and returns an
+// error message if the task is invalid. Defaults must already be applied,
+// see applyProfileDefaults.
+func validateTaskCreate(tc *models.TaskCreate) string {
+	tc.Title = strings.TrimSpace(tc.Title)
+	switch {
+	case tc.Title == "":
+		return "Title is required"
+	case len(tc.Title) < 3:
+		return "Title must be at least 3 characters long"
+	case len(tc.Title) > 255:
+		return "Title must be at most 255 characters long"
+	case tc.Status != "" && !isValidStatus(tc.Status):
+		return "Invalid status value"
+	case !isValidPriority(tc.Priority):
+		return "Invalid priority value"
+	case tc.Category == "":
+		return "Category is required"
+	case !isValidCategory(tc.Category):
+		return "Invalid category value"
+	case tc.EstimateMinutes != nil && !isValidEstimate(*tc.EstimateMinutes):
+		return "Estimate must be between 1 and 100000 minutes"
+	case len(tc.ExternalID) > 255:
+		return "External ID must be at most 255 characters long"
+	case tc.Recurrence != "" && !isValidRecurrence(tc.Recurrence):
+		return "Recurrence must be an RRULE such as FREQ=WEEKLY;BYDAY=MO"
+	}
+	for _, tag := range tc.Tags {
+		if msg := validateTagName(strings.TrimSpace(tag)); msg != "" {
+			return msg
+		}
+	}
+	return ""
+}
+
+// parseCSVImport reads rows from a CSV document whose header names the columns.
+// Unknown columns (such as created_at from an export) are ignored; id and
+// parent_id link subtasks to their parents within the import.
+func parseCSVImport(r io.Reader) ([]importRow, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["title"]; !ok {
+		return nil, fmt.Errorf("missing title column")
+	}
+
+	var rows []importRow
+	for line := 1; ; line++ {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				rows = append(rows, importRow{row: line, err: parseErr.Err.Error()})
+				continue
+			}
+			return nil, err
+		}
+		if len(rows) >= maxImportRows {
+			return nil, fmt.Errorf("more than %d rows", maxImportRows)
+		}
+
+		get := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		row := importRow{row: line, task: models.TaskCreate{
+			Title:       get("title"),
+			Description: get("description"),
+			Status:      get("status"),
+			Priority:    get("priority"),
+			Category:    get("category"),
+			Tags:        splitList(get("tags")),
+			ExternalID:  get("external_id"),
+			Recurrence:  get("recurrence"),
+		}}
+		row.id, _ = strconv.Atoi(get("id"))
+		if parent := get("parent_id"); parent != "" {
+			id, err := strconv.Atoi(parent)
+			if err != nil {
+				row.err = "Invalid parent_id: " + parent
+			} else {
+				row.parentID = &id
+			}
+		}
+		if deleted := get("deleted"); deleted != "" {
+			if row.deleted, err = strconv.ParseBool(deleted); err != nil {
+				row.err = "Invalid deleted: " + deleted
+			}
+		}
+		if due := get("due_date"); due != "" {
+			dueDate, err := parseImportDate(due)
+			if err != nil {
+				row.err = "Invalid due_date: " + due
+			} else {
+				row.task.DueDate = &dueDate
+			}
+		}
+		if estimate := get("estimate_minutes"); estimate != "" {
+			minutes, err := strconv.Atoi(estimate)
+			if err != nil {
+				row.err = "Invalid estimate_minutes: " + estimate
+			} else {
+				row.task.EstimateMinutes = &minutes
+			}
+		}
+		if fields := get("custom_fields"); fields != "" {
+			if err := json.Unmarshal([]byte(fields), &row.task.CustomFields); err != nil {
+				row.err = "Invalid custom_fields: expected a JSON object"
+			}
+		}
+		rows = append(rows, row)
+	}
+}
+
+// parseJSONImport reads rows from a JSON array of task objects
+func parseJSONImport(r io.Reader) ([]importRow, error) {
+	dec := json.NewDecoder(r)
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+		return nil, fmt.Errorf("expected a JSON array of tasks")
+	}
+
+	var rows []importRow
+	for line := 1; dec.More(); line++ {
+		if len(rows) >= maxImportRows {
+			return nil, fmt.Errorf("more than %d rows", maxImportRows)
+		}
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return nil, err
+		}
+		rows = append(rows, decodeImportObject(line, raw))
+	}
+	return rows, nil
+}
+
+// parseNDJSONImport reads rows from newline-delimited JSON task objects
+func parseNDJSONImport(r io.Reader) ([]importRow, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxImportBytes)
+	var rows []importRow
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		if len(rows) >= maxImportRows {
+			return nil, fmt.Errorf("more than %d rows", maxImportRows)
+		}
+		rows = append(rows, decodeImportObject(line, json.RawMessage(text)))
+	}
+	return rows, scanner.Err()
+}
+
+// decodeImportObject turns one JSON object into a row, recording decode errors on the row
+func decodeImportObject(line int, raw json.RawMessage) importRow {
+	var object struct {
+		models.TaskCreate
+		ID      int  `json:"id"`
+		Deleted bool `json:"deleted"`
+	}
+	if err := json.Unmarshal(raw, &object); err != nil {
+		return importRow{row: line, err: "Invalid task object: " + err.Error()}
+	}
+	// parent_id names a task of the exporting account; runImport maps it
+	row := importRow{row: line, task: object.TaskCreate, id: object.ID, parentID: object.ParentID, deleted: object.Deleted}
+	row.task.ParentID = nil
+	return row
+}
+
+// parseImportDate accepts RFC 3339 timestamps and plain YYYY-MM-DD dates
+func parseImportDate(v string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", v)
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"task-manager/models"
+)
+
+func exportFixture() []models.TaskExport {
+	created := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	parentID := 10
+	return []models.TaskExport{
+		{Task: models.Task{ID: 10, Title: "Plan trip", Status: "pending", Priority: "high", Category: "Personal", CreatedAt: created, UpdatedAt: created}},
+		{Task: models.Task{ID: 11, Title: "Book hotel", Status: "pending", Priority: "low", Category: "Personal", CreatedAt: created, UpdatedAt: created, ParentID: &parentID}},
+		{Task: models.Task{ID: 12, Title: "Old idea", Status: "pending", Priority: "low", Category: "Work", CreatedAt: created, UpdatedAt: created}, Deleted: true},
+	}
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	parsers := map[string]func(io.Reader) ([]importRow, error){
+		"csv":    parseCSVImport,
+		"json":   parseJSONImport,
+		"ndjson": parseNDJSONImport,
+	}
+	for format, parse := range parsers {
+		t.Run(format, func(t *testing.T) {
+			tasks := exportFixture()
+			var buf bytes.Buffer
+			i := 0
+			err := writeTaskExport(&buf, format, func() (*models.TaskExport, error) {
+				if i == len(tasks) {
+					return nil, nil
+				}
+				i++
+				return &tasks[i-1], nil
+			})
+			if err != nil {
+				t.Fatalf("export: %v", err)
+			}
+
+			rows, err := parse(&buf)
+			if err != nil {
+				t.Fatalf("import: %v", err)
+			}
+			if len(rows) != len(tasks) {
+				t.Fatalf("got %d rows, want %d", len(rows), len(tasks))
+			}
+			for i, row := range rows {
+				if row.err != "" {
+					t.Errorf("row %d: %s", row.row, row.err)
+				}
+				if row.id != tasks[i].ID {
+					t.Errorf("row %d: id %d, want %d", row.row, row.id, tasks[i].ID)
+				}
+				if row.task.Title != tasks[i].Title {
+					t.Errorf("row %d: title %q, want %q", row.row, row.task.Title, tasks[i].Title)
+				}
+				if row.deleted != tasks[i].Deleted {
+					t.Errorf("row %d: deleted %v, want %v", row.row, row.deleted, tasks[i].Deleted)
+				}
+				// The exporting account's IDs must never reach createTaskTx
+				if row.task.ParentID != nil {
+					t.Errorf("row %d: parent %d passed through unmapped", row.row, *row.task.ParentID)
+				}
+			}
+			if rows[1].parentID == nil || *rows[1].parentID != 10 {
+				t.Fatalf("subtask lost its exported parent: %v", rows[1].parentID)
+			}
+
+			// The parent was created as task 100 in the importing account
+			created := map[int]int{10: 100}
+			if got := importParent(rows[0], created); got != nil {
+				t.Errorf("top-level task got parent %d", *got)
+			}
+			if got := importParent(rows[1], created); got == nil || *got != 100 {
+				t.Errorf("subtask parent mapped to %v, want 100", got)
+			}
+			// A parent that wasn't created in this import is dropped
+			if got := importParent(rows[1], map[int]int{}); got != nil {
+				t.Errorf("subtask of a missing parent got parent %d", *got)
+			}
+		})
+	}
+}
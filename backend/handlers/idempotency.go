@@ -0,0 +1,254 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultIdempotencyRetentionHours = 24
+	// idempotencyLockTimeout is how long a request may hold its key before
+	// a retry treats it as abandoned, e.g. after a crash
+	idempotencyLockTimeout = 5 * time.Minute
+	// maxIdempotentRequestBytes bounds the bodies that are hashed
+	maxIdempotentRequestBytes = 32 << 20
+	// maxIdempotentResponseBytes bounds the responses that are kept; larger
+	// ones are passed on without being stored
+	maxIdempotentResponseBytes = 1 << 20
+)
+
+// replayedHeaders are the response headers stored with a response
+var replayedHeaders = []string{"Content-Type", "ETag", "Location"}
+
+// Idempotency makes POST requests safe to retry. A request sent with an
+// Idempotency-Key header is processed once per user and key; retries with
+// the same key and body get the stored response, and retries with another
+// body are refused. Keys are kept for IDEMPOTENCY_KEY_RETENTION_HOURS
+// (24 by default) and purged by RunPurge.
+type Idempotency struct {
+	db        *sql.DB
+	retention time.Duration
+}
+
+func NewIdempotency(db *sql.DB) *Idempotency {
+	hours := defaultIdempotencyRetentionHours
+	if v, err := strconv.Atoi(os.Getenv("IDEMPOTENCY_KEY_RETENTION_HOURS")); err == nil && v > 0 {
+		hours = v
+	}
+	return &Idempotency{db: db, retention: time.Duration(hours) * time.Hour}
+}
+
+// Middleware honors Idempotency-Key on POST requests. It must run after
+// AuthMiddleware, as keys are scoped to the user.
+func (m *Idempotency) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if r.Method != http.MethodPost || key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		userID, ok := GetUserIDFromContext(r)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if !validIdempotencyKey(key) {
+			http.Error(w, "Idempotency-Key must be 1 to 255 printable ASCII characters", http.StatusBadRequest)
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxIdempotentRequestBytes+1))
+		if err != nil {
+			http.Error(w, "Error reading request body", http.StatusBadRequest)
+			return
+		}
+		if len(body) > maxIdempotentRequestBytes {
+			http.Error(w, "Request body is too large to be sent with an Idempotency-Key", http.StatusRequestEntityTooLarge)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		sum := sha256.Sum256([]byte(r.Method + " " + r.URL.RequestURI() + "\n" + string(body)))
+		hash := hex.EncodeToString(sum[:])
+
+		claimed, err := m.claim(userID, key, hash)
+		if err != nil {
+			log.Printf("Error claiming idempotency key: %v", err)
+			http.Error(w, "Error checking Idempotency-Key", http.StatusInternalServerError)
+			return
+		}
+		if !claimed {
+			m.replay(w, userID, key, hash)
+			return
+		}
+
+		rec := &recordingWriter{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		m.store(userID, key, rec)
+	})
+}
+
+// claim records the key as in flight, returning false if it is already
+// taken. Expired keys and keys abandoned mid-request are released first.
+func (m *Idempotency) claim(userID int, key, hash string) (bool, error) {
+	_, err := m.db.Exec(`
+		DELETE FROM idempotency_keys
+		WHERE user_id = $1 AND key = $2
+			AND (created_at < CURRENT_TIMESTAMP - $3 * interval '1 second'
+				OR (status_code IS NULL AND created_at < CURRENT_TIMESTAMP - $4 * interval '1 second'))
+	`, userID, key, int64(m.retention.Seconds()), int64(idempotencyLockTimeout.Seconds()))
+	if err != nil {
+		return false, err
+	}
+	result, err := m.db.Exec(`
+		INSERT INTO idempotency_keys (user_id, key, request_hash)
+		VALUES ($1, $2, $3)
+		ON CONFLICT DO NOTHING
+	`, userID, key, hash)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n == 1, err
+}
+
+// replay answers a retry with the stored response
+func (m *Idempotency) replay(w http.ResponseWriter, userID int, key, hash string) {
+	var storedHash string
+	var status sql.NullInt64
+	var headersJSON, body []byte
+	err := m.db.QueryRow(`
+		SELECT request_hash, status_code, headers, body FROM idempotency_keys
+		WHERE user_id = $1 AND key = $2
+	`, userID, key).Scan(&storedHash, &status, &headersJSON, &body)
+	if err == sql.ErrNoRows {
+		// Released by a failed request in the meantime
+		http.Error(w, "A request with this Idempotency-Key failed; retry it", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading idempotency key: %v", err)
+		http.Error(w, "Error checking Idempotency-Key", http.StatusInternalServerError)
+		return
+	}
+	if storedHash != hash {
+		http.Error(w, "Idempotency-Key was already used with a different request", http.StatusUnprocessableEntity)
+		return
+	}
+	if !status.Valid {
+		http.Error(w, "A request with this Idempotency-Key is still being processed", http.StatusConflict)
+		return
+	}
+
+	var headers map[string]string
+	if err := json.Unmarshal(headersJSON, &headers); err != nil {
+		http.Error(w, "Error replaying response", http.StatusInternalServerError)
+		return
+	}
+	for name, value := range headers {
+		w.Header().Set(name, value)
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(int(status.Int64))
+	w.Write(body)
+}
+
+// store keeps the response for retries. Server errors and responses too
+// large to keep release the key instead, so the request can be retried.
+func (m *Idempotency) store(userID int, key string, rec *recordingWriter) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	if rec.status >= 500 || rec.overflow {
+		if _, err := m.db.Exec(`DELETE FROM idempotency_keys WHERE user_id = $1 AND key = $2`, userID, key); err != nil {
+			log.Printf("Error releasing idempotency key: %v", err)
+		}
+		return
+	}
+
+	headers := make(map[string]string)
+	for _, name := range replayedHeaders {
+		if value := rec.Header().Get(name); value != "" {
+			headers[name] = value
+		}
+	}
+	headersJSON, _ := json.Marshal(headers)
+	_, err := m.db.Exec(`
+		UPDATE idempotency_keys SET status_code = $1, headers = $2, body = $3
+		WHERE user_id = $4 AND key = $5
+	`, rec.status, headersJSON, rec.body.Bytes(), userID, key)
+	if err != nil {
+		log.Printf("Error storing idempotent response: %v", err)
+	}
+}
+
+// RunPurge deletes expired idempotency keys until ctx is cancelled
+func (m *Idempotency) RunPurge(ctx context.Context) {
+	ticker := time.NewTicker(purgeInterval)
+	defer ticker.Stop()
+	for {
+		_, err := m.db.ExecContext(ctx, `
+			DELETE FROM idempotency_keys
+			WHERE created_at < CURRENT_TIMESTAMP - $1 * interval '1 second'
+		`, int64(m.retention.Seconds()))
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Error purging idempotency keys: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func validIdempotencyKey(key string) bool {
+	if len(key) > 255 {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < 0x20 || key[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// recordingWriter passes a response on while keeping a copy of it
+type recordingWriter struct {
+	http.ResponseWriter
+	status   int
+	body     bytes.Buffer
+	overflow bool
+}
+
+func (rec *recordingWriter) WriteHeader(code int) {
+	if rec.status == 0 {
+		rec.status = code
+	}
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *recordingWriter) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	if !rec.overflow {
+		if rec.body.Len()+len(b) > maxIdempotentResponseBytes {
+			rec.overflow = true
+			rec.body.Reset()
+		} else {
+			rec.body.Write(b)
+		}
+	}
+	return rec.ResponseWriter.Write(b)
+}
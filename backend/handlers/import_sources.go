@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"task-manager/importers"
+	"task-manager/models"
+)
+
+// ImportFromSource creates tasks from another tool's export file, uploaded as
+// the "file" field of a multipart form. The source is todoist, trello or github.
+// An optional "mapping" field holds JSON that maps the source's lists, columns,
+// sections and labels onto status, priority and category, e.g.
+//
+//	{"status": {"Doing": "in_progress"}, "category": {"Groceries": "Shopping"}}
+//
+// Items nothing maps to a category get ?category=, if given, or else the
+// user's default category. Statuses come from the workflow of the item's
+// category: open items start in its first state, finished ones go to its
+// first done state, and mapped statuses must be states of the workflow.
+// Imports are de-duplicated by the source's IDs and accept ?dry_run=true
+// like ImportTasks.
+func (h *TaskHandler) ImportFromSource(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	source := mux.Vars(r)["source"]
+	if !isImportSource(source) {
+		http.Error(w, "Source must be one of "+strings.Join(importers.Sources, ", "), http.StatusBadRequest)
+		return
+	}
+	defaultCategory := r.URL.Query().Get("category")
+	if defaultCategory != "" && !isValidCategory(defaultCategory) {
+		http.Error(w, "Invalid category value", http.StatusBadRequest)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportBytes)
+	if err := r.ParseMultipartForm(maxImportBytes); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			http.Error(w, "Import file is too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Expected a multipart/form-data upload", http.StatusBadRequest)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	var mapping importers.Mapping
+	if raw := r.FormValue("mapping"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &mapping); err != nil {
+			http.Error(w, "Invalid mapping", http.StatusBadRequest)
+			return
+		}
+		if msg := validateImportMapping(mapping); msg != "" {
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+	}
+	addCategoryNames(&mapping)
+
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "No file uploaded", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	items, err := importers.Parse(source, file, mapping)
+	if err != nil {
+		http.Error(w, "Invalid import file: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if defaultCategory == "" {
+		profile, err := loadProfile(h.db, userID)
+		if err != nil {
+			http.Error(w, "Error loading profile", http.StatusInternalServerError)
+			return
+		}
+		defaultCategory = profile.DefaultCategory
+	}
+
+	workflows := make(map[string]models.Workflow)
+	rows := make([]importRow, 0, len(items))
+	for _, item := range items {
+		category := item.Category
+		if category == "" {
+			category = defaultCategory
+		}
+		wf, ok := workflows[category]
+		if !ok {
+			if wf, err = workflowFor(h.db, userID, category); err != nil {
+				http.Error(w, "Error fetching workflow", http.StatusInternalServerError)
+				return
+			}
+			workflows[category] = wf
+		}
+		status, msg := importStatus(&wf, item)
+		if item.Err == "" {
+			item.Err = msg
+		}
+		rows = append(rows, importRow{row: item.Line, err: item.Err, task: models.TaskCreate{
+			Title:       item.Title,
+			Description: item.Description,
+			Status:      status,
+			Priority:    item.Priority,
+			Category:    category,
+			DueDate:     item.DueDate,
+			Tags:        item.Tags,
+			ExternalID:  item.ExternalID,
+		}})
+	}
+
+	h.runImport(w, userID, rows, r.URL.Query().Get("dry_run") == "true")
+}
+
+// importStatus picks an imported item's status from its category's
+// workflow, or returns why it has none. An empty status starts the task in
+// the workflow's first state.
+func importStatus(wf *models.Workflow, item importers.Item) (string, string) {
+	status := item.Status
+	switch {
+	case item.Done && !wf.IsDone(status):
+		if status = wf.DoneState(); status == "" {
+			return "", fmt.Sprintf("The %s workflow has no done state for finished items", wf.Name)
+		}
+	case status == "" && item.Started && wf.HasState("in_progress"):
+		status = "in_progress"
+	}
+	if status != "" && !wf.HasState(status) {
+		return "", fmt.Sprintf("Status %q is not part of the %s workflow", status, wf.Name)
+	}
+	return status, ""
+}
+
+func isImportSource(source string) bool {
+	for _, s := range importers.Sources {
+		if s == source {
+			return true
+		}
+	}
+	return false
+}
+
+// validateImportMapping checks that every mapped value is a valid field value
+func validateImportMapping(m importers.Mapping) string {
+	for name, status := range m.Status {
+		if !isValidStatus(status) {
+			return "Invalid status value for " + name
+		}
+	}
+	for name, priority := range m.Priority {
+		if !isValidPriority(priority) {
+			return "Invalid priority value for " + name
+		}
+	}
+	for name, category := range m.Category {
+		if !isValidCategory(category) {
+			return "Invalid category value for " + name
+		}
+	}
+	return ""
+}
+
+// addCategoryNames maps source names equal to one of our categories onto
+// that category, unless the mapping already says otherwise
+func addCategoryNames(m *importers.Mapping) {
+	if m.Category == nil {
+		m.Category = make(map[string]string)
+	}
+	mapped := make(map[string]bool)
+	for name := range m.Category {
+		mapped[strings.ToLower(strings.TrimSpace(name))] = true
+	}
+	for _, category := range sortedCategories() {
+		if !mapped[strings.ToLower(category)] {
+			m.Category[category] = category
+		}
+	}
+}
@@ -0,0 +1,337 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+
+	"task-manager/inbound"
+	"task-manager/models"
+	"task-manager/storage"
+)
+
+const (
+	maxInboundBytes        = 25 << 20 // 25 MiB
+	defaultInboundCategory = "Personal"
+	inboundMailbox         = "tasks"
+)
+
+var (
+	// inboundAddressPattern matches tasks+<token>@domain; tokens are lowercase
+	// hex so they survive mail systems that change the case of addresses
+	inboundAddressPattern = regexp.MustCompile(`^` + inboundMailbox + `\+([0-9a-f]{32})@(.+)$`)
+	subjectTokenPattern   = regexp.MustCompile(`(^|\s)([!#])([\p{L}_]+)`)
+	forwardPrefixPattern  = regexp.MustCompile(`(?i)^((fwd?|re|aw|wg)\s*:\s*)+`)
+)
+
+// InboundHandler turns forwarded emails into tasks. Each user has a secret
+// address, tasks+<token>@INBOUND_EMAIL_DOMAIN; the mail provider delivering
+// that domain posts raw messages to the Email endpoint.
+type InboundHandler struct {
+	db     *sql.DB
+	store  storage.BlobStore
+	limits attachmentLimits
+	domain string
+	secret string
+}
+
+func NewInboundHandler(db *sql.DB, store storage.BlobStore) *InboundHandler {
+	return &InboundHandler{
+		db:     db,
+		store:  store,
+		limits: attachmentLimitsFromEnv(),
+		domain: strings.ToLower(os.Getenv("INBOUND_EMAIL_DOMAIN")),
+		secret: os.Getenv("INBOUND_WEBHOOK_SECRET"),
+	}
+}
+
+// Enabled reports whether inbound email is configured. Both the domain and
+// the webhook secret are required; without the secret anyone could post
+// messages as any user whose address they know.
+func (h *InboundHandler) Enabled() bool {
+	return h.domain != "" && h.secret != ""
+}
+
+// GetAddress returns the authenticated user's inbound address, creating it
+// the first time it is requested
+func (h *InboundHandler) GetAddress(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if !h.Enabled() {
+		http.Error(w, "Inbound email is not configured", http.StatusNotImplemented)
+		return
+	}
+
+	var token sql.NullString
+	if err := h.db.QueryRow(`SELECT inbound_token FROM users WHERE id = $1`, userID).Scan(&token); err != nil {
+		http.Error(w, "Error fetching inbound address", http.StatusInternalServerError)
+		return
+	}
+	if !token.Valid {
+		newToken, err := h.setInboundToken(userID, false)
+		if err != nil {
+			log.Printf("Error creating inbound token: %v", err)
+			http.Error(w, "Error creating inbound address", http.StatusInternalServerError)
+			return
+		}
+		token = sql.NullString{String: newToken, Valid: true}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"address": h.address(token.String)})
+}
+
+// RotateAddress replaces the user's inbound address; mail to the old one is rejected
+func (h *InboundHandler) RotateAddress(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if !h.Enabled() {
+		http.Error(w, "Inbound email is not configured", http.StatusNotImplemented)
+		return
+	}
+
+	token, err := h.setInboundToken(userID, true)
+	if err != nil {
+		log.Printf("Error rotating inbound token: %v", err)
+		http.Error(w, "Error rotating inbound address", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"address": h.address(token)})
+}
+
+// setInboundToken stores a new token, keeping an existing one unless replace is set
+func (h *InboundHandler) setInboundToken(userID int, replace bool) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b)
+	err := h.db.QueryRow(`
+		UPDATE users
+		SET inbound_token = CASE WHEN $3 OR inbound_token IS NULL THEN $1 ELSE inbound_token END
+		WHERE id = $2
+		RETURNING inbound_token
+	`, token, userID, replace).Scan(&token)
+	return token, err
+}
+
+func (h *InboundHandler) address(token string) string {
+	return inboundMailbox + "+" + token + "@" + h.domain
+}
+
+// Email accepts a raw RFC 5322 message (Content-Type message/rfc822) and
+// creates a task for the user whose address it was sent to. The envelope
+// recipient may be passed as ?recipient=; otherwise the To, Cc and
+// Delivered-To headers are searched. Requests must carry
+// INBOUND_WEBHOOK_SECRET as a bearer token.
+//
+// The subject becomes the title and the text body the description.
+// Subject tokens like !high and #Work set the priority and category.
+// Attachments that exceed the attachment limits are skipped and listed
+// in the response. Re-posting a message with the same Message-ID doesn't
+// create a second task.
+func (h *InboundHandler) Email(w http.ResponseWriter, r *http.Request) {
+	if !h.Enabled() {
+		http.Error(w, "Inbound email is not configured", http.StatusNotImplemented)
+		return
+	}
+	given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(given), []byte(h.secret)) != 1 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	msg, err := inbound.Parse(http.MaxBytesReader(w, r.Body, maxInboundBytes))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			http.Error(w, "Message is too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Invalid email message: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	recipients := msg.Recipients
+	if recipient := r.URL.Query().Get("recipient"); recipient != "" {
+		recipients = []string{strings.ToLower(recipient)}
+	}
+	userID, err := h.userForRecipients(recipients)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Unknown recipient", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error looking up recipient", http.StatusInternalServerError)
+		return
+	}
+
+	profile, err := loadProfile(h.db, userID)
+	if err != nil {
+		http.Error(w, "Error loading profile", http.StatusInternalServerError)
+		return
+	}
+	taskCreate := emailTaskCreate(msg)
+	applyProfileDefaults(&taskCreate, profile)
+	if taskCreate.Category == "" {
+		taskCreate.Category = defaultInboundCategory
+	}
+	if msg := validateTaskCreate(&taskCreate); msg != "" {
+		http.Error(w, msg, http.StatusUnprocessableEntity)
+		return
+	}
+
+	tx, err := beginTaskTx(h.db, userID)
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		http.Error(w, "Error starting transaction", http.StatusInternalServerError)
+		return
+	}
+	blobs := newBlobCleanup(h.db, h.store)
+	defer blobs.run(tx)
+
+	if taskCreate.ExternalID != "" {
+		var existingID int
+		err := tx.QueryRow(`
+			SELECT id FROM tasks WHERE user_id = $1 AND external_id = $2
+		`, userID, taskCreate.ExternalID).Scan(&existingID)
+		if err == nil {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]interface{}{"task_id": existingID, "duplicate": true})
+			return
+		}
+		if err != sql.ErrNoRows {
+			http.Error(w, "Error checking for duplicates", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	task, err := createTaskTx(tx, userID, taskCreate)
+	if _, ok := err.(*taskRuleError); ok {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	if err != nil {
+		log.Printf("Error creating task from email: %v", err)
+		http.Error(w, "Error creating task", http.StatusInternalServerError)
+		return
+	}
+
+	attachments := []models.Attachment{}
+	skipped := []map[string]string{}
+	for _, a := range msg.Attachments {
+		if _, err := tx.Exec("SAVEPOINT inbound_attachment"); err != nil {
+			http.Error(w, "Error creating savepoint", http.StatusInternalServerError)
+			return
+		}
+		attachment, err := saveAttachment(r.Context(), tx, blobs, h.limits, task.ID, userID, a.Filename, a.Data)
+		if err != nil {
+			if _, err := tx.Exec("ROLLBACK TO SAVEPOINT inbound_attachment"); err != nil {
+				http.Error(w, "Error rolling back to savepoint", http.StatusInternalServerError)
+				return
+			}
+			reason := err.Error()
+			if !errors.Is(err, errAttachmentTooLarge) && !errors.Is(err, errAttachmentType) {
+				log.Printf("Error saving email attachment: %v", err)
+				reason = "Error saving attachment"
+			}
+			skipped = append(skipped, map[string]string{"filename": sanitizeFilename(a.Filename), "error": reason})
+			continue
+		}
+		if _, err := tx.Exec("RELEASE SAVEPOINT inbound_attachment"); err != nil {
+			http.Error(w, "Error releasing savepoint", http.StatusInternalServerError)
+			return
+		}
+		attachments = append(attachments, attachment)
+	}
+
+	if err = tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		http.Error(w, "Error committing transaction", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"task_id":             task.ID,
+		"attachments":         attachments,
+		"skipped_attachments": skipped,
+	})
+}
+
+// userForRecipients finds the user owning the first inbound address among the recipients
+func (h *InboundHandler) userForRecipients(recipients []string) (int, error) {
+	for _, recipient := range recipients {
+		match := inboundAddressPattern.FindStringSubmatch(recipient)
+		if match == nil || match[2] != h.domain {
+			continue
+		}
+		var userID int
+		err := h.db.QueryRow(`SELECT id FROM users WHERE inbound_token = $1`, match[1]).Scan(&userID)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		return userID, err
+	}
+	return 0, sql.ErrNoRows
+}
+
+// emailTaskCreate maps a message onto a new task. Priority and category are
+// only set from subject tokens, so the profile defaults can fill them in.
+func emailTaskCreate(msg *inbound.Message) models.TaskCreate {
+	var taskCreate models.TaskCreate
+
+	subject := strings.ToValidUTF8(msg.Subject, "")
+	subject = forwardPrefixPattern.ReplaceAllString(strings.TrimSpace(subject), "")
+	title := subjectTokenPattern.ReplaceAllStringFunc(subject, func(token string) string {
+		match := subjectTokenPattern.FindStringSubmatch(token)
+		word := strings.ToLower(match[3])
+		switch match[2] {
+		case "!":
+			if isValidPriority(word) {
+				taskCreate.Priority = word
+				return match[1]
+			}
+		case "#":
+			for _, category := range sortedCategories() {
+				if strings.ToLower(category) == word {
+					taskCreate.Category = category
+					return match[1]
+				}
+			}
+		}
+		return token
+	})
+	title = strings.Join(strings.Fields(title), " ")
+	if title == "" {
+		title = "(no subject)"
+	}
+	if len(title) > 255 {
+		title = strings.ToValidUTF8(title[:255], "")
+	}
+	taskCreate.Title = title
+
+	// PostgreSQL rejects invalid UTF-8 and NUL bytes, which undecoded charsets can produce
+	taskCreate.Description = strings.ReplaceAll(strings.ToValidUTF8(msg.Text, "\uFFFD"), "\x00", "")
+	if msg.MessageID != "" && len(msg.MessageID) <= 240 {
+		taskCreate.ExternalID = "email:" + msg.MessageID
+	}
+	return taskCreate
+}
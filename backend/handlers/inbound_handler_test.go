@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"testing"
+
+	"task-manager/inbound"
+)
+
+func TestEmailTaskCreate(t *testing.T) {
+	tests := []struct {
+		subject  string
+		title    string
+		priority string
+		category string
+	}{
+		{"Fwd: Renew passport", "Renew passport", "", ""},
+		{"Renew passport #health !high", "Renew passport", "high", "Health"},
+		{"Buy milk #groceries", "Buy milk #groceries", "", ""},
+		{"Fix the #1 bug !urgent", "Fix the #1 bug !urgent", "", ""},
+	}
+	for _, tt := range tests {
+		tc := emailTaskCreate(&inbound.Message{Subject: tt.subject})
+		if tc.Title != tt.title || tc.Priority != tt.priority || tc.Category != tt.category {
+			t.Errorf("%q: got %q/%q/%q, want %q/%q/%q", tt.subject,
+				tc.Title, tc.Priority, tc.Category, tt.title, tt.priority, tt.category)
+		}
+	}
+}
@@ -2,6 +2,8 @@ package handlers
 
 import (
 	"context"
+	"database/sql"
+	"log"
 	"net/http"
 	"strings"
 )
@@ -11,23 +13,31 @@ type ContextKey string
 
 const UserIDKey ContextKey = "userID"
 
-// AuthMiddleware checks for JWT and sets user ID in context
-func AuthMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		header := r.Header.Get("Authorization")
-		if header == "" || !strings.HasPrefix(header, "Bearer ") {
-			http.Error(w, "Missing or invalid Authorization header", http.StatusUnauthorized)
-			return
-		}
-		tokenStr := strings.TrimPrefix(header, "Bearer ")
-		userID, err := ParseJWT(tokenStr)
-		if err != nil {
-			http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
-			return
-		}
-		ctx := context.WithValue(r.Context(), UserIDKey, userID)
-		next.ServeHTTP(w, r.WithContext(ctx))
-	})
+// AuthMiddleware checks for JWT and sets user ID in context. Tokens of
+// deleted accounts and tokens issued before a revocation are rejected.
+func AuthMiddleware(db *sql.DB) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header := r.Header.Get("Authorization")
+			if header == "" || !strings.HasPrefix(header, "Bearer ") {
+				http.Error(w, "Missing or invalid Authorization header", http.StatusUnauthorized)
+				return
+			}
+			tokenStr := strings.TrimPrefix(header, "Bearer ")
+			userID, err := authenticateToken(db, tokenStr)
+			if err == errInvalidToken {
+				http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
+				return
+			}
+			if err != nil {
+				log.Printf("Error checking token: %v", err)
+				http.Error(w, "Error checking token", http.StatusInternalServerError)
+				return
+			}
+			ctx := context.WithValue(r.Context(), UserIDKey, userID)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
 }
 
 // GetUserIDFromContext extracts the user ID from the request context
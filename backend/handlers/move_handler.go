@@ -0,0 +1,288 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"task-manager/models"
+	"task-manager/rank"
+)
+
+// maxPositionLength is how long a position key may get before its column is renumbered
+const maxPositionLength = 64
+
+var errAnchorNotFound = errors.New("anchor task not found in the target column")
+
+// MoveTask moves a task within its board column or to another one, changing
+// its status and position in one transaction. The task goes right after
+// after_id or right before before_id; giving both is rejected, since the two
+// may no longer be adjacent. Moves into the same column are serialized, and
+// the new position is computed from the column as it is then, so concurrent
+// moves never produce the same position and only the moved task is rewritten.
+// If-Match is checked as for PUT /api/tasks/{id}.
+func (h *TaskHandler) MoveTask(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	taskID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid task ID", http.StatusBadRequest)
+		return
+	}
+
+	var move models.TaskMove
+	if err := json.NewDecoder(r.Body).Decode(&move); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if move.Status != "" && !isValidStatus(move.Status) {
+		http.Error(w, "Invalid status value", http.StatusBadRequest)
+		return
+	}
+	if move.AfterID != nil && move.BeforeID != nil {
+		http.Error(w, "Give after_id or before_id, not both", http.StatusBadRequest)
+		return
+	}
+	if (move.AfterID != nil && *move.AfterID == taskID) || (move.BeforeID != nil && *move.BeforeID == taskID) {
+		http.Error(w, "A task can't be placed next to itself", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := beginTaskTx(h.db, userID)
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		http.Error(w, "Error starting transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	before, err := checkIfMatch(tx, r, userID, taskID, h.requireIfMatch)
+	if err == errTaskNotFound {
+		http.Error(w, "Task not found", http.StatusNotFound)
+		return
+	}
+	if writePreconditionError(w, err) {
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error fetching task", http.StatusInternalServerError)
+		return
+	}
+	status := move.Status
+	if status == "" {
+		status = before.Status
+	}
+	done, err := checkTransition(tx, userID, &before, status, before.Category)
+	if err != nil {
+		if _, ok := err.(*taskRuleError); ok {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		http.Error(w, "Error fetching workflow", http.StatusInternalServerError)
+		return
+	}
+
+	position, err := movePosition(tx, userID, taskID, status, move)
+	if err == errAnchorNotFound {
+		http.Error(w, "after_id and before_id must be tasks in the target column", http.StatusUnprocessableEntity)
+		return
+	}
+	if err != nil {
+		log.Printf("Error computing task position: %v", err)
+		http.Error(w, "Error moving task", http.StatusInternalServerError)
+		return
+	}
+
+	_, err = tx.Exec(`
+		UPDATE tasks
+		SET status = $1, position = $2,
+			completed_at = CASE WHEN $5 THEN COALESCE(completed_at, CURRENT_TIMESTAMP) END,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = $3 AND user_id = $4
+	`, status, position, taskID, userID, done)
+	if err != nil {
+		log.Printf("Error moving task: %v", err)
+		http.Error(w, "Error moving task", http.StatusInternalServerError)
+		return
+	}
+
+	after, err := lockTask(tx, taskID, userID, false)
+	if err != nil {
+		http.Error(w, "Error fetching task", http.StatusInternalServerError)
+		return
+	}
+	// Reordering alone isn't recorded; a status change is, like any update
+	if before.Status != after.Status {
+		if err := recordTaskEvent(tx, userID, "updated", &before, &after); err != nil {
+			log.Printf("Error recording task event: %v", err)
+			http.Error(w, "Error recording task history", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		http.Error(w, "Error committing transaction", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", taskETag(after))
+	json.NewEncoder(w).Encode(after)
+}
+
+// lockColumn serializes position changes within one of the user's status columns
+func lockColumn(tx *sql.Tx, userID int, status string) error {
+	_, err := tx.Exec(`SELECT pg_advisory_xact_lock(hashtext('task_position:' || $1 || ':' || $2))`,
+		strconv.Itoa(userID), status)
+	return err
+}
+
+// topPosition locks a column and returns a position above every task in it
+func topPosition(tx *sql.Tx, userID int, status string) (string, error) {
+	if err := lockColumn(tx, userID, status); err != nil {
+		return "", err
+	}
+	var first sql.NullString
+	err := tx.QueryRow(`
+		SELECT min(position) FROM tasks
+		WHERE user_id = $1 AND status = $2 AND is_deleted = false
+	`, userID, status).Scan(&first)
+	if err != nil {
+		return "", err
+	}
+	position, err := rank.Between("", first.String)
+	if err != nil || len(position) > maxPositionLength {
+		if err := renumberColumn(tx, userID, status, 0); err != nil {
+			return "", err
+		}
+		return topPosition(tx, userID, status)
+	}
+	return position, nil
+}
+
+// movePosition locks the target column and returns the position for taskID
+// described by move. The neighbours are read after taking the lock, so the
+// key always falls between two adjacent positions.
+func movePosition(tx *sql.Tx, userID, taskID int, status string, move models.TaskMove) (string, error) {
+	if err := lockColumn(tx, userID, status); err != nil {
+		return "", err
+	}
+
+	for renumbered := false; ; renumbered = true {
+		lower, upper, err := moveBounds(tx, userID, taskID, status, move)
+		if err != nil {
+			return "", err
+		}
+		position, err := rank.Between(lower, upper)
+		if err == nil && len(position) <= maxPositionLength {
+			return position, nil
+		}
+		// Keys have grown too long (or were written by hand); renumber once and retry
+		if renumbered {
+			if err == nil {
+				return position, nil
+			}
+			return "", err
+		}
+		if err := renumberColumn(tx, userID, status, taskID); err != nil {
+			return "", err
+		}
+	}
+}
+
+// moveBounds returns the positions the moved task must fall between; "" is unbounded
+func moveBounds(tx *sql.Tx, userID, taskID int, status string, move models.TaskMove) (string, string, error) {
+	anchor := func(id int) (string, error) {
+		var position sql.NullString
+		err := tx.QueryRow(`
+			SELECT position FROM tasks
+			WHERE id = $1 AND user_id = $2 AND status = $3 AND is_deleted = false
+		`, id, userID, status).Scan(&position)
+		if err == sql.ErrNoRows || (err == nil && !position.Valid) {
+			return "", errAnchorNotFound
+		}
+		return position.String, err
+	}
+	neighbour := func(query string, args ...interface{}) (string, error) {
+		var position sql.NullString
+		err := tx.QueryRow(query, args...).Scan(&position)
+		return position.String, err
+	}
+
+	switch {
+	case move.AfterID != nil:
+		lower, err := anchor(*move.AfterID)
+		if err != nil {
+			return "", "", err
+		}
+		upper, err := neighbour(`
+			SELECT min(position) FROM tasks
+			WHERE user_id = $1 AND status = $2 AND is_deleted = false AND id != $3 AND position > $4
+		`, userID, status, taskID, lower)
+		return lower, upper, err
+	case move.BeforeID != nil:
+		upper, err := anchor(*move.BeforeID)
+		if err != nil {
+			return "", "", err
+		}
+		lower, err := neighbour(`
+			SELECT max(position) FROM tasks
+			WHERE user_id = $1 AND status = $2 AND is_deleted = false AND id != $3 AND position < $4
+		`, userID, status, taskID, upper)
+		return lower, upper, err
+	default:
+		lower, err := neighbour(`
+			SELECT max(position) FROM tasks
+			WHERE user_id = $1 AND status = $2 AND is_deleted = false AND id != $3
+		`, userID, status, taskID)
+		return lower, "", err
+	}
+}
+
+// renumberColumn gives every live task in a column except skipID a fresh,
+// short position, keeping their order. It is only needed when keys have
+// grown past maxPositionLength. The column lock is taken before the rows
+// are, like every other position change; callers usually hold it already.
+func renumberColumn(tx *sql.Tx, userID int, status string, skipID int) error {
+	if err := lockColumn(tx, userID, status); err != nil {
+		return err
+	}
+	rows, err := tx.Query(`
+		SELECT id FROM tasks
+		WHERE user_id = $1 AND status = $2 AND is_deleted = false AND id != $3
+		ORDER BY position NULLS LAST, id
+		FOR UPDATE
+	`, userID, status, skipID)
+	if err != nil {
+		return err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	log.Printf("Renumbering %d task positions in column %s of user %d", len(ids), status, userID)
+	for i, position := range rank.Spread(len(ids)) {
+		if _, err := tx.Exec(`UPDATE tasks SET position = $1 WHERE id = $2`, position, ids[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
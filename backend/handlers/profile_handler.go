@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"task-manager/models"
+)
+
+// localePattern accepts BCP 47 tags such as en, en-US or zh-Hant-TW
+var localePattern = regexp.MustCompile(`^[a-zA-Z]{2,3}(-[a-zA-Z0-9]{2,8})*$`)
+
+type ProfileHandler struct {
+	db *sql.DB
+}
+
+func NewProfileHandler(db *sql.DB) *ProfileHandler {
+	return &ProfileHandler{db: db}
+}
+
+// GetProfile returns the authenticated user's profile
+func (h *ProfileHandler) GetProfile(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	profile, err := loadProfile(h.db, userID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error fetching profile", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(profile)
+}
+
+// UpdateProfile changes the fields present in the request body
+func (h *ProfileHandler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var update models.ProfileUpdate
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if msg := validateProfileUpdate(&update); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	var defaultCategory sql.NullString
+	if update.DefaultCategory != nil {
+		defaultCategory = sql.NullString{String: *update.DefaultCategory, Valid: *update.DefaultCategory != ""}
+	}
+	var workDayStart, workDayEnd sql.NullInt64
+	if update.WorkDayStart != nil {
+		minutes, _ := parseClock(*update.WorkDayStart)
+		workDayStart = sql.NullInt64{Int64: int64(minutes), Valid: true}
+	}
+	if update.WorkDayEnd != nil {
+		minutes, _ := parseClock(*update.WorkDayEnd)
+		workDayEnd = sql.NullInt64{Int64: int64(minutes), Valid: true}
+	}
+	var workDays []int64
+	for _, d := range update.WorkDays {
+		workDays = append(workDays, int64(d))
+	}
+	_, err := h.db.Exec(`
+		UPDATE users
+		SET display_name = COALESCE($2, display_name),
+			timezone = COALESCE($3, timezone),
+			locale = COALESCE($4, locale),
+			week_start = COALESCE($5, week_start),
+			default_priority = COALESCE($6, default_priority),
+			default_category = CASE WHEN $7 THEN $8 ELSE default_category END,
+			work_day_start = COALESCE($9, work_day_start),
+			work_day_end = COALESCE($10, work_day_end),
+			work_days = COALESCE($11, work_days),
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+	`, userID, update.DisplayName, update.Timezone, update.Locale, update.WeekStart,
+		update.DefaultPriority, update.DefaultCategory != nil, defaultCategory,
+		workDayStart, workDayEnd, pq.Array(workDays))
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Constraint == "users_work_hours_check" {
+		http.Error(w, "Working hours must end after they start", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("Error updating profile: %v", err)
+		http.Error(w, "Error updating profile", http.StatusInternalServerError)
+		return
+	}
+
+	profile, err := loadProfile(h.db, userID)
+	if err != nil {
+		http.Error(w, "Error fetching profile", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(profile)
+}
+
+// validateProfileUpdate trims and checks the fields that are set
+func validateProfileUpdate(update *models.ProfileUpdate) string {
+	if update.DisplayName != nil {
+		name := strings.TrimSpace(*update.DisplayName)
+		if len(name) > 100 {
+			return "Display name must be at most 100 characters long"
+		}
+		update.DisplayName = &name
+	}
+	if update.Timezone != nil {
+		// time.LoadLocation also accepts "Local" and "", which depend on the server
+		if *update.Timezone == "" || *update.Timezone == "Local" || len(*update.Timezone) > 64 {
+			return "Invalid timezone"
+		}
+		if _, err := time.LoadLocation(*update.Timezone); err != nil {
+			return "Invalid timezone"
+		}
+	}
+	if update.Locale != nil && (len(*update.Locale) > 35 || !localePattern.MatchString(*update.Locale)) {
+		return "Invalid locale"
+	}
+	if update.WeekStart != nil && (*update.WeekStart < 0 || *update.WeekStart > 6) {
+		return "Week start must be between 0 (Sunday) and 6 (Saturday)"
+	}
+	if update.DefaultPriority != nil && !isValidPriority(*update.DefaultPriority) {
+		return "Invalid priority value"
+	}
+	if update.DefaultCategory != nil && *update.DefaultCategory != "" && !isValidCategory(*update.DefaultCategory) {
+		return "Invalid category value"
+	}
+	if update.WorkDayStart != nil {
+		if _, ok := parseClock(*update.WorkDayStart); !ok {
+			return "Invalid work_day_start; use HH:MM"
+		}
+	}
+	if update.WorkDayEnd != nil {
+		if _, ok := parseClock(*update.WorkDayEnd); !ok {
+			return "Invalid work_day_end; use HH:MM"
+		}
+	}
+	if update.WorkDays != nil {
+		if len(update.WorkDays) == 0 {
+			return "At least one working day is required"
+		}
+		seen := make(map[int]bool)
+		for _, d := range update.WorkDays {
+			if d < 0 || d > 6 || seen[d] {
+				return "Working days must be distinct days between 0 (Sunday) and 6 (Saturday)"
+			}
+			seen[d] = true
+		}
+	}
+	return ""
+}
+
+// parseClock reads an HH:MM time of day as minutes after midnight; 24:00
+// ends a working day at midnight
+func parseClock(s string) (int, bool) {
+	if s == "24:00" {
+		return 24 * 60, true
+	}
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, false
+	}
+	return t.Hour()*60 + t.Minute(), true
+}
+
+// formatClock writes minutes after midnight as HH:MM
+func formatClock(minutes int) string {
+	return fmt.Sprintf("%02d:%02d", minutes/60, minutes%60)
+}
+
+// loadProfile reads a user's profile
+func loadProfile(q queryer, userID int) (models.Profile, error) {
+	var p models.Profile
+	var defaultCategory sql.NullString
+	var workDayStart, workDayEnd int
+	var workDays []int64
+	err := q.QueryRow(`
+		SELECT id, email, display_name, timezone, locale, week_start, default_priority, default_category,
+		       work_day_start, work_day_end, work_days
+		FROM users
+		WHERE id = $1
+	`, userID).Scan(&p.ID, &p.Email, &p.DisplayName, &p.Timezone, &p.Locale, &p.WeekStart,
+		&p.DefaultPriority, &defaultCategory, &workDayStart, &workDayEnd, pq.Array(&workDays))
+	p.DefaultCategory = defaultCategory.String
+	p.WorkDayStart = formatClock(workDayStart)
+	p.WorkDayEnd = formatClock(workDayEnd)
+	p.WorkDays = []int{}
+	for _, d := range workDays {
+		p.WorkDays = append(p.WorkDays, int(d))
+	}
+	return p, err
+}
+
+// profileLocation returns the profile's time zone, or UTC if it can't be loaded
+func profileLocation(p models.Profile) *time.Location {
+	if loc, err := time.LoadLocation(p.Timezone); err == nil && p.Timezone != "" {
+		return loc
+	}
+	return time.UTC
+}
+
+// startOfDay returns midnight of t's day in loc
+func startOfDay(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+}
+
+// startOfWeek returns midnight of the first day of t's week in loc
+func startOfWeek(t time.Time, loc *time.Location, weekStart int) time.Time {
+	day := startOfDay(t, loc)
+	offset := (int(day.Weekday()) - weekStart + 7) % 7
+	return day.AddDate(0, 0, -offset)
+}
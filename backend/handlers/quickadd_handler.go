@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"task-manager/models"
+	"task-manager/quickadd"
+)
+
+const maxQuickAddLength = 1000
+
+// QuickAdd parses a single line of text such as "Pay rent every month on the
+// 1st #Personal !high" into a task. By default it only returns the
+// interpretation so the client can confirm it; with "create": true the task
+// is created as well. Dates are read in the time zone from the request body
+// or the X-Timezone header, falling back to the one in the user's profile.
+// Priority and category default to the profile's defaults.
+func (h *TaskHandler) QuickAdd(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.QuickAddRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	req.Text = strings.TrimSpace(req.Text)
+	if req.Text == "" {
+		http.Error(w, "Text is required", http.StatusBadRequest)
+		return
+	}
+	if len(req.Text) > maxQuickAddLength {
+		http.Error(w, "Text must be at most 1000 characters long", http.StatusBadRequest)
+		return
+	}
+	if req.Category != "" && !isValidCategory(req.Category) {
+		http.Error(w, "Invalid category value", http.StatusBadRequest)
+		return
+	}
+
+	profile, err := loadProfile(h.db, userID)
+	if err != nil {
+		log.Printf("Error loading profile: %v", err)
+		http.Error(w, "Error loading profile", http.StatusInternalServerError)
+		return
+	}
+	loc := profileLocation(profile)
+	timezone := req.Timezone
+	if timezone == "" {
+		timezone = r.Header.Get("X-Timezone")
+	}
+	if timezone != "" {
+		if loc, err = time.LoadLocation(timezone); err != nil || timezone == "Local" {
+			http.Error(w, "Invalid timezone", http.StatusBadRequest)
+			return
+		}
+	}
+
+	parsed := quickadd.Parse(req.Text, quickadd.Options{
+		Now:        time.Now(),
+		Location:   loc,
+		Categories: sortedCategories(),
+	})
+
+	resp := models.QuickAddResponse{
+		Task: models.TaskCreate{
+			Title:      parsed.Title,
+			Priority:   parsed.Priority,
+			Category:   parsed.Category,
+			Tags:       parsed.Tags,
+			DueDate:    parsed.DueDate,
+			Recurrence: parsed.Recurrence,
+		},
+		Tokens:   []models.QuickAddToken{},
+		Timezone: loc.String(),
+	}
+	if resp.Task.Category == "" {
+		resp.Task.Category = req.Category
+	}
+	if resp.Task.Category == "" {
+		resp.Task.Category = profile.DefaultCategory
+	}
+	if resp.Task.Priority == "" {
+		resp.Task.Priority = profile.DefaultPriority
+	}
+	for _, t := range parsed.Tokens {
+		resp.Tokens = append(resp.Tokens, models.QuickAddToken{Kind: t.Kind, Text: t.Text, Value: t.Value})
+	}
+	resp.Error = validateTaskCreate(&resp.Task)
+
+	if !req.Create {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+		return
+	}
+	if resp.Error != "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(resp)
+		return
+	}
+
+	tx, err := beginTaskTx(h.db, userID)
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		http.Error(w, "Error starting transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	task, err := createTaskTx(tx, userID, resp.Task)
+	if _, ok := err.(*taskRuleError); ok {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	if err != nil {
+		log.Printf("Error creating quick-add task: %v", err)
+		http.Error(w, "Error creating task", http.StatusInternalServerError)
+		return
+	}
+	if err = tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		http.Error(w, "Error committing transaction", http.StatusInternalServerError)
+		return
+	}
+	resp.Created = &task
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"task-manager/models"
+)
+
+// riskHorizonDays bounds how far ahead working time is counted; estimates
+// never add up to that much work, so later due dates are safe anyway
+const riskHorizonDays = 3 * 366
+
+// workHours is a user's working week in their time zone
+type workHours struct {
+	loc        *time.Location
+	start, end int // minutes after midnight
+	days       [7]bool
+}
+
+func newWorkHours(p models.Profile) workHours {
+	wh := workHours{loc: profileLocation(p)}
+	wh.start, _ = parseClock(p.WorkDayStart)
+	wh.end, _ = parseClock(p.WorkDayEnd)
+	for _, d := range p.WorkDays {
+		if d >= 0 && d < 7 {
+			wh.days[d] = true
+		}
+	}
+	return wh
+}
+
+// window returns the working hours of the day starting at midnight day, and
+// false on days off
+func (wh workHours) window(day time.Time) (time.Time, time.Time, bool) {
+	if !wh.days[day.Weekday()] {
+		return day, day, false
+	}
+	// time.Date normalizes minutes past 59 and handles DST changes
+	start := time.Date(day.Year(), day.Month(), day.Day(), 0, wh.start, 0, 0, wh.loc)
+	end := time.Date(day.Year(), day.Month(), day.Day(), 0, wh.end, 0, 0, wh.loc)
+	return start, end, true
+}
+
+// between returns the working time in [from, to)
+func (wh workHours) between(from, to time.Time) time.Duration {
+	var total time.Duration
+	day := startOfDay(from, wh.loc)
+	for i := 0; i < riskHorizonDays && day.Before(to); i++ {
+		if start, end, ok := wh.window(day); ok {
+			if start.Before(from) {
+				start = from
+			}
+			if end.After(to) {
+				end = to
+			}
+			if end.After(start) {
+				total += end.Sub(start)
+			}
+		}
+		day = day.AddDate(0, 0, 1)
+	}
+	return total
+}
+
+// after returns the moment work of length d started at from would be done,
+// or false when that is beyond the horizon
+func (wh workHours) after(from time.Time, d time.Duration) (time.Time, bool) {
+	if d <= 0 {
+		return from, true
+	}
+	day := startOfDay(from, wh.loc)
+	for i := 0; i < riskHorizonDays; i++ {
+		if start, end, ok := wh.window(day); ok && end.After(from) {
+			if start.Before(from) {
+				start = from
+			}
+			if end.Sub(start) >= d {
+				return start.Add(d), true
+			}
+			d -= end.Sub(start)
+		}
+		day = day.AddDate(0, 0, 1)
+	}
+	return time.Time{}, false
+}
+
+// GetAtRiskTasks schedules the user's open tasks that have both a due date
+// and an estimate, earliest due date first, within their working hours, and
+// lists the tasks whose work can't be finished by their due date. Time
+// already tracked on a task counts against its estimate. ?all=true lists
+// every scheduled task, flagged with at_risk.
+func (h *TaskHandler) GetAtRiskTasks(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	includeAll := r.URL.Query().Get("all") == "true"
+
+	profile, err := loadProfile(h.db, userID)
+	if err != nil {
+		http.Error(w, "Error loading profile", http.StatusInternalServerError)
+		return
+	}
+	wh := newWorkHours(profile)
+
+	query := newTaskQuery(userID)
+	query.where("t.completed_at IS NULL")
+	query.where("t.due_date IS NOT NULL")
+	query.where("t.estimate_minutes IS NOT NULL")
+	rows, err := h.db.Query(`
+		SELECT `+taskColumns+`
+		FROM tasks t
+		`+query.whereClause()+`
+		ORDER BY t.due_date, t.id
+	`, query.args...)
+	if err != nil {
+		log.Printf("Error fetching tasks to schedule: %v", err)
+		http.Error(w, "Error fetching tasks", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	report := models.AtRiskReport{
+		GeneratedAt:  now.UTC(),
+		Timezone:     wh.loc.String(),
+		WorkDayStart: profile.WorkDayStart,
+		WorkDayEnd:   profile.WorkDayEnd,
+		WorkDays:     profile.WorkDays,
+		Tasks:        []models.AtRiskTask{},
+	}
+
+	// Tasks come in due date order, so both the working time before each due
+	// date and the projected finish are carried forward from the previous task
+	var cumulative, available time.Duration
+	availableUntil, finish, finishKnown := now, now, true
+	for rows.Next() {
+		task, err := scanTask(rows)
+		if err != nil {
+			http.Error(w, "Error scanning task", http.StatusInternalServerError)
+			return
+		}
+		report.Checked++
+
+		remaining := time.Duration(*task.EstimateMinutes)*time.Minute - time.Duration(task.TrackedSeconds)*time.Second
+		if remaining < 0 {
+			remaining = 0
+		}
+		cumulative += remaining
+		if task.DueDate.After(availableUntil) {
+			available += wh.between(availableUntil, *task.DueDate)
+			availableUntil = *task.DueDate
+		}
+
+		item := models.AtRiskTask{
+			Task:              task,
+			RemainingMinutes:  ceilMinutes(remaining),
+			CumulativeMinutes: ceilMinutes(cumulative),
+			AvailableMinutes:  int(available / time.Minute),
+			AtRisk:            cumulative > available,
+		}
+		if item.AtRisk {
+			item.ShortfallMinutes = ceilMinutes(cumulative - available)
+			report.AtRisk++
+		}
+		if finishKnown {
+			if finish, finishKnown = wh.after(finish, remaining); finishKnown {
+				projected := finish.UTC()
+				item.ProjectedFinish = &projected
+			}
+		}
+		if item.AtRisk || includeAll {
+			report.Tasks = append(report.Tasks, item)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "Error fetching tasks", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+func ceilMinutes(d time.Duration) int {
+	return int((d + time.Minute - 1) / time.Minute)
+}
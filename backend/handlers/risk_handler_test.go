@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"task-manager/models"
+)
+
+func TestWorkHours(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("time zone data not available")
+	}
+	at := func(month time.Month, day, hour, min int) time.Time {
+		return time.Date(2026, month, day, hour, min, 0, 0, berlin)
+	}
+	// Office hours on weekdays; summer time starts on Sunday 29 March and
+	// ends on Sunday 25 October 2026
+	office := newWorkHours(models.Profile{
+		Timezone: "Europe/Berlin", WorkDayStart: "09:00", WorkDayEnd: "17:00", WorkDays: []int{1, 2, 3, 4, 5},
+	})
+	// A night shift every day, whose hours cross the DST changes
+	night := newWorkHours(models.Profile{
+		Timezone: "Europe/Berlin", WorkDayStart: "00:00", WorkDayEnd: "06:00", WorkDays: []int{0, 1, 2, 3, 4, 5, 6},
+	})
+	none := newWorkHours(models.Profile{Timezone: "Europe/Berlin", WorkDayStart: "09:00", WorkDayEnd: "17:00"})
+
+	betweenTests := []struct {
+		name     string
+		wh       workHours
+		from, to time.Time
+		want     time.Duration
+	}{
+		{"over a weekend with a DST change", office, at(3, 27, 12, 0), at(3, 30, 12, 0), 8 * time.Hour},
+		{"weekend only", office, at(3, 28, 10, 0), at(3, 29, 18, 0), 0},
+		{"whole week", office, at(3, 23, 0, 0), at(3, 30, 0, 0), 40 * time.Hour},
+		{"outside hours on both ends", office, at(3, 30, 7, 0), at(3, 30, 19, 0), 8 * time.Hour},
+		{"empty range", office, at(3, 30, 10, 0), at(3, 30, 10, 0), 0},
+		{"reversed range", office, at(3, 30, 12, 0), at(3, 30, 10, 0), 0},
+		{"spring forward night", night, at(3, 28, 0, 0), at(3, 30, 0, 0), 11 * time.Hour},
+		{"fall back night", night, at(10, 25, 0, 0), at(10, 26, 0, 0), 7 * time.Hour},
+		{"no work days", none, at(3, 23, 0, 0), at(3, 30, 0, 0), 0},
+	}
+	for _, tt := range betweenTests {
+		if got := tt.wh.between(tt.from, tt.to); got != tt.want {
+			t.Errorf("between, %s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	afterTests := []struct {
+		name string
+		wh   workHours
+		from time.Time
+		d    time.Duration
+		want time.Time
+		ok   bool
+	}{
+		{"across a weekend with a DST change", office, at(3, 27, 15, 0), 4 * time.Hour, at(3, 30, 11, 0), true},
+		{"starting on a Saturday", office, at(3, 28, 10, 0), time.Hour, at(3, 30, 10, 0), true},
+		{"starting before hours", office, at(3, 30, 7, 0), 8 * time.Hour, at(3, 30, 17, 0), true},
+		{"starting after hours", office, at(3, 27, 18, 0), 30 * time.Minute, at(3, 30, 9, 30), true},
+		{"nothing to do", office, at(3, 28, 10, 0), 0, at(3, 28, 10, 0), true},
+		{"spring forward night, exactly", night, at(3, 29, 0, 0), 5 * time.Hour, at(3, 29, 6, 0), true},
+		{"spring forward night, spilling over", night, at(3, 29, 0, 0), 6 * time.Hour, at(3, 30, 1, 0), true},
+		{"fall back night", night, at(10, 25, 0, 0), 7 * time.Hour, at(10, 25, 6, 0), true},
+		{"no work days", none, at(3, 23, 0, 0), time.Hour, time.Time{}, false},
+	}
+	for _, tt := range afterTests {
+		got, ok := tt.wh.after(tt.from, tt.d)
+		if ok != tt.ok || !got.Equal(tt.want) {
+			t.Errorf("after, %s: got %v, %v, want %v, %v", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+}
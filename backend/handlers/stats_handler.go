@@ -0,0 +1,244 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"task-manager/models"
+)
+
+const (
+	defaultStatsDays = 30
+	maxStatsDays     = 366
+)
+
+type StatsHandler struct {
+	db *sql.DB
+}
+
+func NewStatsHandler(db *sql.DB) *StatsHandler {
+	return &StatsHandler{db: db}
+}
+
+// GetStats returns dashboard statistics for the authenticated user's live
+// tasks. ?from= and ?to= (YYYY-MM-DD, inclusive) select the days covered by
+// the completion figures and the daily series; they default to the last 30
+// days. Days are taken in the time zone from the user's profile. A task
+// counts as completed while it is in a done state of its workflow.
+func (h *StatsHandler) GetStats(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	profile, err := loadProfile(h.db, userID)
+	if err != nil {
+		http.Error(w, "Error loading profile", http.StatusInternalServerError)
+		return
+	}
+	loc := profileLocation(profile)
+	now := time.Now()
+	today := startOfDay(now, loc)
+
+	from, to, ok := dateRange(w, r, today, loc)
+	if !ok {
+		return
+	}
+	// The range ends at midnight after the last day
+	end := to.AddDate(0, 0, 1)
+
+	stats := models.Stats{
+		From:       from.Format("2006-01-02"),
+		To:         to.Format("2006-01-02"),
+		Timezone:   loc.String(),
+		ByStatus:   map[string]int{"pending": 0, "in_progress": 0, "completed": 0},
+		ByPriority: map[string]int{"low": 0, "medium": 0, "high": 0},
+		ByCategory: map[string]int{},
+		Daily:      []models.DailyStats{},
+	}
+	for _, category := range sortedCategories() {
+		stats.ByCategory[category] = 0
+	}
+
+	if err := h.loadCounts(&stats, userID, now, today); err != nil {
+		log.Printf("Error computing task counts: %v", err)
+		http.Error(w, "Error computing statistics", http.StatusInternalServerError)
+		return
+	}
+	if err := h.loadCompletion(&stats, userID, from, end); err != nil {
+		log.Printf("Error computing completion statistics: %v", err)
+		http.Error(w, "Error computing statistics", http.StatusInternalServerError)
+		return
+	}
+	if err := h.loadDaily(&stats, userID, from, to, end, loc); err != nil {
+		log.Printf("Error computing daily statistics: %v", err)
+		http.Error(w, "Error computing statistics", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+// dateRange reads the ?from= and ?to= days (YYYY-MM-DD, inclusive) in loc,
+// defaulting to the 30 days up to today. It writes the error response and
+// returns false if they are invalid.
+func dateRange(w http.ResponseWriter, r *http.Request, today time.Time, loc *time.Location) (time.Time, time.Time, bool) {
+	var err error
+	from, to := today.AddDate(0, 0, -(defaultStatsDays-1)), today
+	if v := r.URL.Query().Get("from"); v != "" {
+		if from, err = time.ParseInLocation("2006-01-02", v, loc); err != nil {
+			http.Error(w, "Invalid from date; use YYYY-MM-DD", http.StatusBadRequest)
+			return from, to, false
+		}
+	}
+	if v := r.URL.Query().Get("to"); v != "" {
+		if to, err = time.ParseInLocation("2006-01-02", v, loc); err != nil {
+			http.Error(w, "Invalid to date; use YYYY-MM-DD", http.StatusBadRequest)
+			return from, to, false
+		}
+	}
+	if to.Before(from) {
+		http.Error(w, "from must not be after to", http.StatusBadRequest)
+		return from, to, false
+	}
+	if to.Sub(from) > maxStatsDays*24*time.Hour {
+		http.Error(w, "The range can be at most 366 days", http.StatusBadRequest)
+		return from, to, false
+	}
+	return from, to, true
+}
+
+// loadCounts fills in the totals by status, priority and category and the due date counts
+func (h *StatsHandler) loadCounts(stats *models.Stats, userID int, now, today time.Time) error {
+	rows, err := h.db.Query(`
+		SELECT GROUPING(status), GROUPING(priority), GROUPING(category),
+		       COALESCE(status, ''), COALESCE(priority, ''), COALESCE(category, ''), count(*)
+		FROM tasks
+		WHERE user_id = $1 AND is_deleted = false
+		GROUP BY GROUPING SETS ((status), (priority), (category))
+	`, userID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var noStatus, noPriority, noCategory int
+		var status, priority, category string
+		var count int
+		if err := rows.Scan(&noStatus, &noPriority, &noCategory, &status, &priority, &category, &count); err != nil {
+			return err
+		}
+		switch {
+		case noStatus == 0:
+			stats.ByStatus[status] = count
+			stats.Total += count
+		case noPriority == 0:
+			stats.ByPriority[priority] = count
+		case noCategory == 0:
+			stats.ByCategory[category] = count
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	return h.db.QueryRow(`
+		SELECT count(*) FILTER (WHERE due_date < $2 AND completed_at IS NULL),
+		       count(*) FILTER (WHERE due_date >= $3 AND due_date < $4)
+		FROM tasks
+		WHERE user_id = $1 AND is_deleted = false
+	`, userID, now, today, today.AddDate(0, 0, 1)).Scan(&stats.Overdue, &stats.DueToday)
+}
+
+// loadCompletion fills in the completion rate and lead times for the range [from, end)
+func (h *StatsHandler) loadCompletion(stats *models.Stats, userID int, from, end time.Time) error {
+	var created, createdCompleted int
+	err := h.db.QueryRow(`
+		SELECT count(*), count(*) FILTER (WHERE completed_at IS NOT NULL)
+		FROM tasks
+		WHERE user_id = $1 AND is_deleted = false AND created_at >= $2 AND created_at < $3
+	`, userID, from, end).Scan(&created, &createdCompleted)
+	if err != nil {
+		return err
+	}
+	if created > 0 {
+		stats.CompletionRate = float64(createdCompleted) / float64(created)
+	}
+
+	var average, median sql.NullFloat64
+	err = h.db.QueryRow(`
+		SELECT count(*),
+		       avg(EXTRACT(EPOCH FROM completed_at - created_at)) / 3600,
+		       percentile_cont(0.5) WITHIN GROUP (ORDER BY EXTRACT(EPOCH FROM completed_at - created_at)) / 3600
+		FROM tasks
+		WHERE user_id = $1 AND is_deleted = false
+			AND completed_at >= $2 AND completed_at < $3
+	`, userID, from, end).Scan(&stats.CompletedInRange, &average, &median)
+	if err != nil {
+		return err
+	}
+	if average.Valid {
+		stats.AverageLeadTimeHours = &average.Float64
+	}
+	if median.Valid {
+		stats.MedianLeadTimeHours = &median.Float64
+	}
+	return nil
+}
+
+// loadDaily fills in the per-day series. The running completion rate counts
+// every task created up to the end of each day, including before the range.
+func (h *StatsHandler) loadDaily(stats *models.Stats, userID int, from, to, end time.Time, loc *time.Location) error {
+	rows, err := h.db.Query(`
+		WITH days AS (
+			SELECT generate_series($2::date, $3::date, interval '1 day')::date AS day
+		), created AS (
+			SELECT (created_at AT TIME ZONE $6)::date AS day, count(*) AS n
+			FROM tasks
+			WHERE user_id = $1 AND is_deleted = false AND created_at >= $4 AND created_at < $5
+			GROUP BY 1
+		), completed AS (
+			SELECT (completed_at AT TIME ZONE $6)::date AS day, count(*) AS n
+			FROM tasks
+			WHERE user_id = $1 AND is_deleted = false
+				AND completed_at >= $4 AND completed_at < $5
+			GROUP BY 1
+		), earlier AS (
+			SELECT count(*) AS created,
+			       count(*) FILTER (WHERE completed_at < $4) AS completed
+			FROM tasks
+			WHERE user_id = $1 AND is_deleted = false AND created_at < $4
+		)
+		SELECT to_char(days.day, 'YYYY-MM-DD'),
+		       COALESCE(created.n, 0),
+		       COALESCE(completed.n, 0),
+		       earlier.created + sum(COALESCE(created.n, 0)) OVER (ORDER BY days.day),
+		       earlier.completed + sum(COALESCE(completed.n, 0)) OVER (ORDER BY days.day)
+		FROM days
+		CROSS JOIN earlier
+		LEFT JOIN created ON created.day = days.day
+		LEFT JOIN completed ON completed.day = days.day
+		ORDER BY days.day
+	`, userID, from.Format("2006-01-02"), to.Format("2006-01-02"), from, end, loc.String())
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var day models.DailyStats
+		var createdSoFar, completedSoFar int
+		if err := rows.Scan(&day.Date, &day.Created, &day.Completed, &createdSoFar, &completedSoFar); err != nil {
+			return err
+		}
+		if createdSoFar > 0 {
+			day.CompletionRate = float64(completedSoFar) / float64(createdSoFar)
+		}
+		stats.Daily = append(stats.Daily, day)
+	}
+	return rows.Err()
+}
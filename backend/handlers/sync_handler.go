@@ -0,0 +1,283 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"task-manager/models"
+)
+
+const (
+	defaultSyncPageSize = 500
+	maxSyncPageSize     = 1000
+)
+
+// GetSyncChanges returns the user's tasks changed or deleted after the
+// change sequence number in ?since=, in the order they changed. Without
+// ?since= it returns every live task, to start from. Pages hold ?limit=
+// changes (500 by default, at most 1000); while has_more is set, the
+// returned cursor fetches the next page.
+func (h *TaskHandler) GetSyncChanges(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	since := int64(-1)
+	if v := r.URL.Query().Get("since"); v != "" {
+		var err error
+		since, err = strconv.ParseInt(v, 10, 64)
+		if err != nil || since < 0 {
+			http.Error(w, "Invalid since cursor", http.StatusBadRequest)
+			return
+		}
+	}
+	limit := defaultSyncPageSize
+	if v := r.URL.Query().Get("limit"); v != "" {
+		var err error
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxSyncPageSize {
+			http.Error(w, fmt.Sprintf("Invalid limit; use 1 to %d", maxSyncPageSize), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// One snapshot for the changes and the user's sequence number, so the
+	// cursor covers exactly what was returned
+	tx, err := h.db.BeginTx(r.Context(), &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		http.Error(w, "Error starting transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+		SELECT `+taskColumns+`, t.is_deleted, t.change_seq
+		FROM tasks t
+		WHERE t.user_id = $1 AND t.change_seq > $2 AND ($2 >= 0 OR NOT t.is_deleted)
+		ORDER BY t.change_seq
+		LIMIT $3
+	`, userID, since, limit+1)
+	if err != nil {
+		log.Printf("Error fetching changes: %v", err)
+		http.Error(w, "Error fetching changes", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	changes := models.SyncChanges{Tasks: []models.Task{}, Deleted: []models.SyncTombstone{}}
+	lastSeq := since
+	for n := 0; rows.Next(); n++ {
+		if n == limit {
+			changes.HasMore = true
+			break
+		}
+		var deleted bool
+		task, err := scanTask(scanAppender{row: rows, extra: []interface{}{&deleted, &lastSeq}})
+		if err != nil {
+			http.Error(w, "Error scanning task", http.StatusInternalServerError)
+			return
+		}
+		if deleted {
+			changes.Deleted = append(changes.Deleted, models.SyncTombstone{ID: task.ID, DeletedAt: task.UpdatedAt})
+		} else {
+			changes.Tasks = append(changes.Tasks, task)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "Error fetching changes", http.StatusInternalServerError)
+		return
+	}
+	rows.Close()
+
+	// On the last page the cursor moves to the user's latest change, which
+	// also skips tombstones left out of a full sync
+	if !changes.HasMore {
+		var current int64
+		err = tx.QueryRow(`SELECT task_change_seq FROM users WHERE id = $1`, userID).Scan(&current)
+		if err != nil {
+			http.Error(w, "Error fetching changes", http.StatusInternalServerError)
+			return
+		}
+		if current > lastSeq {
+			lastSeq = current
+		}
+	}
+	if lastSeq < 0 {
+		lastSeq = 0
+	}
+	changes.Cursor = strconv.FormatInt(lastSeq, 10)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(changes)
+}
+
+// PushSyncChanges applies a batch of client mutations in order, in one
+// transaction. Each mutation succeeds or fails on its own; a mutation
+// whose base_version no longer matches the task is reported as a conflict
+// along with the task as it is now, and the client decides what to keep.
+// With TASK_REQUIRE_IF_MATCH, updates and deletes must carry a base_version.
+func (h *TaskHandler) PushSyncChanges(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var push models.SyncPush
+	if err := json.NewDecoder(r.Body).Decode(&push); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if msg := validateSyncPush(&push, h.requireIfMatch); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	profile, err := loadProfile(h.db, userID)
+	if err != nil {
+		http.Error(w, "Error loading profile", http.StatusInternalServerError)
+		return
+	}
+
+	tx, err := beginTaskTx(h.db, userID)
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		http.Error(w, "Error starting transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	resp := models.SyncPushResponse{Results: make([]models.SyncResult, 0, len(push.Mutations))}
+	for _, m := range push.Mutations {
+		if _, err := tx.Exec("SAVEPOINT sync_mutation"); err != nil {
+			http.Error(w, "Error creating savepoint", http.StatusInternalServerError)
+			return
+		}
+
+		result := applySyncMutation(tx, userID, profile, m)
+		release := "RELEASE SAVEPOINT sync_mutation"
+		switch result.Status {
+		case "applied":
+			resp.Applied++
+		case "conflict":
+			resp.Conflicts++
+		default:
+			resp.Failed++
+			release = "ROLLBACK TO SAVEPOINT sync_mutation"
+		}
+		if _, err := tx.Exec(release); err != nil {
+			http.Error(w, "Error releasing savepoint", http.StatusInternalServerError)
+			return
+		}
+		resp.Results = append(resp.Results, result)
+	}
+
+	if err = tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		http.Error(w, "Error committing transaction", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// applySyncMutation applies one mutation inside the push transaction
+func applySyncMutation(tx *sql.Tx, userID int, profile models.Profile, m models.SyncMutation) models.SyncResult {
+	result := models.SyncResult{ClientID: m.ClientID}
+	failed := func(err error) models.SyncResult {
+		result.Status, result.Error = "failed", bulkErrorMessage(err)
+		return result
+	}
+
+	if m.Op == "create" {
+		taskCreate := *m.Task
+		applyProfileDefaults(&taskCreate, profile)
+		if msg := validateTaskCreate(&taskCreate); msg != "" {
+			result.Status, result.Error = "failed", msg
+			return result
+		}
+		task, err := createTaskTx(tx, userID, taskCreate)
+		if err != nil {
+			return failed(err)
+		}
+		result.Status, result.Task = "applied", &task
+		return result
+	}
+
+	current, err := lockTask(tx, m.TaskID, userID, false)
+	if err == errTaskNotFound && m.Op == "delete" {
+		// Deleting a task that was deleted elsewhere already has its effect
+		if _, err := lockTask(tx, m.TaskID, userID, true); err == nil {
+			result.Status = "applied"
+			return result
+		}
+	}
+	if err != nil {
+		return failed(err)
+	}
+	if m.BaseVersion != nil && *m.BaseVersion != current.Version {
+		result.Status, result.Task = "conflict", &current
+		return result
+	}
+
+	if m.Op == "delete" {
+		if err := deleteTaskTx(tx, userID, m.TaskID); err != nil {
+			return failed(err)
+		}
+		result.Status = "applied"
+		return result
+	}
+	task, err := bulkUpdate(tx, userID, m.TaskID, *m.Fields)
+	if err != nil {
+		return failed(err)
+	}
+	result.Status, result.Task = "applied", task
+	return result
+}
+
+// validateSyncPush returns an error message if a mutation is malformed.
+// requireVersion makes base_version mandatory on updates and deletes, as
+// TASK_REQUIRE_IF_MATCH does for If-Match.
+func validateSyncPush(push *models.SyncPush, requireVersion bool) string {
+	if len(push.Mutations) == 0 {
+		return "At least one mutation is required"
+	}
+	if len(push.Mutations) > maxBulkItems {
+		return fmt.Sprintf("At most %d mutations can be pushed in one request", maxBulkItems)
+	}
+	for i, m := range push.Mutations {
+		var msg string
+		switch m.Op {
+		case "create":
+			if m.Task == nil {
+				msg = "task is required to create a task"
+			}
+		case "update":
+			if m.TaskID <= 0 || m.Fields == nil {
+				msg = "task_id and fields are required to update a task"
+			} else {
+				msg = validateBulkFields(m.Fields)
+			}
+		case "delete":
+			if m.TaskID <= 0 {
+				msg = "task_id is required to delete a task"
+			}
+		default:
+			msg = "op must be create, update or delete"
+		}
+		if msg == "" && m.Op != "create" && requireVersion && m.BaseVersion == nil {
+			msg = "base_version is required"
+		}
+		if msg != "" {
+			return fmt.Sprintf("Mutation %d: %s", i+1, msg)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,590 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+	"task-manager/models"
+)
+
+const (
+	defaultTagColor  = "#808080"
+	maxTagNameLength = 50
+)
+
+var tagColorPattern = regexp.MustCompile(`^#[0-9A-Fa-f]{6}$`)
+
+type TagHandler struct {
+	db *sql.DB
+}
+
+func NewTagHandler(db *sql.DB) *TagHandler {
+	return &TagHandler{db: db}
+}
+
+// GetTags lists the authenticated user's tags with the number of live tasks using each
+func (h *TagHandler) GetTags(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	rows, err := h.db.Query(`
+		SELECT g.id, g.name, g.color, g.created_at, g.updated_at,
+		       (SELECT count(*) FROM task_tags tt JOIN tasks t ON t.id = tt.task_id
+		        WHERE tt.tag_id = g.id AND t.is_deleted = false)
+		FROM tags g
+		WHERE g.user_id = $1
+		ORDER BY lower(g.name)
+	`, userID)
+	if err != nil {
+		http.Error(w, "Error fetching tags", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	tags := []models.Tag{}
+	for rows.Next() {
+		var tag models.Tag
+		if err := rows.Scan(&tag.ID, &tag.Name, &tag.Color, &tag.CreatedAt, &tag.UpdatedAt, &tag.TaskCount); err != nil {
+			http.Error(w, "Error scanning tag", http.StatusInternalServerError)
+			return
+		}
+		tags = append(tags, tag)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tags)
+}
+
+// CreateTag creates a new tag for the authenticated user
+func (h *TagHandler) CreateTag(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var tagCreate models.TagCreate
+	if err := json.NewDecoder(r.Body).Decode(&tagCreate); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	tagCreate.Name = strings.TrimSpace(tagCreate.Name)
+	if msg := validateTagName(tagCreate.Name); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	if tagCreate.Color == "" {
+		tagCreate.Color = defaultTagColor
+	}
+	if !tagColorPattern.MatchString(tagCreate.Color) {
+		http.Error(w, "Color must be a hex value like #1a2b3c", http.StatusBadRequest)
+		return
+	}
+
+	var tag models.Tag
+	err := h.db.QueryRow(`
+		INSERT INTO tags (user_id, name, color)
+		VALUES ($1, $2, $3)
+		RETURNING id, name, color, created_at, updated_at
+	`, userID, tagCreate.Name, tagCreate.Color).Scan(&tag.ID, &tag.Name, &tag.Color, &tag.CreatedAt, &tag.UpdatedAt)
+	if isUniqueViolation(err) {
+		http.Error(w, "A tag with that name already exists", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Error creating tag: %v", err)
+		http.Error(w, "Error creating tag", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(tag)
+}
+
+// UpdateTag renames or recolors a tag. Because tasks reference tags by ID,
+// a rename is seen by every tagged task at once.
+func (h *TagHandler) UpdateTag(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	tagID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid tag ID", http.StatusBadRequest)
+		return
+	}
+
+	var tagUpdate models.TagUpdate
+	if err := json.NewDecoder(r.Body).Decode(&tagUpdate); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	tagUpdate.Name = strings.TrimSpace(tagUpdate.Name)
+	if tagUpdate.Name != "" {
+		if msg := validateTagName(tagUpdate.Name); msg != "" {
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+	}
+	if tagUpdate.Color != "" && !tagColorPattern.MatchString(tagUpdate.Color) {
+		http.Error(w, "Color must be a hex value like #1a2b3c", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := beginTaskTx(h.db, userID)
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		http.Error(w, "Error starting transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var name string
+	err = tx.QueryRow(`SELECT name FROM tags WHERE id = $1 AND user_id = $2 FOR UPDATE`, tagID, userID).Scan(&name)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Tag not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error fetching tag", http.StatusInternalServerError)
+		return
+	}
+
+	// A rename changes the tags of every task carrying the tag; a new color doesn't
+	var tasks []models.Task
+	if tagUpdate.Name != "" && tagUpdate.Name != name {
+		if tasks, err = lockTagTasks(tx, userID, tagID); err != nil {
+			http.Error(w, "Error fetching tagged tasks", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	var tag models.Tag
+	err = tx.QueryRow(`
+		UPDATE tags
+		SET name = COALESCE(NULLIF($1, ''), name),
+			color = COALESCE(NULLIF($2, ''), color)
+		WHERE id = $3 AND user_id = $4
+		RETURNING id, name, color, created_at, updated_at
+	`, tagUpdate.Name, tagUpdate.Color, tagID, userID).Scan(&tag.ID, &tag.Name, &tag.Color, &tag.CreatedAt, &tag.UpdatedAt)
+	if isUniqueViolation(err) {
+		http.Error(w, "A tag with that name already exists; merge the tags instead", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Error updating tag: %v", err)
+		http.Error(w, "Error updating tag", http.StatusInternalServerError)
+		return
+	}
+	if err := touchTagTasks(tx, userID, tasks); err != nil {
+		log.Printf("Error updating tagged tasks: %v", err)
+		http.Error(w, "Error updating tagged tasks", http.StatusInternalServerError)
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		http.Error(w, "Error committing transaction", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tag)
+}
+
+// DeleteTag deletes a tag and detaches it from every task
+func (h *TagHandler) DeleteTag(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	tagID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid tag ID", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := beginTaskTx(h.db, userID)
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		http.Error(w, "Error starting transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	tasks, err := lockTagTasks(tx, userID, tagID)
+	if err != nil {
+		http.Error(w, "Error fetching tagged tasks", http.StatusInternalServerError)
+		return
+	}
+	result, err := tx.Exec(`DELETE FROM tags WHERE id = $1 AND user_id = $2`, tagID, userID)
+	if err != nil {
+		log.Printf("Error deleting tag: %v", err)
+		http.Error(w, "Error deleting tag", http.StatusInternalServerError)
+		return
+	}
+	if rowsAffected, err := result.RowsAffected(); err != nil || rowsAffected == 0 {
+		http.Error(w, "Tag not found", http.StatusNotFound)
+		return
+	}
+	if err := touchTagTasks(tx, userID, tasks); err != nil {
+		log.Printf("Error updating tagged tasks: %v", err)
+		http.Error(w, "Error updating tagged tasks", http.StatusInternalServerError)
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		http.Error(w, "Error committing transaction", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// MergeTag moves every task tagged with one tag onto another and deletes the first,
+// all in one transaction
+func (h *TagHandler) MergeTag(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	tagID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid tag ID", http.StatusBadRequest)
+		return
+	}
+
+	var tagMerge models.TagMerge
+	if err := json.NewDecoder(r.Body).Decode(&tagMerge); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if tagMerge.IntoID == 0 || tagMerge.IntoID == tagID {
+		http.Error(w, "into_id must name a different tag", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := beginTaskTx(h.db, userID)
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		http.Error(w, "Error starting transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	// Lock both tags so concurrent merges or deletes can't interleave
+	var found int
+	err = tx.QueryRow(`
+		SELECT count(*) FROM (
+			SELECT id FROM tags WHERE id IN ($1, $2) AND user_id = $3 ORDER BY id FOR UPDATE
+		) locked
+	`, tagID, tagMerge.IntoID, userID).Scan(&found)
+	if err != nil {
+		http.Error(w, "Error fetching tags", http.StatusInternalServerError)
+		return
+	}
+	if found != 2 {
+		http.Error(w, "Tag not found", http.StatusNotFound)
+		return
+	}
+
+	tasks, err := lockTagTasks(tx, userID, tagID)
+	if err != nil {
+		http.Error(w, "Error fetching tagged tasks", http.StatusInternalServerError)
+		return
+	}
+	_, err = tx.Exec(`
+		INSERT INTO task_tags (task_id, tag_id)
+		SELECT task_id, $1 FROM task_tags WHERE tag_id = $2
+		ON CONFLICT DO NOTHING
+	`, tagMerge.IntoID, tagID)
+	if err != nil {
+		log.Printf("Error merging tags: %v", err)
+		http.Error(w, "Error merging tags", http.StatusInternalServerError)
+		return
+	}
+	if _, err := tx.Exec(`DELETE FROM tags WHERE id = $1`, tagID); err != nil {
+		log.Printf("Error deleting merged tag: %v", err)
+		http.Error(w, "Error merging tags", http.StatusInternalServerError)
+		return
+	}
+	if err := touchTagTasks(tx, userID, tasks); err != nil {
+		log.Printf("Error updating tagged tasks: %v", err)
+		http.Error(w, "Error updating tagged tasks", http.StatusInternalServerError)
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		http.Error(w, "Error committing transaction", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AttachTags adds tags to a task by name, creating any tags that don't exist yet
+func (h *TagHandler) AttachTags(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	taskID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid task ID", http.StatusBadRequest)
+		return
+	}
+
+	var taskTags models.TaskTags
+	if err := json.NewDecoder(r.Body).Decode(&taskTags); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if len(taskTags.Tags) == 0 {
+		http.Error(w, "At least one tag is required", http.StatusBadRequest)
+		return
+	}
+	for _, name := range taskTags.Tags {
+		if msg := validateTagName(strings.TrimSpace(name)); msg != "" {
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+	}
+
+	tx, err := beginTaskTx(h.db, userID)
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		http.Error(w, "Error starting transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	task, err := attachTagsTx(tx, userID, taskID, taskTags.Tags)
+	if err == errTaskNotFound {
+		http.Error(w, "Task not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error attaching tags: %v", err)
+		http.Error(w, "Error attaching tags", http.StatusInternalServerError)
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		http.Error(w, "Error committing transaction", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", taskETag(task))
+	json.NewEncoder(w).Encode(task)
+}
+
+// DetachTag removes a tag from a task
+func (h *TagHandler) DetachTag(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	vars := mux.Vars(r)
+	taskID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid task ID", http.StatusBadRequest)
+		return
+	}
+	tagID, err := strconv.Atoi(vars["tagId"])
+	if err != nil {
+		http.Error(w, "Invalid tag ID", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := beginTaskTx(h.db, userID)
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		http.Error(w, "Error starting transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	before, err := lockTask(tx, taskID, userID, false)
+	if err == errTaskNotFound {
+		http.Error(w, "Task not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error fetching task", http.StatusInternalServerError)
+		return
+	}
+
+	result, err := tx.Exec(`
+		DELETE FROM task_tags
+		WHERE task_id = $1 AND tag_id = (SELECT id FROM tags WHERE id = $2 AND user_id = $3)
+	`, taskID, tagID, userID)
+	if err != nil {
+		log.Printf("Error detaching tag: %v", err)
+		http.Error(w, "Error detaching tag", http.StatusInternalServerError)
+		return
+	}
+	if rowsAffected, err := result.RowsAffected(); err != nil || rowsAffected == 0 {
+		http.Error(w, "Tag is not attached to this task", http.StatusNotFound)
+		return
+	}
+	if err := touchTask(tx, taskID); err != nil {
+		http.Error(w, "Error updating task", http.StatusInternalServerError)
+		return
+	}
+
+	after, err := lockTask(tx, taskID, userID, false)
+	if err != nil {
+		http.Error(w, "Error fetching task", http.StatusInternalServerError)
+		return
+	}
+	if err := recordTaskEvent(tx, userID, "updated", &before, &after); err != nil {
+		log.Printf("Error recording task event: %v", err)
+		http.Error(w, "Error recording task history", http.StatusInternalServerError)
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		http.Error(w, "Error committing transaction", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// lockTagTasks locks the user's live tasks carrying a tag, returning them as
+// they are before a change to the tag
+func lockTagTasks(tx *sql.Tx, userID, tagID int) ([]models.Task, error) {
+	return lockTasksWhere(tx, `t.user_id = $1 AND t.is_deleted = false
+		AND t.id IN (SELECT task_id FROM task_tags WHERE tag_id = $2)`, userID, tagID)
+}
+
+// touchTagTasks moves on the tasks returned by lockTagTasks once the tag has
+// changed, so their versions, ETags and sync positions follow the change,
+// and records the change in their history
+func touchTagTasks(tx *sql.Tx, userID int, before []models.Task) error {
+	for i := range before {
+		if err := touchTask(tx, before[i].ID); err != nil {
+			return err
+		}
+		after, err := lockTask(tx, before[i].ID, userID, false)
+		if err != nil {
+			return err
+		}
+		if err := recordTaskEvent(tx, userID, "updated", &before[i], &after); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// attachTagsTx attaches tags to one of the user's tasks by name, creating
+// missing tags, and records the change in the task's history
+func attachTagsTx(tx *sql.Tx, userID, taskID int, names []string) (models.Task, error) {
+	before, err := lockTask(tx, taskID, userID, false)
+	if err != nil {
+		return before, err
+	}
+
+	tagIDs, err := ensureTags(tx, userID, names)
+	if err != nil {
+		return before, err
+	}
+	result, err := tx.Exec(`
+		INSERT INTO task_tags (task_id, tag_id)
+		SELECT $1, unnest($2::int[])
+		ON CONFLICT DO NOTHING
+	`, taskID, pq.Array(tagIDs))
+	if err != nil {
+		return before, err
+	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		if err := touchTask(tx, taskID); err != nil {
+			return before, err
+		}
+	}
+
+	after, err := lockTask(tx, taskID, userID, false)
+	if err != nil {
+		return after, err
+	}
+	if err := recordTaskEvent(tx, userID, "updated", &before, &after); err != nil {
+		return after, err
+	}
+	return after, nil
+}
+
+// ensureTags returns the IDs of the user's tags with the given names,
+// creating any that don't exist yet
+func ensureTags(tx *sql.Tx, userID int, names []string) ([]int64, error) {
+	var cleaned []string
+	for _, name := range names {
+		if name = strings.TrimSpace(name); name != "" {
+			cleaned = append(cleaned, name)
+		}
+	}
+	if len(cleaned) == 0 {
+		return nil, nil
+	}
+
+	_, err := tx.Exec(`
+		INSERT INTO tags (user_id, name)
+		SELECT $1, unnest($2::text[])
+		ON CONFLICT (user_id, (lower(name))) DO NOTHING
+	`, userID, pq.Array(cleaned))
+	if err != nil {
+		return nil, err
+	}
+
+	lowered := make([]string, len(cleaned))
+	for i, name := range cleaned {
+		lowered[i] = strings.ToLower(name)
+	}
+	var ids []int64
+	err = tx.QueryRow(`
+		SELECT COALESCE(array_agg(id), '{}') FROM tags WHERE user_id = $1 AND lower(name) = ANY($2)
+	`, userID, pq.Array(lowered)).Scan(pq.Array(&ids))
+	return ids, err
+}
+
+// validateTagName returns an error message if a tag name is unacceptable
+func validateTagName(name string) string {
+	if name == "" {
+		return "Tag name is required"
+	}
+	if len(name) > maxTagNameLength {
+		return fmt.Sprintf("Tag name must be at most %d characters long", maxTagNameLength)
+	}
+	if strings.Contains(name, ",") {
+		return "Tag name cannot contain commas"
+	}
+	return ""
+}
+
+// isUniqueViolation reports whether err is a PostgreSQL unique constraint violation
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
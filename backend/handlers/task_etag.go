@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"task-manager/models"
+)
+
+// errPreconditionRequired is returned for a write without If-Match when
+// the server requires one
+var errPreconditionRequired = errors.New("If-Match header is required")
+
+// preconditionFailedError is returned when If-Match doesn't name the task's
+// current version; it carries the task as it is now
+type preconditionFailedError struct {
+	current models.Task
+}
+
+func (e *preconditionFailedError) Error() string {
+	return "Task has been changed since it was read"
+}
+
+// taskETag returns the entity tag of a task's current version. Weak tags
+// sent back by clients match too, as etagMatches ignores W/.
+func taskETag(task models.Task) string {
+	return `"` + strconv.Itoa(task.Version) + `"`
+}
+
+// checkIfMatch locks one of the user's live tasks and checks it against the
+// request's If-Match header. Without the header the check passes unless
+// required is set.
+func checkIfMatch(tx *sql.Tx, r *http.Request, userID, taskID int, required bool) (models.Task, error) {
+	header := r.Header.Get("If-Match")
+	if header == "" && required {
+		return models.Task{}, errPreconditionRequired
+	}
+	task, err := lockTask(tx, taskID, userID, false)
+	if err != nil {
+		return task, err
+	}
+	if header != "" && !etagMatches(header, taskETag(task)) {
+		return task, &preconditionFailedError{current: task}
+	}
+	return task, nil
+}
+
+// writePreconditionError answers a failed If-Match check: 428 when the
+// header was required but missing, and 412 with the task's current
+// representation and ETag when it didn't match. It reports false for any
+// other error.
+func writePreconditionError(w http.ResponseWriter, err error) bool {
+	if err == errPreconditionRequired {
+		http.Error(w, "If-Match header is required; send the task's ETag", http.StatusPreconditionRequired)
+		return true
+	}
+	failed, ok := err.(*preconditionFailedError)
+	if !ok {
+		return false
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", taskETag(failed.current))
+	w.WriteHeader(http.StatusPreconditionFailed)
+	json.NewEncoder(w).Encode(failed.current)
+	return true
+}
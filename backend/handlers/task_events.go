@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"task-manager/models"
+)
+
+// taskFields flattens the audited fields of a task into comparable values
+func taskFields(t *models.Task) map[string]interface{} {
+	formatTime := func(tm *time.Time) interface{} {
+		if tm == nil {
+			return nil
+		}
+		return tm.UTC().Format(time.RFC3339)
+	}
+	var estimate interface{}
+	if t.EstimateMinutes != nil {
+		estimate = *t.EstimateMinutes
+	}
+	return map[string]interface{}{
+		"title":            t.Title,
+		"description":      t.Description,
+		"status":           t.Status,
+		"priority":         t.Priority,
+		"category":         t.Category,
+		"due_date":         formatTime(t.DueDate),
+		"completed_at":     formatTime(t.CompletedAt),
+		"tags":             strings.Join(t.Tags, ", "),
+		"recurrence":       t.Recurrence,
+		"estimate_minutes": estimate,
+		// Encoded with sorted keys, so equal values compare equal
+		"custom_fields": customFieldsText(t.CustomFields),
+	}
+}
+
+// customFieldsText encodes custom field values for the history, "" when there are none
+func customFieldsText(values map[string]interface{}) string {
+	if len(values) == 0 {
+		return ""
+	}
+	b, _ := json.Marshal(values)
+	return string(b)
+}
+
+// diffTasks returns the fields whose values differ between two versions of a task.
+// A nil before describes a newly created task.
+func diffTasks(before, after *models.Task) map[string]models.FieldChange {
+	changes := make(map[string]models.FieldChange)
+	afterFields := taskFields(after)
+	beforeFields := make(map[string]interface{})
+	if before != nil {
+		beforeFields = taskFields(before)
+	}
+	for field, to := range afterFields {
+		from := beforeFields[field]
+		if from != to {
+			changes[field] = models.FieldChange{From: from, To: to}
+		}
+	}
+	return changes
+}
+
+// recordTaskEvent writes an audit entry for a task change, and queues any
+// webhook deliveries for it, inside the same transaction
+func recordTaskEvent(tx *sql.Tx, actorID int, action string, before, after *models.Task) error {
+	var taskID int
+	var changes map[string]models.FieldChange
+	switch action {
+	case "deleted":
+		taskID = before.ID
+		changes = map[string]models.FieldChange{"is_deleted": {From: false, To: true}}
+	case "restored":
+		taskID = after.ID
+		changes = map[string]models.FieldChange{"is_deleted": {From: true, To: false}}
+	default:
+		taskID = after.ID
+		changes = diffTasks(before, after)
+		if action == "updated" && len(changes) == 0 {
+			return nil
+		}
+	}
+
+	payload, err := json.Marshal(changes)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		INSERT INTO task_events (task_id, user_id, action, changes)
+		VALUES ($1, $2, $3, $4)
+	`, taskID, actorID, action, payload)
+	if err != nil {
+		return err
+	}
+
+	task := after
+	if action == "deleted" {
+		task = before
+	}
+	return enqueueTaskWebhooks(tx, action, task, changes)
+}
+
+// GetTaskHistory returns the audit history of a task, oldest first.
+// History remains available for soft-deleted tasks.
+func (h *TaskHandler) GetTaskHistory(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	taskID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid task ID", http.StatusBadRequest)
+		return
+	}
+
+	var exists bool
+	err = h.db.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM tasks WHERE id = $1 AND user_id = $2)
+	`, taskID, userID).Scan(&exists)
+	if err != nil {
+		http.Error(w, "Error checking task existence", http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "Task not found", http.StatusNotFound)
+		return
+	}
+
+	rows, err := h.db.Query(`
+		SELECT e.id, e.task_id, e.user_id, COALESCE(u.email, ''), e.action, e.changes, e.created_at
+		FROM task_events e
+		LEFT JOIN users u ON u.id = e.user_id
+		WHERE e.task_id = $1
+		ORDER BY e.created_at ASC, e.id ASC
+	`, taskID)
+	if err != nil {
+		http.Error(w, "Error fetching task history", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	events := []models.TaskEvent{}
+	for rows.Next() {
+		var event models.TaskEvent
+		var actorID sql.NullInt64
+		var changes []byte
+		err := rows.Scan(&event.ID, &event.TaskID, &actorID, &event.ActorEmail,
+			&event.Action, &changes, &event.CreatedAt)
+		if err != nil {
+			http.Error(w, "Error scanning task event", http.StatusInternalServerError)
+			return
+		}
+		if err := json.Unmarshal(changes, &event.Changes); err != nil {
+			http.Error(w, "Error decoding task event", http.StatusInternalServerError)
+			return
+		}
+		event.ActorID = nullIntPtr(actorID)
+		events = append(events, event)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(events)
+}
+
+// nullIntPtr converts a nullable integer column into an optional int
+func nullIntPtr(n sql.NullInt64) *int {
+	if !n.Valid {
+		return nil
+	}
+	v := int(n.Int64)
+	return &v
+}
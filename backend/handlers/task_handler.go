@@ -3,36 +3,107 @@ package handlers
 import (
 	"database/sql"
 	"encoding/json"
+	"io"
 	"log"
 	"net/http"
+	"os"
+	"regexp"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 	"task-manager/models"
 )
 
+// queryer is satisfied by both *sql.DB and *sql.Tx
+type queryer interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
 type TaskHandler struct {
 	db *sql.DB
+	// requireIfMatch makes If-Match mandatory on task writes (TASK_REQUIRE_IF_MATCH=true)
+	requireIfMatch bool
 }
 
 func NewTaskHandler(db *sql.DB) *TaskHandler {
-	return &TaskHandler{db: db}
+	return &TaskHandler{db: db, requireIfMatch: os.Getenv("TASK_REQUIRE_IF_MATCH") == "true"}
 }
 
-// GetTasks retrieves all tasks for the authenticated user
+// GetTasks retrieves all tasks for the authenticated user, optionally filtered by tags
 func (h *TaskHandler) GetTasks(w http.ResponseWriter, r *http.Request) {
 	userID, ok := GetUserIDFromContext(r)
 	if !ok {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
+	query := newTaskQuery(userID)
+
+	// Filter by tags: ?tags=a,b matches tasks with any of them, add &tag_mode=all to require every tag
+	if tags := splitList(r.URL.Query().Get("tags")); len(tags) > 0 {
+		query.withTags(tags, r.URL.Query().Get("tag_mode") == "all")
+	}
+
+	// Filter by parent: ?parent_id= lists a task's subtasks
+	if v := r.URL.Query().Get("parent_id"); v != "" {
+		parentID, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "Invalid parent_id", http.StatusBadRequest)
+			return
+		}
+		query.where("t.parent_id = " + query.arg(parentID))
+	}
+
+	// Filter by due date: ?due=overdue, today or week, in the user's time zone
+	if due := r.URL.Query().Get("due"); due != "" {
+		profile, err := loadProfile(h.db, userID)
+		if err != nil {
+			http.Error(w, "Error loading profile", http.StatusInternalServerError)
+			return
+		}
+		if !query.withDue(due, time.Now(), profileLocation(profile), profile.WeekStart) {
+			http.Error(w, "Invalid due filter; use overdue, today or week", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// ?order=position lists tasks column by column in their board order;
+	// ?order=cf.<key> or -cf.<key> sorts by a custom field
+	orderBy := "t.created_at DESC"
+	fieldOrder := ""
+	switch order := r.URL.Query().Get("order"); {
+	case order == "", order == "created":
+	case order == "position":
+		orderBy = "t.status, t.position, t.id"
+	case strings.HasPrefix(order, "cf.") || strings.HasPrefix(order, "-cf."):
+		fieldOrder = order
+	default:
+		http.Error(w, "Invalid order; use created, position or cf.<key>", http.StatusBadRequest)
+		return
+	}
+
+	// Filter by custom fields: ?cf.<key>=value, or .gte/.lte for number and date fields
+	fieldOrderBy, msg, err := customFieldQuery(h.db, userID, query, r.URL.Query(), fieldOrder)
+	if err != nil {
+		http.Error(w, "Error loading custom fields", http.StatusInternalServerError)
+		return
+	}
+	if msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	if fieldOrderBy != "" {
+		orderBy = fieldOrderBy
+	}
+
 	rows, err := h.db.Query(`
-		SELECT t.id, t.title, t.description, t.status, t.priority, t.category,
-		       t.due_date, t.created_at, t.updated_at, t.completed_at
+		SELECT `+taskColumns+`
 		FROM tasks t
-		WHERE t.is_deleted = false AND t.user_id = $1
-		ORDER BY t.created_at DESC
-	`, userID)
+		`+query.whereClause()+`
+		ORDER BY `+orderBy+`
+	`, query.args...)
 	if err != nil {
 		http.Error(w, "Error fetching tasks", http.StatusInternalServerError)
 		return
@@ -41,23 +112,11 @@ func (h *TaskHandler) GetTasks(w http.ResponseWriter, r *http.Request) {
 
 	var tasks []models.Task
 	for rows.Next() {
-		var task models.Task
-		var dueDate, completedAt sql.NullTime
-		err := rows.Scan(
-			&task.ID, &task.Title, &task.Description, &task.Status,
-			&task.Priority, &task.Category, &dueDate, &task.CreatedAt, &task.UpdatedAt,
-			&completedAt,
-		)
+		task, err := scanTask(rows)
 		if err != nil {
 			http.Error(w, "Error scanning task", http.StatusInternalServerError)
 			return
 		}
-		if dueDate.Valid {
-			task.DueDate = &dueDate.Time
-		}
-		if completedAt.Valid {
-			task.CompletedAt = &completedAt.Time
-		}
 		tasks = append(tasks, task)
 	}
 
@@ -80,7 +139,6 @@ func (h *TaskHandler) CreateTask(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
 		return
 	}
-	log.Printf("Decoded task: %+v", taskCreate)
 
 	// Validate required fields
 	if taskCreate.Title == "" {
@@ -96,12 +154,18 @@ func (h *TaskHandler) CreateTask(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Set default values if not provided
-	if taskCreate.Status == "" {
-		taskCreate.Status = "pending"
+	// Set default values if not provided, preferring the user's own defaults
+	profile, err := loadProfile(h.db, userID)
+	if err != nil {
+		log.Printf("Error loading profile: %v", err)
+		http.Error(w, "Error loading profile", http.StatusInternalServerError)
+		return
 	}
 	if taskCreate.Priority == "" {
-		taskCreate.Priority = "low"
+		taskCreate.Priority = profile.DefaultPriority
+	}
+	if taskCreate.Category == "" {
+		taskCreate.Category = profile.DefaultCategory
 	}
 
 	// Validate status
@@ -116,10 +180,29 @@ func (h *TaskHandler) CreateTask(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	for _, tag := range taskCreate.Tags {
+		if msg := validateTagName(strings.TrimSpace(tag)); msg != "" {
+			log.Printf("Invalid tag: %s", tag)
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+	}
+
+	if taskCreate.EstimateMinutes != nil && !isValidEstimate(*taskCreate.EstimateMinutes) {
+		http.Error(w, "Estimate must be between 1 and 100000 minutes", http.StatusBadRequest)
+		return
+	}
+
+	if taskCreate.Recurrence != "" && !isValidRecurrence(taskCreate.Recurrence) {
+		log.Printf("Invalid recurrence: %s", taskCreate.Recurrence)
+		http.Error(w, "Recurrence must be an RRULE such as FREQ=WEEKLY;BYDAY=MO", http.StatusBadRequest)
+		return
+	}
+
 	log.Printf("Task with defaults: %+v", taskCreate)
 
 	// Start transaction
-	tx, err := h.db.Begin()
+	tx, err := beginTaskTx(h.db, userID)
 	if err != nil {
 		log.Printf("Error starting transaction: %v", err)
 		http.Error(w, "Error starting transaction: "+err.Error(), http.StatusInternalServerError)
@@ -127,25 +210,22 @@ func (h *TaskHandler) CreateTask(w http.ResponseWriter, r *http.Request) {
 	}
 	defer tx.Rollback()
 
-	// Insert task and get the ID
-	var taskID int64
-	query := `
-		INSERT INTO tasks (title, description, status, priority, category, due_date, user_id)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
-		RETURNING id
-	`
-	log.Printf("Executing query: %s with values: %v, %v, %v, %v, %v, %v, %v",
-		query, taskCreate.Title, taskCreate.Description, taskCreate.Status,
-		taskCreate.Priority, taskCreate.Category, taskCreate.DueDate, userID)
-	
-	err = tx.QueryRow(query,
+	// Insert task and record its creation
+	log.Printf("Creating task with values: %v, %v, %v, %v, %v, %v, %v",
 		taskCreate.Title, taskCreate.Description, taskCreate.Status,
-		taskCreate.Priority, taskCreate.Category, taskCreate.DueDate, userID).Scan(&taskID)
+		taskCreate.Priority, taskCreate.Category, taskCreate.DueDate, userID)
+
+	task, err := createTaskTx(tx, userID, taskCreate)
+	if _, ok := err.(*taskRuleError); ok {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
 	if err != nil {
 		log.Printf("Error creating task: %v", err)
 		http.Error(w, "Error creating task: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
+	taskID := int64(task.ID)
 	log.Printf("Task created with ID: %d", taskID)
 
 	if err = tx.Commit(); err != nil {
@@ -160,13 +240,10 @@ func (h *TaskHandler) CreateTask(w http.ResponseWriter, r *http.Request) {
 }
 
 // Helper functions for validation
+// isValidStatus checks the form of a status; whether it belongs to the
+// task's workflow is checked when the task is written
 func isValidStatus(status string) bool {
-	validStatuses := map[string]bool{
-		"pending":     true,
-		"in_progress": true,
-		"completed":   true,
-	}
-	return validStatuses[status]
+	return models.StatusNamePattern.MatchString(status)
 }
 
 func isValidPriority(priority string) bool {
@@ -178,8 +255,102 @@ func isValidPriority(priority string) bool {
 	return validPriorities[priority]
 }
 
-// UpdateTask updates an existing task for the authenticated user
+func isValidCategory(category string) bool {
+	validCategories := map[string]bool{
+		"Work":      true,
+		"Personal":  true,
+		"Shopping":  true,
+		"Health":    true,
+		"Education": true,
+	}
+	return validCategories[category]
+}
+
+// maxEstimateMinutes caps estimates at about 40 weeks of full-time work
+const maxEstimateMinutes = 100000
+
+func isValidEstimate(minutes int) bool {
+	return minutes >= 1 && minutes <= maxEstimateMinutes
+}
+
+// recurrencePattern accepts iCalendar RRULE values with a daily to yearly frequency
+var recurrencePattern = regexp.MustCompile(`^FREQ=(DAILY|WEEKLY|MONTHLY|YEARLY)(;[A-Z]+=[A-Z0-9,+-]+)*$`)
+
+func isValidRecurrence(rrule string) bool {
+	return len(rrule) <= 255 && recurrencePattern.MatchString(rrule)
+}
+
+// taskBelongsToUser reports whether a task exists, isn't deleted and is owned by the user
+func taskBelongsToUser(q queryer, taskID, userID int) (bool, error) {
+	var exists bool
+	err := q.QueryRow(`
+		SELECT EXISTS(
+			SELECT 1 FROM tasks
+			WHERE id = $1 AND is_deleted = false AND user_id = $2
+		)
+	`, taskID, userID).Scan(&exists)
+	return exists, err
+}
+
+// GetTask returns one of the authenticated user's tasks with its ETag.
+// If-None-Match with the current ETag is answered with 304, except while a
+// timer runs on the task: tracked_seconds then grows without the version
+// changing, so the ETag is only good for If-Match and the body is always sent.
+func (h *TaskHandler) GetTask(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	taskID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid task ID", http.StatusBadRequest)
+		return
+	}
+
+	query := newTaskQuery(userID)
+	query.where("t.id = " + query.arg(taskID))
+	var timerRunning bool
+	task, err := scanTask(scanAppender{row: h.db.QueryRow(`
+		SELECT `+taskColumns+`,
+		       EXISTS (SELECT 1 FROM time_entries e WHERE e.task_id = t.id AND e.ended_at IS NULL)
+		FROM tasks t
+		`+query.whereClause(), query.args...), extra: []interface{}{&timerRunning}})
+	if err == sql.ErrNoRows {
+		http.Error(w, "Task not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error fetching task", http.StatusInternalServerError)
+		return
+	}
+
+	etag := taskETag(task)
+	w.Header().Set("ETag", etag)
+	if match := r.Header.Get("If-None-Match"); match != "" && !timerRunning && etagMatches(match, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(task)
+}
+
+// UpdateTask updates an existing task for the authenticated user. Fields
+// left empty keep their values, except the due date and description,
+// which are replaced.
 func (h *TaskHandler) UpdateTask(w http.ResponseWriter, r *http.Request) {
+	h.updateTask(w, r, false)
+}
+
+// PatchTask updates only the fields present in the body; a null due_date
+// clears it
+func (h *TaskHandler) PatchTask(w http.ResponseWriter, r *http.Request) {
+	h.updateTask(w, r, true)
+}
+
+// updateTask applies a PUT or PATCH. With If-Match, the task must still be
+// at that version; otherwise 412 is returned with the task as it is now.
+func (h *TaskHandler) updateTask(w http.ResponseWriter, r *http.Request, patch bool) {
 	userID, ok := GetUserIDFromContext(r)
 	if !ok {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
@@ -192,36 +363,65 @@ func (h *TaskHandler) UpdateTask(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
 	var taskUpdate models.TaskUpdate
-	if err := json.NewDecoder(r.Body).Decode(&taskUpdate); err != nil {
+	var present map[string]json.RawMessage
+	if err := json.Unmarshal(body, &taskUpdate); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
+	if err := json.Unmarshal(body, &present); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if taskUpdate.EstimateMinutes != nil && *taskUpdate.EstimateMinutes != 0 && !isValidEstimate(*taskUpdate.EstimateMinutes) {
+		http.Error(w, "Estimate must be between 1 and 100000 minutes", http.StatusBadRequest)
+		return
+	}
 
 	// Start transaction
-	tx, err := h.db.Begin()
+	tx, err := beginTaskTx(h.db, userID)
 	if err != nil {
 		http.Error(w, "Error starting transaction", http.StatusInternalServerError)
 		return
 	}
 	defer tx.Rollback()
 
+	current, err := checkIfMatch(tx, r, userID, taskID, h.requireIfMatch)
+	if writePreconditionError(w, err) {
+		return
+	}
+	if err == errTaskNotFound {
+		http.Error(w, "Task not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error fetching task", http.StatusInternalServerError)
+		return
+	}
+	if patch {
+		if _, ok := present["due_date"]; !ok {
+			taskUpdate.DueDate = current.DueDate
+		}
+		if _, ok := present["description"]; !ok {
+			taskUpdate.Description = current.Description
+		}
+	}
+
 	// Update task
-	_, err = tx.Exec(`
-		UPDATE tasks 
-		SET title = COALESCE($1, title),
-			description = COALESCE($2, description),
-			status = COALESCE($3, status),
-			priority = COALESCE($4, priority),
-			due_date = $5,
-			completed_at = CASE 
-				WHEN $6 = 'completed' AND status != 'completed' THEN CURRENT_TIMESTAMP
-				ELSE completed_at
-			END,
-			updated_at = CURRENT_TIMESTAMP
-		WHERE id = $7 AND is_deleted = false AND user_id = $8
-	`, taskUpdate.Title, taskUpdate.Description, taskUpdate.Status,
-		taskUpdate.Priority, taskUpdate.DueDate, taskUpdate.Status, taskID, userID)
+	task, err := updateTaskTx(tx, userID, taskID, taskUpdate)
+	if err == errTaskNotFound {
+		http.Error(w, "Task not found", http.StatusNotFound)
+		return
+	}
+	if _, ok := err.(*taskRuleError); ok {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
 	if err != nil {
 		http.Error(w, "Error updating task", http.StatusInternalServerError)
 		return
@@ -232,7 +432,10 @@ func (h *TaskHandler) UpdateTask(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", taskETag(task))
 	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(task)
 }
 
 // DeleteTask soft deletes a task for the authenticated user
@@ -254,7 +457,7 @@ func (h *TaskHandler) DeleteTask(w http.ResponseWriter, r *http.Request) {
 	log.Printf("Attempting to delete task with ID: %d", taskID)
 
 	// Start transaction
-	tx, err := h.db.Begin()
+	tx, err := beginTaskTx(h.db, userID)
 	if err != nil {
 		log.Printf("Error starting transaction: %v", err)
 		http.Error(w, "Error starting transaction: "+err.Error(), http.StatusInternalServerError)
@@ -262,58 +465,78 @@ func (h *TaskHandler) DeleteTask(w http.ResponseWriter, r *http.Request) {
 	}
 	defer tx.Rollback()
 
-	// First check if task exists and is not already deleted and belongs to user
-	var exists bool
-	err = tx.QueryRow(`
-		SELECT EXISTS(
-			SELECT 1 FROM tasks 
-			WHERE id = $1 AND is_deleted = false AND user_id = $2
-		)
-	`, taskID, userID).Scan(&exists)
-	if err != nil {
-		log.Printf("Error checking task existence: %v", err)
-		http.Error(w, "Error checking task existence: "+err.Error(), http.StatusInternalServerError)
+	// With If-Match, only the version the client last saw may be deleted
+	_, err = checkIfMatch(tx, r, userID, taskID, h.requireIfMatch)
+	if writePreconditionError(w, err) {
+		log.Printf("Precondition failed deleting task: %d", taskID)
 		return
 	}
 
-	if !exists {
+	// Soft delete the task if it exists, isn't already deleted and belongs to user
+	if err == nil {
+		err = deleteTaskTx(tx, userID, taskID)
+	}
+	if err == errTaskNotFound {
 		log.Printf("Task not found or already deleted: %d", taskID)
 		http.Error(w, "Task not found", http.StatusNotFound)
 		return
 	}
-
-	// Soft delete the task
-	result, err := tx.Exec(`
-		UPDATE tasks 
-		SET is_deleted = true,
-			updated_at = CURRENT_TIMESTAMP
-		WHERE id = $1 AND is_deleted = false AND user_id = $2
-	`, taskID, userID)
 	if err != nil {
 		log.Printf("Error deleting task: %v", err)
 		http.Error(w, "Error deleting task: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	rowsAffected, err := result.RowsAffected()
+	if err = tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		http.Error(w, "Error committing transaction: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Successfully deleted task: %d", taskID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RestoreTask brings back a soft-deleted task for the authenticated user
+func (h *TaskHandler) RestoreTask(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	taskID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid task ID", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := beginTaskTx(h.db, userID)
 	if err != nil {
-		log.Printf("Error checking affected rows: %v", err)
-		http.Error(w, "Error checking affected rows: "+err.Error(), http.StatusInternalServerError)
+		log.Printf("Error starting transaction: %v", err)
+		http.Error(w, "Error starting transaction", http.StatusInternalServerError)
 		return
 	}
+	defer tx.Rollback()
 
-	if rowsAffected == 0 {
-		log.Printf("No rows affected when deleting task: %d", taskID)
-		http.Error(w, "Task not found", http.StatusNotFound)
+	task, err := restoreTaskTx(tx, userID, taskID)
+	if err == errTaskNotFound {
+		http.Error(w, "Deleted task not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error restoring task: %v", err)
+		http.Error(w, "Error restoring task", http.StatusInternalServerError)
 		return
 	}
 
 	if err = tx.Commit(); err != nil {
 		log.Printf("Error committing transaction: %v", err)
-		http.Error(w, "Error committing transaction: "+err.Error(), http.StatusInternalServerError)
+		http.Error(w, "Error committing transaction", http.StatusInternalServerError)
 		return
 	}
 
-	log.Printf("Successfully deleted task: %d", taskID)
-	w.WriteHeader(http.StatusNoContent)
-} 
\ No newline at end of file
+	log.Printf("Successfully restored task: %d", taskID)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", taskETag(task))
+	json.NewEncoder(w).Encode(task)
+}
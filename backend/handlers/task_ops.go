@@ -0,0 +1,334 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+
+	"github.com/lib/pq"
+	"task-manager/models"
+)
+
+// errTaskNotFound is returned when a task doesn't exist or belongs to another user
+var errTaskNotFound = errors.New("task not found")
+
+// taskRuleError is returned when a task change breaks one of the user's own
+// rules, such as their workflow or custom field definitions. Its message is
+// meant for the client.
+type taskRuleError struct {
+	msg string
+}
+
+func (e *taskRuleError) Error() string {
+	return e.msg
+}
+
+// taskColumns selects every column scanned by scanTask, from a table aliased as t
+const taskColumns = `
+	t.id, t.title, COALESCE(t.description, ''), t.status, t.priority, t.category,
+	t.due_date, t.created_at, t.updated_at, t.completed_at,
+	COALESCE((
+		SELECT array_agg(g.name ORDER BY lower(g.name))
+		FROM task_tags tt JOIN tags g ON g.id = tt.tag_id
+		WHERE tt.task_id = t.id
+	), '{}'), COALESCE(t.external_id, ''), COALESCE(t.recurrence, ''), COALESCE(t.position, ''),
+	t.custom_fields, t.estimate_minutes,
+	COALESCE((
+		SELECT sum(EXTRACT(EPOCH FROM COALESCE(e.ended_at, CURRENT_TIMESTAMP) - e.started_at))::bigint
+		FROM time_entries e
+		WHERE e.task_id = t.id
+	), 0), t.parent_id, t.version`
+
+// scanTask reads a task from a row selected with taskColumns
+func scanTask(row interface{ Scan(...interface{}) error }) (models.Task, error) {
+	var task models.Task
+	var dueDate, completedAt sql.NullTime
+	var customFields []byte
+	var estimate, parentID sql.NullInt64
+	err := row.Scan(
+		&task.ID, &task.Title, &task.Description, &task.Status,
+		&task.Priority, &task.Category, &dueDate, &task.CreatedAt, &task.UpdatedAt,
+		&completedAt, pq.Array(&task.Tags), &task.ExternalID, &task.Recurrence, &task.Position,
+		&customFields, &estimate, &task.TrackedSeconds, &parentID,
+		&task.Version,
+	)
+	if err != nil {
+		return task, err
+	}
+	if err := json.Unmarshal(customFields, &task.CustomFields); err != nil {
+		return task, err
+	}
+	if dueDate.Valid {
+		task.DueDate = &dueDate.Time
+	}
+	if completedAt.Valid {
+		task.CompletedAt = &completedAt.Time
+	}
+	if estimate.Valid {
+		minutes := int(estimate.Int64)
+		task.EstimateMinutes = &minutes
+	}
+	if parentID.Valid {
+		id := int(parentID.Int64)
+		task.ParentID = &id
+	}
+	return task, nil
+}
+
+// beginTaskTx starts a transaction that may write the user's tasks. Every
+// task write takes a number from the user's row (see set_task_change_seq),
+// so that row is locked first: writers then queue on it before locking any
+// task, rather than deadlocking with a writer that holds a task they need.
+func beginTaskTx(db *sql.DB, userID int) (*sql.Tx, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(`SELECT 1 FROM users WHERE id = $1 FOR NO KEY UPDATE`, userID); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return tx, nil
+}
+
+// lockTask loads and locks one of the user's tasks inside a transaction.
+// deleted selects whether to look for a soft-deleted or a live task.
+func lockTask(tx *sql.Tx, taskID, userID int, deleted bool) (models.Task, error) {
+	task, err := scanTask(tx.QueryRow(`
+		SELECT `+taskColumns+`
+		FROM tasks t
+		WHERE t.id = $1 AND t.user_id = $2 AND t.is_deleted = $3
+		FOR UPDATE
+	`, taskID, userID, deleted))
+	if err == sql.ErrNoRows {
+		return task, errTaskNotFound
+	}
+	return task, err
+}
+
+// lockTasksWhere locks the tasks matching a condition on t and returns them
+// in ID order
+func lockTasksWhere(tx *sql.Tx, where string, args ...interface{}) ([]models.Task, error) {
+	rows, err := tx.Query(`
+		SELECT `+taskColumns+`
+		FROM tasks t
+		WHERE `+where+`
+		ORDER BY t.id
+		FOR UPDATE
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tasks []models.Task
+	for rows.Next() {
+		task, err := scanTask(rows)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks, rows.Err()
+}
+
+// touchTask marks a change to a task kept outside its row, such as its
+// tags, so that its updated_at and version move on
+func touchTask(tx *sql.Tx, taskID int) error {
+	_, err := tx.Exec(`UPDATE tasks SET updated_at = CURRENT_TIMESTAMP WHERE id = $1`, taskID)
+	return err
+}
+
+// createTaskTx inserts a validated task with its tags and records its creation
+// An empty status starts the task in the first state of its category's workflow.
+// A parent must be one of the user's live tasks.
+func createTaskTx(tx *sql.Tx, userID int, taskCreate models.TaskCreate) (models.Task, error) {
+	if taskCreate.ParentID != nil {
+		exists, err := taskBelongsToUser(tx, *taskCreate.ParentID, userID)
+		if err != nil {
+			return models.Task{}, err
+		}
+		if !exists {
+			return models.Task{}, &taskRuleError{"Parent task not found"}
+		}
+	}
+
+	status, done, err := initialStatus(tx, userID, taskCreate.Category, taskCreate.Status)
+	if err != nil {
+		return models.Task{}, err
+	}
+	taskCreate.Status = status
+
+	customFields, err := customFieldValues(tx, userID, taskCreate.Category, nil, taskCreate.CustomFields, true)
+	if err != nil {
+		return models.Task{}, err
+	}
+	customFieldsJSON, err := json.Marshal(customFields)
+	if err != nil {
+		return models.Task{}, err
+	}
+
+	// New tasks go to the top of their column, as they did when tasks were listed newest first
+	position, err := topPosition(tx, userID, taskCreate.Status)
+	if err != nil {
+		return models.Task{}, err
+	}
+
+	var taskID int
+	err = tx.QueryRow(`
+		INSERT INTO tasks (title, description, status, priority, category, due_date, user_id, external_id, recurrence, position, completed_at, custom_fields, estimate_minutes, parent_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, ''), NULLIF($9, ''), $10, CASE WHEN $11 THEN CURRENT_TIMESTAMP END, $12, $13, $14)
+		RETURNING id
+	`, taskCreate.Title, taskCreate.Description, taskCreate.Status,
+		taskCreate.Priority, taskCreate.Category, taskCreate.DueDate, userID,
+		taskCreate.ExternalID, taskCreate.Recurrence, position, done, customFieldsJSON,
+		taskCreate.EstimateMinutes, taskCreate.ParentID).Scan(&taskID)
+	if err != nil {
+		return models.Task{}, err
+	}
+
+	if len(taskCreate.Tags) > 0 {
+		tagIDs, err := ensureTags(tx, userID, taskCreate.Tags)
+		if err != nil {
+			return models.Task{}, err
+		}
+		_, err = tx.Exec(`
+			INSERT INTO task_tags (task_id, tag_id)
+			SELECT $1, unnest($2::int[])
+			ON CONFLICT DO NOTHING
+		`, taskID, pq.Array(tagIDs))
+		if err != nil {
+			return models.Task{}, err
+		}
+	}
+
+	task, err := lockTask(tx, taskID, userID, false)
+	if err != nil {
+		return task, err
+	}
+	if err := recordTaskEvent(tx, userID, "created", nil, &task); err != nil {
+		return task, err
+	}
+	return task, nil
+}
+
+// updateTaskTx applies an update to one of the user's tasks and records the
+// diff. The resulting status must be allowed by the workflow of the resulting
+// category; completed_at is set on entering a done state and cleared on
+// leaving one, and a task entering another status column is placed at its top.
+func updateTaskTx(tx *sql.Tx, userID, taskID int, taskUpdate models.TaskUpdate) (models.Task, error) {
+	before, err := lockTask(tx, taskID, userID, false)
+	if err != nil {
+		return before, err
+	}
+
+	status, category := before.Status, before.Category
+	if taskUpdate.Status != "" {
+		status = taskUpdate.Status
+	}
+	if taskUpdate.Category != "" {
+		category = taskUpdate.Category
+	}
+	done, err := checkTransition(tx, userID, &before, status, category)
+	if err != nil {
+		return before, err
+	}
+	customFields, err := customFieldValues(tx, userID, category, before.CustomFields, taskUpdate.CustomFields, false)
+	if err != nil {
+		return before, err
+	}
+	customFieldsJSON, err := json.Marshal(customFields)
+	if err != nil {
+		return before, err
+	}
+	estimate := before.EstimateMinutes
+	if taskUpdate.EstimateMinutes != nil {
+		estimate = taskUpdate.EstimateMinutes
+		if *estimate == 0 {
+			estimate = nil
+		}
+	}
+	// A task changing status goes to the top of its new column, as a new task would
+	var position sql.NullString
+	if status != before.Status {
+		if position.String, err = topPosition(tx, userID, status); err != nil {
+			return before, err
+		}
+		position.Valid = true
+	}
+
+	_, err = tx.Exec(`
+		UPDATE tasks
+		SET title = COALESCE(NULLIF($1, ''), title),
+			description = COALESCE($2, description),
+			status = COALESCE(NULLIF($3, ''), status),
+			priority = COALESCE(NULLIF($4, ''), priority),
+			category = COALESCE(NULLIF($9, ''), category),
+			due_date = $5,
+			completed_at = CASE WHEN $6 THEN COALESCE(completed_at, CURRENT_TIMESTAMP) END,
+			custom_fields = $10,
+			estimate_minutes = $11,
+			position = COALESCE($12, position),
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = $7 AND is_deleted = false AND user_id = $8
+	`, taskUpdate.Title, taskUpdate.Description, taskUpdate.Status,
+		taskUpdate.Priority, taskUpdate.DueDate, done, taskID, userID,
+		taskUpdate.Category, customFieldsJSON, estimate, position)
+	if err != nil {
+		return before, err
+	}
+
+	after, err := lockTask(tx, taskID, userID, false)
+	if err != nil {
+		return after, err
+	}
+	if err := recordTaskEvent(tx, userID, "updated", &before, &after); err != nil {
+		return after, err
+	}
+	return after, nil
+}
+
+// deleteTaskTx soft deletes one of the user's tasks and records the deletion
+func deleteTaskTx(tx *sql.Tx, userID, taskID int) error {
+	task, err := lockTask(tx, taskID, userID, false)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE tasks
+		SET is_deleted = true,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND is_deleted = false AND user_id = $2
+	`, taskID, userID)
+	if err != nil {
+		return err
+	}
+	return recordTaskEvent(tx, userID, "deleted", &task, nil)
+}
+
+// restoreTaskTx brings back one of the user's soft-deleted tasks and records the restore
+func restoreTaskTx(tx *sql.Tx, userID, taskID int) (models.Task, error) {
+	if _, err := lockTask(tx, taskID, userID, true); err != nil {
+		return models.Task{}, err
+	}
+
+	_, err := tx.Exec(`
+		UPDATE tasks
+		SET is_deleted = false,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND is_deleted = true AND user_id = $2
+	`, taskID, userID)
+	if err != nil {
+		return models.Task{}, err
+	}
+
+	task, err := lockTask(tx, taskID, userID, false)
+	if err != nil {
+		return task, err
+	}
+	if err := recordTaskEvent(tx, userID, "restored", nil, &task); err != nil {
+		return task, err
+	}
+	return task, nil
+}
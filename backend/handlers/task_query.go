@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"task-manager/models"
+)
+
+// taskQuery accumulates WHERE conditions and their positional arguments
+// for queries over a user's tasks (aliased as t)
+type taskQuery struct {
+	conditions []string
+	args       []interface{}
+}
+
+// newTaskQuery starts a query restricted to the user's live tasks
+func newTaskQuery(userID int) *taskQuery {
+	q := &taskQuery{}
+	q.where("t.user_id = " + q.arg(userID))
+	q.where("t.is_deleted = false")
+	return q
+}
+
+// arg adds a positional argument and returns its placeholder
+func (q *taskQuery) arg(v interface{}) string {
+	q.args = append(q.args, v)
+	return "$" + strconv.Itoa(len(q.args))
+}
+
+// where adds a condition that every returned task must satisfy
+func (q *taskQuery) where(condition string) {
+	q.conditions = append(q.conditions, condition)
+}
+
+// whereClause joins the conditions into a WHERE clause
+func (q *taskQuery) whereClause() string {
+	return "WHERE " + strings.Join(q.conditions, " AND ")
+}
+
+// withTags restricts the query to tasks tagged with any (or all) of the named tags
+func (q *taskQuery) withTags(names []string, matchAll bool) {
+	seen := make(map[string]bool)
+	var lowered []string
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != "" && !seen[name] {
+			seen[name] = true
+			lowered = append(lowered, name)
+		}
+	}
+	if len(lowered) == 0 {
+		return
+	}
+
+	placeholder := q.arg(pq.Array(lowered))
+	if matchAll {
+		q.where(`(
+			SELECT count(*) FROM task_tags tt JOIN tags g ON g.id = tt.tag_id
+			WHERE tt.task_id = t.id AND lower(g.name) = ANY(` + placeholder + `)
+		) = ` + q.arg(len(lowered)))
+		return
+	}
+	q.where(`EXISTS (
+		SELECT 1 FROM task_tags tt JOIN tags g ON g.id = tt.tag_id
+		WHERE tt.task_id = t.id AND lower(g.name) = ANY(` + placeholder + `)
+	)`)
+}
+
+// withDue restricts the query to tasks that are overdue, due today or due
+// this week, with days and weeks taken in loc. It reports false for an
+// unknown filter.
+func (q *taskQuery) withDue(filter string, now time.Time, loc *time.Location, weekStart int) bool {
+	switch filter {
+	case "overdue":
+		q.where("t.due_date < " + q.arg(now))
+		q.where("t.completed_at IS NULL")
+	case "today":
+		start := startOfDay(now, loc)
+		q.where("t.due_date >= " + q.arg(start))
+		q.where("t.due_date < " + q.arg(start.AddDate(0, 0, 1)))
+	case "week":
+		start := startOfWeek(now, loc, weekStart)
+		q.where("t.due_date >= " + q.arg(start))
+		q.where("t.due_date < " + q.arg(start.AddDate(0, 0, 7)))
+	default:
+		return false
+	}
+	return true
+}
+
+// splitList splits a comma separated query parameter, dropping empty entries
+func splitList(v string) []string {
+	var items []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// withCustomField restricts the query to tasks whose value for a custom
+// field equals value (for multi_select, includes it), or with op "gte" or
+// "lte" is at least or at most value
+func (q *taskQuery) withCustomField(f *models.CustomField, op string, value interface{}) {
+	switch op {
+	case "gte":
+		op = ">="
+	case "lte":
+		op = "<="
+	default:
+		op = "="
+	}
+	q.where(q.customFieldCondition(f, op, value))
+}
+
+// customFieldCondition returns a condition that a custom field's value
+// equals value (for multi_select, includes it), or with op <, <=, > or >=
+// compares to it that way
+func (q *taskQuery) customFieldCondition(f *models.CustomField, op string, value interface{}) string {
+	if op == "=" {
+		// Containment is served by the GIN index on custom_fields
+		if f.Type == "multi_select" {
+			value = []interface{}{value}
+		}
+		match, _ := json.Marshal(map[string]interface{}{f.Key: value})
+		return "t.custom_fields @> " + q.arg(string(match)) + "::jsonb"
+	}
+	return q.customFieldExpr(f) + " " + op + " " + q.arg(value)
+}
+
+// customFieldExpr returns an expression for a custom field's value that
+// compares and sorts by the field's type; it is NULL where the task has no
+// value
+func (q *taskQuery) customFieldExpr(f *models.CustomField) string {
+	key := q.arg(f.Key)
+	switch f.Type {
+	case "number", "user":
+		return "(CASE WHEN jsonb_typeof(t.custom_fields -> " + key + ") = 'number' THEN (t.custom_fields ->> " + key + ")::numeric END)"
+	}
+	// Dates are stored as YYYY-MM-DD, which sorts as text
+	return "(t.custom_fields ->> " + key + ")"
+}
@@ -0,0 +1,495 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+	"task-manager/models"
+)
+
+const (
+	// maxTemplateTasks bounds the number of tasks, subtasks included, in a template
+	maxTemplateTasks = 200
+	// maxTemplateDepth bounds how deeply subtasks nest
+	maxTemplateDepth = 5
+)
+
+// placeholderPattern matches {{name}} placeholders in template text
+var placeholderPattern = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+
+type TemplateHandler struct {
+	db *sql.DB
+}
+
+func NewTemplateHandler(db *sql.DB) *TemplateHandler {
+	return &TemplateHandler{db: db}
+}
+
+const templateColumns = `id, name, description, tasks, created_at, updated_at`
+
+func scanTemplate(row interface{ Scan(...interface{}) error }) (models.Template, error) {
+	var t models.Template
+	var tasks []byte
+	if err := row.Scan(&t.ID, &t.Name, &t.Description, &tasks, &t.CreatedAt, &t.UpdatedAt); err != nil {
+		return t, err
+	}
+	err := json.Unmarshal(tasks, &t.Tasks)
+	return t, err
+}
+
+// GetTemplates lists the authenticated user's task templates
+func (h *TemplateHandler) GetTemplates(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	rows, err := h.db.Query(`
+		SELECT `+templateColumns+` FROM task_templates
+		WHERE user_id = $1
+		ORDER BY lower(name), id
+	`, userID)
+	if err != nil {
+		http.Error(w, "Error fetching templates", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	templates := []models.Template{}
+	for rows.Next() {
+		t, err := scanTemplate(rows)
+		if err != nil {
+			http.Error(w, "Error scanning template", http.StatusInternalServerError)
+			return
+		}
+		templates = append(templates, t)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(templates)
+}
+
+// GetTemplate returns one of the authenticated user's task templates
+func (h *TemplateHandler) GetTemplate(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	templateID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid template ID", http.StatusBadRequest)
+		return
+	}
+
+	t, err := scanTemplate(h.db.QueryRow(`
+		SELECT `+templateColumns+` FROM task_templates WHERE id = $1 AND user_id = $2
+	`, templateID, userID))
+	if err == sql.ErrNoRows {
+		http.Error(w, "Template not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error fetching template", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(t)
+}
+
+// CreateTemplate saves a new task template for the authenticated user
+func (h *TemplateHandler) CreateTemplate(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var input models.TemplateInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if msg := validateTemplateInput(&input); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	tasks, err := json.Marshal(input.Tasks)
+	if err != nil {
+		http.Error(w, "Error encoding template", http.StatusInternalServerError)
+		return
+	}
+
+	t, err := scanTemplate(h.db.QueryRow(`
+		INSERT INTO task_templates (user_id, name, description, tasks)
+		VALUES ($1, $2, $3, $4)
+		RETURNING `+templateColumns+`
+	`, userID, input.Name, input.Description, tasks))
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+		http.Error(w, "A template with this name already exists", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Error creating template: %v", err)
+		http.Error(w, "Error creating template", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(t)
+}
+
+// UpdateTemplate replaces a template's name, description and tasks. Tasks
+// created from it earlier are left as they are.
+func (h *TemplateHandler) UpdateTemplate(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	templateID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid template ID", http.StatusBadRequest)
+		return
+	}
+
+	var input models.TemplateInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if msg := validateTemplateInput(&input); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	tasks, err := json.Marshal(input.Tasks)
+	if err != nil {
+		http.Error(w, "Error encoding template", http.StatusInternalServerError)
+		return
+	}
+
+	t, err := scanTemplate(h.db.QueryRow(`
+		UPDATE task_templates SET name = $1, description = $2, tasks = $3
+		WHERE id = $4 AND user_id = $5
+		RETURNING `+templateColumns+`
+	`, input.Name, input.Description, tasks, templateID, userID))
+	if err == sql.ErrNoRows {
+		http.Error(w, "Template not found", http.StatusNotFound)
+		return
+	}
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+		http.Error(w, "A template with this name already exists", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Error updating template: %v", err)
+		http.Error(w, "Error updating template", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(t)
+}
+
+// DeleteTemplate removes a task template
+func (h *TemplateHandler) DeleteTemplate(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	templateID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid template ID", http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.db.Exec(`DELETE FROM task_templates WHERE id = $1 AND user_id = $2`, templateID, userID)
+	if err != nil {
+		http.Error(w, "Error deleting template", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		http.Error(w, "Template not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// InstantiateTemplate creates the template's tasks and subtasks in one
+// transaction and returns them, parents before their subtasks. Due dates
+// are offset from the start date, and placeholders are filled in from the
+// built-in values ({{date}}, {{today}}, {{weekday}}, {{month}} and
+// {{year}}, all taken from the start date except today) and the variables
+// sent.
+func (h *TemplateHandler) InstantiateTemplate(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	templateID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid template ID", http.StatusBadRequest)
+		return
+	}
+
+	// The body is optional
+	var input models.TemplateInstantiate
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil && err != io.EOF {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	t, err := scanTemplate(h.db.QueryRow(`
+		SELECT `+templateColumns+` FROM task_templates WHERE id = $1 AND user_id = $2
+	`, templateID, userID))
+	if err == sql.ErrNoRows {
+		http.Error(w, "Template not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error fetching template", http.StatusInternalServerError)
+		return
+	}
+	profile, err := loadProfile(h.db, userID)
+	if err != nil {
+		http.Error(w, "Error loading profile", http.StatusInternalServerError)
+		return
+	}
+
+	loc := profileLocation(profile)
+	today := startOfDay(time.Now(), loc)
+	start := today
+	if input.StartDate != "" {
+		day, err := time.ParseInLocation("2006-01-02", input.StartDate, loc)
+		if err != nil {
+			http.Error(w, "Invalid start_date; use YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		start = day
+	}
+
+	values := map[string]string{
+		"date":    start.Format("2006-01-02"),
+		"today":   today.Format("2006-01-02"),
+		"weekday": start.Weekday().String(),
+		"month":   start.Month().String(),
+		"year":    strconv.Itoa(start.Year()),
+	}
+	for name, value := range input.Variables {
+		values[name] = value
+	}
+	if missing := missingPlaceholders(t.Tasks, values); len(missing) > 0 {
+		http.Error(w, "Missing values for placeholders: "+strings.Join(missing, ", "), http.StatusBadRequest)
+		return
+	}
+
+	tx, err := beginTaskTx(h.db, userID)
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		http.Error(w, "Error starting transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	inst := templateInstance{
+		tx:       tx,
+		userID:   userID,
+		start:    start,
+		values:   values,
+		profile:  profile,
+		created:  []models.Task{},
+		location: loc,
+	}
+	for _, task := range t.Tasks {
+		msg, err := inst.create(task, nil, profile.DefaultCategory)
+		if rule, ok := err.(*taskRuleError); ok {
+			http.Error(w, rule.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		if err != nil {
+			log.Printf("Error instantiating template %d: %v", templateID, err)
+			http.Error(w, "Error creating tasks", http.StatusInternalServerError)
+			return
+		}
+		if msg != "" {
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		http.Error(w, "Error committing transaction", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(inst.created)
+}
+
+// templateInstance creates the tasks of a template inside a transaction
+type templateInstance struct {
+	tx       *sql.Tx
+	userID   int
+	start    time.Time
+	location *time.Location
+	values   map[string]string
+	profile  models.Profile
+	created  []models.Task
+}
+
+// create creates a template task and its subtasks, returning an error
+// message for a task that isn't valid once its placeholders are filled in
+func (inst *templateInstance) create(tt models.TemplateTask, parentID *int, category string) (string, error) {
+	taskCreate := models.TaskCreate{
+		Title:           fillPlaceholders(tt.Title, inst.values),
+		Description:     fillPlaceholders(tt.Description, inst.values),
+		Priority:        tt.Priority,
+		Category:        tt.Category,
+		EstimateMinutes: tt.EstimateMinutes,
+		ParentID:        parentID,
+	}
+	if taskCreate.Priority == "" {
+		taskCreate.Priority = inst.profile.DefaultPriority
+	}
+	if taskCreate.Category == "" {
+		taskCreate.Category = category
+	}
+	for _, tag := range tt.Tags {
+		taskCreate.Tags = append(taskCreate.Tags, strings.TrimSpace(fillPlaceholders(tag, inst.values)))
+	}
+	if tt.DueOffsetDays != nil {
+		minutes, _ := parseClock(tt.DueTime)
+		day := inst.start.AddDate(0, 0, *tt.DueOffsetDays)
+		due := time.Date(day.Year(), day.Month(), day.Day(), 0, minutes, 0, 0, inst.location)
+		taskCreate.DueDate = &due
+	}
+	if msg := validateTaskCreate(&taskCreate); msg != "" {
+		return fmt.Sprintf("%s (task %q)", msg, taskCreate.Title), nil
+	}
+
+	task, err := createTaskTx(inst.tx, inst.userID, taskCreate)
+	if err != nil {
+		return "", err
+	}
+	inst.created = append(inst.created, task)
+
+	for _, sub := range tt.Subtasks {
+		if msg, err := inst.create(sub, &task.ID, task.Category); msg != "" || err != nil {
+			return msg, err
+		}
+	}
+	return "", nil
+}
+
+// fillPlaceholders replaces {{name}} placeholders with their values
+func fillPlaceholders(s string, values map[string]string) string {
+	return placeholderPattern.ReplaceAllStringFunc(s, func(m string) string {
+		return values[placeholderPattern.FindStringSubmatch(m)[1]]
+	})
+}
+
+// missingPlaceholders returns the sorted names of placeholders used in the
+// tasks that have no value
+func missingPlaceholders(tasks []models.TemplateTask, values map[string]string) []string {
+	seen := make(map[string]bool)
+	var walk func(tasks []models.TemplateTask)
+	check := func(s string) {
+		for _, m := range placeholderPattern.FindAllStringSubmatch(s, -1) {
+			if _, ok := values[m[1]]; !ok {
+				seen[m[1]] = true
+			}
+		}
+	}
+	walk = func(tasks []models.TemplateTask) {
+		for _, t := range tasks {
+			check(t.Title)
+			check(t.Description)
+			for _, tag := range t.Tags {
+				check(tag)
+			}
+			walk(t.Subtasks)
+		}
+	}
+	walk(tasks)
+
+	missing := make([]string, 0, len(seen))
+	for name := range seen {
+		missing = append(missing, name)
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// validateTemplateInput returns an error message if the template is
+// invalid. Titles and tags are checked again once placeholders are filled in.
+func validateTemplateInput(input *models.TemplateInput) string {
+	input.Name = strings.TrimSpace(input.Name)
+	switch {
+	case input.Name == "":
+		return "Name is required"
+	case len(input.Name) > 100:
+		return "Name must be at most 100 characters long"
+	case len(input.Tasks) == 0:
+		return "A template needs at least one task"
+	}
+
+	count := 0
+	var validate func(tasks []models.TemplateTask, depth int) string
+	validate = func(tasks []models.TemplateTask, depth int) string {
+		if depth > maxTemplateDepth {
+			return fmt.Sprintf("Subtasks can be nested at most %d levels deep", maxTemplateDepth)
+		}
+		for i := range tasks {
+			t := &tasks[i]
+			if count++; count > maxTemplateTasks {
+				return fmt.Sprintf("A template can have at most %d tasks", maxTemplateTasks)
+			}
+			t.Title = strings.TrimSpace(t.Title)
+			switch {
+			case t.Title == "":
+				return "Every task needs a title"
+			case len(t.Title) > 255:
+				return "Title must be at most 255 characters long"
+			case t.Priority != "" && !isValidPriority(t.Priority):
+				return "Invalid priority value"
+			case t.Category != "" && !isValidCategory(t.Category):
+				return "Invalid category value"
+			case t.EstimateMinutes != nil && !isValidEstimate(*t.EstimateMinutes):
+				return "Estimate must be between 1 and 100000 minutes"
+			case t.DueOffsetDays != nil && (*t.DueOffsetDays < -3660 || *t.DueOffsetDays > 3660):
+				return "due_offset_days must be between -3660 and 3660"
+			case t.DueTime != "" && t.DueOffsetDays == nil:
+				return "due_time needs due_offset_days"
+			}
+			if t.DueTime != "" {
+				if minutes, ok := parseClock(t.DueTime); !ok || minutes >= 24*60 {
+					return "due_time must be HH:MM"
+				}
+			}
+			if msg := validate(t.Subtasks, depth+1); msg != "" {
+				return msg
+			}
+		}
+		return ""
+	}
+	return validate(input.Tasks, 1)
+}
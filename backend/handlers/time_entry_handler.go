@@ -0,0 +1,579 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+	"task-manager/models"
+)
+
+const (
+	// maxTimeEntryDuration bounds manual entries, which catches typos in dates
+	maxTimeEntryDuration = 24 * time.Hour
+	maxTimeEntryNote     = 1000
+)
+
+// timeEntryColumns selects every column scanned by scanTimeEntry, from a table aliased as e
+const timeEntryColumns = `
+	e.id, e.task_id, e.user_id, e.started_at, e.ended_at, COALESCE(e.note, ''),
+	e.created_at, e.updated_at,
+	EXTRACT(EPOCH FROM COALESCE(e.ended_at, CURRENT_TIMESTAMP) - e.started_at)::bigint`
+
+func scanTimeEntry(row interface{ Scan(...interface{}) error }) (models.TimeEntry, error) {
+	var e models.TimeEntry
+	var endedAt sql.NullTime
+	err := row.Scan(&e.ID, &e.TaskID, &e.UserID, &e.StartedAt, &endedAt, &e.Note,
+		&e.CreatedAt, &e.UpdatedAt, &e.DurationSeconds)
+	e.EndedAt = nullTimePtr(endedAt)
+	e.Running = e.EndedAt == nil
+	return e, err
+}
+
+type TimeEntryHandler struct {
+	db *sql.DB
+}
+
+func NewTimeEntryHandler(db *sql.DB) *TimeEntryHandler {
+	return &TimeEntryHandler{db: db}
+}
+
+// GetTaskTimeEntries lists the time tracked on one of the user's tasks, newest first
+func (h *TimeEntryHandler) GetTaskTimeEntries(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	taskID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid task ID", http.StatusBadRequest)
+		return
+	}
+	if !h.ownsTask(w, userID, taskID) {
+		return
+	}
+
+	rows, err := h.db.Query(`
+		SELECT `+timeEntryColumns+`
+		FROM time_entries e
+		WHERE e.task_id = $1 AND e.user_id = $2
+		ORDER BY e.started_at DESC, e.id DESC
+	`, taskID, userID)
+	if err != nil {
+		http.Error(w, "Error fetching time entries", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	entries := []models.TimeEntry{}
+	for rows.Next() {
+		e, err := scanTimeEntry(rows)
+		if err != nil {
+			http.Error(w, "Error scanning time entry", http.StatusInternalServerError)
+			return
+		}
+		entries = append(entries, e)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+// StartTimer starts a timer on one of the user's tasks. A user has at most
+// one running timer; starting another while one runs is a conflict.
+func (h *TimeEntryHandler) StartTimer(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	taskID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid task ID", http.StatusBadRequest)
+		return
+	}
+
+	var start models.TimerStart
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&start); err != nil {
+			http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if len(start.Note) > maxTimeEntryNote {
+		http.Error(w, "Note must be at most 1000 characters long", http.StatusBadRequest)
+		return
+	}
+	tx, err := beginTaskTx(h.db, userID)
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		http.Error(w, "Error starting transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+	if !lockTimeEntryTask(w, tx, userID, taskID) {
+		return
+	}
+
+	var runningTaskID int
+	err = tx.QueryRow(`
+		SELECT task_id FROM time_entries WHERE user_id = $1 AND ended_at IS NULL
+	`, userID).Scan(&runningTaskID)
+	if err == nil {
+		http.Error(w, fmt.Sprintf("A timer is already running on task %d; stop it first", runningTaskID), http.StatusConflict)
+		return
+	}
+	if err != sql.ErrNoRows {
+		http.Error(w, "Error checking running timer", http.StatusInternalServerError)
+		return
+	}
+
+	entry, err := scanTimeEntry(tx.QueryRow(`
+		INSERT INTO time_entries AS e (task_id, user_id, started_at, note)
+		VALUES ($1, $2, CURRENT_TIMESTAMP, NULLIF($3, ''))
+		RETURNING `+timeEntryColumns+`
+	`, taskID, userID, start.Note))
+	// The unique index on running timers settles concurrent starts
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+		http.Error(w, "A timer is already running; stop it first", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Error starting timer: %v", err)
+		http.Error(w, "Error starting timer", http.StatusInternalServerError)
+		return
+	}
+	if !touchTimeEntryTask(w, tx, entry.TaskID) {
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		http.Error(w, "Error committing transaction", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(entry)
+}
+
+// StopTimer stops the user's running timer. On /api/tasks/{id}/timer/stop
+// it only stops a timer running on that task.
+func (h *TimeEntryHandler) StopTimer(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	taskID := 0
+	if v, ok := mux.Vars(r)["id"]; ok {
+		var err error
+		if taskID, err = strconv.Atoi(v); err != nil {
+			http.Error(w, "Invalid task ID", http.StatusBadRequest)
+			return
+		}
+	}
+
+	tx, err := beginTaskTx(h.db, userID)
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		http.Error(w, "Error starting transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	entry, err := scanTimeEntry(tx.QueryRow(`
+		UPDATE time_entries AS e
+		SET ended_at = CURRENT_TIMESTAMP
+		WHERE e.user_id = $1 AND e.ended_at IS NULL AND ($2 = 0 OR e.task_id = $2)
+		RETURNING `+timeEntryColumns+`
+	`, userID, taskID))
+	if err == sql.ErrNoRows {
+		http.Error(w, "No timer is running", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error stopping timer: %v", err)
+		http.Error(w, "Error stopping timer", http.StatusInternalServerError)
+		return
+	}
+	if !touchTimeEntryTask(w, tx, entry.TaskID) {
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		http.Error(w, "Error committing transaction", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entry)
+}
+
+// GetRunningTimer returns the user's running timer, or 204 when none runs
+func (h *TimeEntryHandler) GetRunningTimer(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	entry, err := scanTimeEntry(h.db.QueryRow(`
+		SELECT `+timeEntryColumns+`
+		FROM time_entries e
+		WHERE e.user_id = $1 AND e.ended_at IS NULL
+	`, userID))
+	if err == sql.ErrNoRows {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error fetching running timer", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entry)
+}
+
+// CreateTimeEntry records time spent on one of the user's tasks after the fact
+func (h *TimeEntryHandler) CreateTimeEntry(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	taskID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid task ID", http.StatusBadRequest)
+		return
+	}
+
+	var input models.TimeEntryInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	endedAt, msg := validateTimeEntryInput(&input, false)
+	if msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	tx, err := beginTaskTx(h.db, userID)
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		http.Error(w, "Error starting transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+	if !lockTimeEntryTask(w, tx, userID, taskID) {
+		return
+	}
+
+	entry, err := scanTimeEntry(tx.QueryRow(`
+		INSERT INTO time_entries AS e (task_id, user_id, started_at, ended_at, note)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''))
+		RETURNING `+timeEntryColumns+`
+	`, taskID, userID, input.StartedAt, endedAt, input.Note))
+	if err != nil {
+		log.Printf("Error creating time entry: %v", err)
+		http.Error(w, "Error creating time entry", http.StatusInternalServerError)
+		return
+	}
+	if !touchTimeEntryTask(w, tx, entry.TaskID) {
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		http.Error(w, "Error committing transaction", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(entry)
+}
+
+// UpdateTimeEntry changes the span or note of one of the user's time
+// entries. A running timer may be edited without an end, and keeps running.
+func (h *TimeEntryHandler) UpdateTimeEntry(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	entryID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid time entry ID", http.StatusBadRequest)
+		return
+	}
+
+	var input models.TimeEntryInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tx, err := beginTaskTx(h.db, userID)
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		http.Error(w, "Error starting transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var running bool
+	err = tx.QueryRow(`
+		SELECT ended_at IS NULL FROM time_entries WHERE id = $1 AND user_id = $2 FOR UPDATE
+	`, entryID, userID).Scan(&running)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Time entry not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error fetching time entry", http.StatusInternalServerError)
+		return
+	}
+	endedAt, msg := validateTimeEntryInput(&input, running)
+	if msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	// The row is locked, so a running timer can't be stopped meanwhile
+	entry, err := scanTimeEntry(tx.QueryRow(`
+		UPDATE time_entries AS e
+		SET started_at = $1, ended_at = COALESCE($2, e.ended_at), note = NULLIF($3, '')
+		WHERE e.id = $4 AND e.user_id = $5 AND COALESCE($2, e.ended_at, $1) >= $1
+		RETURNING `+timeEntryColumns+`
+	`, input.StartedAt, endedAt, input.Note, entryID, userID))
+	if err == sql.ErrNoRows {
+		http.Error(w, "Time entry not found or would end before it starts", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Error updating time entry: %v", err)
+		http.Error(w, "Error updating time entry", http.StatusInternalServerError)
+		return
+	}
+	if !touchTimeEntryTask(w, tx, entry.TaskID) {
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		http.Error(w, "Error committing transaction", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entry)
+}
+
+// DeleteTimeEntry removes one of the user's time entries, running or not
+func (h *TimeEntryHandler) DeleteTimeEntry(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	entryID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid time entry ID", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := beginTaskTx(h.db, userID)
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		http.Error(w, "Error starting transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var taskID int
+	err = tx.QueryRow(`
+		DELETE FROM time_entries WHERE id = $1 AND user_id = $2 RETURNING task_id
+	`, entryID, userID).Scan(&taskID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Time entry not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error deleting time entry", http.StatusInternalServerError)
+		return
+	}
+	if !touchTimeEntryTask(w, tx, taskID) {
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		http.Error(w, "Error committing transaction", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetTimeReport totals the time the user tracked on live tasks by category
+// and by day. ?from= and ?to= work as for /api/stats. Entries count
+// towards the day they started on, in the user's time zone, and a running
+// timer counts up to now.
+func (h *TimeEntryHandler) GetTimeReport(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	profile, err := loadProfile(h.db, userID)
+	if err != nil {
+		http.Error(w, "Error loading profile", http.StatusInternalServerError)
+		return
+	}
+	loc := profileLocation(profile)
+	from, to, ok := dateRange(w, r, startOfDay(time.Now(), loc), loc)
+	if !ok {
+		return
+	}
+
+	rows, err := h.db.Query(`
+		SELECT to_char((e.started_at AT TIME ZONE $4)::date, 'YYYY-MM-DD') AS day, t.category,
+		       sum(EXTRACT(EPOCH FROM COALESCE(e.ended_at, CURRENT_TIMESTAMP) - e.started_at))::bigint
+		FROM time_entries e
+		JOIN tasks t ON t.id = e.task_id
+		WHERE e.user_id = $1 AND t.is_deleted = false
+			AND e.started_at >= $2 AND e.started_at < $3
+		GROUP BY 1, 2
+		ORDER BY 1, 2
+	`, userID, from, to.AddDate(0, 0, 1), loc.String())
+	if err != nil {
+		log.Printf("Error computing time report: %v", err)
+		http.Error(w, "Error computing time report", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	report := models.TimeReport{
+		From:       from.Format("2006-01-02"),
+		To:         to.Format("2006-01-02"),
+		Timezone:   loc.String(),
+		ByCategory: map[string]int64{},
+		Days:       []models.TimeReportDay{},
+	}
+	for rows.Next() {
+		var day, category string
+		var seconds int64
+		if err := rows.Scan(&day, &category, &seconds); err != nil {
+			http.Error(w, "Error scanning time report", http.StatusInternalServerError)
+			return
+		}
+		if n := len(report.Days); n == 0 || report.Days[n-1].Date != day {
+			report.Days = append(report.Days, models.TimeReportDay{Date: day, ByCategory: map[string]int64{}})
+		}
+		d := &report.Days[len(report.Days)-1]
+		d.ByCategory[category] += seconds
+		d.Total += seconds
+		report.ByCategory[category] += seconds
+		report.Total += seconds
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "Error computing time report", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// ownsTask checks that the task is one of the user's live tasks, writing
+// the error response if not
+func (h *TimeEntryHandler) ownsTask(w http.ResponseWriter, userID, taskID int) bool {
+	exists, err := taskBelongsToUser(h.db, taskID, userID)
+	if err != nil {
+		http.Error(w, "Error fetching task", http.StatusInternalServerError)
+		return false
+	}
+	if !exists {
+		http.Error(w, "Task not found", http.StatusNotFound)
+		return false
+	}
+	return true
+}
+
+// lockTimeEntryTask locks one of the user's live tasks for a change to its
+// time entries, writing the error response if there is none
+func lockTimeEntryTask(w http.ResponseWriter, tx *sql.Tx, userID, taskID int) bool {
+	_, err := lockTask(tx, taskID, userID, false)
+	if err == errTaskNotFound {
+		http.Error(w, "Task not found", http.StatusNotFound)
+		return false
+	}
+	if err != nil {
+		http.Error(w, "Error fetching task", http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
+
+// touchTimeEntryTask moves a task's version on after a change to its time
+// entries, since they make up its tracked_seconds
+func touchTimeEntryTask(w http.ResponseWriter, tx *sql.Tx, taskID int) bool {
+	if err := touchTask(tx, taskID); err != nil {
+		log.Printf("Error updating task: %v", err)
+		http.Error(w, "Error updating task", http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
+
+// validateTimeEntryInput checks a time entry and returns its end, which may
+// only be missing when the entry is a running timer
+func validateTimeEntryInput(input *models.TimeEntryInput, running bool) (*time.Time, string) {
+	if input.StartedAt == nil {
+		return nil, "started_at is required"
+	}
+	if input.StartedAt.After(time.Now()) {
+		return nil, "started_at can't be in the future"
+	}
+	if len(input.Note) > maxTimeEntryNote {
+		return nil, "Note must be at most 1000 characters long"
+	}
+
+	endedAt := input.EndedAt
+	switch {
+	case endedAt != nil && input.DurationMinutes != 0:
+		return nil, "Give either ended_at or duration_minutes, not both"
+	case input.DurationMinutes < 0:
+		return nil, "duration_minutes must be positive"
+	case input.DurationMinutes > 0:
+		end := input.StartedAt.Add(time.Duration(input.DurationMinutes) * time.Minute)
+		endedAt = &end
+	case endedAt == nil && !running:
+		return nil, "ended_at or duration_minutes is required"
+	case endedAt == nil:
+		return nil, ""
+	}
+
+	if !endedAt.After(*input.StartedAt) {
+		return nil, "ended_at must be after started_at"
+	}
+	if endedAt.After(time.Now()) {
+		return nil, "ended_at can't be in the future"
+	}
+	if endedAt.Sub(*input.StartedAt) > maxTimeEntryDuration {
+		return nil, "A time entry can be at most 24 hours long"
+	}
+	return endedAt, ""
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"task-manager/models"
+)
+
+func TestValidateTimeEntryInput(t *testing.T) {
+	now := time.Now()
+	at := func(d time.Duration) *time.Time {
+		t := now.Add(d)
+		return &t
+	}
+	tests := []struct {
+		name    string
+		input   models.TimeEntryInput
+		running bool
+		msg     string
+	}{
+		{"span", models.TimeEntryInput{StartedAt: at(-2 * time.Hour), EndedAt: at(-time.Hour)}, false, ""},
+		{"duration", models.TimeEntryInput{StartedAt: at(-2 * time.Hour), DurationMinutes: 30}, false, ""},
+		{"running without end", models.TimeEntryInput{StartedAt: at(-time.Hour)}, true, ""},
+		{"no start", models.TimeEntryInput{EndedAt: at(-time.Hour)}, false, "started_at is required"},
+		{"future start", models.TimeEntryInput{StartedAt: at(time.Hour), EndedAt: at(2 * time.Hour)}, false, "started_at can't be in the future"},
+		{"future end", models.TimeEntryInput{StartedAt: at(-time.Hour), EndedAt: at(time.Hour)}, false, "ended_at can't be in the future"},
+		{"duration past now", models.TimeEntryInput{StartedAt: at(-time.Hour), DurationMinutes: 120}, false, "ended_at can't be in the future"},
+		{"future end on a running timer", models.TimeEntryInput{StartedAt: at(-time.Hour), EndedAt: at(time.Minute)}, true, "ended_at can't be in the future"},
+		{"no end", models.TimeEntryInput{StartedAt: at(-time.Hour)}, false, "ended_at or duration_minutes is required"},
+		{"end and duration", models.TimeEntryInput{StartedAt: at(-2 * time.Hour), EndedAt: at(-time.Hour), DurationMinutes: 5}, false, "not both"},
+		{"negative duration", models.TimeEntryInput{StartedAt: at(-time.Hour), DurationMinutes: -5}, false, "must be positive"},
+		{"end before start", models.TimeEntryInput{StartedAt: at(-time.Hour), EndedAt: at(-2 * time.Hour)}, false, "must be after started_at"},
+		{"too long", models.TimeEntryInput{StartedAt: at(-48 * time.Hour), EndedAt: at(-time.Hour)}, false, "at most 24 hours"},
+		{"long note", models.TimeEntryInput{StartedAt: at(-2 * time.Hour), EndedAt: at(-time.Hour), Note: strings.Repeat("x", maxTimeEntryNote+1)}, false, "Note must be"},
+	}
+	for _, tt := range tests {
+		input := tt.input
+		_, msg := validateTimeEntryInput(&input, tt.running)
+		if (tt.msg == "") != (msg == "") || !strings.Contains(msg, tt.msg) {
+			t.Errorf("%s: got %q, want %q", tt.name, msg, tt.msg)
+		}
+	}
+}
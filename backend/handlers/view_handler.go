@@ -0,0 +1,599 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+	"task-manager/models"
+	"task-manager/viewquery"
+)
+
+type ViewHandler struct {
+	db *sql.DB
+}
+
+func NewViewHandler(db *sql.DB) *ViewHandler {
+	return &ViewHandler{db: db}
+}
+
+const viewColumns = `id, name, query, sort, created_at, updated_at`
+
+func scanView(row interface{ Scan(...interface{}) error }) (models.View, error) {
+	var v models.View
+	err := row.Scan(&v.ID, &v.Name, &v.Query, &v.Sort, &v.CreatedAt, &v.UpdatedAt)
+	return v, err
+}
+
+// viewSorts maps the sort names of views to the expressions they order by
+var viewSorts = map[string]string{
+	"created":  "t.created_at",
+	"updated":  "t.updated_at",
+	"due":      "t.due_date",
+	"priority": "(CASE t.priority WHEN 'low' THEN 1 WHEN 'medium' THEN 2 WHEN 'high' THEN 3 END)",
+	"title":    "lower(t.title)",
+}
+
+// GetViews lists the authenticated user's saved views
+func (h *ViewHandler) GetViews(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	rows, err := h.db.Query(`
+		SELECT `+viewColumns+` FROM views
+		WHERE user_id = $1
+		ORDER BY lower(name), id
+	`, userID)
+	if err != nil {
+		http.Error(w, "Error fetching views", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	views := []models.View{}
+	for rows.Next() {
+		v, err := scanView(rows)
+		if err != nil {
+			http.Error(w, "Error scanning view", http.StatusInternalServerError)
+			return
+		}
+		views = append(views, v)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(views)
+}
+
+// GetView returns one of the authenticated user's saved views
+func (h *ViewHandler) GetView(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	viewID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid view ID", http.StatusBadRequest)
+		return
+	}
+
+	v, err := h.loadView(viewID, userID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "View not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error fetching view", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// CreateView saves a new view for the authenticated user. The query is
+// checked against the user's custom fields before it is saved.
+func (h *ViewHandler) CreateView(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var input models.ViewInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	msg, err := h.validateViewInput(userID, &input)
+	if err != nil {
+		log.Printf("Error checking view query: %v", err)
+		http.Error(w, "Error checking view query", http.StatusInternalServerError)
+		return
+	}
+	if msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	v, err := scanView(h.db.QueryRow(`
+		INSERT INTO views (user_id, name, query, sort)
+		VALUES ($1, $2, $3, $4)
+		RETURNING `+viewColumns+`
+	`, userID, input.Name, input.Query, input.Sort))
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+		http.Error(w, "A view with this name already exists", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Error creating view: %v", err)
+		http.Error(w, "Error creating view", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(v)
+}
+
+// UpdateView replaces a view's name, query and sort
+func (h *ViewHandler) UpdateView(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	viewID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid view ID", http.StatusBadRequest)
+		return
+	}
+
+	var input models.ViewInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	msg, err := h.validateViewInput(userID, &input)
+	if err != nil {
+		log.Printf("Error checking view query: %v", err)
+		http.Error(w, "Error checking view query", http.StatusInternalServerError)
+		return
+	}
+	if msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	v, err := scanView(h.db.QueryRow(`
+		UPDATE views SET name = $1, query = $2, sort = $3
+		WHERE id = $4 AND user_id = $5
+		RETURNING `+viewColumns+`
+	`, input.Name, input.Query, input.Sort, viewID, userID))
+	if err == sql.ErrNoRows {
+		http.Error(w, "View not found", http.StatusNotFound)
+		return
+	}
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+		http.Error(w, "A view with this name already exists", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Error updating view: %v", err)
+		http.Error(w, "Error updating view", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// DeleteView removes a saved view
+func (h *ViewHandler) DeleteView(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	viewID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid view ID", http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.db.Exec(`DELETE FROM views WHERE id = $1 AND user_id = $2`, viewID, userID)
+	if err != nil {
+		http.Error(w, "Error deleting view", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		http.Error(w, "View not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetViewTasks runs a view and returns a page of the tasks it matches.
+// ?limit= defaults to 50 (at most 500) and ?offset= to 0. A view whose
+// query no longer fits the user's custom fields is answered with 422.
+func (h *ViewHandler) GetViewTasks(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	viewID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid view ID", http.StatusBadRequest)
+		return
+	}
+
+	limit, offset := 50, 0
+	if v := r.URL.Query().Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > 500 {
+			http.Error(w, "Invalid limit; use 1 to 500", http.StatusBadRequest)
+			return
+		}
+	}
+	if v := r.URL.Query().Get("offset"); v != "" {
+		offset, err = strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			http.Error(w, "Invalid offset", http.StatusBadRequest)
+			return
+		}
+	}
+
+	v, err := h.loadView(viewID, userID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "View not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error fetching view", http.StatusInternalServerError)
+		return
+	}
+	profile, err := loadProfile(h.db, userID)
+	if err != nil {
+		http.Error(w, "Error loading profile", http.StatusInternalServerError)
+		return
+	}
+
+	query := newTaskQuery(userID)
+	orderBy, filterArgs, msg, err := compileView(h.db, userID, query, v.Query, v.Sort, time.Now(), profile)
+	if err != nil {
+		log.Printf("Error compiling view %d: %v", viewID, err)
+		http.Error(w, "Error running view", http.StatusInternalServerError)
+		return
+	}
+	if msg != "" {
+		http.Error(w, msg, http.StatusUnprocessableEntity)
+		return
+	}
+
+	page := models.ViewTasks{View: v, Tasks: []models.Task{}, Limit: limit, Offset: offset}
+	err = h.db.QueryRow(`
+		SELECT count(*) FROM tasks t
+		`+query.whereClause(), query.args[:filterArgs]...).Scan(&page.Total)
+	if err != nil {
+		log.Printf("Error counting view tasks: %v", err)
+		http.Error(w, "Error fetching tasks", http.StatusInternalServerError)
+		return
+	}
+
+	rows, err := h.db.Query(`
+		SELECT `+taskColumns+`
+		FROM tasks t
+		`+query.whereClause()+`
+		ORDER BY `+orderBy+`
+		LIMIT `+query.arg(limit)+` OFFSET `+query.arg(offset), query.args...)
+	if err != nil {
+		log.Printf("Error fetching view tasks: %v", err)
+		http.Error(w, "Error fetching tasks", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		task, err := scanTask(rows)
+		if err != nil {
+			http.Error(w, "Error scanning task", http.StatusInternalServerError)
+			return
+		}
+		page.Tasks = append(page.Tasks, task)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "Error fetching tasks", http.StatusInternalServerError)
+		return
+	}
+	if next := offset + len(page.Tasks); next < page.Total {
+		page.NextOffset = &next
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+func (h *ViewHandler) loadView(viewID, userID int) (models.View, error) {
+	return scanView(h.db.QueryRow(`
+		SELECT `+viewColumns+` FROM views WHERE id = $1 AND user_id = $2
+	`, viewID, userID))
+}
+
+// validateViewInput returns an error message if the view is invalid,
+// including a query or sort that doesn't compile for the user
+func (h *ViewHandler) validateViewInput(userID int, input *models.ViewInput) (string, error) {
+	input.Name = strings.TrimSpace(input.Name)
+	input.Query = strings.TrimSpace(input.Query)
+	input.Sort = strings.TrimSpace(input.Sort)
+	if input.Sort == "" {
+		input.Sort = "-created"
+	}
+	switch {
+	case input.Name == "":
+		return "Name is required", nil
+	case len(input.Name) > 100:
+		return "Name must be at most 100 characters long", nil
+	case len(input.Sort) > 50:
+		return "Invalid sort", nil
+	}
+	_, _, msg, err := compileView(h.db, userID, newTaskQuery(userID), input.Query, input.Sort, time.Now(), models.Profile{})
+	return msg, err
+}
+
+// compileView parses a view's query and sort into conditions on query and
+// an ORDER BY expression, with every value passed as an argument. It also
+// returns how many of query's arguments the conditions use, since sorting
+// may add more. It returns an error message for a query that doesn't parse
+// or doesn't fit the user's custom fields.
+func compileView(q queryer, userID int, query *taskQuery, text, sort string, now time.Time, profile models.Profile) (string, int, string, error) {
+	terms, err := viewquery.Parse(text)
+	if err != nil {
+		return "", 0, "Invalid query: " + err.Error(), nil
+	}
+
+	var fields map[string]models.CustomField
+	field := func(name string) (*models.CustomField, string, error) {
+		key := strings.TrimPrefix(name, "cf.")
+		if fields == nil {
+			if fields, err = loadCustomFields(q, userID); err != nil {
+				return nil, "", err
+			}
+		}
+		f, ok := fields[key]
+		if !ok {
+			return nil, "Unknown custom field " + key, nil
+		}
+		return &f, "", nil
+	}
+
+	c := viewCompiler{query: query, now: now, loc: profileLocation(profile), weekStart: profile.WeekStart}
+	for _, term := range terms {
+		var condition, msg string
+		if strings.HasPrefix(term.Field, "cf.") {
+			var f *models.CustomField
+			if f, msg, err = field(term.Field); err != nil {
+				return "", 0, "", err
+			}
+			if f != nil {
+				condition, msg = c.customField(f, term)
+			}
+		} else {
+			condition, msg = c.term(term)
+		}
+		if msg != "" {
+			return "", 0, msg, nil
+		}
+		if term.Negate {
+			// A negated term also matches tasks without a value
+			condition = "NOT COALESCE(" + condition + ", false)"
+		}
+		query.where(condition)
+	}
+	filterArgs := len(query.args)
+
+	direction := " ASC"
+	if strings.HasPrefix(sort, "-") {
+		sort, direction = sort[1:], " DESC"
+	}
+	expr, ok := viewSorts[sort]
+	if strings.HasPrefix(sort, "cf.") {
+		f, msg, err := field(sort)
+		if err != nil || msg != "" {
+			return "", 0, msg, err
+		}
+		if f.Type == "multi_select" {
+			return "", 0, "Tasks can't be sorted by a multi_select field", nil
+		}
+		expr, ok = query.customFieldExpr(f), true
+	}
+	if !ok {
+		return "", 0, "Invalid sort; use created, updated, due, priority, title or cf.<key>, with - to reverse", nil
+	}
+	return expr + direction + " NULLS LAST, t.id" + direction, filterArgs, "", nil
+}
+
+// viewCompiler turns view query terms into SQL conditions
+type viewCompiler struct {
+	query     *taskQuery
+	now       time.Time
+	loc       *time.Location
+	weekStart int
+}
+
+// term returns the condition for a term on a built-in field, or an error message
+func (c *viewCompiler) term(term viewquery.Term) (string, string) {
+	q := c.query
+	var values []string
+	for _, v := range term.Values {
+		values = append(values, strings.ToLower(v))
+	}
+
+	switch term.Field {
+	case "status":
+		for _, v := range term.Values {
+			if !isValidStatus(v) {
+				return "", "Invalid status " + v
+			}
+		}
+		return "t.status = ANY(" + q.arg(pq.Array(term.Values)) + ")", ""
+	case "priority":
+		for _, v := range values {
+			if !isValidPriority(v) {
+				return "", "Invalid priority " + v + "; use low, medium or high"
+			}
+		}
+		return "t.priority = ANY(" + q.arg(pq.Array(values)) + ")", ""
+	case "category":
+		var categories []string
+		for _, v := range term.Values {
+			category := ""
+			for _, name := range sortedCategories() {
+				if strings.EqualFold(name, v) {
+					category = name
+				}
+			}
+			if category == "" {
+				return "", "Invalid category " + v
+			}
+			categories = append(categories, category)
+		}
+		return "t.category = ANY(" + q.arg(pq.Array(categories)) + ")", ""
+	case "tag":
+		return `EXISTS (
+			SELECT 1 FROM task_tags tt JOIN tags g ON g.id = tt.tag_id
+			WHERE tt.task_id = t.id AND lower(g.name) = ANY(` + q.arg(pq.Array(values)) + `)
+		)`, ""
+	case "text":
+		var conditions []string
+		for _, v := range term.Values {
+			pattern := q.arg("%" + likeEscaper.Replace(v) + "%")
+			conditions = append(conditions, "t.title ILIKE "+pattern+" OR t.description ILIKE "+pattern)
+		}
+		return anyOf(conditions), ""
+	case "is":
+		var conditions []string
+		for _, v := range values {
+			switch v {
+			case "open":
+				conditions = append(conditions, "t.completed_at IS NULL")
+			case "done":
+				conditions = append(conditions, "t.completed_at IS NOT NULL")
+			case "overdue":
+				conditions = append(conditions, "t.due_date < "+q.arg(c.now)+" AND t.completed_at IS NULL")
+			case "recurring":
+				conditions = append(conditions, "COALESCE(t.recurrence, '') <> ''")
+			}
+		}
+		return anyOf(conditions), ""
+	case "has":
+		var conditions []string
+		for _, v := range values {
+			switch v {
+			case "due":
+				conditions = append(conditions, "t.due_date IS NOT NULL")
+			case "estimate":
+				conditions = append(conditions, "t.estimate_minutes IS NOT NULL")
+			case "tags":
+				conditions = append(conditions, "EXISTS (SELECT 1 FROM task_tags tt WHERE tt.task_id = t.id)")
+			case "recurrence":
+				conditions = append(conditions, "COALESCE(t.recurrence, '') <> ''")
+			}
+		}
+		return anyOf(conditions), ""
+	case "due", "created":
+		column := "t.due_date"
+		if term.Field == "created" {
+			column = "t.created_at"
+		}
+		return c.dates(column, term.Op, values), ""
+	case "estimate":
+		var conditions []string
+		for _, v := range values {
+			if v == "none" {
+				conditions = append(conditions, "t.estimate_minutes IS NULL")
+				continue
+			}
+			minutes, _ := viewquery.Minutes(v)
+			conditions = append(conditions, "t.estimate_minutes "+term.Op+" "+q.arg(minutes))
+		}
+		return anyOf(conditions), ""
+	}
+	return "", "Unknown field " + term.Field
+}
+
+// dates returns the condition for a due: or created: term, whose values
+// the parser has already checked
+func (c *viewCompiler) dates(column, op string, values []string) string {
+	q := c.query
+	between := func(start, end time.Time) string {
+		return column + " >= " + q.arg(start) + " AND " + column + " < " + q.arg(end)
+	}
+	today := startOfDay(c.now, c.loc)
+
+	var conditions []string
+	for _, v := range values {
+		if op != "=" {
+			bound, _ := viewquery.Bound(op, v, c.now, c.loc)
+			conditions = append(conditions, column+" "+op+" "+q.arg(bound))
+			continue
+		}
+		switch v {
+		case "today":
+			conditions = append(conditions, between(today, today.AddDate(0, 0, 1)))
+		case "tomorrow":
+			conditions = append(conditions, between(today.AddDate(0, 0, 1), today.AddDate(0, 0, 2)))
+		case "yesterday":
+			conditions = append(conditions, between(today.AddDate(0, 0, -1), today))
+		case "week":
+			week := startOfWeek(c.now, c.loc, c.weekStart)
+			conditions = append(conditions, between(week, week.AddDate(0, 0, 7)))
+		case "overdue":
+			conditions = append(conditions, column+" < "+q.arg(c.now)+" AND t.completed_at IS NULL")
+		case "none":
+			conditions = append(conditions, column+" IS NULL")
+		default:
+			start, end, _ := viewquery.Day(v, c.now, c.loc)
+			conditions = append(conditions, between(start, end))
+		}
+	}
+	return anyOf(conditions)
+}
+
+// customField returns the condition for a cf.<key> term, or an error message
+func (c *viewCompiler) customField(f *models.CustomField, term viewquery.Term) (string, string) {
+	if term.Op != "=" && f.Type != "number" && f.Type != "date" {
+		return "", "Only number and date fields can be compared with " + term.Op
+	}
+	var conditions []string
+	for _, raw := range term.Values {
+		if term.Op == "=" && strings.EqualFold(raw, "none") && f.Type != "text" && !hasOption(f, raw) {
+			conditions = append(conditions, "NOT t.custom_fields ? "+c.query.arg(f.Key))
+			continue
+		}
+		value, ok := parseCustomFieldFilter(f, raw)
+		if !ok {
+			return "", "Invalid value for custom field " + f.Key
+		}
+		conditions = append(conditions, c.query.customFieldCondition(f, term.Op, value))
+	}
+	return anyOf(conditions), ""
+}
+
+// likeEscaper escapes the wildcards of LIKE patterns
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// anyOf joins alternative conditions
+func anyOf(conditions []string) string {
+	return "((" + strings.Join(conditions, ") OR (") + "))"
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"task-manager/models"
+)
+
+// TestCompileViewInjection checks that hostile query text only ever reaches
+// the SQL as arguments, never as part of the statement
+func TestCompileViewInjection(t *testing.T) {
+	queries := []string{
+		`"'; DROP TABLE tasks; --"`,
+		"tag:x');DELETE/**/FROM/**/tasks;--",
+		`text:"a' OR '1'='1"`,
+		"-tag:\"x\\\" OR true --\"",
+		"100%_done",
+	}
+	for _, text := range queries {
+		query := newTaskQuery(1)
+		order, _, msg, err := compileView(nil, 1, query, text, "-due", time.Now(), models.Profile{})
+		if err != nil || msg != "" {
+			t.Errorf("compileView(%q): %v %s", text, err, msg)
+			continue
+		}
+		statement := query.whereClause() + " ORDER BY " + order
+		for _, bad := range []string{"DROP", "DELETE", "'", "--", "OR true", "%"} {
+			if strings.Contains(statement, bad) {
+				t.Errorf("compileView(%q) put %q into the statement: %s", text, bad, statement)
+			}
+		}
+	}
+}
+
+func TestCompileViewErrors(t *testing.T) {
+	tests := []struct {
+		text, sort, msg string
+	}{
+		{"status:'pending'", "created", "Invalid status"},
+		{"priority:urgent", "created", "Invalid priority"},
+		{"category:Nope", "created", "Invalid category"},
+		{"due:<", "created", "Invalid query"},
+		{"", "title;DROP TABLE tasks", "Invalid sort"},
+	}
+	for _, tt := range tests {
+		_, _, msg, err := compileView(nil, 1, newTaskQuery(1), tt.text, tt.sort, time.Now(), models.Profile{})
+		if err != nil || !strings.Contains(msg, tt.msg) {
+			t.Errorf("compileView(%q, %q) = %q, %v, want %q", tt.text, tt.sort, msg, err, tt.msg)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// XML namespaces used by WebDAV and CalDAV
+const (
+	nsDAV    = "DAV:"
+	nsCalDAV = "urn:ietf:params:xml:ns:caldav"
+	nsCS     = "http://calendarserver.org/ns/"
+)
+
+var davPrefixes = map[string]string{nsDAV: "d", nsCalDAV: "c", nsCS: "cs"}
+
+// davRequest is the part of a PROPFIND or REPORT body this server understands
+type davRequest struct {
+	root        xml.Name
+	props       []xml.Name
+	allProp     bool
+	hrefs       []string
+	syncToken   string
+	compFilters []string
+}
+
+// wantsProp reports whether a property should be included in the response
+func (req *davRequest) wantsProp(name xml.Name) bool {
+	if req.allProp || len(req.props) == 0 {
+		return true
+	}
+	for _, p := range req.props {
+		if p == name {
+			return true
+		}
+	}
+	return false
+}
+
+// parseDAVRequest reads a PROPFIND or REPORT body. An empty body is treated as allprop.
+func parseDAVRequest(body io.Reader) (*davRequest, error) {
+	req := &davRequest{}
+	dec := xml.NewDecoder(body)
+	var stack []xml.Name
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if len(stack) == 0 {
+				req.root = t.Name
+			}
+			parent := xml.Name{}
+			if len(stack) > 0 {
+				parent = stack[len(stack)-1]
+			}
+			switch {
+			case parent.Space == nsDAV && parent.Local == "prop":
+				req.props = append(req.props, t.Name)
+			case t.Name.Space == nsDAV && t.Name.Local == "allprop":
+				req.allProp = true
+			case t.Name.Space == nsCalDAV && t.Name.Local == "comp-filter":
+				for _, attr := range t.Attr {
+					if attr.Name.Local == "name" {
+						req.compFilters = append(req.compFilters, strings.ToUpper(attr.Value))
+					}
+				}
+			}
+			stack = append(stack, t.Name)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) == 0 {
+				continue
+			}
+			current := stack[len(stack)-1]
+			text := strings.TrimSpace(string(t))
+			if current.Space == nsDAV && current.Local == "href" && text != "" {
+				req.hrefs = append(req.hrefs, text)
+			}
+			if current.Space == nsDAV && current.Local == "sync-token" {
+				req.syncToken += text
+			}
+		}
+	}
+	return req, nil
+}
+
+// davProp is a property value; inner holds the already-encoded XML content
+type davProp struct {
+	name  xml.Name
+	inner string
+}
+
+// davResponse is one <response> of a multistatus body
+type davResponse struct {
+	href    string
+	props   []davProp
+	missing []xml.Name
+	status  int // when set, the response has this status and no properties
+}
+
+// selectProps splits the available properties into those requested and those missing
+func selectProps(req *davRequest, href string, available []davProp) davResponse {
+	resp := davResponse{href: href}
+	if req.allProp || len(req.props) == 0 {
+		resp.props = available
+		return resp
+	}
+	for _, name := range req.props {
+		found := false
+		for _, p := range available {
+			if p.name == name {
+				resp.props = append(resp.props, p)
+				found = true
+				break
+			}
+		}
+		if !found {
+			resp.missing = append(resp.missing, name)
+		}
+	}
+	return resp
+}
+
+// writeMultistatus writes a 207 Multi-Status response
+func writeMultistatus(w http.ResponseWriter, responses []davResponse, syncToken string) {
+	var b bytes.Buffer
+	b.WriteString(`<?xml version="1.0" encoding="utf-8"?>` + "\n")
+	b.WriteString(`<d:multistatus xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav" xmlns:cs="http://calendarserver.org/ns/">`)
+	for _, resp := range responses {
+		b.WriteString("<d:response><d:href>" + xmlEscape(resp.href) + "</d:href>")
+		if resp.status != 0 {
+			b.WriteString(statusLine(resp.status))
+		} else {
+			if len(resp.props) > 0 {
+				b.WriteString("<d:propstat><d:prop>")
+				for _, p := range resp.props {
+					b.WriteString(davElement(p.name, p.inner))
+				}
+				b.WriteString("</d:prop>" + statusLine(http.StatusOK) + "</d:propstat>")
+			}
+			if len(resp.missing) > 0 {
+				b.WriteString("<d:propstat><d:prop>")
+				for _, name := range resp.missing {
+					b.WriteString(davElement(name, ""))
+				}
+				b.WriteString("</d:prop>" + statusLine(http.StatusNotFound) + "</d:propstat>")
+			}
+		}
+		b.WriteString("</d:response>")
+	}
+	if syncToken != "" {
+		b.WriteString("<d:sync-token>" + xmlEscape(syncToken) + "</d:sync-token>")
+	}
+	b.WriteString("</d:multistatus>\n")
+
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusMultiStatus)
+	w.Write(b.Bytes())
+}
+
+// davElement encodes an element, declaring its namespace inline when it has no known prefix
+func davElement(name xml.Name, inner string) string {
+	tag := name.Local
+	attrs := ""
+	if prefix, ok := davPrefixes[name.Space]; ok {
+		tag = prefix + ":" + name.Local
+	} else if name.Space != "" {
+		attrs = ` xmlns="` + xmlEscape(name.Space) + `"`
+	}
+	if inner == "" {
+		return "<" + tag + attrs + "/>"
+	}
+	return "<" + tag + attrs + ">" + inner + "</" + tag + ">"
+}
+
+func statusLine(code int) string {
+	return fmt.Sprintf("<d:status>HTTP/1.1 %d %s</d:status>", code, http.StatusText(code))
+}
+
+// writeDAVError writes an error response carrying a precondition element
+func writeDAVError(w http.ResponseWriter, code int, condition xml.Name) {
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(code)
+	io.WriteString(w, `<?xml version="1.0" encoding="utf-8"?>`+"\n"+
+		`<d:error xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">`+davElement(condition, "")+"</d:error>\n")
+}
+
+func xmlEscape(s string) string {
+	var b bytes.Buffer
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// hrefProp returns the inner XML of a property holding a single href
+func hrefProp(href string) string {
+	return "<d:href>" + xmlEscape(href) + "</d:href>"
+}
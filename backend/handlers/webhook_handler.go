@@ -0,0 +1,487 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+	"task-manager/models"
+	"task-manager/webhooks"
+)
+
+// maxWebhooksPerUser bounds how many endpoints one user can register
+const maxWebhooksPerUser = 20
+
+type WebhookHandler struct {
+	db *sql.DB
+}
+
+func NewWebhookHandler(db *sql.DB) *WebhookHandler {
+	return &WebhookHandler{db: db}
+}
+
+// GetWebhooks lists the authenticated user's webhooks, without their secrets
+func (h *WebhookHandler) GetWebhooks(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	rows, err := h.db.Query(`
+		SELECT id, url, events, description, is_active, created_at, updated_at
+		FROM webhooks
+		WHERE user_id = $1
+		ORDER BY id
+	`, userID)
+	if err != nil {
+		http.Error(w, "Error fetching webhooks", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	webhooks := []models.Webhook{}
+	for rows.Next() {
+		var webhook models.Webhook
+		if err := scanWebhook(rows, &webhook); err != nil {
+			http.Error(w, "Error scanning webhook", http.StatusInternalServerError)
+			return
+		}
+		webhooks = append(webhooks, webhook)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(webhooks)
+}
+
+// CreateWebhook registers an endpoint. The response includes the signing
+// secret, which isn't shown again.
+func (h *WebhookHandler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var webhookCreate models.WebhookCreate
+	if err := json.NewDecoder(r.Body).Decode(&webhookCreate); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if msg := validateWebhookURL(webhookCreate.URL); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	if msg := validateWebhookEvents(webhookCreate.Events); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	if len(webhookCreate.Description) > 255 {
+		http.Error(w, "Description must be at most 255 characters long", http.StatusBadRequest)
+		return
+	}
+
+	var count int
+	if err := h.db.QueryRow(`SELECT count(*) FROM webhooks WHERE user_id = $1`, userID).Scan(&count); err != nil {
+		http.Error(w, "Error counting webhooks", http.StatusInternalServerError)
+		return
+	}
+	if count >= maxWebhooksPerUser {
+		http.Error(w, "Too many webhooks", http.StatusConflict)
+		return
+	}
+
+	secret, err := randomToken()
+	if err != nil {
+		http.Error(w, "Error creating webhook secret", http.StatusInternalServerError)
+		return
+	}
+
+	var webhook models.Webhook
+	err = scanWebhook(h.db.QueryRow(`
+		INSERT INTO webhooks (user_id, url, secret, events, description)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, url, events, description, is_active, created_at, updated_at
+	`, userID, webhookCreate.URL, secret, pq.Array(webhookCreate.Events), webhookCreate.Description), &webhook)
+	if err != nil {
+		log.Printf("Error creating webhook: %v", err)
+		http.Error(w, "Error creating webhook", http.StatusInternalServerError)
+		return
+	}
+	webhook.Secret = secret
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(webhook)
+}
+
+// UpdateWebhook changes a webhook's URL, events, description or active flag
+func (h *WebhookHandler) UpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	webhookID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid webhook ID", http.StatusBadRequest)
+		return
+	}
+
+	var webhookUpdate models.WebhookUpdate
+	if err := json.NewDecoder(r.Body).Decode(&webhookUpdate); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if webhookUpdate.URL != nil {
+		if msg := validateWebhookURL(*webhookUpdate.URL); msg != "" {
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+	}
+	if webhookUpdate.Events != nil {
+		if msg := validateWebhookEvents(webhookUpdate.Events); msg != "" {
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+	}
+	if webhookUpdate.Description != nil && len(*webhookUpdate.Description) > 255 {
+		http.Error(w, "Description must be at most 255 characters long", http.StatusBadRequest)
+		return
+	}
+
+	var events interface{}
+	if webhookUpdate.Events != nil {
+		events = pq.Array(webhookUpdate.Events)
+	}
+	var webhook models.Webhook
+	err = scanWebhook(h.db.QueryRow(`
+		UPDATE webhooks
+		SET url = COALESCE($1, url),
+			events = COALESCE($2, events),
+			description = COALESCE($3, description),
+			is_active = COALESCE($4, is_active)
+		WHERE id = $5 AND user_id = $6
+		RETURNING id, url, events, description, is_active, created_at, updated_at
+	`, webhookUpdate.URL, events, webhookUpdate.Description, webhookUpdate.IsActive, webhookID, userID), &webhook)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error updating webhook: %v", err)
+		http.Error(w, "Error updating webhook", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(webhook)
+}
+
+// DeleteWebhook removes a webhook along with its delivery log
+func (h *WebhookHandler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	webhookID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid webhook ID", http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.db.Exec(`DELETE FROM webhooks WHERE id = $1 AND user_id = $2`, webhookID, userID)
+	if err != nil {
+		log.Printf("Error deleting webhook: %v", err)
+		http.Error(w, "Error deleting webhook", http.StatusInternalServerError)
+		return
+	}
+	if rowsAffected, err := result.RowsAffected(); err != nil || rowsAffected == 0 {
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RotateWebhookSecret replaces a webhook's signing secret and returns the new one
+func (h *WebhookHandler) RotateWebhookSecret(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	webhookID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid webhook ID", http.StatusBadRequest)
+		return
+	}
+
+	secret, err := randomToken()
+	if err != nil {
+		http.Error(w, "Error creating webhook secret", http.StatusInternalServerError)
+		return
+	}
+	var webhook models.Webhook
+	err = scanWebhook(h.db.QueryRow(`
+		UPDATE webhooks SET secret = $1
+		WHERE id = $2 AND user_id = $3
+		RETURNING id, url, events, description, is_active, created_at, updated_at
+	`, secret, webhookID, userID), &webhook)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error rotating webhook secret: %v", err)
+		http.Error(w, "Error rotating webhook secret", http.StatusInternalServerError)
+		return
+	}
+	webhook.Secret = secret
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(webhook)
+}
+
+// GetDeliveries returns a webhook's delivery log, newest first.
+// Filter with ?status=pending|delivered|dead; ?limit= defaults to 50.
+func (h *WebhookHandler) GetDeliveries(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	webhookID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid webhook ID", http.StatusBadRequest)
+		return
+	}
+	status := r.URL.Query().Get("status")
+	if status != "" && status != "pending" && status != "delivered" && status != "dead" {
+		http.Error(w, "Status must be pending, delivered or dead", http.StatusBadRequest)
+		return
+	}
+	limit := 50
+	if v := r.URL.Query().Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > 500 {
+			http.Error(w, "Limit must be between 1 and 500", http.StatusBadRequest)
+			return
+		}
+	}
+
+	var exists bool
+	err = h.db.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM webhooks WHERE id = $1 AND user_id = $2)
+	`, webhookID, userID).Scan(&exists)
+	if err != nil {
+		http.Error(w, "Error checking webhook existence", http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+		return
+	}
+
+	rows, err := h.db.Query(`
+		SELECT `+deliveryColumns+`
+		FROM webhook_deliveries
+		WHERE webhook_id = $1 AND ($2 = '' OR status = $2)
+		ORDER BY created_at DESC, id DESC
+		LIMIT $3
+	`, webhookID, status, limit)
+	if err != nil {
+		http.Error(w, "Error fetching deliveries", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	deliveries := []models.WebhookDelivery{}
+	for rows.Next() {
+		var delivery models.WebhookDelivery
+		if err := scanDelivery(rows, &delivery); err != nil {
+			http.Error(w, "Error scanning delivery", http.StatusInternalServerError)
+			return
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(deliveries)
+}
+
+// Redeliver queues a delivery to be sent again straight away, whatever its
+// current status. Its attempt count starts over.
+func (h *WebhookHandler) Redeliver(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	webhookID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid webhook ID", http.StatusBadRequest)
+		return
+	}
+	deliveryID, err := strconv.ParseInt(mux.Vars(r)["deliveryId"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid delivery ID", http.StatusBadRequest)
+		return
+	}
+
+	var delivery models.WebhookDelivery
+	err = scanDelivery(h.db.QueryRow(`
+		UPDATE webhook_deliveries d
+		SET status = 'pending', attempts = 0, next_attempt_at = CURRENT_TIMESTAMP, delivered_at = NULL
+		FROM webhooks w
+		WHERE d.id = $1 AND d.webhook_id = $2 AND w.id = d.webhook_id AND w.user_id = $3
+		RETURNING `+qualifiedDeliveryColumns+`
+	`, deliveryID, webhookID, userID), &delivery)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Delivery not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error queueing redelivery: %v", err)
+		http.Error(w, "Error queueing redelivery", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(delivery)
+}
+
+// deliveryColumns lists the webhook_deliveries columns read by scanDelivery
+const deliveryColumns = `id, webhook_id, event, payload, status, attempts, next_attempt_at,
+	last_attempt_at, response_status, last_error, created_at, delivered_at`
+
+const qualifiedDeliveryColumns = `d.id, d.webhook_id, d.event, d.payload, d.status, d.attempts, d.next_attempt_at,
+	d.last_attempt_at, d.response_status, d.last_error, d.created_at, d.delivered_at`
+
+func scanDelivery(row interface{ Scan(...interface{}) error }, d *models.WebhookDelivery) error {
+	var nextAttempt, lastAttempt, delivered sql.NullTime
+	var responseStatus sql.NullInt64
+	err := row.Scan(&d.ID, &d.WebhookID, &d.Event, &d.Payload, &d.Status, &d.Attempts, &nextAttempt,
+		&lastAttempt, &responseStatus, &d.LastError, &d.CreatedAt, &delivered)
+	if err != nil {
+		return err
+	}
+	d.NextAttemptAt = nullTimePtr(nextAttempt)
+	d.LastAttemptAt = nullTimePtr(lastAttempt)
+	d.DeliveredAt = nullTimePtr(delivered)
+	d.ResponseStatus = nullIntPtr(responseStatus)
+	return nil
+}
+
+func scanWebhook(row interface{ Scan(...interface{}) error }, webhook *models.Webhook) error {
+	return row.Scan(&webhook.ID, &webhook.URL, pq.Array(&webhook.Events), &webhook.Description,
+		&webhook.IsActive, &webhook.CreatedAt, &webhook.UpdatedAt)
+}
+
+func nullTimePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+// validateWebhookURL requires an absolute http or https URL that doesn't
+// point at this host or a private network. Hostnames are checked again by the
+// dispatcher once resolved, since what they resolve to can change.
+func validateWebhookURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "URL must be an absolute http or https URL"
+	}
+	if u.User != nil {
+		return "URL must not contain credentials"
+	}
+	if len(raw) > 2048 {
+		return "URL must be at most 2048 characters long"
+	}
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return "URL must point to a public address"
+	}
+	if ip, err := netip.ParseAddr(host); err == nil && !webhooks.IsPublicIP(ip) {
+		return "URL must point to a public address"
+	}
+	return ""
+}
+
+// validateWebhookEvents requires a non-empty list of known events without repeats
+func validateWebhookEvents(events []string) string {
+	if len(events) == 0 {
+		return "At least one event is required"
+	}
+	seen := make(map[string]bool)
+	for _, event := range events {
+		known := false
+		for _, e := range models.WebhookEvents {
+			known = known || e == event
+		}
+		if !known {
+			return "Events must be among " + strings.Join(models.WebhookEvents, ", ")
+		}
+		if seen[event] {
+			return "Event " + event + " is listed more than once"
+		}
+		seen[event] = true
+	}
+	return ""
+}
+
+// webhookPayload is the JSON body POSTed to webhook endpoints
+type webhookPayload struct {
+	Event      string                        `json:"event"`
+	OccurredAt time.Time                     `json:"occurred_at"`
+	Task       *models.Task                  `json:"task"`
+	Changes    map[string]models.FieldChange `json:"changes,omitempty"`
+}
+
+// enqueueTaskWebhooks queues deliveries of a task event to the owner's
+// subscribed webhooks inside the transaction that made the change
+func enqueueTaskWebhooks(tx *sql.Tx, action string, task *models.Task, changes map[string]models.FieldChange) error {
+	var events []string
+	switch action {
+	case "created":
+		events = []string{"task.created"}
+	case "updated", "restored":
+		events = []string{"task.updated"}
+		// Entering any done state of the task's workflow completes it
+		if change, ok := changes["completed_at"]; ok && change.From == nil && change.To != nil {
+			events = append(events, "task.completed")
+		}
+	case "deleted":
+		events = []string{"task.deleted"}
+	}
+
+	now := time.Now().UTC()
+	for _, event := range events {
+		payload, err := json.Marshal(webhookPayload{Event: event, OccurredAt: now, Task: task, Changes: changes})
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`
+			INSERT INTO webhook_deliveries (webhook_id, event, payload)
+			SELECT w.id, $2, $3
+			FROM webhooks w
+			WHERE w.user_id = (SELECT user_id FROM tasks WHERE id = $1)
+			  AND w.is_active AND $2 = ANY(w.events)
+		`, task.ID, event, payload)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
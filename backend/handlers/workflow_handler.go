@@ -0,0 +1,420 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+	"task-manager/models"
+)
+
+const (
+	maxWorkflowStates = 20
+	// defaultWorkflowKey names the user's default workflow in routes
+	defaultWorkflowKey = "default"
+)
+
+// workflowFor returns the workflow for a category: the user's workflow for
+// that category, else their default workflow, else the built-in one
+func workflowFor(q queryer, userID int, category string) (models.Workflow, error) {
+	wf, err := scanWorkflow(q.QueryRow(`
+		SELECT `+workflowColumns+`
+		FROM workflows
+		WHERE user_id = $1 AND (category = $2 OR category IS NULL)
+		ORDER BY category NULLS LAST
+		LIMIT 1
+	`, userID, category))
+	if err == sql.ErrNoRows {
+		return models.DefaultWorkflow(), nil
+	}
+	return wf, err
+}
+
+// initialStatus checks the status of a new task, defaulting to the first
+// state of its workflow, and reports whether it is a done state
+func initialStatus(q queryer, userID int, category, status string) (string, bool, error) {
+	wf, err := workflowFor(q, userID, category)
+	if err != nil {
+		return "", false, err
+	}
+	if status == "" {
+		status = wf.InitialState()
+	}
+	if !wf.HasState(status) {
+		return "", false, &taskRuleError{fmt.Sprintf("Status %q is not part of the %s workflow", status, wf.Name)}
+	}
+	return status, wf.IsDone(status), nil
+}
+
+// checkTransition checks moving a task to status and category and reports
+// whether the new status is a done state. Transition rules aren't applied
+// when the task comes from a state the target workflow doesn't have, as
+// happens when it changes category.
+func checkTransition(q queryer, userID int, task *models.Task, status, category string) (bool, error) {
+	wf, err := workflowFor(q, userID, category)
+	if err != nil {
+		return false, err
+	}
+	if !wf.HasState(status) {
+		return false, &taskRuleError{fmt.Sprintf("Status %q is not part of the %s workflow", status, wf.Name)}
+	}
+	if wf.HasState(task.Status) && !wf.Allows(task.Status, status) {
+		return false, &taskRuleError{fmt.Sprintf("The %s workflow doesn't allow moving from %q to %q", wf.Name, task.Status, status)}
+	}
+	return wf.IsDone(status), nil
+}
+
+const workflowColumns = `id, COALESCE(category, ''), name, states, transitions, created_at, updated_at`
+
+func scanWorkflow(row interface{ Scan(...interface{}) error }) (models.Workflow, error) {
+	var wf models.Workflow
+	var states, transitions []byte
+	var createdAt, updatedAt sql.NullTime
+	if err := row.Scan(&wf.ID, &wf.Category, &wf.Name, &states, &transitions, &createdAt, &updatedAt); err != nil {
+		return wf, err
+	}
+	if err := json.Unmarshal(states, &wf.States); err != nil {
+		return wf, err
+	}
+	if err := json.Unmarshal(transitions, &wf.Transitions); err != nil {
+		return wf, err
+	}
+	if len(wf.States) == 0 {
+		return wf, fmt.Errorf("workflow %d has no states", wf.ID)
+	}
+	wf.CreatedAt = nullTimePtr(createdAt)
+	wf.UpdatedAt = nullTimePtr(updatedAt)
+	return wf, nil
+}
+
+type WorkflowHandler struct {
+	db *sql.DB
+}
+
+func NewWorkflowHandler(db *sql.DB) *WorkflowHandler {
+	return &WorkflowHandler{db: db}
+}
+
+// GetWorkflows lists the authenticated user's workflows, including the
+// built-in default when they haven't defined their own
+func (h *WorkflowHandler) GetWorkflows(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	rows, err := h.db.Query(`
+		SELECT `+workflowColumns+`
+		FROM workflows
+		WHERE user_id = $1
+		ORDER BY category NULLS FIRST
+	`, userID)
+	if err != nil {
+		http.Error(w, "Error fetching workflows", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	workflows := []models.Workflow{}
+	for rows.Next() {
+		wf, err := scanWorkflow(rows)
+		if err != nil {
+			log.Printf("Error scanning workflow: %v", err)
+			http.Error(w, "Error scanning workflow", http.StatusInternalServerError)
+			return
+		}
+		workflows = append(workflows, wf)
+	}
+	if len(workflows) == 0 || workflows[0].Category != "" {
+		workflows = append([]models.Workflow{models.DefaultWorkflow()}, workflows...)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(workflows)
+}
+
+// GetWorkflow returns the workflow in effect for a category, or the user's
+// default workflow for /api/workflows/default
+func (h *WorkflowHandler) GetWorkflow(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	category, ok := workflowCategory(w, r)
+	if !ok {
+		return
+	}
+
+	wf, err := workflowFor(h.db, userID, category)
+	if err != nil {
+		http.Error(w, "Error fetching workflow", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(wf)
+}
+
+// PutWorkflow creates or replaces the workflow of a category or the user's
+// default workflow. It is refused while tasks it applies to are in a status
+// the new workflow doesn't have. Tasks whose status changes between done
+// and not done have completed_at set or cleared to match.
+func (h *WorkflowHandler) PutWorkflow(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	category, ok := workflowCategory(w, r)
+	if !ok {
+		return
+	}
+
+	var input models.WorkflowInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if msg := validateWorkflowInput(&input, category); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	states, _ := json.Marshal(input.States)
+	transitions, _ := json.Marshal(input.Transitions)
+
+	tx, err := beginTaskTx(h.db, userID)
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		http.Error(w, "Error starting transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	wf, err := scanWorkflow(tx.QueryRow(`
+		INSERT INTO workflows (user_id, category, name, states, transitions)
+		VALUES ($1, NULLIF($2, ''), $3, $4, $5)
+		ON CONFLICT (user_id, (COALESCE(category, ''))) DO UPDATE
+		SET name = EXCLUDED.name, states = EXCLUDED.states, transitions = EXCLUDED.transitions
+		RETURNING `+workflowColumns+`
+	`, userID, category, input.Name, states, transitions))
+	if err != nil {
+		log.Printf("Error saving workflow: %v", err)
+		http.Error(w, "Error saving workflow", http.StatusInternalServerError)
+		return
+	}
+
+	if !h.applyWorkflow(w, tx, userID, category, wf) {
+		return
+	}
+	if err = tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		http.Error(w, "Error committing transaction", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(wf)
+}
+
+// DeleteWorkflow removes a workflow, so its tasks fall back to the default
+// one. Like PutWorkflow, it is refused if that would strand tasks.
+func (h *WorkflowHandler) DeleteWorkflow(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	category, ok := workflowCategory(w, r)
+	if !ok {
+		return
+	}
+
+	tx, err := beginTaskTx(h.db, userID)
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		http.Error(w, "Error starting transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		DELETE FROM workflows WHERE user_id = $1 AND COALESCE(category, '') = $2
+	`, userID, category)
+	if err != nil {
+		http.Error(w, "Error deleting workflow", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		http.Error(w, "Workflow not found", http.StatusNotFound)
+		return
+	}
+
+	fallback, err := workflowFor(tx, userID, category)
+	if err != nil {
+		http.Error(w, "Error fetching workflow", http.StatusInternalServerError)
+		return
+	}
+	if !h.applyWorkflow(w, tx, userID, category, fallback) {
+		return
+	}
+	if err = tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		http.Error(w, "Error committing transaction", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// applyWorkflow checks that every task the workflow now governs is in one of
+// its states and brings completed_at in line with its done states. It writes
+// the error response and returns false if the change can't be made.
+func (h *WorkflowHandler) applyWorkflow(w http.ResponseWriter, tx *sql.Tx, userID int, category string, wf models.Workflow) bool {
+	scope := "t.category = $2"
+	if category == "" {
+		scope = `$2 = '' AND NOT EXISTS (
+			SELECT 1 FROM workflows wf WHERE wf.user_id = t.user_id AND wf.category = t.category
+		)`
+	}
+
+	var names, done []string
+	for _, s := range wf.States {
+		names = append(names, s.Name)
+		if s.Done {
+			done = append(done, s.Name)
+		}
+	}
+
+	var stranded []string
+	err := tx.QueryRow(`
+		SELECT COALESCE(array_agg(DISTINCT t.status), '{}')
+		FROM tasks t
+		WHERE t.user_id = $1 AND `+scope+` AND NOT (t.status = ANY($3))
+	`, userID, category, pq.Array(names)).Scan(pq.Array(&stranded))
+	if err != nil {
+		log.Printf("Error checking task statuses: %v", err)
+		http.Error(w, "Error checking task statuses", http.StatusInternalServerError)
+		return false
+	}
+	if len(stranded) > 0 {
+		sort.Strings(stranded)
+		http.Error(w, "Tasks are still in statuses the workflow doesn't have: "+strings.Join(stranded, ", "), http.StatusConflict)
+		return false
+	}
+
+	// Each task whose completion changes gets a history entry and webhook
+	// deliveries, as it would when updated on its own
+	before, err := lockTasksWhere(tx, `t.user_id = $1 AND `+scope+`
+		AND (t.status = ANY($3)) = (t.completed_at IS NULL)`, userID, category, pq.Array(done))
+	if err != nil {
+		log.Printf("Error fetching tasks: %v", err)
+		http.Error(w, "Error fetching tasks", http.StatusInternalServerError)
+		return false
+	}
+	if len(before) == 0 {
+		return true
+	}
+	ids := make([]int64, len(before))
+	for i := range before {
+		ids[i] = int64(before[i].ID)
+	}
+
+	_, err = tx.Exec(`
+		UPDATE tasks t
+		SET completed_at = CASE WHEN t.status = ANY($2) THEN COALESCE(t.completed_at, CURRENT_TIMESTAMP) END
+		WHERE t.id = ANY($1)
+	`, pq.Array(ids), pq.Array(done))
+	if err != nil {
+		log.Printf("Error updating completion times: %v", err)
+		http.Error(w, "Error updating tasks", http.StatusInternalServerError)
+		return false
+	}
+
+	after, err := lockTasksWhere(tx, `t.id = ANY($1)`, pq.Array(ids))
+	if err == nil && len(after) != len(before) {
+		err = fmt.Errorf("expected %d tasks, found %d", len(before), len(after))
+	}
+	for i := 0; err == nil && i < len(after); i++ {
+		err = recordTaskEvent(tx, userID, "updated", &before[i], &after[i])
+	}
+	if err != nil {
+		log.Printf("Error recording task changes: %v", err)
+		http.Error(w, "Error recording task changes", http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
+
+// workflowCategory reads the category from the route; "" stands for the default workflow
+func workflowCategory(w http.ResponseWriter, r *http.Request) (string, bool) {
+	category := mux.Vars(r)["category"]
+	if category == defaultWorkflowKey {
+		return "", true
+	}
+	if !isValidCategory(category) {
+		http.Error(w, "Invalid category value", http.StatusNotFound)
+		return "", false
+	}
+	return category, true
+}
+
+// validateWorkflowInput checks a workflow definition and fills in defaults
+func validateWorkflowInput(input *models.WorkflowInput, category string) string {
+	input.Name = strings.TrimSpace(input.Name)
+	if input.Name == "" {
+		input.Name = category
+		if category == "" {
+			input.Name = "Default"
+		}
+	}
+	if len(input.Name) > 100 {
+		return "Name must be at most 100 characters long"
+	}
+	if len(input.States) == 0 || len(input.States) > maxWorkflowStates {
+		return fmt.Sprintf("A workflow must have between 1 and %d states", maxWorkflowStates)
+	}
+
+	seen := make(map[string]bool)
+	hasDone := false
+	for i := range input.States {
+		s := &input.States[i]
+		s.Label = strings.TrimSpace(s.Label)
+		if !models.StatusNamePattern.MatchString(s.Name) {
+			return fmt.Sprintf("State name %q must be lowercase letters, digits and underscores, starting with a letter and at most 20 characters long", s.Name)
+		}
+		if seen[s.Name] {
+			return fmt.Sprintf("State %q is listed twice", s.Name)
+		}
+		if len(s.Label) > 50 {
+			return "State labels must be at most 50 characters long"
+		}
+		seen[s.Name] = true
+		hasDone = hasDone || s.Done
+	}
+	if !hasDone {
+		return "A workflow needs at least one done state"
+	}
+
+	for from, targets := range input.Transitions {
+		if !seen[from] {
+			return fmt.Sprintf("Transition from unknown state %q", from)
+		}
+		for _, to := range targets {
+			if !seen[to] {
+				return fmt.Sprintf("Transition to unknown state %q", to)
+			}
+		}
+	}
+	if input.Transitions == nil {
+		input.Transitions = map[string][]string{}
+	}
+	return ""
+}
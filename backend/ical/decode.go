@@ -0,0 +1,175 @@
+package ical
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Decode parses iCalendar text into its top-level component
+func Decode(r io.Reader) (*Component, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var stack []*Component
+	var root *Component
+	for n, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		prop, err := parseLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n+1, err)
+		}
+		switch prop.Name {
+		case "BEGIN":
+			c := NewComponent(prop.Value)
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.Components = append(parent.Components, c)
+			} else if root == nil {
+				root = c
+			} else {
+				return nil, fmt.Errorf("line %d: more than one top-level component", n+1)
+			}
+			stack = append(stack, c)
+		case "END":
+			if len(stack) == 0 || stack[len(stack)-1].Name != strings.ToUpper(prop.Value) {
+				return nil, fmt.Errorf("line %d: unexpected END:%s", n+1, prop.Value)
+			}
+			stack = stack[:len(stack)-1]
+		default:
+			if len(stack) == 0 {
+				return nil, fmt.Errorf("line %d: property outside of a component", n+1)
+			}
+			c := stack[len(stack)-1]
+			c.Properties = append(c.Properties, prop)
+		}
+	}
+	if root == nil {
+		return nil, fmt.Errorf("no calendar component found")
+	}
+	if len(stack) > 0 {
+		return nil, fmt.Errorf("missing END:%s", stack[len(stack)-1].Name)
+	}
+	return root, nil
+}
+
+// unfold joins folded continuation lines
+func unfold(r io.Reader) ([]string, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	var lines []string
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if len(line) > 0 && (line[0] == ' ' || line[0] == '\t') && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, scanner.Err()
+}
+
+// parseLine splits a content line into name, parameters and value
+func parseLine(line string) (Property, error) {
+	prop := Property{}
+	inQuotes := false
+	nameEnd, valueStart := -1, -1
+	for i, ch := range line {
+		switch {
+		case ch == '"':
+			inQuotes = !inQuotes
+		case !inQuotes && ch == ';' && nameEnd < 0:
+			nameEnd = i
+		case !inQuotes && ch == ':':
+			valueStart = i
+		}
+		if valueStart >= 0 {
+			break
+		}
+	}
+	if valueStart < 0 {
+		return prop, fmt.Errorf("missing ':' in %q", line)
+	}
+	if nameEnd < 0 {
+		nameEnd = valueStart
+	}
+	prop.Name = strings.ToUpper(strings.TrimSpace(line[:nameEnd]))
+	prop.Value = line[valueStart+1:]
+	if prop.Name == "" {
+		return prop, fmt.Errorf("missing property name in %q", line)
+	}
+
+	if nameEnd < valueStart {
+		prop.Params = make(map[string]string)
+		for _, param := range splitParams(line[nameEnd+1 : valueStart]) {
+			key, value, _ := strings.Cut(param, "=")
+			prop.Params[strings.ToUpper(strings.TrimSpace(key))] = strings.Trim(value, `"`)
+		}
+	}
+	return prop, nil
+}
+
+// splitParams splits parameters on semicolons outside of quotes
+func splitParams(s string) []string {
+	var params []string
+	inQuotes := false
+	start := 0
+	for i, ch := range s {
+		switch {
+		case ch == '"':
+			inQuotes = !inQuotes
+		case ch == ';' && !inQuotes:
+			params = append(params, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(params, s[start:])
+}
+
+// UnescapeText reverses EscapeText
+func UnescapeText(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+			switch s[i] {
+			case 'n', 'N':
+				b.WriteByte('\n')
+			default:
+				b.WriteByte(s[i])
+			}
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// Text returns the unescaped value of a TEXT property
+func (p *Property) Text() string {
+	return UnescapeText(p.Value)
+}
+
+// Time parses a DATE or DATE-TIME property. UTC values, values with a TZID
+// parameter and floating values (interpreted in loc) are supported.
+func (p *Property) Time(loc *time.Location) (time.Time, error) {
+	value := strings.TrimSpace(p.Value)
+	if p.Params["VALUE"] == "DATE" || len(value) == 8 {
+		return time.ParseInLocation("20060102", value, loc)
+	}
+	if strings.HasSuffix(value, "Z") {
+		return time.Parse("20060102T150405Z", value)
+	}
+	if tzid := p.Params["TZID"]; tzid != "" {
+		if tz, err := time.LoadLocation(tzid); err == nil {
+			loc = tz
+		}
+	}
+	return time.ParseInLocation("20060102T150405", value, loc)
+}
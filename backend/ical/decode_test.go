@@ -0,0 +1,170 @@
+package ical
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDecodeUnfolding(t *testing.T) {
+	src := "BEGIN:VCALENDAR\r\n" +
+		"BEGIN:VTODO\r\n" +
+		"UID:abc\r\n" +
+		"DESCRIPTION:This description is long enough that the client folded it o\r\n" +
+		" ver two lines\r\n" +
+		"SUMMARY:Folded\r\n" +
+		"\twith a tab\r\n" +
+		"END:VTODO\r\n" +
+		"END:VCALENDAR\r\n"
+	cal, err := Decode(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	todo := cal.Find("VTODO")
+	if todo == nil {
+		t.Fatal("VTODO not found")
+	}
+	want := "This description is long enough that the client folded it over two lines"
+	if got := todo.Get("DESCRIPTION").Text(); got != want {
+		t.Errorf("DESCRIPTION = %q, want %q", got, want)
+	}
+	if got := todo.Get("SUMMARY").Text(); got != "Foldedwith a tab" {
+		t.Errorf("SUMMARY = %q", got)
+	}
+}
+
+func TestDecodeParams(t *testing.T) {
+	src := "BEGIN:VTODO\n" +
+		`X-TEST;X-A="a;b:c";x-b=plain:value:with:colons` + "\n" +
+		"END:VTODO\n"
+	cal, err := Decode(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := cal.Get("X-TEST")
+	if p == nil {
+		t.Fatal("X-TEST not found")
+	}
+	if p.Params["X-A"] != "a;b:c" || p.Params["X-B"] != "plain" || p.Value != "value:with:colons" {
+		t.Errorf("got params %v and value %q", p.Params, p.Value)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	tests := map[string]string{
+		"empty":              "",
+		"missing end":        "BEGIN:VCALENDAR\nBEGIN:VTODO\nEND:VTODO\n",
+		"mismatched end":     "BEGIN:VCALENDAR\nEND:VTODO\n",
+		"property outside":   "SUMMARY:x\nBEGIN:VCALENDAR\nEND:VCALENDAR\n",
+		"missing colon":      "BEGIN:VCALENDAR\nSUMMARY\nEND:VCALENDAR\n",
+		"two top components": "BEGIN:VCALENDAR\nEND:VCALENDAR\nBEGIN:VCALENDAR\nEND:VCALENDAR\n",
+	}
+	for name, src := range tests {
+		if _, err := Decode(strings.NewReader(src)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestUnescapeText(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{`plain`, "plain"},
+		{`a\, b\; c`, "a, b; c"},
+		{`line one\nline two\Nthree`, "line one\nline two\nthree"},
+		{`back\\slash`, `back\slash`},
+		{`trailing\`, `trailing\`},
+		{`\\n`, `\n`},
+	}
+	for _, tt := range tests {
+		if got := UnescapeText(tt.in); got != tt.want {
+			t.Errorf("UnescapeText(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	texts := []string{
+		"Simple",
+		"Commas, semicolons; and \\ backslashes",
+		"Two\nlines\r\nand a CRLF",
+		strings.Repeat("Long line that needs folding. ", 10),
+		strings.Repeat("日本語のテキスト", 20),
+	}
+	due := time.Date(2026, 3, 10, 14, 30, 0, 0, time.UTC)
+	for _, text := range texts {
+		todo := NewComponent("VTODO")
+		todo.AddText("SUMMARY", text)
+		todo.AddTime("DUE", due)
+		cal := NewComponent("VCALENDAR")
+		cal.Components = append(cal.Components, todo)
+
+		var buf bytes.Buffer
+		if err := Encode(&buf, cal); err != nil {
+			t.Fatal(err)
+		}
+		for _, line := range strings.Split(buf.String(), "\r\n") {
+			if len(line) > 75 {
+				t.Errorf("line longer than 75 octets: %q", line)
+			}
+		}
+
+		decoded, err := Decode(&buf)
+		if err != nil {
+			t.Fatalf("%q: %v", text, err)
+		}
+		got := decoded.Find("VTODO")
+		want := strings.ReplaceAll(strings.ReplaceAll(text, "\r\n", "\n"), "\r", "\n")
+		if s := got.Get("SUMMARY").Text(); s != want {
+			t.Errorf("SUMMARY = %q, want %q", s, want)
+		}
+		if d, err := got.Get("DUE").Time(time.UTC); err != nil || !d.Equal(due) {
+			t.Errorf("DUE = %v, %v", d, err)
+		}
+	}
+}
+
+func TestPropertyTime(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("time zone data not available")
+	}
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("time zone data not available")
+	}
+	tests := []struct {
+		name   string
+		params map[string]string
+		value  string
+		want   time.Time
+	}{
+		{"date", map[string]string{"VALUE": "DATE"}, "20260310", time.Date(2026, 3, 10, 0, 0, 0, 0, newYork)},
+		{"date without VALUE", nil, "20260310", time.Date(2026, 3, 10, 0, 0, 0, 0, newYork)},
+		{"utc", nil, "20260310T143000Z", time.Date(2026, 3, 10, 14, 30, 0, 0, time.UTC)},
+		{"tzid", map[string]string{"TZID": "Europe/Berlin"}, "20260310T143000", time.Date(2026, 3, 10, 14, 30, 0, 0, berlin)},
+		{"tzid in summer time", map[string]string{"TZID": "Europe/Berlin"}, "20260710T143000", time.Date(2026, 7, 10, 12, 30, 0, 0, time.UTC)},
+		{"unknown tzid is floating", map[string]string{"TZID": "Custom/Zone"}, "20260310T143000", time.Date(2026, 3, 10, 14, 30, 0, 0, newYork)},
+		{"floating", nil, "20260310T143000", time.Date(2026, 3, 10, 14, 30, 0, 0, newYork)},
+	}
+	for _, tt := range tests {
+		p := Property{Name: "DUE", Params: tt.params, Value: tt.value}
+		got, err := p.Time(newYork)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	for _, value := range []string{"", "2026-03-10", "20260310T1430", "20261310"} {
+		p := Property{Name: "DUE", Value: value}
+		if _, err := p.Time(time.UTC); err == nil {
+			t.Errorf("%q: expected an error", value)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package ical
+
+import (
+	"bufio"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Property is a single content line such as "DTSTART;VALUE=DATE:20240101"
+type Property struct {
+	Name   string
+	Params map[string]string
+	Value  string
+}
+
+// Component is a BEGIN/END block such as VCALENDAR or VTODO
+type Component struct {
+	Name       string
+	Properties []Property
+	Components []*Component
+}
+
+// NewComponent creates an empty component with the given name
+func NewComponent(name string) *Component {
+	return &Component{Name: strings.ToUpper(name)}
+}
+
+// Add appends a property with an already-formatted value
+func (c *Component) Add(name, value string) {
+	c.Properties = append(c.Properties, Property{Name: strings.ToUpper(name), Value: value})
+}
+
+// AddText appends a TEXT property, escaping the value
+func (c *Component) AddText(name, value string) {
+	c.Add(name, EscapeText(value))
+}
+
+// AddTime appends a DATE-TIME property in UTC
+func (c *Component) AddTime(name string, t time.Time) {
+	c.Add(name, FormatDateTime(t))
+}
+
+// Set replaces every property with the given name by a single new value
+func (c *Component) Set(name, value string) {
+	name = strings.ToUpper(name)
+	kept := c.Properties[:0]
+	for _, p := range c.Properties {
+		if p.Name != name {
+			kept = append(kept, p)
+		}
+	}
+	c.Properties = append(kept, Property{Name: name, Value: value})
+}
+
+// Find returns the first child component with the given name, or nil
+func (c *Component) Find(name string) *Component {
+	name = strings.ToUpper(name)
+	for _, child := range c.Components {
+		if child.Name == name {
+			return child
+		}
+	}
+	return nil
+}
+
+// Get returns the first property with the given name, or nil
+func (c *Component) Get(name string) *Property {
+	name = strings.ToUpper(name)
+	for i := range c.Properties {
+		if c.Properties[i].Name == name {
+			return &c.Properties[i]
+		}
+	}
+	return nil
+}
+
+// Encode writes the component as iCalendar text with CRLF line endings,
+// folding lines longer than 75 octets as RFC 5545 requires
+func Encode(w io.Writer, c *Component) error {
+	bw := bufio.NewWriter(w)
+	encodeComponent(bw, c)
+	return bw.Flush()
+}
+
+func encodeComponent(w *bufio.Writer, c *Component) {
+	writeLine(w, "BEGIN:"+c.Name)
+	for _, p := range c.Properties {
+		line := p.Name
+		keys := make([]string, 0, len(p.Params))
+		for k := range p.Params {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			line += ";" + k + "=" + quoteParam(p.Params[k])
+		}
+		writeLine(w, line+":"+p.Value)
+	}
+	for _, child := range c.Components {
+		encodeComponent(w, child)
+	}
+	writeLine(w, "END:"+c.Name)
+}
+
+// writeLine writes one content line, folding it without splitting UTF-8
+// sequences. The space that starts a continuation line counts towards its
+// 75 octets.
+func writeLine(w *bufio.Writer, line string) {
+	limit := 75
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !isRuneStart(line[cut]) {
+			cut--
+		}
+		w.WriteString(line[:cut] + "\r\n ")
+		line = line[cut:]
+		limit = 74
+	}
+	w.WriteString(line + "\r\n")
+}
+
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
+
+func quoteParam(v string) string {
+	if strings.ContainsAny(v, ";:,") {
+		return `"` + strings.ReplaceAll(v, `"`, "") + `"`
+	}
+	return v
+}
+
+// EscapeText escapes a TEXT value
+func EscapeText(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`)
+	return r.Replace(s)
+}
+
+// FormatDateTime formats a time as a UTC DATE-TIME value
+func FormatDateTime(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
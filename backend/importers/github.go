@@ -0,0 +1,89 @@
+package importers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+type githubLabel struct {
+	Name string `json:"name"`
+}
+
+// githubIssue accepts both REST API issue objects and the output of
+// `gh issue list --json number,title,body,state,labels,milestone,url`
+type githubIssue struct {
+	Number        int           `json:"number"`
+	Title         string        `json:"title"`
+	Body          string        `json:"body"`
+	State         string        `json:"state"`
+	Labels        []githubLabel `json:"labels"`
+	RepositoryURL string        `json:"repository_url"`
+	HTMLURL       string        `json:"html_url"`
+	URL           string        `json:"url"`
+	PullRequest   *struct{}     `json:"pull_request"`
+	Milestone     *struct {
+		Title string `json:"title"`
+		DueOn string `json:"due_on"`
+		// gh reports the due date as dueOn
+		DueOnCamel string `json:"dueOn"`
+	} `json:"milestone"`
+}
+
+// parseGitHub reads a JSON array of issues. Closed issues are completed;
+// labels and milestone titles are looked up in the mapping and the
+// milestone due date becomes the task's due date. Pull requests are skipped.
+func parseGitHub(r io.Reader, m Mapping) ([]Item, error) {
+	var issues []githubIssue
+	if err := json.NewDecoder(r).Decode(&issues); err != nil {
+		return nil, fmt.Errorf("invalid GitHub issues JSON: %w", err)
+	}
+
+	var items []Item
+	for i, issue := range issues {
+		if issue.PullRequest != nil {
+			continue
+		}
+		b := newBuilder(m, i+1)
+		if repo := githubRepo(issue); repo != "" && issue.Number != 0 {
+			b.item.ExternalID = "github:" + repo + "#" + strconv.Itoa(issue.Number)
+		}
+		b.item.Title = strings.TrimSpace(issue.Title)
+		b.item.Description = issue.Body
+		if issue.Milestone != nil {
+			b.container(issue.Milestone.Title)
+		}
+		for _, label := range issue.Labels {
+			b.label(label.Name)
+		}
+		if strings.EqualFold(issue.State, "closed") {
+			b.item.Done = true
+		}
+		if issue.Milestone != nil {
+			due := issue.Milestone.DueOn
+			if due == "" {
+				due = issue.Milestone.DueOnCamel
+			}
+			b.due(due)
+		}
+		items = append(items, b.item)
+	}
+	return items, nil
+}
+
+// githubRepo extracts "owner/repo" from whichever URL the export includes
+func githubRepo(issue githubIssue) string {
+	for _, u := range []string{issue.RepositoryURL, issue.HTMLURL, issue.URL} {
+		for _, prefix := range []string{"https://api.github.com/repos/", "https://github.com/"} {
+			if rest, ok := strings.CutPrefix(u, prefix); ok {
+				parts := strings.Split(rest, "/")
+				if len(parts) >= 2 {
+					return parts[0] + "/" + parts[1]
+				}
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,181 @@
+// Package importers reads task exports from other tools (Todoist, Trello and
+// GitHub Issues) and maps them onto this application's task fields. Parsing
+// works entirely on the uploaded file; nothing is fetched from the source
+// service.
+package importers
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Item is one task read from an export file
+type Item struct {
+	Line        int // position of the item in the file, starting at 1
+	ExternalID  string
+	Title       string
+	Description string
+	Status      string // the status the mapping names, or empty
+	Started     bool   // the item sits in a list for work in progress
+	Done        bool   // the source marks the item finished
+	Priority    string // low, medium, high or empty when the source has none
+	Category    string // empty when nothing in the mapping matched
+	Tags        []string
+	DueDate     *time.Time
+	Err         string // set when the item couldn't be read
+}
+
+// Mapping says how source lists, columns, sections and labels translate to
+// task fields. Keys are matched case-insensitively. Values must be valid
+// statuses, priorities and categories; the caller validates them, as
+// statuses depend on the workflow of the item's category.
+type Mapping struct {
+	Status   map[string]string `json:"status"`
+	Priority map[string]string `json:"priority"`
+	Category map[string]string `json:"category"`
+}
+
+// Sources lists the supported export formats
+var Sources = []string{"todoist", "trello", "github"}
+
+// Parse reads an export of the given source. Todoist exports may be CSV or JSON;
+// the format is detected from the content.
+func Parse(source string, r io.Reader, m Mapping) ([]Item, error) {
+	m = m.normalized()
+	switch source {
+	case "todoist":
+		return parseTodoist(r, m)
+	case "trello":
+		return parseTrello(r, m)
+	case "github":
+		return parseGitHub(r, m)
+	}
+	return nil, fmt.Errorf("unknown import source %q", source)
+}
+
+// normalized returns a copy of the mapping with lowercased keys
+func (m Mapping) normalized() Mapping {
+	lower := func(in map[string]string) map[string]string {
+		out := make(map[string]string, len(in))
+		for k, v := range in {
+			out[normalizeName(k)] = v
+		}
+		return out
+	}
+	return Mapping{Status: lower(m.Status), Priority: lower(m.Priority), Category: lower(m.Category)}
+}
+
+func normalizeName(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// defaultStages recognizes common list names when the mapping has no entry.
+// They mark items as started or done rather than naming a status, which the
+// caller picks from the workflow; to do lists keep the initial status.
+var defaultStages = map[string]string{
+	"to do":       "",
+	"todo":        "",
+	"backlog":     "",
+	"doing":       "started",
+	"in progress": "started",
+	"in-progress": "started",
+	"wip":         "started",
+	"done":        "done",
+	"complete":    "done",
+	"completed":   "done",
+}
+
+// defaultPriorities recognizes common priority labels when the mapping has no entry
+var defaultPriorities = map[string]string{
+	"p0":               "high",
+	"p1":               "high",
+	"p2":               "medium",
+	"p3":               "low",
+	"urgent":           "high",
+	"critical":         "high",
+	"high":             "high",
+	"high priority":    "high",
+	"priority: high":   "high",
+	"priority: medium": "medium",
+	"medium":           "medium",
+	"low":              "low",
+	"low priority":     "low",
+	"priority: low":    "low",
+}
+
+// builder accumulates the fields of one item while the source's names are mapped
+type builder struct {
+	m    Mapping
+	item Item
+}
+
+func newBuilder(m Mapping, line int) *builder {
+	return &builder{m: m, item: Item{Line: line}}
+}
+
+// container maps the list, column, section or project the item lives in.
+// It may set the status and category but never becomes a tag.
+func (b *builder) container(name string) {
+	key := normalizeName(name)
+	if key == "" {
+		return
+	}
+	if status, ok := b.m.Status[key]; ok {
+		b.setStatus(status)
+	} else if stage, ok := defaultStages[key]; ok {
+		b.item.Status, b.item.Started, b.item.Done = "", stage == "started", stage == "done"
+	}
+	if category, ok := b.m.Category[key]; ok && b.item.Category == "" {
+		b.item.Category = category
+	}
+}
+
+// setStatus applies a status named by the mapping, which replaces what
+// earlier list names said about the item's progress
+func (b *builder) setStatus(status string) {
+	b.item.Status, b.item.Started, b.item.Done = status, false, false
+}
+
+// label maps a label. Labels that set the status, priority or category are
+// consumed; the rest are kept as tags.
+func (b *builder) label(name string) {
+	key := normalizeName(name)
+	if key == "" {
+		return
+	}
+	if status, ok := b.m.Status[key]; ok {
+		b.setStatus(status)
+		return
+	}
+	if priority, ok := b.m.Priority[key]; ok {
+		b.item.Priority = priority
+		return
+	}
+	if category, ok := b.m.Category[key]; ok {
+		b.item.Category = category
+		return
+	}
+	if priority, ok := defaultPriorities[key]; ok {
+		b.item.Priority = priority
+		return
+	}
+	// Commas separate tags everywhere else, so they can't appear inside one
+	b.item.Tags = append(b.item.Tags, strings.TrimSpace(strings.ReplaceAll(name, ",", " ")))
+}
+
+// due parses a due date in any of the formats the sources use
+func (b *builder) due(value string) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			b.item.DueDate = &t
+			return
+		}
+	}
+	b.item.Err = "Invalid due date: " + value
+}
@@ -0,0 +1,99 @@
+package importers
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func date(year int, month time.Month, day, hour int) *time.Time {
+	t := time.Date(year, month, day, hour, 0, 0, 0, time.UTC)
+	return &t
+}
+
+func TestParseFixtures(t *testing.T) {
+	tests := []struct {
+		source  string
+		file    string
+		mapping Mapping
+		want    []Item
+	}{
+		{"todoist", "todoist.json", Mapping{Category: map[string]string{"Work": "Work", "Home": "Personal"}}, []Item{
+			{Line: 1, ExternalID: "todoist:6X7rM8997g3RQmvh", Title: "Write quarterly report", Description: "Numbers from finance",
+				Started: true, Priority: "high", Category: "Work", Tags: []string{"Q1"}, DueDate: date(2026, 3, 31, 0)},
+			{Line: 2, ExternalID: "todoist:2995104339", Title: "Fix the sink",
+				Done: true, Priority: "high", Category: "Personal", Tags: []string{"plumbing"}, DueDate: date(2026, 3, 5, 18)},
+			{Line: 4, ExternalID: "todoist:6X7rfEVP8hvv25ZQ", Title: "Water the plants", Description: "Due: someday", Priority: "low"},
+		}},
+		{"todoist", "todoist.csv", Mapping{Category: map[string]string{"work": "Work"}}, []Item{
+			{Line: 2, Title: "Draft slides", Description: "Outline first\n\nAsk Sam for the template",
+				Started: true, Priority: "high", Category: "Work", Tags: []string{"slides"}, DueDate: date(2026, 3, 12, 0)},
+			{Line: 6, Title: "Read a book", Description: "Due: every day"},
+		}},
+		{"trello", "trello.json", Mapping{Status: map[string]string{"Waiting": "pending"}, Category: map[string]string{"Website": "Work"}}, []Item{
+			{Line: 1, ExternalID: "trello:5f1a", Title: "Fix login", Description: "Users get logged out",
+				Started: true, Priority: "high", Category: "Work", Tags: []string{"Bug"}, DueDate: date(2026, 3, 20, 12)},
+			{Line: 2, ExternalID: "trello:5f1b", Title: "Ship newsletter", Description: "**Steps**\n\n- [x] Write\n- [ ] Send",
+				Done: true, Category: "Work", Tags: []string{"green"}},
+			{Line: 5, ExternalID: "trello:5f1e", Title: "Bad date", Category: "Work", Err: "Invalid due date: next week"},
+			{Line: 6, ExternalID: "trello:5f1f", Title: "Renew domain", Status: "pending", Category: "Work"},
+		}},
+		{"github", "github.json", Mapping{Category: map[string]string{"v1.2": "Work"}}, []Item{
+			{Line: 1, ExternalID: "github:acme/app#12", Title: "Crash on start", Description: "Stack trace attached",
+				Priority: "high", Category: "Work", Tags: []string{"bug"}, DueDate: date(2026, 4, 1, 7)},
+			{Line: 3, ExternalID: "github:acme/app#14", Title: "Document the API", Done: true, Tags: []string{"docs"}},
+			{Line: 4, ExternalID: "github:acme/app#15", Title: "Migrate the database", Err: "Invalid due date: soon"},
+		}},
+		{"github", "github_gh.json", Mapping{}, []Item{
+			{Line: 1, ExternalID: "github:acme/app#3", Title: "Add dark mode", Tags: []string{"enhancement"}, DueDate: date(2026, 6, 30, 0)},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			f, err := os.Open(filepath.Join("testdata", tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			items, err := Parse(tt.source, f, tt.mapping)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(items) != len(tt.want) {
+				t.Fatalf("got %d items, want %d: %+v", len(items), len(tt.want), items)
+			}
+			for i, got := range items {
+				want := tt.want[i]
+				if (got.DueDate == nil) != (want.DueDate == nil) || (got.DueDate != nil && !got.DueDate.Equal(*want.DueDate)) {
+					t.Errorf("item %d: due %v, want %v", i, got.DueDate, want.DueDate)
+				}
+				got.DueDate, want.DueDate = nil, nil
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("item %d:\n got %+v\nwant %+v", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := []struct {
+		source string
+		data   string
+	}{
+		{"todoist", `{"items": [`},
+		{"todoist", "TITLE,DATE\nSomething,2026-01-01\n"},
+		{"trello", `[]`},
+		{"github", `{"number": 1}`},
+		{"asana", `[]`},
+	}
+	for _, tt := range tests {
+		if _, err := Parse(tt.source, strings.NewReader(tt.data), Mapping{}); err == nil {
+			t.Errorf("%s %q: expected an error", tt.source, tt.data)
+		}
+	}
+}
@@ -0,0 +1,263 @@
+package importers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// flexID accepts identifiers encoded either as JSON strings or numbers
+type flexID string
+
+func (id *flexID) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*id = flexID(s)
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return fmt.Errorf("invalid id %s", data)
+	}
+	*id = flexID(n.String())
+	return nil
+}
+
+type todoistDue struct {
+	Date   string `json:"date"`
+	String string `json:"string"`
+}
+
+type todoistTask struct {
+	ID          flexID      `json:"id"`
+	Content     string      `json:"content"`
+	Description string      `json:"description"`
+	Priority    int         `json:"priority"`
+	Due         *todoistDue `json:"due"`
+	Labels      []string    `json:"labels"`
+	ProjectID   flexID      `json:"project_id"`
+	SectionID   flexID      `json:"section_id"`
+	Checked     bool        `json:"checked"`
+	IsCompleted bool        `json:"is_completed"`
+	IsDeleted   bool        `json:"is_deleted"`
+}
+
+type todoistNamed struct {
+	ID   flexID `json:"id"`
+	Name string `json:"name"`
+}
+
+// todoistBackup is the shape of a full Todoist sync backup
+type todoistBackup struct {
+	Items    []todoistTask  `json:"items"`
+	Projects []todoistNamed `json:"projects"`
+	Sections []todoistNamed `json:"sections"`
+}
+
+// todoistLabelPattern finds inline @labels in CSV task content
+var todoistLabelPattern = regexp.MustCompile(`(^|\s)@([\p{L}\p{N}_-]+)`)
+
+// parseTodoist reads either a JSON backup (a sync backup object or an array of
+// tasks from the REST API) or a CSV project template export
+func parseTodoist(r io.Reader, m Mapping) ([]Item, error) {
+	br := bufio.NewReader(r)
+	first, err := peekNonSpace(br)
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if first == '{' || first == '[' {
+		return parseTodoistJSON(br, m)
+	}
+	return parseTodoistCSV(br, m)
+}
+
+func parseTodoistJSON(r io.Reader, m Mapping) ([]Item, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var backup todoistBackup
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		err = json.Unmarshal(data, &backup.Items)
+	} else {
+		err = json.Unmarshal(data, &backup)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid Todoist JSON: %w", err)
+	}
+
+	projects := make(map[flexID]string)
+	for _, p := range backup.Projects {
+		projects[p.ID] = p.Name
+	}
+	sections := make(map[flexID]string)
+	for _, s := range backup.Sections {
+		sections[s.ID] = s.Name
+	}
+
+	var items []Item
+	for i, t := range backup.Items {
+		if t.IsDeleted {
+			continue
+		}
+		b := newBuilder(m, i+1)
+		if t.ID != "" {
+			b.item.ExternalID = "todoist:" + string(t.ID)
+		}
+		b.item.Title = strings.TrimSpace(t.Content)
+		b.item.Description = t.Description
+		b.item.Priority = todoistAPIPriority(t.Priority)
+		b.container(projects[t.ProjectID])
+		b.container(sections[t.SectionID])
+		for _, label := range t.Labels {
+			b.label(label)
+		}
+		if t.Checked || t.IsCompleted {
+			b.item.Done = true
+		}
+		if t.Due != nil {
+			b.todoistDue(t.Due.Date, t.Due.String)
+		}
+		items = append(items, b.item)
+	}
+	return items, nil
+}
+
+// parseTodoistCSV reads a project template export. Rows of TYPE section
+// apply to the tasks that follow them and notes are appended to the
+// description of the preceding task.
+func parseTodoistCSV(r io.Reader, m Mapping) ([]Item, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToUpper(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["CONTENT"]; !ok {
+		return nil, fmt.Errorf("missing CONTENT column; is this a Todoist CSV export?")
+	}
+
+	var items []Item
+	section := ""
+	for line := 1; ; line++ {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return items, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		get := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		switch strings.ToLower(get("TYPE")) {
+		case "section":
+			section = get("CONTENT")
+		case "note":
+			if len(items) > 0 && get("CONTENT") != "" {
+				last := &items[len(items)-1]
+				last.Description = strings.TrimSpace(last.Description + "\n\n" + get("CONTENT"))
+			}
+		case "task", "":
+			content := get("CONTENT")
+			if content == "" {
+				continue
+			}
+			b := newBuilder(m, line)
+			b.item.Priority = todoistCSVPriority(get("PRIORITY"))
+			b.container(section)
+			for _, match := range todoistLabelPattern.FindAllStringSubmatch(content, -1) {
+				b.label(match[2])
+			}
+			b.item.Title = strings.TrimSpace(todoistLabelPattern.ReplaceAllString(content, "$1"))
+			b.item.Description = get("DESCRIPTION")
+			b.todoistDue(get("DATE"), get("DATE"))
+			items = append(items, b.item)
+		}
+	}
+}
+
+// todoistDue sets the due date. Recurring or natural-language dates that
+// can't be resolved offline are kept in the description instead.
+func (b *builder) todoistDue(date, text string) {
+	if date == "" {
+		return
+	}
+	b.due(date)
+	if b.item.Err != "" {
+		b.item.Err = ""
+		b.item.DueDate = nil
+		b.item.Description = strings.TrimSpace(b.item.Description + "\n\nDue: " + text)
+	}
+}
+
+// todoistAPIPriority maps API priorities, where 4 is the most urgent (p1)
+func todoistAPIPriority(p int) string {
+	switch p {
+	case 4:
+		return "high"
+	case 3:
+		return "medium"
+	case 2:
+		return "low"
+	}
+	return ""
+}
+
+// todoistCSVPriority maps CSV priorities, where 1 is the most urgent (p1)
+func todoistCSVPriority(p string) string {
+	switch p {
+	case "1":
+		return "high"
+	case "2":
+		return "medium"
+	case "3":
+		return "low"
+	}
+	return ""
+}
+
+// peekNonSpace returns the first non-whitespace byte without consuming it
+func peekNonSpace(br *bufio.Reader) (byte, error) {
+	for {
+		b, err := br.Peek(1)
+		if err != nil {
+			return 0, err
+		}
+		switch b[0] {
+		case ' ', '\t', '\r', '\n':
+			br.ReadByte()
+		case 0xEF:
+			// Skip a UTF-8 byte order mark
+			if bom, _ := br.Peek(3); bytes.Equal(bom, []byte{0xEF, 0xBB, 0xBF}) {
+				br.Discard(3)
+				continue
+			}
+			return b[0], nil
+		default:
+			return b[0], nil
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package importers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+type trelloLabel struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Color string `json:"color"`
+}
+
+type trelloCard struct {
+	ID          string        `json:"id"`
+	Name        string        `json:"name"`
+	Desc        string        `json:"desc"`
+	IDList      string        `json:"idList"`
+	IDLabels    []string      `json:"idLabels"`
+	Labels      []trelloLabel `json:"labels"`
+	Due         string        `json:"due"`
+	DueComplete bool          `json:"dueComplete"`
+	Closed      bool          `json:"closed"`
+}
+
+type trelloChecklist struct {
+	IDCard     string `json:"idCard"`
+	Name       string `json:"name"`
+	CheckItems []struct {
+		Name  string `json:"name"`
+		State string `json:"state"`
+	} `json:"checkItems"`
+}
+
+// trelloBoard is the shape of a board exported with "Print and export > JSON"
+type trelloBoard struct {
+	Name  string `json:"name"`
+	Lists []struct {
+		ID     string `json:"id"`
+		Name   string `json:"name"`
+		Closed bool   `json:"closed"`
+	} `json:"lists"`
+	Labels     []trelloLabel     `json:"labels"`
+	Cards      []trelloCard      `json:"cards"`
+	Checklists []trelloChecklist `json:"checklists"`
+}
+
+// parseTrello reads a board JSON export. The board name and each card's list
+// are looked up in the mapping; labels become tags unless mapped. Archived
+// cards and cards on archived lists are left out.
+func parseTrello(r io.Reader, m Mapping) ([]Item, error) {
+	var board trelloBoard
+	if err := json.NewDecoder(r).Decode(&board); err != nil {
+		return nil, fmt.Errorf("invalid Trello board JSON: %w", err)
+	}
+
+	lists := make(map[string]string)
+	closedLists := make(map[string]bool)
+	for _, l := range board.Lists {
+		lists[l.ID] = l.Name
+		closedLists[l.ID] = l.Closed
+	}
+	labels := make(map[string]trelloLabel)
+	for _, l := range board.Labels {
+		labels[l.ID] = l
+	}
+	checklists := make(map[string][]trelloChecklist)
+	for _, c := range board.Checklists {
+		checklists[c.IDCard] = append(checklists[c.IDCard], c)
+	}
+
+	var items []Item
+	for i, card := range board.Cards {
+		if card.Closed || closedLists[card.IDList] {
+			continue
+		}
+		b := newBuilder(m, i+1)
+		if card.ID != "" {
+			b.item.ExternalID = "trello:" + card.ID
+		}
+		b.item.Title = strings.TrimSpace(card.Name)
+		b.item.Description = strings.TrimSpace(card.Desc + trelloChecklistText(checklists[card.ID]))
+		b.container(board.Name)
+		b.container(lists[card.IDList])
+
+		cardLabels := card.Labels
+		if len(cardLabels) == 0 {
+			for _, id := range card.IDLabels {
+				cardLabels = append(cardLabels, labels[id])
+			}
+		}
+		for _, label := range cardLabels {
+			// Unnamed labels are identified only by their color
+			name := label.Name
+			if name == "" {
+				name = label.Color
+			}
+			b.label(name)
+		}
+
+		if card.DueComplete {
+			b.item.Done = true
+		}
+		b.due(card.Due)
+		items = append(items, b.item)
+	}
+	return items, nil
+}
+
+// trelloChecklistText renders a card's checklists as markdown to append to its description
+func trelloChecklistText(checklists []trelloChecklist) string {
+	var sb strings.Builder
+	for _, c := range checklists {
+		sb.WriteString("\n\n**" + c.Name + "**\n")
+		for _, item := range c.CheckItems {
+			mark := " "
+			if item.State == "complete" {
+				mark = "x"
+			}
+			sb.WriteString("\n- [" + mark + "] " + item.Name)
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,221 @@
+// Package inbound parses raw RFC 5322 email messages forwarded to the
+// application so they can be turned into tasks.
+package inbound
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"regexp"
+	"strings"
+)
+
+// maxParts bounds how many MIME parts are read from one message
+const maxParts = 100
+
+// Message is the part of an email needed to create a task
+type Message struct {
+	MessageID   string
+	From        string
+	Recipients  []string // addresses from the To, Cc and Delivered-To headers, lowercased
+	Subject     string
+	Text        string
+	Attachments []Attachment
+}
+
+// Attachment is a file attached to a message
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+var wordDecoder = &mime.WordDecoder{
+	// Only UTF-8 and ASCII are decoded; other charsets are passed through undecoded
+	CharsetReader: func(charset string, input io.Reader) (io.Reader, error) {
+		switch strings.ToLower(charset) {
+		case "utf-8", "us-ascii":
+			return input, nil
+		}
+		return nil, fmt.Errorf("unsupported charset %q", charset)
+	},
+}
+
+// Parse reads a raw message. The body is the first text/plain part, or the
+// first text/html part with its markup removed when there is no plain text.
+// Any other part with a filename is returned as an attachment.
+func Parse(r io.Reader) (*Message, error) {
+	raw, err := mail.ReadMessage(r)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := &Message{
+		MessageID: strings.Trim(strings.TrimSpace(raw.Header.Get("Message-Id")), "<>"),
+		Subject:   decodeHeader(raw.Header.Get("Subject")),
+	}
+	if from, err := mail.ParseAddress(decodeHeader(raw.Header.Get("From"))); err == nil {
+		msg.From = from.Address
+	}
+	for _, name := range []string{"To", "Cc", "Delivered-To", "X-Original-To"} {
+		for _, value := range raw.Header[name] {
+			addresses, err := mail.ParseAddressList(value)
+			if err != nil {
+				continue
+			}
+			for _, a := range addresses {
+				msg.Recipients = append(msg.Recipients, strings.ToLower(a.Address))
+			}
+		}
+	}
+
+	var plain, htmlText string
+	parts := 0
+	err = walkPart(partHeader(raw.Header), raw.Body, &parts, func(header partHeader, data []byte) {
+		mediaType, params, _ := mime.ParseMediaType(header.get("Content-Type"))
+		if mediaType == "" {
+			mediaType = "text/plain"
+		}
+		disposition, dispParams, _ := mime.ParseMediaType(header.get("Content-Disposition"))
+		filename := decodeHeader(dispParams["filename"])
+		if filename == "" {
+			filename = decodeHeader(params["name"])
+		}
+
+		switch {
+		case filename != "" || disposition == "attachment":
+			if filename == "" {
+				filename = "attachment"
+			}
+			msg.Attachments = append(msg.Attachments, Attachment{Filename: filename, ContentType: mediaType, Data: data})
+		case mediaType == "text/plain" && plain == "":
+			plain = string(data)
+		case mediaType == "text/html" && htmlText == "":
+			htmlText = stripHTML(string(data))
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	msg.Text = plain
+	if strings.TrimSpace(msg.Text) == "" {
+		msg.Text = htmlText
+	}
+	msg.Text = strings.TrimSpace(strings.ReplaceAll(msg.Text, "\r\n", "\n"))
+	return msg, nil
+}
+
+// partHeader gives case-insensitive access to MIME part headers
+type partHeader map[string][]string
+
+func (h partHeader) get(name string) string {
+	for k, v := range h {
+		if strings.EqualFold(k, name) && len(v) > 0 {
+			return v[0]
+		}
+	}
+	return ""
+}
+
+// walkPart calls leaf with every non-multipart part, decoded from its transfer encoding
+func walkPart(header partHeader, body io.Reader, parts *int, leaf func(partHeader, []byte)) error {
+	*parts++
+	if *parts > maxParts {
+		return errors.New("message has too many parts")
+	}
+
+	mediaType, params, _ := mime.ParseMediaType(header.get("Content-Type"))
+	if strings.HasPrefix(mediaType, "multipart/") {
+		if params["boundary"] == "" {
+			return errors.New("multipart message without boundary")
+		}
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := mr.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			err = walkPart(partHeader(part.Header), part, parts, leaf)
+			part.Close()
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	var reader io.Reader = body
+	switch strings.ToLower(strings.TrimSpace(header.get("Content-Transfer-Encoding"))) {
+	case "base64":
+		reader = base64.NewDecoder(base64.StdEncoding, &newlineStripper{r: body})
+	case "quoted-printable":
+		reader = quotedprintable.NewReader(body)
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return fmt.Errorf("failed to decode message part: %w", err)
+	}
+	leaf(header, data)
+	return nil
+}
+
+// newlineStripper drops line breaks so base64 bodies can be decoded in one stream
+type newlineStripper struct {
+	r io.Reader
+}
+
+func (n *newlineStripper) Read(p []byte) (int, error) {
+	for {
+		count, err := n.r.Read(p)
+		kept := 0
+		for _, b := range p[:count] {
+			if b != '\r' && b != '\n' && b != ' ' && b != '\t' {
+				p[kept] = b
+				kept++
+			}
+		}
+		if kept > 0 || err != nil {
+			return kept, err
+		}
+	}
+}
+
+// decodeHeader decodes RFC 2047 encoded words, leaving the value as is if it can't
+func decodeHeader(value string) string {
+	decoded, err := wordDecoder.DecodeHeader(value)
+	if err != nil {
+		return value
+	}
+	return decoded
+}
+
+var (
+	htmlDropPattern  = regexp.MustCompile(`(?is)<(script|style|head)\b.*?</(script|style|head)>`)
+	htmlBreakPattern = regexp.MustCompile(`(?i)<(br|/p|/div|/li|/tr|/h[1-6])\b[^>]*>`)
+	htmlTagPattern   = regexp.MustCompile(`<[^>]*>`)
+	blankLines       = regexp.MustCompile(`\n{3,}`)
+)
+
+// stripHTML reduces an HTML body to plain text
+func stripHTML(s string) string {
+	s = htmlDropPattern.ReplaceAllString(s, "")
+	s = htmlBreakPattern.ReplaceAllString(s, "\n")
+	s = htmlTagPattern.ReplaceAllString(s, "")
+	s = html.UnescapeString(s)
+	var b bytes.Buffer
+	for _, line := range strings.Split(s, "\n") {
+		b.WriteString(strings.TrimSpace(line))
+		b.WriteByte('\n')
+	}
+	return blankLines.ReplaceAllString(b.String(), "\n\n")
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
 	"os"
@@ -10,6 +11,8 @@ import (
 	"github.com/rs/cors"
 	"task-manager/database"
 	"task-manager/handlers"
+	"task-manager/storage"
+	"task-manager/webhooks"
 	"github.com/joho/godotenv"
 )
 
@@ -31,11 +34,43 @@ func main() {
 		log.Fatal(err)
 	}
 
+	// Initialize attachment storage
+	blobStore, err := storage.NewFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Deliver queued webhooks in the background
+	go webhooks.NewDispatcher(db).Run(context.Background())
+
 	// Initialize handlers
 	taskHandler := handlers.NewTaskHandler(db)
+	commentHandler := handlers.NewCommentHandler(db)
+	attachmentHandler := handlers.NewAttachmentHandler(db, blobStore)
+	tagHandler := handlers.NewTagHandler(db)
+	calendarHandler := handlers.NewCalendarHandler(db)
+	caldavHandler := handlers.NewCalDAVHandler(db)
+	webhookHandler := handlers.NewWebhookHandler(db)
+	inboundHandler := handlers.NewInboundHandler(db, blobStore)
+	profileHandler := handlers.NewProfileHandler(db)
+	accountHandler := handlers.NewAccountHandler(db, blobStore)
+	statsHandler := handlers.NewStatsHandler(db)
+	workflowHandler := handlers.NewWorkflowHandler(db)
+	customFieldHandler := handlers.NewCustomFieldHandler(db)
+	timeEntryHandler := handlers.NewTimeEntryHandler(db)
+	viewHandler := handlers.NewViewHandler(db)
+	templateHandler := handlers.NewTemplateHandler(db)
+
+	// Purge deleted accounts once their grace period is over
+	go accountHandler.RunPurge(context.Background())
+
+	// Idempotency-Key support for POST requests; expired keys are purged in the background
+	idempotency := handlers.NewIdempotency(db)
+	go idempotency.RunPurge(context.Background())
 
 	// Initialize router
 	router := mux.NewRouter()
+	authMiddleware := handlers.AuthMiddleware(db)
 
 	// Add middleware
 	router.Use(loggingMiddleware)
@@ -43,14 +78,168 @@ func main() {
 	// Auth routes
 	router.HandleFunc("/api/register", handlers.RegisterHandler(db)).Methods("POST")
 	router.HandleFunc("/api/login", handlers.LoginHandler(db)).Methods("POST")
+	router.HandleFunc("/api/account/restore", accountHandler.RestoreAccount).Methods("POST")
+
+	// Profile and account routes
+	meRouter := router.PathPrefix("/api/me").Subrouter()
+	meRouter.Use(authMiddleware)
+	meRouter.Use(idempotency.Middleware)
+	meRouter.HandleFunc("/profile", profileHandler.GetProfile).Methods("GET")
+	meRouter.HandleFunc("/profile", profileHandler.UpdateProfile).Methods("PUT")
+	meRouter.HandleFunc("/export", accountHandler.ExportData).Methods("GET")
+	meRouter.HandleFunc("", accountHandler.DeleteAccount).Methods("DELETE")
 
 	// Protected task routes
 	taskRouter := router.PathPrefix("/api/tasks").Subrouter()
-	taskRouter.Use(handlers.AuthMiddleware)
+	taskRouter.Use(authMiddleware)
+	taskRouter.Use(idempotency.Middleware)
 	taskRouter.HandleFunc("", taskHandler.GetTasks).Methods("GET")
 	taskRouter.HandleFunc("", taskHandler.CreateTask).Methods("POST")
+	taskRouter.HandleFunc("/bulk", taskHandler.BulkTasks).Methods("POST")
+	taskRouter.HandleFunc("/quick", taskHandler.QuickAdd).Methods("POST")
+	taskRouter.HandleFunc("/at-risk", taskHandler.GetAtRiskTasks).Methods("GET")
+	taskRouter.HandleFunc("/export", taskHandler.ExportTasks).Methods("GET")
+	taskRouter.HandleFunc("/import", taskHandler.ImportTasks).Methods("POST")
+	taskRouter.HandleFunc("/import/{source}", taskHandler.ImportFromSource).Methods("POST")
+	taskRouter.HandleFunc("/{id}", taskHandler.GetTask).Methods("GET")
 	taskRouter.HandleFunc("/{id}", taskHandler.UpdateTask).Methods("PUT")
+	taskRouter.HandleFunc("/{id}", taskHandler.PatchTask).Methods("PATCH")
 	taskRouter.HandleFunc("/{id}", taskHandler.DeleteTask).Methods("DELETE")
+	taskRouter.HandleFunc("/{id}/restore", taskHandler.RestoreTask).Methods("POST")
+	taskRouter.HandleFunc("/{id}/move", taskHandler.MoveTask).Methods("POST")
+	taskRouter.HandleFunc("/{id}/history", taskHandler.GetTaskHistory).Methods("GET")
+
+	// Task comment routes
+	taskRouter.HandleFunc("/{id}/comments", commentHandler.GetComments).Methods("GET")
+	taskRouter.HandleFunc("/{id}/comments", commentHandler.CreateComment).Methods("POST")
+	taskRouter.HandleFunc("/{id}/comments/{commentId}", commentHandler.UpdateComment).Methods("PUT")
+	taskRouter.HandleFunc("/{id}/comments/{commentId}", commentHandler.DeleteComment).Methods("DELETE")
+	taskRouter.HandleFunc("/{id}/comments/{commentId}/history", commentHandler.GetCommentHistory).Methods("GET")
+
+	// Task attachment routes
+	taskRouter.HandleFunc("/{id}/attachments", attachmentHandler.GetAttachments).Methods("GET")
+	taskRouter.HandleFunc("/{id}/attachments", attachmentHandler.UploadAttachment).Methods("POST")
+	taskRouter.HandleFunc("/{id}/attachments/{attachmentId}", attachmentHandler.DownloadAttachment).Methods("GET")
+	taskRouter.HandleFunc("/{id}/attachments/{attachmentId}", attachmentHandler.DeleteAttachment).Methods("DELETE")
+
+	// Task tag routes
+	taskRouter.HandleFunc("/{id}/tags", tagHandler.AttachTags).Methods("POST")
+	taskRouter.HandleFunc("/{id}/tags/{tagId}", tagHandler.DetachTag).Methods("DELETE")
+
+	// Time tracking routes
+	taskRouter.HandleFunc("/{id}/time-entries", timeEntryHandler.GetTaskTimeEntries).Methods("GET")
+	taskRouter.HandleFunc("/{id}/time-entries", timeEntryHandler.CreateTimeEntry).Methods("POST")
+	taskRouter.HandleFunc("/{id}/timer/start", timeEntryHandler.StartTimer).Methods("POST")
+	taskRouter.HandleFunc("/{id}/timer/stop", timeEntryHandler.StopTimer).Methods("POST")
+
+	// Tag routes
+	tagRouter := router.PathPrefix("/api/tags").Subrouter()
+	tagRouter.Use(authMiddleware)
+	tagRouter.Use(idempotency.Middleware)
+	tagRouter.HandleFunc("", tagHandler.GetTags).Methods("GET")
+	tagRouter.HandleFunc("", tagHandler.CreateTag).Methods("POST")
+	tagRouter.HandleFunc("/{id}", tagHandler.UpdateTag).Methods("PUT")
+	tagRouter.HandleFunc("/{id}", tagHandler.DeleteTag).Methods("DELETE")
+	tagRouter.HandleFunc("/{id}/merge", tagHandler.MergeTag).Methods("POST")
+
+	// Calendar feed routes; the feed itself is authorized by the secret in its URL
+	router.HandleFunc("/api/calendar/{token:[A-Za-z0-9_-]+}.ics", calendarHandler.Feed).Methods("GET")
+	calendarRouter := router.PathPrefix("/api/calendar").Subrouter()
+	calendarRouter.Use(authMiddleware)
+	calendarRouter.Use(idempotency.Middleware)
+	calendarRouter.HandleFunc("/feed", calendarHandler.GetFeedURL).Methods("GET")
+	calendarRouter.HandleFunc("/feed/rotate", calendarHandler.RotateFeedURL).Methods("POST")
+
+	// CalDAV routes; the handler does its own authentication and method routing
+	router.HandleFunc("/.well-known/caldav", caldavHandler.WellKnown)
+	router.Handle("/caldav", caldavHandler)
+	router.PathPrefix("/caldav/").Handler(caldavHandler)
+
+	// Webhook routes
+	webhookRouter := router.PathPrefix("/api/webhooks").Subrouter()
+	webhookRouter.Use(authMiddleware)
+	webhookRouter.Use(idempotency.Middleware)
+	webhookRouter.HandleFunc("", webhookHandler.GetWebhooks).Methods("GET")
+	webhookRouter.HandleFunc("", webhookHandler.CreateWebhook).Methods("POST")
+	webhookRouter.HandleFunc("/{id}", webhookHandler.UpdateWebhook).Methods("PUT")
+	webhookRouter.HandleFunc("/{id}", webhookHandler.DeleteWebhook).Methods("DELETE")
+	webhookRouter.HandleFunc("/{id}/rotate-secret", webhookHandler.RotateWebhookSecret).Methods("POST")
+	webhookRouter.HandleFunc("/{id}/deliveries", webhookHandler.GetDeliveries).Methods("GET")
+	webhookRouter.HandleFunc("/{id}/deliveries/{deliveryId}/redeliver", webhookHandler.Redeliver).Methods("POST")
+
+	// Inbound email routes; messages are routed to users by their secret address
+	if inboundHandler.Enabled() {
+		router.HandleFunc("/api/inbound/email", inboundHandler.Email).Methods("POST")
+	} else {
+		log.Println("Inbound email is disabled; set INBOUND_EMAIL_DOMAIN and INBOUND_WEBHOOK_SECRET to enable it")
+	}
+	inboundRouter := router.PathPrefix("/api/inbound").Subrouter()
+	inboundRouter.Use(authMiddleware)
+	inboundRouter.Use(idempotency.Middleware)
+	inboundRouter.HandleFunc("/address", inboundHandler.GetAddress).Methods("GET")
+	inboundRouter.HandleFunc("/address/rotate", inboundHandler.RotateAddress).Methods("POST")
+
+	// Statistics routes
+	statsRouter := router.PathPrefix("/api/stats").Subrouter()
+	statsRouter.Use(authMiddleware)
+	statsRouter.Use(idempotency.Middleware)
+	statsRouter.HandleFunc("", statsHandler.GetStats).Methods("GET")
+
+	// Workflow routes; {category} is a category name or "default"
+	workflowRouter := router.PathPrefix("/api/workflows").Subrouter()
+	workflowRouter.Use(authMiddleware)
+	workflowRouter.Use(idempotency.Middleware)
+	workflowRouter.HandleFunc("", workflowHandler.GetWorkflows).Methods("GET")
+	workflowRouter.HandleFunc("/{category}", workflowHandler.GetWorkflow).Methods("GET")
+	workflowRouter.HandleFunc("/{category}", workflowHandler.PutWorkflow).Methods("PUT")
+	workflowRouter.HandleFunc("/{category}", workflowHandler.DeleteWorkflow).Methods("DELETE")
+
+	// Custom field routes
+	customFieldRouter := router.PathPrefix("/api/custom-fields").Subrouter()
+	customFieldRouter.Use(authMiddleware)
+	customFieldRouter.Use(idempotency.Middleware)
+	customFieldRouter.HandleFunc("", customFieldHandler.GetCustomFields).Methods("GET")
+	customFieldRouter.HandleFunc("", customFieldHandler.CreateCustomField).Methods("POST")
+	customFieldRouter.HandleFunc("/{id}", customFieldHandler.UpdateCustomField).Methods("PUT")
+	customFieldRouter.HandleFunc("/{id}", customFieldHandler.DeleteCustomField).Methods("DELETE")
+
+	timeRouter := router.PathPrefix("/api/time-entries").Subrouter()
+	timeRouter.Use(authMiddleware)
+	timeRouter.Use(idempotency.Middleware)
+	timeRouter.HandleFunc("/running", timeEntryHandler.GetRunningTimer).Methods("GET")
+	timeRouter.HandleFunc("/stop", timeEntryHandler.StopTimer).Methods("POST")
+	timeRouter.HandleFunc("/report", timeEntryHandler.GetTimeReport).Methods("GET")
+	timeRouter.HandleFunc("/{id}", timeEntryHandler.UpdateTimeEntry).Methods("PUT")
+	timeRouter.HandleFunc("/{id}", timeEntryHandler.DeleteTimeEntry).Methods("DELETE")
+
+	// Saved view routes
+	viewRouter := router.PathPrefix("/api/views").Subrouter()
+	viewRouter.Use(authMiddleware)
+	viewRouter.Use(idempotency.Middleware)
+	viewRouter.HandleFunc("", viewHandler.GetViews).Methods("GET")
+	viewRouter.HandleFunc("", viewHandler.CreateView).Methods("POST")
+	viewRouter.HandleFunc("/{id}", viewHandler.GetView).Methods("GET")
+	viewRouter.HandleFunc("/{id}", viewHandler.UpdateView).Methods("PUT")
+	viewRouter.HandleFunc("/{id}", viewHandler.DeleteView).Methods("DELETE")
+	viewRouter.HandleFunc("/{id}/tasks", viewHandler.GetViewTasks).Methods("GET")
+
+	// Task template routes
+	templateRouter := router.PathPrefix("/api/templates").Subrouter()
+	templateRouter.Use(authMiddleware)
+	templateRouter.Use(idempotency.Middleware)
+	templateRouter.HandleFunc("", templateHandler.GetTemplates).Methods("GET")
+	templateRouter.HandleFunc("", templateHandler.CreateTemplate).Methods("POST")
+	templateRouter.HandleFunc("/{id}", templateHandler.GetTemplate).Methods("GET")
+	templateRouter.HandleFunc("/{id}", templateHandler.UpdateTemplate).Methods("PUT")
+	templateRouter.HandleFunc("/{id}", templateHandler.DeleteTemplate).Methods("DELETE")
+	templateRouter.HandleFunc("/{id}/instantiate", templateHandler.InstantiateTemplate).Methods("POST")
+
+	// Offline sync routes: pull changes since a cursor, push batched mutations
+	syncRouter := router.PathPrefix("/api/sync").Subrouter()
+	syncRouter.Use(authMiddleware)
+	syncRouter.Use(idempotency.Middleware)
+	syncRouter.HandleFunc("", taskHandler.GetSyncChanges).Methods("GET")
+	syncRouter.HandleFunc("", taskHandler.PushSyncChanges).Methods("POST")
 
 	// Category routes
 	router.HandleFunc("/api/categories", getCategories).Methods("GET")
@@ -59,8 +248,9 @@ func main() {
 	// Configure CORS
 	c := cors.New(cors.Options{
 		AllowedOrigins:   []string{"http://localhost:3000"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Content-Type", "Authorization"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Content-Type", "Authorization", "X-Timezone", "If-Match", "If-None-Match", "Idempotency-Key"},
+		ExposedHeaders:   []string{"ETag", "Idempotent-Replayed"},
 		AllowCredentials: true,
 	})
 
@@ -0,0 +1,177 @@
+package markdown
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+var (
+	headingPattern = regexp.MustCompile(`^(#{1,6})\s+(.*)$`)
+	bulletPattern  = regexp.MustCompile(`^\s*[-*+]\s+(.*)$`)
+	orderedPattern = regexp.MustCompile(`^\s*\d+[.)]\s+(.*)$`)
+	linkPattern    = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+	boldPattern    = regexp.MustCompile(`\*\*([^*]+)\*\*|__([^_]+)__`)
+	italicPattern  = regexp.MustCompile(`\*([^*]+)\*|\b_([^_]+)_\b`)
+	mentionPattern = regexp.MustCompile(`(^|[^\w@.])@([A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,})`)
+	allowedSchemes = []string{"http://", "https://", "mailto:"}
+)
+
+// Render converts a small, safe subset of markdown into HTML.
+// All user text is escaped before any markup is added, so the output never
+// contains raw HTML from the source. Supported syntax: headings, paragraphs,
+// bullet and numbered lists, block quotes, fenced code blocks, inline code,
+// bold, italics, links (http, https and mailto only) and @mentions.
+func Render(src string) string {
+	lines := strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n")
+
+	var out strings.Builder
+	var paragraph []string
+	listTag := ""
+	inCode := false
+
+	flushParagraph := func() {
+		if len(paragraph) > 0 {
+			out.WriteString("<p>" + strings.Join(paragraph, "<br>") + "</p>\n")
+			paragraph = nil
+		}
+	}
+	closeList := func() {
+		if listTag != "" {
+			out.WriteString("</" + listTag + ">\n")
+			listTag = ""
+		}
+	}
+	openList := func(tag string) {
+		if listTag != tag {
+			closeList()
+			out.WriteString("<" + tag + ">\n")
+			listTag = tag
+		}
+	}
+
+	for _, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			flushParagraph()
+			closeList()
+			if inCode {
+				out.WriteString("</code></pre>\n")
+			} else {
+				out.WriteString("<pre><code>")
+			}
+			inCode = !inCode
+			continue
+		}
+		if inCode {
+			out.WriteString(html.EscapeString(line) + "\n")
+			continue
+		}
+
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+			flushParagraph()
+			closeList()
+		case headingPattern.MatchString(trimmed):
+			flushParagraph()
+			closeList()
+			m := headingPattern.FindStringSubmatch(trimmed)
+			level := string(rune('0' + len(m[1])))
+			out.WriteString("<h" + level + ">" + renderInline(m[2]) + "</h" + level + ">\n")
+		case bulletPattern.MatchString(line):
+			flushParagraph()
+			openList("ul")
+			out.WriteString("<li>" + renderInline(bulletPattern.FindStringSubmatch(line)[1]) + "</li>\n")
+		case orderedPattern.MatchString(line):
+			flushParagraph()
+			openList("ol")
+			out.WriteString("<li>" + renderInline(orderedPattern.FindStringSubmatch(line)[1]) + "</li>\n")
+		case strings.HasPrefix(trimmed, ">"):
+			flushParagraph()
+			closeList()
+			out.WriteString("<blockquote>" + renderInline(strings.TrimSpace(strings.TrimPrefix(trimmed, ">"))) + "</blockquote>\n")
+		default:
+			closeList()
+			paragraph = append(paragraph, renderInline(trimmed))
+		}
+	}
+
+	if inCode {
+		out.WriteString("</code></pre>\n")
+	}
+	flushParagraph()
+	closeList()
+	return strings.TrimSuffix(out.String(), "\n")
+}
+
+// renderInline escapes a single line and applies inline formatting.
+// Backtick-delimited code spans are left untouched by the other rules.
+func renderInline(text string) string {
+	parts := strings.Split(text, "`")
+	var out strings.Builder
+	for i, part := range parts {
+		escaped := html.EscapeString(part)
+		// An odd index is inside a code span, unless the span is never closed
+		if i%2 == 1 && i < len(parts)-1 {
+			out.WriteString("<code>" + escaped + "</code>")
+			continue
+		}
+		if i%2 == 1 {
+			out.WriteString("`")
+		}
+		out.WriteString(formatSpan(escaped))
+	}
+	return out.String()
+}
+
+// formatSpan applies links, emphasis and mentions to already-escaped text.
+// Link targets are copied verbatim so that no markup ends up inside an href.
+func formatSpan(escaped string) string {
+	var out strings.Builder
+	last := 0
+	for _, loc := range linkPattern.FindAllStringSubmatchIndex(escaped, -1) {
+		out.WriteString(formatText(escaped[last:loc[0]]))
+		text, target := escaped[loc[2]:loc[3]], escaped[loc[4]:loc[5]]
+		if isAllowedURL(html.UnescapeString(target)) {
+			out.WriteString(`<a href="` + target + `" rel="nofollow noopener noreferrer">` + formatText(text) + `</a>`)
+		} else {
+			out.WriteString(formatText(text))
+		}
+		last = loc[1]
+	}
+	out.WriteString(formatText(escaped[last:]))
+	return out.String()
+}
+
+// formatText applies emphasis and mentions to escaped text without links
+func formatText(escaped string) string {
+	escaped = boldPattern.ReplaceAllString(escaped, "<strong>$1$2</strong>")
+	escaped = italicPattern.ReplaceAllString(escaped, "<em>$1$2</em>")
+	return mentionPattern.ReplaceAllString(escaped, `$1<span class="mention">@$2</span>`)
+}
+
+// isAllowedURL reports whether a link target uses a safe scheme
+func isAllowedURL(url string) bool {
+	lower := strings.ToLower(strings.TrimSpace(url))
+	for _, scheme := range allowedSchemes {
+		if strings.HasPrefix(lower, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// Mentions returns the distinct email addresses mentioned as @user@example.com
+// in the source text, in the order they first appear.
+func Mentions(src string) []string {
+	seen := make(map[string]bool)
+	var mentions []string
+	for _, m := range mentionPattern.FindAllStringSubmatch(src, -1) {
+		email := strings.ToLower(m[2])
+		if !seen[email] {
+			seen[email] = true
+			mentions = append(mentions, email)
+		}
+	}
+	return mentions
+}
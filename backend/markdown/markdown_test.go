@@ -0,0 +1,94 @@
+package markdown
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"empty", "", ""},
+		{"paragraph", "hello\nworld", "<p>hello<br>world</p>"},
+		{"heading", "## Plan", "<h2>Plan</h2>"},
+		{"bullets", "- one\n- two", "<ul>\n<li>one</li>\n<li>two</li>\n</ul>"},
+		{"numbered", "1. one\n2) two", "<ol>\n<li>one</li>\n<li>two</li>\n</ol>"},
+		{"quote", "> said", "<blockquote>said</blockquote>"},
+		{"emphasis", "**bold** and *it*", "<p><strong>bold</strong> and <em>it</em></p>"},
+		{"code span", "run `a*b*c`", "<p>run <code>a*b*c</code></p>"},
+		{"unclosed code span", "a `b", "<p>a `b</p>"},
+		{"unclosed fence", "```\nx < y", "<pre><code>x &lt; y\n</code></pre>"},
+		{"link", "[docs](https://example.com/a?b=1&c=2)",
+			`<p><a href="https://example.com/a?b=1&amp;c=2" rel="nofollow noopener noreferrer">docs</a></p>`},
+		{"mailto link", "[me](mailto:me@example.com)",
+			`<p><a href="mailto:me@example.com" rel="nofollow noopener noreferrer">me</a></p>`},
+		{"mention", "ask @ann@example.com", `<p>ask <span class="mention">@ann@example.com</span></p>`},
+		{"heading without space", "#Work", "<p>#Work</p>"},
+		{"crlf", "a\r\nb", "<p>a<br>b</p>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Render(tt.src); got != tt.want {
+				t.Errorf("Render(%q) =\n%s\nwant\n%s", tt.src, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestRenderUnsafe feeds markup meant to run script through Render. None of
+// it may come out as a tag, attribute or link the browser would act on.
+func TestRenderUnsafe(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+	}{
+		{"script tag", "<script>alert(1)</script>"},
+		{"script in heading", "# <script>alert(1)</script>"},
+		{"script in list", "- <script>alert(1)</script>"},
+		{"script in code block", "```\n</code></pre><script>alert(1)</script>\n```"},
+		{"script in code span", "`<script>alert(1)</script>`"},
+		{"img onerror", `<img src=x onerror="alert(1)">`},
+		{"javascript link", "[click](javascript:alert(1))"},
+		{"uppercase javascript link", "[click](JavaScript:alert(1))"},
+		{"encoded javascript link", "[click](javascript&#58;alert(1))"},
+		{"data link", "[click](data:text/html;base64,PHNjcmlwdD4=)"},
+		{"vbscript link", "[click](vbscript:msgbox(1))"},
+		{"attribute breakout", `[click](https://example.com/"onmouseover="alert(1))`},
+		{"markup in link text", "[<script>alert(1)</script>](https://example.com)"},
+		{"emphasis around tag", "**<script>**alert(1)**</script>**"},
+		{"mention with tag", "@<script>@example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Render(tt.src)
+			lower := strings.ToLower(got)
+			for _, bad := range []string{"<script", "</script", "<img", `href="javascript:`, `href="data:`, `href="vbscript:`, `"onmouseover=`} {
+				if strings.Contains(lower, bad) {
+					t.Errorf("Render(%q) = %q contains %q", tt.src, got, bad)
+				}
+			}
+		})
+	}
+}
+
+func TestMentions(t *testing.T) {
+	tests := []struct {
+		src  string
+		want []string
+	}{
+		{"no mentions here", nil},
+		{"@Ann@Example.com and @ann@example.com", []string{"ann@example.com"}},
+		{"@a@example.com, @b@example.org", []string{"a@example.com", "b@example.org"}},
+		{"mail me at ann@example.com", nil},
+		{"@ann@localhost", nil},
+	}
+	for _, tt := range tests {
+		if got := Mentions(tt.src); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Mentions(%q) = %q, want %q", tt.src, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,7 @@
+-- Drop triggers
+DROP TRIGGER IF EXISTS update_task_comments_updated_at ON task_comments;
+
+-- Drop tables
+DROP TABLE IF EXISTS notifications;
+DROP TABLE IF EXISTS task_comment_edits;
+DROP TABLE IF EXISTS task_comments;
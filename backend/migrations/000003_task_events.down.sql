@@ -0,0 +1,2 @@
+-- Drop task events table
+DROP TABLE IF EXISTS task_events;
@@ -0,0 +1,6 @@
+-- Drop triggers
+DROP TRIGGER IF EXISTS update_tags_updated_at ON tags;
+
+-- Drop tables
+DROP TABLE IF EXISTS task_tags;
+DROP TABLE IF EXISTS tags;
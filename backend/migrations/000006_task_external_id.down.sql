@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_tasks_user_external_id;
+
+ALTER TABLE tasks DROP COLUMN IF EXISTS external_id;
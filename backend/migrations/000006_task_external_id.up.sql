@@ -0,0 +1,5 @@
+-- Identifier of a task in the system it was imported from, used to skip duplicates
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS external_id VARCHAR(255);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_tasks_user_external_id
+    ON tasks(user_id, external_id) WHERE external_id IS NOT NULL;
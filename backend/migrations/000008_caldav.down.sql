@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_tasks_user_updated_at;
+DROP INDEX IF EXISTS idx_tasks_user_caldav_name;
+
+ALTER TABLE tasks DROP COLUMN IF EXISTS caldav_name;
+ALTER TABLE tasks DROP COLUMN IF EXISTS ical_uid;
@@ -0,0 +1,10 @@
+-- UID and resource name chosen by CalDAV clients for tasks they create.
+-- Tasks created elsewhere use task-<id>@task-manager and task-<id>.ics.
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS ical_uid VARCHAR(255);
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS caldav_name VARCHAR(255);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_tasks_user_caldav_name
+    ON tasks(user_id, caldav_name) WHERE caldav_name IS NOT NULL;
+
+-- Sync reports look for tasks changed after a point in time
+CREATE INDEX IF NOT EXISTS idx_tasks_user_updated_at ON tasks(user_id, updated_at);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_users_inbound_token;
+
+ALTER TABLE users DROP COLUMN IF EXISTS inbound_token;
@@ -0,0 +1,5 @@
+-- Secret token identifying each user's inbound email address
+ALTER TABLE users ADD COLUMN IF NOT EXISTS inbound_token VARCHAR(64);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_inbound_token
+    ON users(inbound_token) WHERE inbound_token IS NOT NULL;
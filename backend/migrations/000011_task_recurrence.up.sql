@@ -0,0 +1,2 @@
+-- Recurrence rule of repeating tasks, as an iCalendar RRULE value
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS recurrence VARCHAR(255);
@@ -0,0 +1,11 @@
+-- The task timestamps stay WITH TIME ZONE; converting them back would lose information
+
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_default_priority_check;
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_week_start_check;
+
+ALTER TABLE users DROP COLUMN IF EXISTS default_category;
+ALTER TABLE users DROP COLUMN IF EXISTS default_priority;
+ALTER TABLE users DROP COLUMN IF EXISTS week_start;
+ALTER TABLE users DROP COLUMN IF EXISTS locale;
+ALTER TABLE users DROP COLUMN IF EXISTS timezone;
+ALTER TABLE users DROP COLUMN IF EXISTS display_name;
@@ -0,0 +1,39 @@
+-- Profile and preferences of each user
+ALTER TABLE users ADD COLUMN IF NOT EXISTS display_name VARCHAR(100) NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS timezone VARCHAR(64) NOT NULL DEFAULT 'UTC';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS locale VARCHAR(35) NOT NULL DEFAULT 'en-US';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS week_start SMALLINT NOT NULL DEFAULT 1;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS default_priority VARCHAR(20) NOT NULL DEFAULT 'low';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS default_category VARCHAR(50);
+
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'users_week_start_check') THEN
+        ALTER TABLE users ADD CONSTRAINT users_week_start_check CHECK (week_start BETWEEN 0 AND 6);
+    END IF;
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'users_default_priority_check') THEN
+        ALTER TABLE users ADD CONSTRAINT users_default_priority_check
+            CHECK (default_priority IN ('low', 'medium', 'high'));
+    END IF;
+END $$;
+
+-- Databases created by 000001 store task times without a time zone, so their
+-- meaning depends on the server's locale. Values were written in UTC; convert
+-- them to TIMESTAMP WITH TIME ZONE as in schema.sql.
+DO $$
+DECLARE
+    col TEXT;
+BEGIN
+    FOREACH col IN ARRAY ARRAY['due_date', 'created_at', 'updated_at', 'completed_at'] LOOP
+        IF EXISTS (
+            SELECT 1 FROM information_schema.columns
+            WHERE table_name = 'tasks' AND column_name = col
+                AND data_type = 'timestamp without time zone'
+        ) THEN
+            EXECUTE format(
+                'ALTER TABLE tasks ALTER COLUMN %I TYPE TIMESTAMP WITH TIME ZONE USING %I AT TIME ZONE ''UTC''',
+                col, col
+            );
+        END IF;
+    END LOOP;
+END $$;
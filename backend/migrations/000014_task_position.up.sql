@@ -0,0 +1,15 @@
+-- Manual order of tasks within each status column, as keys from the rank
+-- package; the C collation makes them compare byte by byte
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS position VARCHAR(255) COLLATE "C";
+
+-- Number existing tasks in their current order, newest first. The trailing
+-- "i" keeps keys from ending in 0, as the rank package requires.
+UPDATE tasks t
+SET position = lpad(r.rn::text, 10, '0') || 'i'
+FROM (
+    SELECT id, row_number() OVER (PARTITION BY user_id, status ORDER BY created_at DESC, id DESC) AS rn
+    FROM tasks
+) r
+WHERE t.id = r.id AND t.position IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_tasks_position ON tasks(user_id, status, position);
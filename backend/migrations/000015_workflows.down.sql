@@ -0,0 +1,14 @@
+-- Custom statuses don't fit the fixed set; done tasks become completed and the rest pending
+UPDATE tasks SET status = CASE WHEN completed_at IS NOT NULL THEN 'completed' ELSE 'pending' END
+WHERE status NOT IN ('pending', 'in_progress', 'completed');
+
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'status_check') THEN
+        ALTER TABLE tasks ADD CONSTRAINT status_check CHECK (status IN ('pending', 'in_progress', 'completed'));
+    END IF;
+END $$;
+
+DROP TRIGGER IF EXISTS update_workflows_updated_at ON workflows;
+DROP INDEX IF EXISTS idx_workflows_user_category;
+DROP TABLE IF EXISTS workflows;
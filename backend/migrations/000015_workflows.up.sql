@@ -0,0 +1,33 @@
+-- Workflows define the statuses available to a user's tasks. A row with a
+-- NULL category is the user's default; otherwise it applies to one category.
+CREATE TABLE IF NOT EXISTS workflows (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    category VARCHAR(50),
+    name VARCHAR(100) NOT NULL,
+    states JSONB NOT NULL,
+    transitions JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_workflows_user_category
+    ON workflows(user_id, COALESCE(category, ''));
+
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_trigger WHERE tgname = 'update_workflows_updated_at') THEN
+        CREATE TRIGGER update_workflows_updated_at
+            BEFORE UPDATE ON workflows
+            FOR EACH ROW
+            EXECUTE FUNCTION update_updated_at_column();
+    END IF;
+END $$;
+
+-- Statuses are now checked against the task's workflow by the application
+ALTER TABLE tasks DROP CONSTRAINT IF EXISTS status_check;
+
+-- A task is done exactly when completed_at is set; fill it in for tasks
+-- that were created as completed
+UPDATE tasks SET completed_at = updated_at
+WHERE status = 'completed' AND completed_at IS NULL;
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_tasks_custom_fields;
+
+ALTER TABLE tasks DROP COLUMN IF EXISTS custom_fields;
+
+DROP TRIGGER IF EXISTS update_custom_fields_updated_at ON custom_fields;
+DROP TABLE IF EXISTS custom_fields;
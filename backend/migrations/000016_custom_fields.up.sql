@@ -0,0 +1,33 @@
+-- Custom field definitions. A NULL category makes the field available to
+-- tasks in every category; keys are unique per user so filters by key are
+-- unambiguous.
+CREATE TABLE IF NOT EXISTS custom_fields (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    category VARCHAR(50),
+    key VARCHAR(40) NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    type VARCHAR(20) NOT NULL,
+    options TEXT[] NOT NULL DEFAULT '{}',
+    required BOOLEAN NOT NULL DEFAULT false,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT custom_fields_user_key UNIQUE (user_id, key),
+    CONSTRAINT custom_field_type_check CHECK (type IN ('text', 'number', 'date', 'select', 'multi_select', 'user'))
+);
+
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_trigger WHERE tgname = 'update_custom_fields_updated_at') THEN
+        CREATE TRIGGER update_custom_fields_updated_at
+            BEFORE UPDATE ON custom_fields
+            FOR EACH ROW
+            EXECUTE FUNCTION update_updated_at_column();
+    END IF;
+END $$;
+
+-- Values are kept on the task as one JSON object keyed by field key; the
+-- GIN index serves the containment queries used for filtering
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS custom_fields JSONB NOT NULL DEFAULT '{}';
+
+CREATE INDEX IF NOT EXISTS idx_tasks_custom_fields ON tasks USING GIN (custom_fields jsonb_path_ops);
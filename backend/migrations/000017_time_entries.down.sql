@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS update_time_entries_updated_at ON time_entries;
+DROP INDEX IF EXISTS idx_time_entries_user_started;
+DROP INDEX IF EXISTS idx_time_entries_task;
+DROP INDEX IF EXISTS idx_time_entries_running;
+DROP TABLE IF EXISTS time_entries;
@@ -0,0 +1,7 @@
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_work_hours_check;
+ALTER TABLE users DROP COLUMN IF EXISTS work_days;
+ALTER TABLE users DROP COLUMN IF EXISTS work_day_end;
+ALTER TABLE users DROP COLUMN IF EXISTS work_day_start;
+
+ALTER TABLE tasks DROP CONSTRAINT IF EXISTS tasks_estimate_minutes_check;
+ALTER TABLE tasks DROP COLUMN IF EXISTS estimate_minutes;
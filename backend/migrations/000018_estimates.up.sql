@@ -0,0 +1,21 @@
+-- Estimated effort of a task, in minutes
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS estimate_minutes INTEGER;
+
+-- Working hours used to tell whether estimated work fits before due dates.
+-- Times are minutes after midnight in the user's time zone; days use 0 for
+-- Sunday, like week_start.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS work_day_start SMALLINT NOT NULL DEFAULT 540;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS work_day_end SMALLINT NOT NULL DEFAULT 1020;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS work_days SMALLINT[] NOT NULL DEFAULT '{1,2,3,4,5}';
+
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'tasks_estimate_minutes_check') THEN
+        ALTER TABLE tasks ADD CONSTRAINT tasks_estimate_minutes_check
+            CHECK (estimate_minutes BETWEEN 1 AND 100000);
+    END IF;
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'users_work_hours_check') THEN
+        ALTER TABLE users ADD CONSTRAINT users_work_hours_check
+            CHECK (work_day_start >= 0 AND work_day_start < work_day_end AND work_day_end <= 1440);
+    END IF;
+END $$;
@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS update_views_updated_at ON views;
+DROP INDEX IF EXISTS idx_views_user_name;
+DROP TABLE IF EXISTS views;
@@ -0,0 +1,24 @@
+-- Saved views are named filters over a user's tasks, written in the query
+-- language of the viewquery package. Names are unique per user regardless
+-- of case.
+CREATE TABLE IF NOT EXISTS views (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    query TEXT NOT NULL DEFAULT '',
+    sort VARCHAR(50) NOT NULL DEFAULT '-created',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_views_user_name ON views(user_id, lower(name));
+
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_trigger WHERE tgname = 'update_views_updated_at') THEN
+        CREATE TRIGGER update_views_updated_at
+            BEFORE UPDATE ON views
+            FOR EACH ROW
+            EXECUTE FUNCTION update_updated_at_column();
+    END IF;
+END $$;
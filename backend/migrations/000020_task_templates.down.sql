@@ -0,0 +1,6 @@
+DROP TRIGGER IF EXISTS update_task_templates_updated_at ON task_templates;
+DROP INDEX IF EXISTS idx_task_templates_user_name;
+DROP TABLE IF EXISTS task_templates;
+
+DROP INDEX IF EXISTS idx_tasks_parent_id;
+ALTER TABLE tasks DROP COLUMN IF EXISTS parent_id;
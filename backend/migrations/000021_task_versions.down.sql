@@ -0,0 +1,4 @@
+DROP TRIGGER IF EXISTS bump_tasks_version ON tasks;
+DROP FUNCTION IF EXISTS bump_task_version();
+
+ALTER TABLE tasks DROP COLUMN IF EXISTS version;
@@ -0,0 +1,21 @@
+-- Every change to a task moves its version on; clients send it back in
+-- If-Match to avoid overwriting each other's edits
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
+
+CREATE OR REPLACE FUNCTION bump_task_version()
+RETURNS TRIGGER AS $$
+BEGIN
+    NEW.version = OLD.version + 1;
+    RETURN NEW;
+END;
+$$ language 'plpgsql';
+
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_trigger WHERE tgname = 'bump_tasks_version') THEN
+        CREATE TRIGGER bump_tasks_version
+            BEFORE UPDATE ON tasks
+            FOR EACH ROW
+            EXECUTE FUNCTION bump_task_version();
+    END IF;
+END $$;
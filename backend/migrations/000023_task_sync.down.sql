@@ -0,0 +1,6 @@
+DROP TRIGGER IF EXISTS set_tasks_change_seq ON tasks;
+DROP FUNCTION IF EXISTS set_task_change_seq();
+
+DROP INDEX IF EXISTS idx_tasks_change_seq;
+ALTER TABLE tasks DROP COLUMN IF EXISTS change_seq;
+ALTER TABLE users DROP COLUMN IF EXISTS task_change_seq;
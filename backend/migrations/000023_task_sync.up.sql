@@ -0,0 +1,49 @@
+-- Every change to a task takes the next number of its owner's change
+-- sequence, which clients sync from. Numbering through the users row keeps
+-- it locked until commit, so a user's changes commit in sequence order and
+-- a client never skips a change that commits late.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS task_change_seq BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS change_seq BIGINT NOT NULL DEFAULT 0;
+
+-- Number existing tasks in the order they last changed, leaving their
+-- updated_at and version alone
+ALTER TABLE tasks DISABLE TRIGGER update_tasks_updated_at;
+ALTER TABLE tasks DISABLE TRIGGER bump_tasks_version;
+
+UPDATE tasks t
+SET change_seq = r.rn
+FROM (
+    SELECT id, row_number() OVER (PARTITION BY user_id ORDER BY updated_at, id) AS rn
+    FROM tasks
+) r
+WHERE t.id = r.id AND t.change_seq = 0;
+
+ALTER TABLE tasks ENABLE TRIGGER update_tasks_updated_at;
+ALTER TABLE tasks ENABLE TRIGGER bump_tasks_version;
+
+UPDATE users u
+SET task_change_seq = s.max_seq
+FROM (SELECT user_id, max(change_seq) AS max_seq FROM tasks GROUP BY user_id) s
+WHERE u.id = s.user_id;
+
+CREATE INDEX IF NOT EXISTS idx_tasks_change_seq ON tasks(user_id, change_seq);
+
+CREATE OR REPLACE FUNCTION set_task_change_seq()
+RETURNS TRIGGER AS $$
+BEGIN
+    UPDATE users SET task_change_seq = task_change_seq + 1
+    WHERE id = NEW.user_id
+    RETURNING task_change_seq INTO NEW.change_seq;
+    RETURN NEW;
+END;
+$$ language 'plpgsql';
+
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_trigger WHERE tgname = 'set_tasks_change_seq') THEN
+        CREATE TRIGGER set_tasks_change_seq
+            BEFORE INSERT OR UPDATE ON tasks
+            FOR EACH ROW
+            EXECUTE FUNCTION set_task_change_seq();
+    END IF;
+END $$;
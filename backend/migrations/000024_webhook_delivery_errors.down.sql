@@ -0,0 +1,2 @@
+-- The response bodies that were removed can't be restored
+SELECT 1;
@@ -0,0 +1,5 @@
+-- Deliveries used to keep the start of the endpoint's response body in
+-- last_error; keep only the status code
+UPDATE webhook_deliveries
+SET last_error = 'endpoint returned status ' || response_status
+WHERE response_status IS NOT NULL AND last_error <> '';
@@ -0,0 +1,3 @@
+-- Mention notifications were removed: tasks have a single owner, so there is
+-- nobody else a mention could notify
+DROP TABLE IF EXISTS notifications;
@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// AccountDeletion confirms an account deletion with the user's password
+type AccountDeletion struct {
+	Password string `json:"password" validate:"required"`
+}
+
+// AccountDeletionStatus tells when a deleted account will be purged for good
+type AccountDeletionStatus struct {
+	DeletedAt  time.Time `json:"deleted_at"`
+	PurgeAfter time.Time `json:"purge_after"`
+}
+
+// CategoryUsage is a category and how many of the user's tasks are in it
+type CategoryUsage struct {
+	Name      string `json:"name"`
+	TaskCount int    `json:"task_count"`
+}
+
+// AttachmentExport describes an attachment and where its contents are in a data export
+type AttachmentExport struct {
+	Attachment
+	Path string `json:"path"`
+}
+
+// DataExportManifest is written last to a data export and lists what it holds
+type DataExportManifest struct {
+	UserID             int       `json:"user_id"`
+	ExportedAt         time.Time `json:"exported_at"`
+	Files              []string  `json:"files"`
+	MissingAttachments []int     `json:"missing_attachments"` // IDs of attachments whose contents couldn't be read
+}
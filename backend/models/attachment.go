@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// Attachment describes a file attached to a task.
+// The file contents live in the blob store under a key derived from SHA256.
+type Attachment struct {
+	ID          int       `json:"id"`
+	TaskID      int       `json:"task_id"`
+	Filename    string    `json:"filename"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	SHA256      string    `json:"sha256"`
+	CreatedAt   time.Time `json:"created_at"`
+}
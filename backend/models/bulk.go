@@ -0,0 +1,48 @@
+package models
+
+import "time"
+
+// BulkRequest applies one operation to many tasks in a single transaction
+type BulkRequest struct {
+	IDs       []int       `json:"ids" validate:"required,min=1"`
+	Operation string      `json:"operation" validate:"required,oneof=update delete restore move_category add_tag"`
+	Fields    *BulkFields `json:"fields,omitempty"`
+	Category  string      `json:"category,omitempty"`
+	Tag       string      `json:"tag,omitempty"`
+	Mode      string      `json:"mode" validate:"omitempty,oneof=atomic best_effort"`
+	// BaseVersions maps task IDs to the versions the client last saw; a task
+	// that has changed since is reported as a conflict and left alone
+	BaseVersions map[int]int `json:"base_versions,omitempty"`
+}
+
+// BulkFields lists the fields changed by a bulk update; nil fields are left as they are
+type BulkFields struct {
+	Title        *string    `json:"title,omitempty"`
+	Description  *string    `json:"description,omitempty"`
+	Status       *string    `json:"status,omitempty"`
+	Priority     *string    `json:"priority,omitempty"`
+	Category     *string    `json:"category,omitempty"`
+	DueDate      *time.Time `json:"due_date,omitempty"`
+	ClearDueDate bool       `json:"clear_due_date,omitempty"`
+	// CustomFields sets the listed custom fields; a null value clears one
+	CustomFields map[string]interface{} `json:"custom_fields,omitempty"`
+	// EstimateMinutes replaces the estimate when set; 0 clears it
+	EstimateMinutes *int `json:"estimate_minutes,omitempty"`
+}
+
+// BulkItemResult is the outcome of a bulk operation for one task
+type BulkItemResult struct {
+	ID     int    `json:"id"`
+	Status string `json:"status"` // ok, failed, conflict or rolled_back
+	Error  string `json:"error,omitempty"`
+	Task   *Task  `json:"task,omitempty"`
+}
+
+// BulkResponse reports the outcome of a bulk operation
+type BulkResponse struct {
+	Mode      string           `json:"mode"`
+	Committed bool             `json:"committed"`
+	Succeeded int              `json:"succeeded"`
+	Failed    int              `json:"failed"`
+	Results   []BulkItemResult `json:"results"`
+}
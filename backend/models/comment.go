@@ -0,0 +1,36 @@
+package models
+
+import "time"
+
+// Comment represents a comment left on a task
+type Comment struct {
+	ID          int        `json:"id"`
+	TaskID      int        `json:"task_id"`
+	AuthorID    int        `json:"author_id"`
+	AuthorEmail string     `json:"author_email"`
+	Body        string     `json:"body"`
+	BodyHTML    string     `json:"body_html"`
+	Mentions    []string   `json:"mentions,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	EditedAt    *time.Time `json:"edited_at,omitempty"`
+}
+
+// CommentCreate represents the data needed to create a new comment
+type CommentCreate struct {
+	Body string `json:"body" validate:"required,max=10000"`
+}
+
+// CommentUpdate represents the data needed to edit a comment
+type CommentUpdate struct {
+	Body string `json:"body" validate:"required,max=10000"`
+}
+
+// CommentEdit is a previous revision of a comment's body
+type CommentEdit struct {
+	ID        int       `json:"id"`
+	CommentID int       `json:"comment_id"`
+	Body      string    `json:"body"`
+	EditedBy  int       `json:"edited_by"`
+	EditedAt  time.Time `json:"edited_at"`
+}
@@ -0,0 +1,44 @@
+package models
+
+import (
+	"regexp"
+	"time"
+)
+
+// CustomFieldKeyPattern is the form of a custom field key, which names the
+// field in task JSON and in ?cf.<key>= filters
+var CustomFieldKeyPattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,39}$`)
+
+// CustomFieldTypes lists the supported custom field types
+var CustomFieldTypes = []string{"text", "number", "date", "select", "multi_select", "user"}
+
+// CustomField defines a piece of metadata tasks can carry. Values are a
+// string for text, a number, a YYYY-MM-DD string for date, one of Options
+// for select, a list of Options for multi_select and the owner's user ID for user.
+type CustomField struct {
+	ID        int        `json:"id"`
+	Category  string     `json:"category,omitempty"` // empty when the field applies to every category
+	Key       string     `json:"key"`
+	Name      string     `json:"name"`
+	Type      string     `json:"type"`
+	Options   []string   `json:"options,omitempty"`
+	Required  bool       `json:"required"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+}
+
+// CustomFieldInput is the data sent to create or change a custom field. The
+// key and type can't be changed once the field exists.
+type CustomFieldInput struct {
+	Category string   `json:"category"`
+	Key      string   `json:"key"`
+	Name     string   `json:"name"`
+	Type     string   `json:"type"`
+	Options  []string `json:"options"`
+	Required bool     `json:"required"`
+}
+
+// AppliesTo reports whether the field is available to tasks in a category
+func (f *CustomField) AppliesTo(category string) bool {
+	return f.Category == "" || f.Category == category
+}
@@ -0,0 +1,25 @@
+package models
+
+// QuickAddRequest is a single line of text to turn into a task
+type QuickAddRequest struct {
+	Text     string `json:"text" validate:"required"`
+	Timezone string `json:"timezone"` // IANA name such as Europe/Berlin; defaults to the profile's
+	Category string `json:"category"` // used when the text names no category
+	Create   bool   `json:"create"`   // create the task instead of only previewing it
+}
+
+// QuickAddToken is one part of the text that was recognized
+type QuickAddToken struct {
+	Kind  string `json:"kind"`
+	Text  string `json:"text"`
+	Value string `json:"value"`
+}
+
+// QuickAddResponse shows how the text was interpreted, and the task if one was created
+type QuickAddResponse struct {
+	Task     TaskCreate      `json:"task"`
+	Tokens   []QuickAddToken `json:"tokens"`
+	Timezone string          `json:"timezone"`
+	Error    string          `json:"error,omitempty"` // why the task can't be created as is
+	Created  *Task           `json:"created,omitempty"`
+}
@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// AtRiskReport lists open tasks whose estimated work can't be done before
+// their due dates within the user's working hours
+type AtRiskReport struct {
+	GeneratedAt  time.Time    `json:"generated_at"`
+	Timezone     string       `json:"timezone"`
+	WorkDayStart string       `json:"work_day_start"`
+	WorkDayEnd   string       `json:"work_day_end"`
+	WorkDays     []int        `json:"work_days"`
+	Checked      int          `json:"checked"` // open tasks with both a due date and an estimate
+	AtRisk       int          `json:"at_risk"`
+	Tasks        []AtRiskTask `json:"tasks"`
+}
+
+// AtRiskTask is a task in the schedule. Tasks are worked on in due date
+// order, so the work ahead of a task includes every task due before it.
+type AtRiskTask struct {
+	Task              Task `json:"task"`
+	RemainingMinutes  int  `json:"remaining_minutes"`  // estimate less time already tracked
+	CumulativeMinutes int  `json:"cumulative_minutes"` // remaining work up to and including this task
+	AvailableMinutes  int  `json:"available_minutes"`  // working time from now until the due date
+	ShortfallMinutes  int  `json:"shortfall_minutes"`
+	// ProjectedFinish is when the work would be done, working only within
+	// working hours; it is omitted when that is too far away to compute
+	ProjectedFinish *time.Time `json:"projected_finish,omitempty"`
+	AtRisk          bool       `json:"at_risk"`
+}
@@ -0,0 +1,31 @@
+package models
+
+// Stats summarizes a user's tasks for the dashboard
+type Stats struct {
+	From     string `json:"from"` // first day of the range, YYYY-MM-DD in the user's time zone
+	To       string `json:"to"`   // last day of the range, inclusive
+	Timezone string `json:"timezone"`
+
+	Total      int            `json:"total"`
+	ByStatus   map[string]int `json:"by_status"`
+	ByPriority map[string]int `json:"by_priority"`
+	ByCategory map[string]int `json:"by_category"`
+	Overdue    int            `json:"overdue"`
+	DueToday   int            `json:"due_today"`
+
+	// Of the tasks created in the range, the share that has been completed (0 to 1)
+	CompletionRate float64 `json:"completion_rate"`
+	// Time from creation to completion of tasks completed in the range
+	CompletedInRange     int          `json:"completed_in_range"`
+	AverageLeadTimeHours *float64     `json:"average_lead_time_hours"`
+	MedianLeadTimeHours  *float64     `json:"median_lead_time_hours"`
+	Daily                []DailyStats `json:"daily"`
+}
+
+// DailyStats counts the tasks created and completed on one day
+type DailyStats struct {
+	Date           string  `json:"date"`
+	Created        int     `json:"created"`
+	Completed      int     `json:"completed"`
+	CompletionRate float64 `json:"completion_rate"` // completed tasks among those created up to this day
+}
@@ -0,0 +1,54 @@
+package models
+
+import "time"
+
+// SyncChanges is a page of the changes to a user's tasks after a cursor
+type SyncChanges struct {
+	// Cursor is passed back as ?since= to get the changes after this page
+	Cursor  string `json:"cursor"`
+	HasMore bool   `json:"has_more"`
+	// Tasks were created, changed or restored; Deleted were deleted
+	Tasks   []Task          `json:"tasks"`
+	Deleted []SyncTombstone `json:"deleted"`
+}
+
+// SyncTombstone marks a deleted task
+type SyncTombstone struct {
+	ID        int       `json:"id"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+// SyncPush is a batch of changes made by a client, applied in order
+type SyncPush struct {
+	Mutations []SyncMutation `json:"mutations"`
+}
+
+// SyncMutation is one change made by a client while offline. Create uses
+// Task; update uses TaskID and Fields; delete uses TaskID. With
+// BaseVersion, the change is only applied if the task is still at that
+// version.
+type SyncMutation struct {
+	ClientID    string      `json:"client_id"` // echoed in the result
+	Op          string      `json:"op"`        // create, update or delete
+	TaskID      int         `json:"task_id,omitempty"`
+	BaseVersion *int        `json:"base_version,omitempty"`
+	Task        *TaskCreate `json:"task,omitempty"`
+	Fields      *BulkFields `json:"fields,omitempty"`
+}
+
+// SyncResult is the outcome of one mutation. On a conflict Task is the
+// task as it is on the server, unchanged.
+type SyncResult struct {
+	ClientID string `json:"client_id"`
+	Status   string `json:"status"` // applied, conflict or failed
+	Error    string `json:"error,omitempty"`
+	Task     *Task  `json:"task,omitempty"`
+}
+
+// SyncPushResponse reports the outcome of each mutation, in order
+type SyncPushResponse struct {
+	Applied   int          `json:"applied"`
+	Conflicts int          `json:"conflicts"`
+	Failed    int          `json:"failed"`
+	Results   []SyncResult `json:"results"`
+}
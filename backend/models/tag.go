@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// Tag is a free-form label a user can attach to any number of tasks
+type Tag struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	Color     string    `json:"color"`
+	TaskCount int       `json:"task_count"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TagCreate represents the data needed to create a new tag
+type TagCreate struct {
+	Name  string `json:"name" validate:"required,min=1,max=50"`
+	Color string `json:"color" validate:"omitempty,hexcolor"`
+}
+
+// TagUpdate represents the data needed to rename or recolor a tag
+type TagUpdate struct {
+	Name  string `json:"name" validate:"omitempty,min=1,max=50"`
+	Color string `json:"color" validate:"omitempty,hexcolor"`
+}
+
+// TagMerge moves every task from one tag onto another and removes the first
+type TagMerge struct {
+	IntoID int `json:"into_id" validate:"required"`
+}
+
+// TaskTags lists tag names to attach to a task, creating missing tags
+type TaskTags struct {
+	Tags []string `json:"tags" validate:"required"`
+}
@@ -16,36 +16,87 @@ type Task struct {
 	CreatedAt   time.Time  `json:"created_at"`
 	UpdatedAt   time.Time  `json:"updated_at"`
 	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	Tags        []string   `json:"tags"`
+	ExternalID  string     `json:"external_id,omitempty"`
+	Recurrence  string     `json:"recurrence,omitempty"`
+	Position    string     `json:"position,omitempty"` // sort key within the task's status column
+	// CustomFields holds the values of the user's custom fields, by field key
+	CustomFields map[string]interface{} `json:"custom_fields"`
+	// TrackedSeconds totals the time entries on the task, including a running timer
+	TrackedSeconds  int64 `json:"tracked_seconds"`
+	EstimateMinutes *int  `json:"estimate_minutes,omitempty"`
+	ParentID        *int  `json:"parent_id,omitempty"` // the task this is a subtask of
+	// Version moves on with every change to the task; it is the task's ETag
+	Version int `json:"version"`
 }
 
 // TaskCreate represents the data needed to create a new task
 type TaskCreate struct {
-	Title       string     `json:"title" validate:"required,min=3,max=255"`
-	Description string     `json:"description"`
-	Status      string     `json:"status" validate:"required,oneof=pending in_progress completed"`
-	Priority    string     `json:"priority" validate:"required,oneof=low medium high"`
-	Category    string     `json:"category" validate:"required,oneof=Work Personal Shopping Health Education"`
-	DueDate     *time.Time `json:"due_date"`
+	Title           string                 `json:"title" validate:"required,min=3,max=255"`
+	Description     string                 `json:"description"`
+	Status          string                 `json:"status"` // defaults to the first state of the category's workflow
+	Priority        string                 `json:"priority" validate:"required,oneof=low medium high"`
+	Category        string                 `json:"category" validate:"required,oneof=Work Personal Shopping Health Education"`
+	DueDate         *time.Time             `json:"due_date"`
+	Tags            []string               `json:"tags,omitempty"`
+	ExternalID      string                 `json:"external_id,omitempty" validate:"omitempty,max=255"`
+	Recurrence      string                 `json:"recurrence,omitempty" validate:"omitempty,max=255"`
+	CustomFields    map[string]interface{} `json:"custom_fields,omitempty"`
+	EstimateMinutes *int                   `json:"estimate_minutes,omitempty"`
+	ParentID        *int                   `json:"parent_id,omitempty"`
+}
+
+// TaskMove places a task in a status column, right after AfterID or right
+// before BeforeID; without either it goes to the end of the column
+type TaskMove struct {
+	Status   string `json:"status" validate:"omitempty,max=20"`
+	AfterID  *int   `json:"after_id"`
+	BeforeID *int   `json:"before_id"`
+}
+
+// TaskExport is a task as written by the export endpoint
+type TaskExport struct {
+	Task
+	Deleted bool `json:"deleted"`
+}
+
+// ImportRowResult reports what happened to one row of an import
+type ImportRowResult struct {
+	Row        int    `json:"row"`
+	ExternalID string `json:"external_id,omitempty"`
+	Status     string `json:"status"` // created, duplicate, invalid or failed
+	Error      string `json:"error,omitempty"`
+	TaskID     int    `json:"task_id,omitempty"`
+}
+
+// ImportReport summarizes an import
+type ImportReport struct {
+	DryRun    bool              `json:"dry_run"`
+	Total     int               `json:"total"`
+	Created   int               `json:"created"`
+	Duplicate int               `json:"duplicate"`
+	Invalid   int               `json:"invalid"`
+	Failed    int               `json:"failed"`
+	Rows      []ImportRowResult `json:"rows"`
 }
 
 // TaskUpdate represents the data needed to update a task
 type TaskUpdate struct {
 	Title       string     `json:"title" validate:"omitempty,min=3,max=255"`
 	Description string     `json:"description"`
-	Status      string     `json:"status" validate:"omitempty,oneof=pending in_progress completed"`
+	Status      string     `json:"status" validate:"omitempty,max=20"`
 	Priority    string     `json:"priority" validate:"omitempty,oneof=low medium high"`
 	Category    string     `json:"category" validate:"omitempty,oneof=Work Personal Shopping Health Education"`
 	DueDate     *time.Time `json:"due_date"`
+	// CustomFields sets the listed custom fields; a null value clears one
+	CustomFields map[string]interface{} `json:"custom_fields,omitempty"`
+	// EstimateMinutes replaces the estimate when set; 0 clears it
+	EstimateMinutes *int `json:"estimate_minutes,omitempty"`
 }
 
-// ValidateStatus checks if the status is valid
+// ValidateStatus checks if the status is a well-formed workflow state name
 func (t *Task) ValidateStatus() bool {
-	validStatuses := map[string]bool{
-		"pending":     true,
-		"in_progress": true,
-		"completed":   true,
-	}
-	return validStatuses[t.Status]
+	return StatusNamePattern.MatchString(t.Status)
 }
 
 // ValidatePriority checks if the priority is valid
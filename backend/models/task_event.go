@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// TaskEvent is an entry in a task's audit history
+type TaskEvent struct {
+	ID         int64                  `json:"id"`
+	TaskID     int                    `json:"task_id"`
+	ActorID    *int                   `json:"actor_id,omitempty"`
+	ActorEmail string                 `json:"actor_email,omitempty"`
+	Action     string                 `json:"action"`
+	Changes    map[string]FieldChange `json:"changes"`
+	CreatedAt  time.Time              `json:"created_at"`
+}
+
+// FieldChange holds the value of a field before and after a change
+type FieldChange struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
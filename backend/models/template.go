@@ -0,0 +1,47 @@
+package models
+
+import "time"
+
+// Template is a reusable tree of tasks. Titles, descriptions and tags may
+// contain placeholders such as {{date}} that are filled in when the
+// template is instantiated.
+type Template struct {
+	ID          int            `json:"id"`
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	Tasks       []TemplateTask `json:"tasks"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+}
+
+// TemplateTask is a task in a template. An empty priority uses the user's
+// default, and an empty category the parent's category or the user's
+// default.
+type TemplateTask struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Priority    string `json:"priority,omitempty"`
+	Category    string `json:"category,omitempty"`
+	// DueOffsetDays sets the due date that many days after the start date
+	DueOffsetDays *int `json:"due_offset_days,omitempty"`
+	// DueTime is the time of day the task is due, HH:MM; midnight when empty
+	DueTime         string         `json:"due_time,omitempty"`
+	Tags            []string       `json:"tags,omitempty"`
+	EstimateMinutes *int           `json:"estimate_minutes,omitempty"`
+	Subtasks        []TemplateTask `json:"subtasks,omitempty"`
+}
+
+// TemplateInput is the data sent to create or replace a template
+type TemplateInput struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	Tasks       []TemplateTask `json:"tasks"`
+}
+
+// TemplateInstantiate is the optional body sent to instantiate a template.
+// StartDate (YYYY-MM-DD) defaults to today in the user's time zone;
+// Variables fill in placeholders other than the built-in ones.
+type TemplateInstantiate struct {
+	StartDate string            `json:"start_date"`
+	Variables map[string]string `json:"variables"`
+}
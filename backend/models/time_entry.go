@@ -0,0 +1,49 @@
+package models
+
+import "time"
+
+// TimeEntry is a span of time tracked on a task. A running timer has no EndedAt.
+type TimeEntry struct {
+	ID        int        `json:"id"`
+	TaskID    int        `json:"task_id"`
+	UserID    int        `json:"user_id"`
+	StartedAt time.Time  `json:"started_at"`
+	EndedAt   *time.Time `json:"ended_at,omitempty"`
+	// DurationSeconds counts up to now while the timer runs
+	DurationSeconds int64     `json:"duration_seconds"`
+	Running         bool      `json:"running"`
+	Note            string    `json:"note,omitempty"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// TimeEntryInput is a manually entered or edited time entry. The end is
+// given either as EndedAt or as DurationMinutes after StartedAt.
+type TimeEntryInput struct {
+	StartedAt       *time.Time `json:"started_at"`
+	EndedAt         *time.Time `json:"ended_at"`
+	DurationMinutes int        `json:"duration_minutes"`
+	Note            string     `json:"note"`
+}
+
+// TimerStart is the optional body sent to start a timer
+type TimerStart struct {
+	Note string `json:"note"`
+}
+
+// TimeReport totals tracked time by category and by day
+type TimeReport struct {
+	From       string           `json:"from"` // first day of the range, YYYY-MM-DD in the user's time zone
+	To         string           `json:"to"`   // last day of the range, inclusive
+	Timezone   string           `json:"timezone"`
+	Total      int64            `json:"total_seconds"`
+	ByCategory map[string]int64 `json:"by_category"`
+	Days       []TimeReportDay  `json:"days"`
+}
+
+// TimeReportDay totals the time tracked on one day, by category
+type TimeReportDay struct {
+	Date       string           `json:"date"`
+	Total      int64            `json:"total_seconds"`
+	ByCategory map[string]int64 `json:"by_category"`
+}
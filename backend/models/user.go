@@ -19,4 +19,32 @@ func HashPassword(password string) (string, error) {
 // CheckPassword compares a plain password with a hash
 func CheckPassword(hash, password string) bool {
 	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
-} 
\ No newline at end of file
+}
+// Profile holds a user's display settings and task defaults
+type Profile struct {
+	ID              int    `json:"id"`
+	Email           string `json:"email"`
+	DisplayName     string `json:"display_name"`
+	Timezone        string `json:"timezone"`   // IANA name such as Europe/Berlin
+	Locale          string `json:"locale"`     // BCP 47 tag such as en-US
+	WeekStart       int    `json:"week_start"` // 0 is Sunday, 1 is Monday
+	DefaultPriority string `json:"default_priority"`
+	DefaultCategory string `json:"default_category,omitempty"`
+	// Working hours, used to check that estimated work fits before due dates
+	WorkDayStart string `json:"work_day_start"` // HH:MM in the profile's time zone
+	WorkDayEnd   string `json:"work_day_end"`
+	WorkDays     []int  `json:"work_days"` // 0 is Sunday, as for WeekStart
+}
+
+// ProfileUpdate changes the fields that are set
+type ProfileUpdate struct {
+	DisplayName     *string `json:"display_name"`
+	Timezone        *string `json:"timezone"`
+	Locale          *string `json:"locale"`
+	WeekStart       *int    `json:"week_start"`
+	DefaultPriority *string `json:"default_priority"`
+	DefaultCategory *string `json:"default_category"` // "" clears it
+	WorkDayStart    *string `json:"work_day_start"`
+	WorkDayEnd      *string `json:"work_day_end"`
+	WorkDays        []int   `json:"work_days"` // left unchanged when absent
+}
@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// View is a saved, named filter over the user's tasks. Query is written in
+// the viewquery language, e.g. "status:pending priority:high due:<7d".
+type View struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	Query     string    `json:"query"`
+	Sort      string    `json:"sort"` // created, updated, due, priority, title or cf.<key>; a leading - reverses
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ViewInput is the data sent to create or change a view
+type ViewInput struct {
+	Name  string `json:"name"`
+	Query string `json:"query"`
+	Sort  string `json:"sort"`
+}
+
+// ViewTasks is a page of the tasks a view matches
+type ViewTasks struct {
+	View   View   `json:"view"`
+	Tasks  []Task `json:"tasks"`
+	Total  int    `json:"total"`
+	Limit  int    `json:"limit"`
+	Offset int    `json:"offset"`
+	// NextOffset is the offset of the next page, omitted on the last one
+	NextOffset *int `json:"next_offset,omitempty"`
+}
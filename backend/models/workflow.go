@@ -0,0 +1,101 @@
+package models
+
+import (
+	"regexp"
+	"time"
+)
+
+// StatusNamePattern is the form of a workflow state name, which is stored as the task status
+var StatusNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,19}$`)
+
+// WorkflowState is one status a task can be in
+type WorkflowState struct {
+	Name  string `json:"name"`
+	Label string `json:"label,omitempty"`
+	Done  bool   `json:"done"` // entering a done state completes the task
+}
+
+// Workflow defines the statuses of the tasks in a category and the moves
+// allowed between them. A task starts in the first state.
+type Workflow struct {
+	ID       int             `json:"id,omitempty"`
+	Category string          `json:"category,omitempty"` // empty for the user's default workflow
+	Name     string          `json:"name"`
+	States   []WorkflowState `json:"states"`
+	// Transitions lists the states reachable from each state; when it is
+	// empty every move is allowed
+	Transitions map[string][]string `json:"transitions,omitempty"`
+	IsBuiltin   bool                `json:"is_builtin,omitempty"`
+	CreatedAt   *time.Time          `json:"created_at,omitempty"`
+	UpdatedAt   *time.Time          `json:"updated_at,omitempty"`
+}
+
+// WorkflowInput is the definition sent to create or replace a workflow
+type WorkflowInput struct {
+	Name        string              `json:"name"`
+	States      []WorkflowState     `json:"states"`
+	Transitions map[string][]string `json:"transitions"`
+}
+
+// DefaultWorkflow is used for categories the user hasn't defined a workflow for
+func DefaultWorkflow() Workflow {
+	return Workflow{
+		Name: "Default",
+		States: []WorkflowState{
+			{Name: "pending", Label: "Pending"},
+			{Name: "in_progress", Label: "In progress"},
+			{Name: "completed", Label: "Completed", Done: true},
+		},
+		IsBuiltin: true,
+	}
+}
+
+// State returns the named state
+func (wf *Workflow) State(name string) (WorkflowState, bool) {
+	for _, s := range wf.States {
+		if s.Name == name {
+			return s, true
+		}
+	}
+	return WorkflowState{}, false
+}
+
+// HasState reports whether the workflow has the named state
+func (wf *Workflow) HasState(name string) bool {
+	_, ok := wf.State(name)
+	return ok
+}
+
+// IsDone reports whether the named state is a done state
+func (wf *Workflow) IsDone(name string) bool {
+	s, ok := wf.State(name)
+	return ok && s.Done
+}
+
+// Allows reports whether a task may move from one state to another
+func (wf *Workflow) Allows(from, to string) bool {
+	if from == to || len(wf.Transitions) == 0 {
+		return true
+	}
+	for _, next := range wf.Transitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// InitialState returns the state new tasks start in
+func (wf *Workflow) InitialState() string {
+	return wf.States[0].Name
+}
+
+// DoneState returns the first done state, or "" if there is none
+func (wf *Workflow) DoneState() string {
+	for _, s := range wf.States {
+		if s.Done {
+			return s.Name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,524 @@
+// Package quickadd parses a single line of free text such as
+// "Pay rent every month on the 1st #Personal !high" into task fields.
+//
+// Recognized tokens are removed from the text and whatever remains becomes
+// the title:
+//
+//	!high !medium !low !1 !2 !3       priority
+//	#Name                             category when Name is one, otherwise a tag
+//	today, tonight, tomorrow          due date
+//	monday ... sunday, next friday    the next such day (today is never "friday")
+//	this friday                       the next such day, counting today
+//	next week / month / year          Monday of next week, the 1st of next month, January 1st
+//	in 3 days, in 2 hours, in a week  relative to now
+//	2024-05-01, may 1st, 1 may 2025   absolute dates; without a year the next one is used
+//	the 1st, on the 15th              the next such day of the month
+//	at 5pm, 9:30am, at 17:00, noon    time of day
+//	every day / week / month / year   recurrence, with an optional count ("every 2 weeks")
+//	every monday, every weekday       weekly recurrence on those days
+//	every month on the 1st            monthly recurrence on that day
+//	daily, weekly, monthly, yearly    recurrence
+//
+// Recurrences are returned as iCalendar RRULE values (RFC 5545).
+package quickadd
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Token describes one recognized part of the input
+type Token struct {
+	Kind  string `json:"kind"` // priority, category, tag, due_date, time or recurrence
+	Text  string `json:"text"`
+	Value string `json:"value"`
+}
+
+// Result is the interpretation of a line
+type Result struct {
+	Title      string
+	Priority   string
+	Category   string
+	Tags       []string
+	DueDate    *time.Time
+	Recurrence string
+	Tokens     []Token
+}
+
+// Options controls parsing
+type Options struct {
+	Now        time.Time      // reference time for relative dates
+	Location   *time.Location // time zone dates are interpreted in; UTC when nil
+	Categories []string       // names #tokens are matched against, case-insensitively
+}
+
+var weekdays = map[string]time.Weekday{
+	"sunday": time.Sunday, "monday": time.Monday, "tuesday": time.Tuesday,
+	"wednesday": time.Wednesday, "thursday": time.Thursday, "friday": time.Friday,
+	"saturday": time.Saturday,
+}
+
+var months = map[string]time.Month{
+	"jan": time.January, "feb": time.February, "mar": time.March, "apr": time.April,
+	"may": time.May, "jun": time.June, "jul": time.July, "aug": time.August,
+	"sep": time.September, "oct": time.October, "nov": time.November, "dec": time.December,
+}
+
+var numberWords = map[string]int{
+	"a": 1, "an": 1, "one": 1, "two": 2, "three": 3, "four": 4, "five": 5,
+	"six": 6, "seven": 7, "eight": 8, "nine": 9, "ten": 10,
+}
+
+var rruleDays = map[time.Weekday]string{
+	time.Sunday: "SU", time.Monday: "MO", time.Tuesday: "TU", time.Wednesday: "WE",
+	time.Thursday: "TH", time.Friday: "FR", time.Saturday: "SA",
+}
+
+const (
+	weekdayPattern = `(monday|tuesday|wednesday|thursday|friday|saturday|sunday)`
+	monthPattern   = `(jan(?:uary)?|feb(?:ruary)?|mar(?:ch)?|apr(?:il)?|may|june?|july?|aug(?:ust)?|sep(?:t(?:ember)?)?|oct(?:ober)?|nov(?:ember)?|dec(?:ember)?)`
+	ordinalPattern = `(\d{1,2})(?:st|nd|rd|th)?`
+	datePrefix     = `(?:(?:due\s+)?(?:on|by)\s+|due\s+)?`
+)
+
+// rule is one pattern and what to do with a match. Submatches are passed
+// lowercased; apply returns false to leave the text in the title.
+type rule struct {
+	re    *regexp.Regexp
+	apply func(p *parser, m []string) bool
+}
+
+func compile(pattern string) *regexp.Regexp {
+	return regexp.MustCompile(`(?i)(?:^|\s)(` + pattern + `)(?:$|[\s,.;!?])`)
+}
+
+// parser accumulates the result while the rules run
+type parser struct {
+	opts Options
+	res  Result
+
+	current string // the original text of the match being applied
+
+	date     *time.Time // a calendar day, at midnight in opts.Location
+	instant  *time.Time // an exact time, from "in 2 hours"
+	hour     int
+	minute   int
+	hasTime  bool
+	timeText string
+	dateText string
+}
+
+var rules = []rule{
+	// Priority
+	{compile(`!(high|medium|low|1|2|3)`), func(p *parser, m []string) bool {
+		if p.res.Priority != "" {
+			return false
+		}
+		p.res.Priority = map[string]string{"1": "high", "2": "medium", "3": "low"}[m[1]]
+		if p.res.Priority == "" {
+			p.res.Priority = m[1]
+		}
+		p.token("priority", p.res.Priority)
+		return true
+	}},
+
+	// Category or tag
+	{compile(`#([\p{L}\p{N}_-]+)`), func(p *parser, m []string) bool {
+		for _, category := range p.opts.Categories {
+			if strings.EqualFold(category, m[1]) && p.res.Category == "" {
+				p.res.Category = category
+				p.token("category", category)
+				return true
+			}
+		}
+		tag := strings.TrimPrefix(p.current, "#")
+		p.res.Tags = append(p.res.Tags, tag)
+		p.token("tag", tag)
+		return true
+	}},
+
+	// Recurrence; these run before dates so "every monday" isn't read as a date
+	{compile(`every\s+weekday`), func(p *parser, m []string) bool {
+		if !p.recur("FREQ=WEEKLY;BYDAY=MO,TU,WE,TH,FR") {
+			return false
+		}
+		day := p.today()
+		for day.Weekday() == time.Saturday || day.Weekday() == time.Sunday {
+			day = day.AddDate(0, 0, 1)
+		}
+		p.setDate(day)
+		return true
+	}},
+	{compile(`every\s+` + weekdayPattern + `((?:\s*(?:,|and|&)\s*` + weekdayPattern + `)*)`), func(p *parser, m []string) bool {
+		var days []time.Weekday
+		for name, day := range weekdays {
+			if strings.Contains(m[0], name) {
+				days = append(days, day)
+			}
+		}
+		sort.Slice(days, func(i, j int) bool { return days[i] < days[j] })
+		var codes []string
+		for _, day := range days {
+			codes = append(codes, rruleDays[day])
+		}
+		if !p.recur("FREQ=WEEKLY;BYDAY=" + strings.Join(codes, ",")) {
+			return false
+		}
+		// The first occurrence is the earliest of the days, counting today
+		first := p.today().AddDate(0, 0, 7)
+		for _, day := range days {
+			if next := p.nextWeekday(day, true); next.Before(first) {
+				first = next
+			}
+		}
+		p.setDate(first)
+		return true
+	}},
+	{compile(`every\s+(other\s+|\d+\s+)?(day|week|month|year)s?(?:\s+on\s+(?:the\s+)?` + ordinalPattern + `)?`), func(p *parser, m []string) bool {
+		interval := 1
+		if strings.TrimSpace(m[1]) == "other" {
+			interval = 2
+		} else if n, err := strconv.Atoi(strings.TrimSpace(m[1])); err == nil && n > 0 {
+			interval = n
+		}
+		freq := map[string]string{"day": "DAILY", "week": "WEEKLY", "month": "MONTHLY", "year": "YEARLY"}[m[2]]
+		rrule := "FREQ=" + freq
+		if interval > 1 {
+			rrule += ";INTERVAL=" + strconv.Itoa(interval)
+		}
+		monthDay := 0
+		if m[3] != "" {
+			monthDay, _ = strconv.Atoi(m[3])
+			if freq != "MONTHLY" || monthDay < 1 || monthDay > 31 {
+				return false
+			}
+			rrule += ";BYMONTHDAY=" + strconv.Itoa(monthDay)
+		}
+		if !p.recur(rrule) {
+			return false
+		}
+		if monthDay > 0 {
+			p.setDate(p.nextMonthDay(monthDay, true))
+		} else if freq == "DAILY" {
+			p.setDate(p.today())
+		}
+		return true
+	}},
+	{compile(`daily|weekly|monthly|yearly|annually`), func(p *parser, m []string) bool {
+		freq := map[string]string{"daily": "DAILY", "weekly": "WEEKLY", "monthly": "MONTHLY", "yearly": "YEARLY", "annually": "YEARLY"}[m[0]]
+		return p.recur("FREQ=" + freq)
+	}},
+
+	// Time of day
+	{compile(`(?:at\s+)?(\d{1,2})(?::(\d{2}))?\s*(am|pm)`), func(p *parser, m []string) bool {
+		hour, _ := strconv.Atoi(m[1])
+		minute, _ := strconv.Atoi(m[2])
+		if hour < 1 || hour > 12 || minute > 59 {
+			return false
+		}
+		if m[3] == "pm" && hour != 12 {
+			hour += 12
+		} else if m[3] == "am" && hour == 12 {
+			hour = 0
+		}
+		return p.setTime(hour, minute)
+	}},
+	{compile(`at\s+(\d{1,2}):(\d{2})`), func(p *parser, m []string) bool {
+		hour, _ := strconv.Atoi(m[1])
+		minute, _ := strconv.Atoi(m[2])
+		if hour > 23 || minute > 59 {
+			return false
+		}
+		return p.setTime(hour, minute)
+	}},
+	{compile(`(?:at\s+)?(noon|midnight)`), func(p *parser, m []string) bool {
+		if m[1] == "noon" {
+			return p.setTime(12, 0)
+		}
+		return p.setTime(0, 0)
+	}},
+
+	// Dates
+	{compile(datePrefix + `(\d{4})-(\d{2})-(\d{2})`), func(p *parser, m []string) bool {
+		year, _ := strconv.Atoi(m[1])
+		month, _ := strconv.Atoi(m[2])
+		day, _ := strconv.Atoi(m[3])
+		date, ok := p.validDate(year, time.Month(month), day)
+		return ok && p.setDate(date)
+	}},
+	{compile(datePrefix + monthPattern + `\s+` + ordinalPattern + `(?:,?\s+(\d{4}))?`), func(p *parser, m []string) bool {
+		day, _ := strconv.Atoi(m[2])
+		return p.monthDay(months[m[1][:3]], day, m[3])
+	}},
+	{compile(datePrefix + `(?:the\s+)?` + ordinalPattern + `\s+(?:of\s+)?` + monthPattern + `(?:,?\s+(\d{4}))?`), func(p *parser, m []string) bool {
+		day, _ := strconv.Atoi(m[1])
+		return p.monthDay(months[m[2][:3]], day, m[3])
+	}},
+	{compile(datePrefix + `(today|tonight|tomorrow|tmrw)`), func(p *parser, m []string) bool {
+		day := p.today()
+		if m[1] == "tomorrow" || m[1] == "tmrw" {
+			day = day.AddDate(0, 0, 1)
+		}
+		if !p.setDate(day) {
+			return false
+		}
+		if m[1] == "tonight" && !p.hasTime {
+			p.hour, p.minute, p.hasTime = 20, 0, true
+		}
+		return true
+	}},
+	{compile(datePrefix + `(next\s+|this\s+)?` + weekdayPattern), func(p *parser, m []string) bool {
+		return p.setDate(p.nextWeekday(weekdays[m[2]], strings.HasPrefix(m[1], "this")))
+	}},
+	{compile(datePrefix + `next\s+(week|month|year)`), func(p *parser, m []string) bool {
+		today := p.today()
+		var day time.Time
+		switch m[1] {
+		case "week":
+			day = p.nextWeekday(time.Monday, false)
+		case "month":
+			day = time.Date(today.Year(), today.Month()+1, 1, 0, 0, 0, 0, p.loc())
+		case "year":
+			day = time.Date(today.Year()+1, time.January, 1, 0, 0, 0, 0, p.loc())
+		}
+		return p.setDate(day)
+	}},
+	{compile(`in\s+(\d+|an?|one|two|three|four|five|six|seven|eight|nine|ten)\s+(minute|min|hour|hr|day|week|month|year)s?`), func(p *parser, m []string) bool {
+		n, err := strconv.Atoi(m[1])
+		if err != nil {
+			n = numberWords[m[1]]
+		}
+		if p.date != nil || p.instant != nil || n <= 0 {
+			return false
+		}
+		now := p.now()
+		switch m[2] {
+		case "minute", "min":
+			t := now.Add(time.Duration(n) * time.Minute)
+			p.instant = &t
+		case "hour", "hr":
+			t := now.Add(time.Duration(n) * time.Hour)
+			p.instant = &t
+		case "day":
+			return p.setDate(p.today().AddDate(0, 0, n))
+		case "week":
+			return p.setDate(p.today().AddDate(0, 0, 7*n))
+		case "month":
+			return p.setDate(p.today().AddDate(0, n, 0))
+		case "year":
+			return p.setDate(p.today().AddDate(n, 0, 0))
+		}
+		p.dateText = p.current
+		return true
+	}},
+	{compile(datePrefix + `the\s+` + ordinalPattern), func(p *parser, m []string) bool {
+		day, _ := strconv.Atoi(m[1])
+		if day < 1 || day > 31 {
+			return false
+		}
+		return p.setDate(p.nextMonthDay(day, true))
+	}},
+}
+
+// Parse interprets a line of text
+func Parse(text string, opts Options) Result {
+	if opts.Location == nil {
+		opts.Location = time.UTC
+	}
+	if opts.Now.IsZero() {
+		opts.Now = time.Now()
+	}
+	p := &parser{opts: opts}
+
+	consumed := make([]bool, len(text))
+	for _, r := range rules {
+		// Matches are searched for one at a time, resuming right after each
+		// token, so the separator it ended on can start the next match
+		for pos := 0; pos < len(text); {
+			base := pos
+			loc := r.re.FindStringSubmatchIndex(text[base:])
+			if loc == nil {
+				break
+			}
+			// Group 1 is the token without the surrounding separators
+			start, end := base+loc[2], base+loc[3]
+			pos = end
+			if overlaps(consumed, start, end) {
+				continue
+			}
+			m := []string{strings.ToLower(text[start:end])}
+			for i := 4; i < len(loc); i += 2 {
+				if loc[i] < 0 {
+					m = append(m, "")
+				} else {
+					m = append(m, strings.ToLower(text[base+loc[i]:base+loc[i+1]]))
+				}
+			}
+			p.current = text[start:end]
+			if r.apply(p, m) {
+				for i := start; i < end; i++ {
+					consumed[i] = true
+				}
+			}
+		}
+	}
+
+	p.resolveDueDate()
+
+	var title strings.Builder
+	for i := 0; i < len(text); i++ {
+		if consumed[i] {
+			title.WriteByte(' ')
+		} else {
+			title.WriteByte(text[i])
+		}
+	}
+	p.res.Title = strings.Join(strings.Fields(title.String()), " ")
+	p.res.Title = strings.TrimRight(p.res.Title, " ,;")
+	return p.res
+}
+
+func overlaps(consumed []bool, start, end int) bool {
+	for i := start; i < end; i++ {
+		if consumed[i] {
+			return true
+		}
+	}
+	return false
+}
+
+// Rules rerun their regexps on overlapping text, so each setter ignores later
+// matches once its field is set
+
+func (p *parser) token(kind, value string) {
+	p.res.Tokens = append(p.res.Tokens, Token{Kind: kind, Text: p.current, Value: value})
+}
+
+func (p *parser) recur(rrule string) bool {
+	if p.res.Recurrence != "" {
+		return false
+	}
+	p.res.Recurrence = rrule
+	p.token("recurrence", rrule)
+	return true
+}
+
+func (p *parser) setDate(day time.Time) bool {
+	if p.date != nil || p.instant != nil {
+		return false
+	}
+	p.date = &day
+	p.dateText = p.current
+	return true
+}
+
+func (p *parser) setTime(hour, minute int) bool {
+	if p.hasTime {
+		return false
+	}
+	p.hour, p.minute, p.hasTime = hour, minute, true
+	p.timeText = p.current
+	return true
+}
+
+// monthDay sets a date given by month and day with an optional year
+func (p *parser) monthDay(month time.Month, day int, yearText string) bool {
+	today := p.today()
+	year := today.Year()
+	if yearText != "" {
+		year, _ = strconv.Atoi(yearText)
+	}
+	date, ok := p.validDate(year, month, day)
+	if !ok {
+		return false
+	}
+	if yearText == "" && date.Before(today) {
+		date, ok = p.validDate(year+1, month, day)
+		if !ok {
+			return false
+		}
+	}
+	return p.setDate(date)
+}
+
+// validDate builds a date, rejecting days that don't exist such as February 30th
+func (p *parser) validDate(year int, month time.Month, day int) (time.Time, bool) {
+	date := time.Date(year, month, day, 0, 0, 0, 0, p.loc())
+	return date, date.Month() == month && date.Day() == day
+}
+
+func (p *parser) loc() *time.Location {
+	return p.opts.Location
+}
+
+func (p *parser) now() time.Time {
+	return p.opts.Now.In(p.loc())
+}
+
+func (p *parser) today() time.Time {
+	now := p.now()
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, p.loc())
+}
+
+// nextWeekday returns the next given weekday, which may be today if includeToday is set
+func (p *parser) nextWeekday(day time.Weekday, includeToday bool) time.Time {
+	today := p.today()
+	diff := (int(day) - int(today.Weekday()) + 7) % 7
+	if diff == 0 && !includeToday {
+		diff = 7
+	}
+	return today.AddDate(0, 0, diff)
+}
+
+// nextMonthDay returns the next date falling on the given day of the month,
+// skipping months too short to have it
+func (p *parser) nextMonthDay(day int, includeToday bool) time.Time {
+	today := p.today()
+	for i := 0; i < 12; i++ {
+		date, ok := p.validDate(today.Year(), today.Month()+time.Month(i), day)
+		if !ok {
+			continue
+		}
+		if date.After(today) || (includeToday && date.Equal(today)) {
+			return date
+		}
+	}
+	return today
+}
+
+// resolveDueDate combines the date and time into the due date
+func (p *parser) resolveDueDate() {
+	var due time.Time
+	switch {
+	case p.instant != nil:
+		due = *p.instant
+	case p.date != nil:
+		due = *p.date
+		if p.hasTime {
+			due = time.Date(due.Year(), due.Month(), due.Day(), p.hour, p.minute, 0, 0, p.loc())
+		}
+	case p.hasTime:
+		// A time alone means the next time the clock shows it
+		today := p.today()
+		due = time.Date(today.Year(), today.Month(), today.Day(), p.hour, p.minute, 0, 0, p.loc())
+		if !due.After(p.now()) {
+			due = due.AddDate(0, 0, 1)
+		}
+	default:
+		return
+	}
+	p.res.DueDate = &due
+
+	p.current = p.dateText
+	if p.current != "" {
+		p.token("due_date", due.Format("2006-01-02"))
+	}
+	p.current = p.timeText
+	if p.hasTime && p.current != "" {
+		p.token("time", fmt.Sprintf("%02d:%02d", p.hour, p.minute))
+	}
+}
@@ -0,0 +1,158 @@
+package quickadd
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// now is Tuesday, March 10th 2026 at 10:00
+var now = time.Date(2026, 3, 10, 10, 0, 0, 0, time.UTC)
+
+func parse(text string) Result {
+	return Parse(text, Options{Now: now, Categories: []string{"Work", "Personal"}})
+}
+
+func date(month time.Month, day, hour, minute int) *time.Time {
+	t := time.Date(2026, month, day, hour, minute, 0, 0, time.UTC)
+	return &t
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		text       string
+		title      string
+		priority   string
+		category   string
+		tags       []string
+		due        *time.Time
+		recurrence string
+	}{
+		{text: "Buy milk", title: "Buy milk"},
+		{text: "Call mom !high", title: "Call mom", priority: "high"},
+		{text: "Call mom !2", title: "Call mom", priority: "medium"},
+		{text: "Report #work #q1", title: "Report", category: "Work", tags: []string{"q1"}},
+		{text: "Report #Work #Personal", title: "Report", category: "Work", tags: []string{"Personal"}},
+		{text: "Dentist tomorrow at 3pm", title: "Dentist", due: date(3, 11, 15, 0)},
+		{text: "Dinner tonight", title: "Dinner", due: date(3, 10, 20, 0)},
+		{text: "Standup at 9:30am", title: "Standup", due: date(3, 11, 9, 30)},
+		{text: "Lunch at noon", title: "Lunch", due: date(3, 10, 12, 0)},
+		{text: "Review friday", title: "Review", due: date(3, 13, 0, 0)},
+		{text: "Review next tuesday", title: "Review", due: date(3, 17, 0, 0)},
+		{text: "Review this tuesday", title: "Review", due: date(3, 10, 0, 0)},
+		{text: "Plan next month", title: "Plan", due: date(4, 1, 0, 0)},
+		{text: "Ship in 3 days", title: "Ship", due: date(3, 13, 0, 0)},
+		{text: "Ping in 2 hours", title: "Ping", due: date(3, 10, 12, 0)},
+		{text: "Taxes due by 2026-04-15", title: "Taxes", due: date(4, 15, 0, 0)},
+		{text: "Party on May 1st at 18:00", title: "Party", due: date(5, 1, 18, 0)},
+		{text: "Renew 1st of march", title: "Renew", due: func() *time.Time { t := time.Date(2027, 3, 1, 0, 0, 0, 0, time.UTC); return &t }()},
+		{text: "Pay rent every month on the 1st #Personal !high", title: "Pay rent", priority: "high", category: "Personal",
+			due: date(4, 1, 0, 0), recurrence: "FREQ=MONTHLY;BYMONTHDAY=1"},
+		{text: "Gym every monday and thursday", title: "Gym", due: date(3, 12, 0, 0), recurrence: "FREQ=WEEKLY;BYDAY=MO,TH"},
+		{text: "Water plants every other day", title: "Water plants", due: date(3, 10, 0, 0), recurrence: "FREQ=DAILY;INTERVAL=2"},
+		{text: "Backup weekly", title: "Backup", recurrence: "FREQ=WEEKLY"},
+		{text: "Stretch every weekday", title: "Stretch", due: date(3, 10, 0, 0), recurrence: "FREQ=WEEKLY;BYDAY=MO,TU,WE,TH,FR"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			got := parse(tt.text)
+			if got.Title != tt.title {
+				t.Errorf("title %q, want %q", got.Title, tt.title)
+			}
+			if got.Priority != tt.priority {
+				t.Errorf("priority %q, want %q", got.Priority, tt.priority)
+			}
+			if got.Category != tt.category {
+				t.Errorf("category %q, want %q", got.Category, tt.category)
+			}
+			if !reflect.DeepEqual(got.Tags, tt.tags) {
+				t.Errorf("tags %q, want %q", got.Tags, tt.tags)
+			}
+			if (got.DueDate == nil) != (tt.due == nil) || (got.DueDate != nil && !got.DueDate.Equal(*tt.due)) {
+				t.Errorf("due %v, want %v", got.DueDate, tt.due)
+			}
+			if got.Recurrence != tt.recurrence {
+				t.Errorf("recurrence %q, want %q", got.Recurrence, tt.recurrence)
+			}
+		})
+	}
+}
+
+// TestParseMalformed checks that text that only looks like a token is left
+// in the title rather than misread
+func TestParseMalformed(t *testing.T) {
+	tests := []struct {
+		text  string
+		title string
+	}{
+		{"", ""},
+		{"   ", ""},
+		{"Fix bug !urgent", "Fix bug !urgent"},
+		{"Fix bug!high", "Fix bug!high"},
+		{"Order on feb 30", "Order on feb 30"},
+		{"Call at 25:00", "Call at 25:00"},
+		{"Call at 13pm", "Call at 13pm"},
+		{"Call at 9:75am", "Call at 9:75am"},
+		{"Read 2026-13-01", "Read 2026-13-01"},
+		{"Read 2026-02-29", "Read 2026-02-29"},
+		{"Ship in 0 days", "Ship in 0 days"},
+		{"Pay the 32nd", "Pay the 32nd"},
+		{"Email about mondays", "Email about mondays"},
+		{"Fix #", "Fix #"},
+	}
+	for _, tt := range tests {
+		got := parse(tt.text)
+		if got.Title != tt.title {
+			t.Errorf("Parse(%q) title %q, want %q", tt.text, got.Title, tt.title)
+		}
+		if got.DueDate != nil || got.Priority != "" || got.Recurrence != "" {
+			t.Errorf("Parse(%q) = %+v, want no fields set", tt.text, got)
+		}
+	}
+}
+
+// TestParseFirstWins checks that a repeated token only sets its field once
+func TestParseFirstWins(t *testing.T) {
+	got := parse("Task !low !high tomorrow friday daily weekly")
+	if got.Priority != "low" || got.Recurrence != "FREQ=DAILY" || !got.DueDate.Equal(*date(3, 11, 0, 0)) {
+		t.Errorf("got %+v", got)
+	}
+	if got.Title != "Task !high friday weekly" {
+		t.Errorf("title %q", got.Title)
+	}
+}
+
+func TestParseTimeZone(t *testing.T) {
+	loc := time.FixedZone("UTC-8", -8*60*60)
+	// 10:00 UTC is 02:00 in loc, still March 10th
+	got := Parse("Call tomorrow at 9am", Options{Now: now, Location: loc})
+	want := time.Date(2026, 3, 11, 9, 0, 0, 0, loc)
+	if got.DueDate == nil || !got.DueDate.Equal(want) {
+		t.Errorf("due %v, want %v", got.DueDate, want)
+	}
+}
+
+func TestParseUnusualText(t *testing.T) {
+	inputs := []string{
+		"\xff\xfe broken utf-8 tomorrow",
+		"Café 🎉 #über !high",
+		strings.Repeat("every ", 200),
+		strings.Repeat("#a ", 300),
+		"<script>alert(1)</script> tomorrow",
+	}
+	for _, text := range inputs {
+		got := parse(text)
+		if len(got.Title) > len(text) {
+			t.Errorf("Parse(%.40q) title grew to %d bytes", text, len(got.Title))
+		}
+		for _, token := range got.Tokens {
+			if !strings.Contains(text, token.Text) {
+				t.Errorf("Parse(%.40q) token %q isn't in the input", text, token.Text)
+			}
+		}
+	}
+	if got := parse("<script>alert(1)</script> tomorrow"); got.Title != "<script>alert(1)</script>" {
+		t.Errorf("title %q; escaping is left to whatever renders it", got.Title)
+	}
+}
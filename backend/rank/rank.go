@@ -0,0 +1,159 @@
+// Package rank generates sort keys for manually ordered lists.
+//
+// A key is a string of base-36 digits (0-9a-z) read as a fraction: "i" is
+// about one half, "0i" about one fiftieth. Keys compare correctly with plain
+// byte-wise string comparison (COLLATE "C" in PostgreSQL), and a new key can
+// always be made between two others, so moving an item only rewrites that
+// item. Keys never end in "0", which keeps room below every key.
+//
+// Keys get longer when items keep being inserted at the same spot; Spread
+// makes fresh short keys for renumbering a list when that happens.
+package rank
+
+import (
+	"errors"
+	"strings"
+)
+
+const digits = "0123456789abcdefghijklmnopqrstuvwxyz"
+
+// ErrOrder is returned when the lower bound is not below the upper bound
+var ErrOrder = errors.New("rank: lower bound must sort before upper bound")
+
+// ErrKey is returned for keys with characters outside 0-9a-z or a trailing 0
+var ErrKey = errors.New("rank: invalid key")
+
+// Valid reports whether key can be used as a bound
+func Valid(key string) bool {
+	if key == "" || key[len(key)-1] == '0' {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if strings.IndexByte(digits, key[i]) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Between returns a key that sorts after a and before b. An empty a means
+// no lower bound and an empty b means no upper bound.
+func Between(a, b string) (string, error) {
+	if (a != "" && !Valid(a)) || (b != "" && !Valid(b)) {
+		return "", ErrKey
+	}
+	if b != "" && a >= b {
+		return "", ErrOrder
+	}
+	switch {
+	case a == "" && b == "":
+		return string(digits[len(digits)/2]), nil
+	case b == "":
+		return after(a), nil
+	case a == "":
+		return before(b), nil
+	}
+	return midpoint(a, b), nil
+}
+
+// after returns a short key above a. Stepping by one digit rather than
+// halving the gap keeps keys short when items keep being added at the end.
+func after(a string) string {
+	for i := 0; i < len(a); i++ {
+		if d := strings.IndexByte(digits, a[i]); d < len(digits)-1 {
+			return a[:i] + string(digits[d+1])
+		}
+	}
+	return a + string(digits[1])
+}
+
+// before returns a short key below b, stepping down like after steps up
+func before(b string) string {
+	for i := 0; i < len(b); i++ {
+		switch d := strings.IndexByte(digits, b[i]); {
+		case d > 1:
+			return b[:i] + string(digits[d-1])
+		case d == 1 && i+1 < len(b):
+			return b[:i+1]
+		case d == 1:
+			return b[:i] + string(digits[0]) + string(digits[len(digits)-1])
+		}
+	}
+	// Unreachable for valid keys, which don't end in 0
+	return b
+}
+
+// midpoint finds a key between a and b, where a < b, neither ends in 0 and
+// an empty b is unbounded
+func midpoint(a, b string) string {
+	if b != "" {
+		// Copy the prefix the two share, reading a as padded with zeros
+		n := 0
+		for n < len(b) && digitAt(a, n) == b[n] {
+			n++
+		}
+		if n > 0 {
+			rest := ""
+			if n < len(a) {
+				rest = a[n:]
+			}
+			return b[:n] + midpoint(rest, b[n:])
+		}
+	}
+
+	lo := 0
+	if a != "" {
+		lo = strings.IndexByte(digits, a[0])
+	}
+	hi := len(digits)
+	if b != "" {
+		hi = strings.IndexByte(digits, b[0])
+	}
+	if hi-lo > 1 {
+		return string(digits[(lo+hi+1)/2])
+	}
+	// The first digits are adjacent. If b has more digits, its first digit
+	// alone sorts between; otherwise keep a's first digit and go deeper.
+	if len(b) > 1 {
+		return b[:1]
+	}
+	rest := ""
+	if len(a) > 1 {
+		rest = a[1:]
+	}
+	return string(digits[lo]) + midpoint(rest, "")
+}
+
+// digitAt returns the i-th digit of key, or 0 past its end
+func digitAt(key string, i int) byte {
+	if i < len(key) {
+		return key[i]
+	}
+	return digits[0]
+}
+
+// Spread returns n keys in increasing order spaced evenly over the key
+// space, for renumbering a list whose keys have grown too long
+func Spread(n int) []string {
+	width := 1
+	for capacity := len(digits) - 1; capacity < n; capacity *= len(digits) {
+		width++
+	}
+	total := 1
+	for i := 0; i < width; i++ {
+		total *= len(digits)
+	}
+
+	keys := make([]string, n)
+	for i := range keys {
+		// Evenly spaced values in (0, total), written with width digits
+		v := (i + 1) * total / (n + 1)
+		buf := make([]byte, width)
+		for j := width - 1; j >= 0; j-- {
+			buf[j] = digits[v%len(digits)]
+			v /= len(digits)
+		}
+		keys[i] = strings.TrimRight(string(buf), "0")
+	}
+	return keys
+}
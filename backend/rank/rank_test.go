@@ -0,0 +1,160 @@
+package rank
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestValid(t *testing.T) {
+	tests := []struct {
+		key  string
+		want bool
+	}{
+		{"i", true},
+		{"1", true},
+		{"z", true},
+		{"zzz", true},
+		{"a0i", true},
+		{"", false},
+		{"0", false},
+		{"a0", false},
+		{"A", false},
+		{"a-b", false},
+		{"é", false},
+	}
+	for _, tt := range tests {
+		if got := Valid(tt.key); got != tt.want {
+			t.Errorf("Valid(%q) = %v, want %v", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestBetween(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want string
+	}{
+		{"", "", "i"},
+		{"i", "", "j"},
+		{"", "i", "h"},
+		{"a", "b", "ai"},
+		{"a", "a1", "a0i"},
+		{"1", "2", "1i"},
+		{"", "1", "0z"},
+		{"", "01", "00z"},
+		{"", "001", "000z"},
+		{"z", "", "z1"},
+		{"zz", "", "zz1"},
+		{"y", "z", "yi"},
+		{"yz", "z", "yzi"},
+		{"1", "z", "i"},
+	}
+	for _, tt := range tests {
+		got, err := Between(tt.a, tt.b)
+		if err != nil {
+			t.Errorf("Between(%q, %q): %v", tt.a, tt.b, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Between(%q, %q) = %q, want %q", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestBetweenErrors(t *testing.T) {
+	tests := []struct {
+		a, b string
+		err  error
+	}{
+		{"b", "a", ErrOrder},
+		{"a", "a", ErrOrder},
+		{"a1", "a", ErrOrder},
+		{"a0", "b", ErrKey},
+		{"a", "b0", ErrKey},
+		{"A", "", ErrKey},
+		{"", "0", ErrKey},
+	}
+	for _, tt := range tests {
+		if _, err := Between(tt.a, tt.b); err != tt.err {
+			t.Errorf("Between(%q, %q): got %v, want %v", tt.a, tt.b, err, tt.err)
+		}
+	}
+}
+
+// randomKey returns a valid key of one to four digits, biased towards the
+// ends of the alphabet where carries and borrows happen
+func randomKey(r *rand.Rand) string {
+	buf := make([]byte, 1+r.Intn(4))
+	for i := range buf {
+		switch r.Intn(4) {
+		case 0:
+			buf[i] = digits[0]
+		case 1:
+			buf[i] = digits[len(digits)-1]
+		default:
+			buf[i] = digits[r.Intn(len(digits))]
+		}
+	}
+	if buf[len(buf)-1] == digits[0] {
+		buf[len(buf)-1] = digits[1]
+	}
+	return string(buf)
+}
+
+func TestBetweenOrders(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	check := func(a, b string) {
+		t.Helper()
+		got, err := Between(a, b)
+		if err != nil {
+			t.Fatalf("Between(%q, %q): %v", a, b, err)
+		}
+		if !Valid(got) || (a != "" && got <= a) || (b != "" && got >= b) {
+			t.Fatalf("Between(%q, %q) = %q, want a valid key strictly between", a, b, got)
+		}
+	}
+	for i := 0; i < 10000; i++ {
+		a, b := randomKey(r), randomKey(r)
+		if a == b {
+			continue
+		}
+		if a > b {
+			a, b = b, a
+		}
+		check(a, b)
+		check(a, "")
+		check("", b)
+	}
+
+	// Repeatedly inserting at the same spot must keep working
+	lo, hi := "", ""
+	for i := 0; i < 200; i++ {
+		mid, err := Between(lo, hi)
+		if err != nil {
+			t.Fatalf("Between(%q, %q): %v", lo, hi, err)
+		}
+		check(lo, hi)
+		if i%2 == 0 {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+}
+
+func TestSpread(t *testing.T) {
+	for _, n := range []int{0, 1, 2, 35, 36, 100, 1260, 1261, 5000} {
+		keys := Spread(n)
+		if len(keys) != n {
+			t.Fatalf("Spread(%d) returned %d keys", n, len(keys))
+		}
+		for i, key := range keys {
+			if !Valid(key) {
+				t.Fatalf("Spread(%d)[%d] = %q is not valid", n, i, key)
+			}
+			if i > 0 && keys[i-1] >= key {
+				t.Fatalf("Spread(%d): %q is not below %q", n, keys[i-1], key)
+			}
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// s3Stub is a minimal S3-compatible server keeping objects in memory
+type s3Stub struct {
+	t       *testing.T
+	mu      sync.Mutex
+	objects map[string]string
+	types   map[string]string
+	fail    bool
+}
+
+var authPattern = regexp.MustCompile(`^AWS4-HMAC-SHA256 Credential=AKID/\d{8}/eu-west-1/s3/aws4_request, SignedHeaders=host;x-amz-content-sha256;x-amz-date, Signature=[0-9a-f]{64}$`)
+
+func (s *s3Stub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !authPattern.MatchString(r.Header.Get("Authorization")) {
+		s.t.Errorf("unexpected Authorization header %q", r.Header.Get("Authorization"))
+		http.Error(w, "SignatureDoesNotMatch", http.StatusForbidden)
+		return
+	}
+	if r.Header.Get("X-Amz-Date") == "" || r.Header.Get("X-Amz-Content-Sha256") != unsignedPayload {
+		s.t.Errorf("missing signing headers: %v", r.Header)
+	}
+	if s.fail {
+		http.Error(w, "InternalError", http.StatusInternalServerError)
+		return
+	}
+	if !strings.HasPrefix(r.URL.Path, "/bucket/") {
+		http.Error(w, "NoSuchBucket", http.StatusNotFound)
+		return
+	}
+	key := strings.TrimPrefix(r.URL.Path, "/bucket/")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch r.Method {
+	case http.MethodPut:
+		data, _ := io.ReadAll(r.Body)
+		if r.ContentLength != int64(len(data)) {
+			s.t.Errorf("Content-Length %d, body has %d bytes", r.ContentLength, len(data))
+		}
+		s.objects[key] = string(data)
+		s.types[key] = r.Header.Get("Content-Type")
+	case http.MethodGet:
+		data, ok := s.objects[key]
+		if !ok {
+			http.Error(w, "NoSuchKey", http.StatusNotFound)
+			return
+		}
+		io.WriteString(w, data)
+	case http.MethodDelete:
+		if _, ok := s.objects[key]; !ok {
+			http.Error(w, "NoSuchKey", http.StatusNotFound)
+			return
+		}
+		delete(s.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func newS3Stub(t *testing.T) (*s3Stub, *S3Store) {
+	stub := &s3Stub{t: t, objects: map[string]string{}, types: map[string]string{}}
+	server := httptest.NewServer(stub)
+	t.Cleanup(server.Close)
+	store := &S3Store{
+		Endpoint:  server.URL + "/",
+		Bucket:    "bucket",
+		Region:    "eu-west-1",
+		AccessKey: "AKID",
+		SecretKey: "secret",
+		Client:    server.Client(),
+	}
+	return stub, store
+}
+
+func TestS3StoreRoundTrip(t *testing.T) {
+	stub, store := newS3Stub(t)
+	ctx := context.Background()
+	key := "sha256/ab/abcdef"
+
+	body := "hello, attachment"
+	if err := store.Put(ctx, key, strings.NewReader(body), int64(len(body)), "text/plain"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if got := stub.objects[key]; got != body {
+		t.Fatalf("stored %q, want %q", got, body)
+	}
+	if got := stub.types[key]; got != "text/plain" {
+		t.Errorf("stored content type %q, want text/plain", got)
+	}
+
+	r, err := store.Get(ctx, key)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	data, _ := io.ReadAll(r)
+	r.Close()
+	if string(data) != body {
+		t.Errorf("Get returned %q, want %q", data, body)
+	}
+
+	if err := store.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, ok := stub.objects[key]; ok {
+		t.Error("object still stored after Delete")
+	}
+}
+
+func TestS3StoreMissing(t *testing.T) {
+	_, store := newS3Stub(t)
+	ctx := context.Background()
+
+	if _, err := store.Get(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get of a missing key returned %v, want ErrNotFound", err)
+	}
+	if err := store.Delete(ctx, "missing"); err != nil {
+		t.Errorf("Delete of a missing key returned %v, want nil", err)
+	}
+}
+
+func TestS3StoreServerError(t *testing.T) {
+	stub, store := newS3Stub(t)
+	stub.fail = true
+	ctx := context.Background()
+
+	err := store.Put(ctx, "key", strings.NewReader("x"), 1, "")
+	if err == nil || !strings.Contains(err.Error(), "InternalError") {
+		t.Errorf("Put against a failing server returned %v, want the server's error", err)
+	}
+	if _, err := store.Get(ctx, "key"); err == nil || errors.Is(err, ErrNotFound) {
+		t.Errorf("Get against a failing server returned %v, want an error other than ErrNotFound", err)
+	}
+}
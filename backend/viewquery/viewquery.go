@@ -0,0 +1,364 @@
+// Package viewquery parses the filter language of saved views, such as
+// `status:pending priority:high due:<7d`, into terms.
+//
+// A query is a list of terms separated by spaces; a task must match every
+// term. A term is field:value, where the value may be a comma separated
+// list of alternatives and may be quoted ("in review"). A leading - negates
+// a term. Anything that isn't field:value is text searched for in titles
+// and descriptions.
+//
+//	status:pending,in_progress       status is one of the values
+//	priority:high                    priority
+//	category:Work                    category, case-insensitively
+//	tag:urgent                       tagged with the tag
+//	is:open is:done is:overdue       completion state
+//	is:recurring
+//	has:due has:estimate has:tags    the task has a value
+//	has:recurrence
+//	due:today due:tomorrow due:week  due on that day or in this week
+//	due:overdue due:none             overdue, or without a due date
+//	due:<7d due:>=2026-01-01         compared to a date or to now +/- an offset
+//	created:>-2w                     created less than two weeks ago
+//	estimate:<=90 estimate:>2h       estimate in minutes, or with an h suffix
+//	cf.points:>=3 cf.team:Backend    custom field value
+//	cf.team:none                     no value for the custom field
+//	"exact words" words              text search
+//
+// Offsets are a signed number of hours (h), days (d) or weeks (w). Dates
+// compare by whole days: due:<=2026-01-01 includes that day, due:>2026-01-01
+// starts the day after.
+package viewquery
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Term is one condition of a query
+type Term struct {
+	Field  string   // status, priority, category, tag, is, has, due, created, estimate, text or cf.<key>
+	Op     string   // =, <, <=, > or >=
+	Values []string // alternatives; a task matches the term if it matches any of them
+	Negate bool
+}
+
+// Error describes why a query couldn't be parsed
+type Error struct {
+	Pos int // byte offset of the offending term
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s (at position %d)", e.Msg, e.Pos+1)
+}
+
+const (
+	// MaxLength is the longest query accepted
+	MaxLength = 1000
+	// MaxTerms is the most terms a query may have
+	MaxTerms = 30
+)
+
+// comparable lists the fields that take <, <=, > and >=; custom fields may
+// too, depending on their type
+var comparable = map[string]bool{"due": true, "created": true, "estimate": true}
+
+var fields = map[string]bool{
+	"status": true, "priority": true, "category": true, "tag": true,
+	"is": true, "has": true, "due": true, "created": true, "estimate": true, "text": true,
+}
+
+var isValues = map[string]bool{"open": true, "done": true, "overdue": true, "recurring": true}
+
+var hasValues = map[string]bool{"due": true, "estimate": true, "tags": true, "recurrence": true}
+
+var customFieldPattern = regexp.MustCompile(`^cf\.[a-z][a-z0-9_]{0,39}$`)
+
+// Parse splits a query into terms
+func Parse(query string) ([]Term, error) {
+	if len(query) > MaxLength {
+		return nil, &Error{Pos: MaxLength, Msg: fmt.Sprintf("query is longer than %d characters", MaxLength)}
+	}
+	var terms []Term
+	s := scanner{src: query}
+	for {
+		s.skipSpace()
+		if s.done() {
+			break
+		}
+		term, err := s.term()
+		if err != nil {
+			return nil, err
+		}
+		if len(terms) == MaxTerms {
+			return nil, &Error{Pos: s.pos, Msg: fmt.Sprintf("query has more than %d terms", MaxTerms)}
+		}
+		terms = append(terms, term)
+	}
+	return terms, nil
+}
+
+// scanner walks the query one term at a time
+type scanner struct {
+	src string
+	pos int
+}
+
+func (s *scanner) done() bool {
+	return s.pos >= len(s.src)
+}
+
+func (s *scanner) skipSpace() {
+	for !s.done() && isSpace(s.src[s.pos]) {
+		s.pos++
+	}
+}
+
+func (s *scanner) term() (Term, error) {
+	start := s.pos
+	term := Term{Op: "="}
+	if s.src[s.pos] == '-' {
+		term.Negate = true
+		s.pos++
+	}
+
+	// A quoted string is always text
+	if !s.done() && s.src[s.pos] == '"' {
+		value, err := s.quoted()
+		if err != nil {
+			return term, err
+		}
+		term.Field, term.Values = "text", []string{value}
+		return term, s.endOfTerm()
+	}
+
+	// Read up to the colon of field:value, or to the end of a bare word
+	wordStart := s.pos
+	for !s.done() && !isSpace(s.src[s.pos]) && s.src[s.pos] != ':' && s.src[s.pos] != '"' {
+		s.pos++
+	}
+	word := s.src[wordStart:s.pos]
+	if s.done() || s.src[s.pos] != ':' {
+		if word == "" {
+			return term, &Error{Pos: start, Msg: "expected a term"}
+		}
+		term.Field, term.Values = "text", []string{word}
+		return term, s.endOfTerm()
+	}
+	s.pos++ // the colon
+
+	field := strings.ToLower(word)
+	if !fields[field] && !customFieldPattern.MatchString(field) {
+		return term, &Error{Pos: start, Msg: fmt.Sprintf("unknown field %q", word)}
+	}
+	term.Field = field
+
+	for _, op := range []string{"<=", ">=", "<", ">", "="} {
+		if strings.HasPrefix(s.src[s.pos:], op) {
+			term.Op = op
+			s.pos += len(op)
+			break
+		}
+	}
+	if term.Op != "=" && !comparable[field] && !strings.HasPrefix(field, "cf.") {
+		return term, &Error{Pos: start, Msg: fmt.Sprintf("%s can't be compared with %s", field, term.Op)}
+	}
+
+	for {
+		var value string
+		var err error
+		if !s.done() && s.src[s.pos] == '"' {
+			value, err = s.quoted()
+		} else {
+			valueStart := s.pos
+			for !s.done() && !isSpace(s.src[s.pos]) && s.src[s.pos] != ',' {
+				s.pos++
+			}
+			value = s.src[valueStart:s.pos]
+		}
+		if err != nil {
+			return term, err
+		}
+		if value == "" {
+			return term, &Error{Pos: start, Msg: fmt.Sprintf("missing value for %s", field)}
+		}
+		term.Values = append(term.Values, value)
+		if s.done() || s.src[s.pos] != ',' {
+			break
+		}
+		s.pos++
+	}
+	if term.Op != "=" && len(term.Values) > 1 {
+		return term, &Error{Pos: start, Msg: "a comparison takes a single value, not a list"}
+	}
+	if err := checkValues(term); err != nil {
+		err.Pos = start
+		return term, err
+	}
+	return term, s.endOfTerm()
+}
+
+// quoted reads a double quoted string; \" and \\ are escapes
+func (s *scanner) quoted() (string, error) {
+	start := s.pos
+	s.pos++
+	var b strings.Builder
+	for !s.done() {
+		c := s.src[s.pos]
+		switch {
+		case c == '"':
+			s.pos++
+			return b.String(), nil
+		case c == '\\' && s.pos+1 < len(s.src):
+			b.WriteByte(s.src[s.pos+1])
+			s.pos += 2
+		default:
+			b.WriteByte(c)
+			s.pos++
+		}
+	}
+	return "", &Error{Pos: start, Msg: "unterminated quote"}
+}
+
+func (s *scanner) endOfTerm() error {
+	if !s.done() && !isSpace(s.src[s.pos]) {
+		return &Error{Pos: s.pos, Msg: fmt.Sprintf("unexpected %q", s.src[s.pos])}
+	}
+	return nil
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t'
+}
+
+// checkValues rejects values that can never be valid for the field. Values
+// that depend on the user, such as statuses and custom fields, are checked
+// when the query runs.
+func checkValues(term Term) *Error {
+	for _, v := range term.Values {
+		lower := strings.ToLower(v)
+		switch term.Field {
+		case "is":
+			if !isValues[lower] {
+				return &Error{Msg: fmt.Sprintf("unknown is:%s; use open, done, overdue or recurring", v)}
+			}
+		case "has":
+			if !hasValues[lower] {
+				return &Error{Msg: fmt.Sprintf("unknown has:%s; use due, estimate, tags or recurrence", v)}
+			}
+		case "due", "created":
+			if term.Op == "=" && keyword(term.Field, lower) {
+				continue
+			}
+			d, ok := parseDateValue(lower)
+			if !ok {
+				return &Error{Msg: fmt.Sprintf("invalid %s date %q", term.Field, v)}
+			}
+			if term.Op == "=" && d.offset != 0 {
+				return &Error{Msg: fmt.Sprintf("%s:%s names no single day; compare with < or > instead", term.Field, v)}
+			}
+		case "estimate":
+			if lower == "none" && term.Op == "=" {
+				continue
+			}
+			if _, ok := Minutes(lower); !ok {
+				return &Error{Msg: fmt.Sprintf("invalid estimate %q; use minutes or hours such as 90 or 1.5h", v)}
+			}
+		}
+	}
+	return nil
+}
+
+// keyword reports whether v is one of the named ranges a date field accepts
+func keyword(field, v string) bool {
+	switch v {
+	case "today", "tomorrow", "yesterday", "week":
+		return true
+	case "overdue", "none":
+		return field == "due"
+	}
+	return false
+}
+
+var offsetPattern = regexp.MustCompile(`^([+-]?\d{1,4})([hdw])$`)
+
+// dateValue is a parsed calendar date or offset from now
+type dateValue struct {
+	date   time.Time // the calendar day, when isDay
+	isDay  bool
+	days   int // day and week offsets move by calendar days
+	offset time.Duration
+}
+
+func parseDateValue(v string) (dateValue, bool) {
+	if m := offsetPattern.FindStringSubmatch(v); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		switch m[2] {
+		case "h":
+			return dateValue{offset: time.Duration(n) * time.Hour}, true
+		case "d":
+			return dateValue{days: n}, true
+		default:
+			return dateValue{days: 7 * n}, true
+		}
+	}
+	d, err := time.Parse("2006-01-02", v)
+	if err != nil {
+		return dateValue{}, false
+	}
+	return dateValue{date: d, isDay: true}, true
+}
+
+// Bound is the instant a date comparison compares against
+//
+// For a calendar date, v is taken as the start of that day in loc, moved to
+// the following day for <= and > so that the whole day is included or
+// excluded. Offsets are relative to now; day and week offsets keep the
+// time of day across DST changes.
+func Bound(op, v string, now time.Time, loc *time.Location) (time.Time, bool) {
+	d, ok := parseDateValue(strings.ToLower(v))
+	if !ok {
+		return time.Time{}, false
+	}
+	if !d.isDay {
+		return now.In(loc).AddDate(0, 0, d.days).Add(d.offset), true
+	}
+	day := time.Date(d.date.Year(), d.date.Month(), d.date.Day(), 0, 0, 0, 0, loc)
+	if op == "<=" || op == ">" {
+		day = day.AddDate(0, 0, 1)
+	}
+	return day, true
+}
+
+// Day returns the calendar day [start, end) an = comparison matches: the
+// named date, or the day now +/- a day or week offset falls on. Hour offsets
+// have no day and return false.
+func Day(v string, now time.Time, loc *time.Location) (time.Time, time.Time, bool) {
+	d, ok := parseDateValue(strings.ToLower(v))
+	if !ok || (!d.isDay && d.offset != 0) {
+		return time.Time{}, time.Time{}, false
+	}
+	if !d.isDay {
+		d.date = now.In(loc).AddDate(0, 0, d.days)
+	}
+	start := time.Date(d.date.Year(), d.date.Month(), d.date.Day(), 0, 0, 0, 0, loc)
+	return start, start.AddDate(0, 0, 1), true
+}
+
+// Minutes parses an estimate of whole minutes ("90") or of hours ("1.5h")
+func Minutes(v string) (int, bool) {
+	hours := strings.HasSuffix(v, "h")
+	v = strings.TrimSuffix(strings.TrimSuffix(v, "h"), "m")
+	n, err := strconv.ParseFloat(v, 64)
+	if err != nil || n < 0 || n > 1e6 || strings.IndexFunc(v, unicode.IsLetter) >= 0 {
+		return 0, false
+	}
+	if hours {
+		n *= 60
+	}
+	return int(n + 0.5), true
+}
@@ -0,0 +1,210 @@
+package viewquery
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []Term
+	}{
+		{"", nil},
+		{"   ", nil},
+		{"status:pending,in_progress", []Term{{Field: "status", Op: "=", Values: []string{"pending", "in_progress"}}}},
+		{"Priority:high -tag:later", []Term{
+			{Field: "priority", Op: "=", Values: []string{"high"}},
+			{Field: "tag", Op: "=", Values: []string{"later"}, Negate: true},
+		}},
+		{`category:"Side Project"`, []Term{{Field: "category", Op: "=", Values: []string{"Side Project"}}}},
+		{`"exact words" loose`, []Term{
+			{Field: "text", Op: "=", Values: []string{"exact words"}},
+			{Field: "text", Op: "=", Values: []string{"loose"}},
+		}},
+		{`"say \"hi\" \\ bye"`, []Term{{Field: "text", Op: "=", Values: []string{`say "hi" \ bye`}}}},
+		{"due:<7d created:>=2026-01-01", []Term{
+			{Field: "due", Op: "<", Values: []string{"7d"}},
+			{Field: "created", Op: ">=", Values: []string{"2026-01-01"}},
+		}},
+		{"estimate:<=1.5h is:open has:due", []Term{
+			{Field: "estimate", Op: "<=", Values: []string{"1.5h"}},
+			{Field: "is", Op: "=", Values: []string{"open"}},
+			{Field: "has", Op: "=", Values: []string{"due"}},
+		}},
+		{"cf.points:>=3 cf.team:none", []Term{
+			{Field: "cf.points", Op: ">=", Values: []string{"3"}},
+			{Field: "cf.team", Op: "=", Values: []string{"none"}},
+		}},
+		{"due:=today", []Term{{Field: "due", Op: "=", Values: []string{"today"}}}},
+		{"\tdue:overdue\t", []Term{{Field: "due", Op: "=", Values: []string{"overdue"}}}},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.query)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.query, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Parse(%q) = %+v, want %+v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		query string
+		msg   string
+	}{
+		{"-", "expected a term"},
+		{"status:", "missing value for status"},
+		{"status:pending,", "missing value for status"},
+		{"bogus:1", `unknown field "bogus"`},
+		{"priority:>high", "priority can't be compared with >"},
+		{"due:<1d,2d", "a comparison takes a single value"},
+		{`"unterminated`, "unterminated quote"},
+		{`category:"Work`, "unterminated quote"},
+		{`"a"b`, `unexpected 'b'`},
+		{"is:closed", "unknown is:closed"},
+		{"has:owner", "unknown has:owner"},
+		{"due:someday", `invalid due date "someday"`},
+		{"created:overdue", `invalid created date "overdue"`},
+		{"due:2026-02-30", "invalid due date"},
+		{"due:3h", "names no single day"},
+		{"due:99999d", "invalid due date"},
+		{"estimate:-5", "invalid estimate"},
+		{"estimate:1e9", "invalid estimate"},
+		{"estimate:NaN", "invalid estimate"},
+		{"cf.:1", "unknown field"},
+		{"cf.1points:1", "unknown field"},
+		{"cf." + strings.Repeat("a", 41) + ":1", "unknown field"},
+		{strings.Repeat("x ", MaxTerms+1), "more than 30 terms"},
+		{strings.Repeat("x", MaxLength+1), "longer than 1000 characters"},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.query)
+		var parseErr *Error
+		if !errors.As(err, &parseErr) {
+			t.Errorf("Parse(%.40q) = %v, want a parse error", tt.query, err)
+			continue
+		}
+		if !strings.Contains(parseErr.Msg, tt.msg) {
+			t.Errorf("Parse(%.40q) error %q, want it to mention %q", tt.query, parseErr.Msg, tt.msg)
+		}
+	}
+}
+
+// TestParseInjection checks that SQL in a query can't reach the compiled
+// statement as anything but a value: field names are closed sets and
+// comparison operators come from a fixed list, so such input either fails
+// to parse or is kept verbatim as a value, which is passed as an argument.
+func TestParseInjection(t *testing.T) {
+	rejected := []string{
+		"status';DROP TABLE tasks;--:x",
+		"t.user_id:1",
+		"cf.x'||'y:1",
+		"cf.x)--:1",
+		`cf.a"b:1`,
+		"due:<now()",
+		"due:<7d;DELETE",
+		"estimate:<1)OR(1=1",
+		"estimate:>1)--",
+		"due:<>1d",
+		"created:=<1d",
+	}
+	for _, query := range rejected {
+		if terms, err := Parse(query); err == nil {
+			t.Errorf("Parse(%q) = %+v, want an error", query, terms)
+		}
+	}
+
+	kept := []struct {
+		query string
+		value string
+	}{
+		{`"'; DROP TABLE tasks; --"`, "'; DROP TABLE tasks; --"},
+		{"tag:x');DELETE/**/FROM/**/tasks;--", "x');DELETE/**/FROM/**/tasks;--"},
+		{`status:"pending' OR '1'='1"`, "pending' OR '1'='1"},
+		{"100%_done", "100%_done"},
+	}
+	for _, tt := range kept {
+		terms, err := Parse(tt.query)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.query, err)
+			continue
+		}
+		if len(terms) != 1 || len(terms[0].Values) != 1 || terms[0].Values[0] != tt.value {
+			t.Errorf("Parse(%q) = %+v, want the single value %q", tt.query, terms, tt.value)
+		}
+		for _, term := range terms {
+			if !fields[term.Field] && !customFieldPattern.MatchString(term.Field) {
+				t.Errorf("Parse(%q) produced field %q", tt.query, term.Field)
+			}
+		}
+	}
+}
+
+func TestBound(t *testing.T) {
+	loc := time.FixedZone("UTC+2", 2*60*60)
+	now := time.Date(2026, 3, 10, 15, 0, 0, 0, loc)
+	tests := []struct {
+		op, v string
+		want  time.Time
+	}{
+		{"<", "2026-03-01", time.Date(2026, 3, 1, 0, 0, 0, 0, loc)},
+		{"<=", "2026-03-01", time.Date(2026, 3, 2, 0, 0, 0, 0, loc)},
+		{">", "2026-03-01", time.Date(2026, 3, 2, 0, 0, 0, 0, loc)},
+		{">=", "2026-03-01", time.Date(2026, 3, 1, 0, 0, 0, 0, loc)},
+		{"<", "7d", time.Date(2026, 3, 17, 15, 0, 0, 0, loc)},
+		{">", "-2w", time.Date(2026, 2, 24, 15, 0, 0, 0, loc)},
+		{"<", "+3h", time.Date(2026, 3, 10, 18, 0, 0, 0, loc)},
+	}
+	for _, tt := range tests {
+		got, ok := Bound(tt.op, tt.v, now, loc)
+		if !ok || !got.Equal(tt.want) {
+			t.Errorf("Bound(%s, %s) = %v, %v, want %v", tt.op, tt.v, got, ok, tt.want)
+		}
+	}
+	if _, ok := Bound("<", "soon", now, loc); ok {
+		t.Error("Bound accepted an invalid date")
+	}
+}
+
+func TestDay(t *testing.T) {
+	now := time.Date(2026, 3, 10, 23, 30, 0, 0, time.UTC)
+	start, end, ok := Day("1d", now, time.UTC)
+	if !ok || !start.Equal(time.Date(2026, 3, 11, 0, 0, 0, 0, time.UTC)) || !end.Equal(time.Date(2026, 3, 12, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Day(1d) = %v, %v, %v", start, end, ok)
+	}
+	if _, _, ok := Day("5h", now, time.UTC); ok {
+		t.Error("Day accepted an hour offset")
+	}
+}
+
+func TestMinutes(t *testing.T) {
+	tests := []struct {
+		v    string
+		want int
+		ok   bool
+	}{
+		{"90", 90, true},
+		{"90m", 90, true},
+		{"1.5h", 90, true},
+		{"0", 0, true},
+		{"-1", 0, false},
+		{"", 0, false},
+		{"h", 0, false},
+		{"inf", 0, false},
+		{"0x10", 0, false},
+		{"2000000", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := Minutes(tt.v)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("Minutes(%q) = %d, %v, want %d, %v", tt.v, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+// Package webhooks delivers queued task events to user-registered endpoints.
+//
+// Events are written to the webhook_deliveries table in the same transaction
+// as the change that caused them, so a delivery is queued if and only if the
+// change is committed. A Dispatcher polls the queue, POSTs each payload and
+// retries failures with exponential backoff until the delivery succeeds or
+// runs out of attempts, at which point it is marked dead.
+//
+// Every request is signed: X-Webhook-Signature holds "sha256=" followed by
+// the hex HMAC-SHA256 of "<X-Webhook-Timestamp>.<body>" keyed with the
+// webhook's secret. Receivers should recompute it and reject stale timestamps.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// MaxAttempts is how many times a delivery is tried before it is marked dead
+	MaxAttempts = 10
+
+	baseBackoff  = 30 * time.Second
+	maxBackoff   = 6 * time.Hour
+	leaseTimeout = 5 * time.Minute
+	maxErrorLen  = 512
+)
+
+// Sign returns the X-Webhook-Signature value for a payload sent at timestamp
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Backoff returns how long to wait before the next try after the given number of failed attempts
+func Backoff(attempts int) time.Duration {
+	delay := maxBackoff
+	if attempts < 20 {
+		delay = min(baseBackoff<<(attempts-1), maxBackoff)
+	}
+	// Up to 10% jitter keeps endpoints that fail together from being retried together
+	return delay + time.Duration(rand.Int63n(int64(delay)/10+1))
+}
+
+// Dispatcher delivers pending webhook deliveries
+type Dispatcher struct {
+	db           *sql.DB
+	client       *http.Client
+	pollInterval time.Duration
+	batchSize    int
+}
+
+func NewDispatcher(db *sql.DB) *Dispatcher {
+	return &Dispatcher{
+		db: db,
+		client: &http.Client{
+			Timeout:   10 * time.Second,
+			Transport: newTransport(),
+			// A redirect is treated as a failed delivery rather than followed
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		pollInterval: 5 * time.Second,
+		batchSize:    20,
+	}
+}
+
+// Run delivers due webhooks until ctx is cancelled
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.pollInterval)
+	defer ticker.Stop()
+	for {
+		// Keep going while full batches come back, then wait for the next tick
+		for {
+			n, err := d.deliverDue(ctx)
+			if err != nil {
+				log.Printf("Error delivering webhooks: %v", err)
+				break
+			}
+			if n < d.batchSize {
+				break
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// delivery is a claimed row of the queue
+type delivery struct {
+	id       int64
+	event    string
+	payload  []byte
+	attempts int
+	url      string
+	secret   string
+}
+
+// deliverDue claims a batch of due deliveries and sends them. Claiming pushes
+// next_attempt_at forward so other dispatchers skip the rows; if this process
+// dies mid-delivery they become due again once the lease runs out.
+func (d *Dispatcher) deliverDue(ctx context.Context) (int, error) {
+	rows, err := d.db.QueryContext(ctx, `
+		UPDATE webhook_deliveries wd
+		SET next_attempt_at = CURRENT_TIMESTAMP + $2 * interval '1 second'
+		FROM webhooks w
+		WHERE w.id = wd.webhook_id AND wd.id IN (
+			SELECT q.id
+			FROM webhook_deliveries q
+			JOIN webhooks qw ON qw.id = q.webhook_id
+			WHERE q.status = 'pending' AND q.next_attempt_at <= CURRENT_TIMESTAMP AND qw.is_active
+			ORDER BY q.next_attempt_at
+			LIMIT $1
+			FOR UPDATE OF q SKIP LOCKED
+		)
+		RETURNING wd.id, wd.event, wd.payload, wd.attempts, w.url, w.secret
+	`, d.batchSize, int(leaseTimeout.Seconds()))
+	if err != nil {
+		return 0, err
+	}
+	var batch []delivery
+	for rows.Next() {
+		var dl delivery
+		if err := rows.Scan(&dl.id, &dl.event, &dl.payload, &dl.attempts, &dl.url, &dl.secret); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		batch = append(batch, dl)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, dl := range batch {
+		status, deliverErr := d.send(ctx, dl)
+		if ctx.Err() != nil {
+			// Shutting down; the lease expires and the delivery is retried later
+			return len(batch), nil
+		}
+		if err := d.record(dl, status, deliverErr); err != nil {
+			log.Printf("Error recording webhook delivery %d: %v", dl.id, err)
+		}
+	}
+	return len(batch), nil
+}
+
+// send POSTs one delivery and returns the response status
+func (d *Dispatcher) send(ctx context.Context, dl delivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, dl.url, bytes.NewReader(dl.payload))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "TaskManager-Webhooks/1.0")
+	req.Header.Set("X-Webhook-Event", dl.event)
+	req.Header.Set("X-Webhook-Delivery", strconv.FormatInt(dl.id, 10))
+	req.Header.Set("X-Webhook-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-Webhook-Signature", Sign(dl.secret, timestamp, dl.payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// The body is drained so the connection can be reused, but never kept:
+	// last_error is shown to the webhook's owner and must not echo what the
+	// endpoint said
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint returned status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// record stores the outcome of an attempt and schedules the next one if needed
+func (d *Dispatcher) record(dl delivery, status int, deliverErr error) error {
+	var responseStatus sql.NullInt64
+	if status != 0 {
+		responseStatus = sql.NullInt64{Int64: int64(status), Valid: true}
+	}
+	attempts := dl.attempts + 1
+
+	if deliverErr == nil {
+		_, err := d.db.Exec(`
+			UPDATE webhook_deliveries
+			SET status = 'delivered', attempts = $2, last_attempt_at = CURRENT_TIMESTAMP,
+				response_status = $3, last_error = '', next_attempt_at = NULL,
+				delivered_at = CURRENT_TIMESTAMP
+			WHERE id = $1
+		`, dl.id, attempts, responseStatus)
+		return err
+	}
+
+	// PostgreSQL text must be valid UTF-8 without NULs
+	message := deliverErr.Error()
+	if len(message) > maxErrorLen {
+		message = message[:maxErrorLen]
+	}
+	message = strings.ReplaceAll(strings.ToValidUTF8(message, ""), "\x00", "")
+	if attempts >= MaxAttempts {
+		log.Printf("Webhook delivery %d is dead after %d attempts: %s", dl.id, attempts, message)
+		_, err := d.db.Exec(`
+			UPDATE webhook_deliveries
+			SET status = 'dead', attempts = $2, last_attempt_at = CURRENT_TIMESTAMP,
+				response_status = $3, last_error = $4, next_attempt_at = NULL
+			WHERE id = $1
+		`, dl.id, attempts, responseStatus, message)
+		return err
+	}
+	_, err := d.db.Exec(`
+		UPDATE webhook_deliveries
+		SET attempts = $2, last_attempt_at = CURRENT_TIMESTAMP, response_status = $3,
+			last_error = $4, next_attempt_at = CURRENT_TIMESTAMP + $5 * interval '1 millisecond'
+		WHERE id = $1
+	`, dl.id, attempts, responseStatus, message, Backoff(attempts).Milliseconds())
+	return err
+}